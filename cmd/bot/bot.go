@@ -2,16 +2,23 @@ package main
 
 import (
 	"context"
+	"github.com/lynbklk/tradebot/pkg/config"
 	"github.com/lynbklk/tradebot/pkg/exchange"
 	"github.com/lynbklk/tradebot/pkg/indicator"
+	"github.com/lynbklk/tradebot/pkg/order"
+	"github.com/lynbklk/tradebot/pkg/storage"
 	"github.com/lynbklk/tradebot/pkg/strategy"
 	"github.com/natefinch/lumberjack"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"io"
 	"os"
+	"time"
 )
 
+// reconcilePeriod is the lookback of the orders imported from the exchange at startup
+const reconcilePeriod = 7 * 24 * time.Hour
+
 func main() {
 	writers := make([]io.Writer, 0)
 	writers = append(writers, zerolog.ConsoleWriter{Out: os.Stderr})
@@ -23,18 +30,43 @@ func main() {
 	log.Info().Msg("bot started.")
 
 	ctx := context.Background()
-	binance, err := exchange.NewBinance(ctx, exchange.WithBinanceCredentials("", ""))
+	binance, err := exchange.NewBinance(ctx, exchange.WithBinanceCredentials(config.C.Key, config.C.Secret))
+	if err != nil {
+		log.Fatal().Err(err).Msg("init binance failed.")
+	}
+
+	db, err := storage.FromFile("tradebot.db")
 	if err != nil {
-		log.Fatal().Msg("init binance failed.")
+		log.Fatal().Err(err).Msg("init storage failed.")
+	}
+
+	monitor := order.NewMonitor(binance)
+	controller := order.NewController(ctx, binance, db, monitor)
+	agent := indicator.NewAgent(ctx, indicator.WithExchange(binance), indicator.WithRollingWindow(1000))
+
+	runtime := strategy.NewRuntime(agent, controller, strategy.WithOrderMonitor(monitor))
+	if err := runtime.AddStrategy(strategy.NewEma45Strategy(), "BTCUSDT"); err != nil {
+		log.Fatal().Err(err).Msg("add strategy failed.")
 	}
 
-	agent := indicator.NewAgent(ctx, indicator.WithExchange(binance))
+	monitor.Start()
 
-	strategyEma45 := strategy.NewEma45Strategy(agent)
-	strategyEma45.AddIndicators("BTCUSDT", "1m")
-	strategyEma45.AddIndicators("BTCUSDT", "1h")
-	strategyEma45.AddIndicators("BTCUSDT", "1d")
-	strategyEma45.Run()
+	// the ledger is synced with the exchange before trading, the holdings from before the
+	// ledger or the fees paid in the asset are reported as differences
+	report, err := controller.Reconcile(time.Now().Add(-reconcilePeriod), "BTCUSDT")
+	if err != nil {
+		log.Fatal().Err(err).Msg("reconcile orders failed.")
+	}
+	if !report.Consistent() {
+		log.Warn().Msgf("balances differ from the ledger.\n%s", report)
+	}
+
+	controller.Start()
+	defer controller.Stop()
+
+	if err := runtime.Run(); err != nil {
+		log.Fatal().Err(err).Msg("run strategies failed.")
+	}
 }
 
 func newRollingFile(file string) io.Writer {
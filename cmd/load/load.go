@@ -20,13 +20,13 @@ func main() {
 	ctx := context.Background()
 	binance, err := exchange.NewBinance(ctx, exchange.WithBinanceCredentials("", ""))
 	if err != nil {
-		fmt.Errorf("creating exchange failed. error: %v", err)
+		fmt.Printf("creating exchange failed. error: %v\n", err)
 		return
 	}
 
 	loader := download.NewDownloader(binance)
-	if loader.Download(ctx, Pair, Timeframe, Output, download.WithDays(Days)) != nil {
-		fmt.Errorf("download failed. error: %v", err)
+	if err := loader.Download(ctx, Pair, Timeframe, Output, download.WithDays(Days)); err != nil {
+		fmt.Printf("download failed. error: %v\n", err)
 		return
 	}
 	fmt.Println("download succeed.")
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/storage"
 
 	"github.com/urfave/cli/v2"
 )
@@ -84,6 +85,48 @@ func main() {
 
 				},
 			},
+			{
+				Name:     "pairs",
+				HelpName: "pairs",
+				Usage:    "Save a snapshot of the Binance pairs metadata",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "eg. ./pairs.json or ./pairs.csv",
+						Required: true,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					registry := exchange.NewRegistry()
+					if err := registry.Refresh(c.Context); err != nil {
+						return err
+					}
+					return registry.SaveFile(c.String("output"))
+				},
+			},
+			{
+				Name:     "migrate",
+				HelpName: "migrate",
+				Usage:    "Copy a buntdb storage file into a sqlite database",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "from",
+						Aliases:  []string{"f"},
+						Usage:    "eg. ./tradebot.db",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "to",
+						Aliases:  []string{"t"},
+						Usage:    "eg. ./tradebot.sqlite",
+						Required: true,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return storage.MigrateBunt(c.String("from"), c.String("to"))
+				},
+			},
 		},
 	}
 
@@ -1,83 +1,90 @@
 package main
 
-/*
-func main() {
-	ctx := context.Background()
+import (
+	"context"
+	"fmt"
+
+	"github.com/lynbklk/tradebot/pkg/backtest"
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/indicator"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/strategy"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+type crossEMA struct {
+	strategy.Base
+}
+
+func (s crossEMA) Timeframe() string {
+	return "1h"
+}
+
+func (s crossEMA) WarmupPeriod() int {
+	return 30
+}
 
-	settings := tradebot.Settings{
-		Pairs: []string{
-			"BTCUSDT",
-			"ETHUSDT",
-		},
+func (s crossEMA) IndicatorSpecs(_ string) []indicator.Spec {
+	return []indicator.Spec{
+		indicator.EMA("ema4", 4),
+		indicator.EMA("ema24", 24),
 	}
+}
 
-	strategy := new(strategies.CrossEMA)
+func (s crossEMA) Indicators(_ *model.Dataframe) {}
 
-	csvFeed, err := exchange.NewCSVFeed(
-		strategy.Timeframe(),
-		exchange.PairFeed{
-			Pair:      "BTCUSDT",
-			File:      "testdata/btc-1h.csv",
-			Timeframe: "1h",
-		},
-		exchange.PairFeed{
-			Pair:      "ETHUSDT",
-			File:      "testdata/eth-1h.csv",
-			Timeframe: "1h",
-		},
-	)
+func (s *crossEMA) OnCandle(df *model.Dataframe, trader exchange.Trader) {
+	assetPosition, quotePosition, err := trader.Position(df.Pair)
 	if err != nil {
-		log.Fatal(err)
+		log.Error().Err(err).Msg("get position failed.")
+		return
 	}
 
-	storage, err := storage.FromMemory()
-	if err != nil {
-		log.Fatal(err)
+	if quotePosition > 10 && df.Metadata["ema4"].Crossover(df.Metadata["ema24"]) {
+		_, err := trader.CreateOrderMarketQuote(model.SideTypeBuy, df.Pair, quotePosition/2)
+		if err != nil {
+			log.Error().Err(err).Msgf("buy %s failed.", df.Pair)
+		}
+		return
 	}
 
+	if assetPosition > 0 && df.Metadata["ema4"].Crossunder(df.Metadata["ema24"]) {
+		_, err := trader.CreateOrderMarket(model.SideTypeSell, df.Pair, assetPosition)
+		if err != nil {
+			log.Error().Err(err).Msgf("sell %s failed.", df.Pair)
+		}
+	}
+}
+
+func main() {
+	ctx := context.Background()
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+
 	wallet := exchange.NewPaperWallet(
 		ctx,
 		"USDT",
 		exchange.WithPaperAsset("USDT", 10000),
-		exchange.WithDataFeed(csvFeed),
 	)
 
-	chart, err := plot.NewChart(plot.WithIndicators(
-		indicator.EMA(8, "red"),
-		indicator.SMA(21, "#000"),
-		indicator.RSI(14, "purple"),
-	), plot.WithPaperWallet(wallet))
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	bot, err := tradebot.NewBot(
+	backtester, err := backtest.NewBacktester(
 		ctx,
-		settings,
-		wallet,
-		strategy,
-		tradebot.WithBacktest(wallet),
-		tradebot.WithStorage(storage),
-		tradebot.WithCandleSubscription(chart),
-		tradebot.WithOrderSubscription(chart),
-		tradebot.WithLogLevel(log.WarnLevel),
+		backtest.WithCsvFile("BTCUSDT", "1h", "testdata/btc-1h.csv"),
+		backtest.WithCsvFile("ETHUSDT", "1h", "testdata/eth-1h.csv"),
+		backtest.WithPaperWallet(wallet),
 	)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal().Err(err).Msg("init backtester failed.")
 	}
 
-	err = bot.Run(ctx)
-	if err != nil {
-		log.Fatal(err)
+	if err := backtester.AddStrategy(new(crossEMA), "BTCUSDT", "ETHUSDT"); err != nil {
+		log.Fatal().Err(err).Msg("add strategy failed.")
 	}
 
-	// Print bot results
-	bot.Summary()
-
-	// Display candlesticks chart in browser
-	err = chart.Start()
+	results, err := backtester.Run()
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal().Err(err).Msg("backtest failed.")
 	}
+	fmt.Println(results)
+	wallet.Summary()
 }
-*/
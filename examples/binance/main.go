@@ -1,6 +1,20 @@
 package main
 
-/*
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/lynbklk/tradebot/examples/strategies"
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/indicator"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/notifier"
+	"github.com/lynbklk/tradebot/pkg/order"
+	"github.com/lynbklk/tradebot/pkg/storage"
+	"github.com/lynbklk/tradebot/pkg/strategy"
+	"github.com/rs/zerolog/log"
+)
 
 func main() {
 	var (
@@ -11,13 +25,13 @@ func main() {
 		telegramUser, _ = strconv.Atoi(os.Getenv("TELEGRAM_USER"))
 	)
 
-	settings := tradebot.Settings{
+	settings := model.Settings{
 		Pairs: []string{
 			"BTCUSDT",
 			"ETHUSDT",
 		},
-		Telegram: tradebot.TelegramSettings{
-			Enabled: true,
+		Telegram: model.TelegramSettings{
+			Enabled: telegramToken != "",
 			Token:   telegramToken,
 			Users:   []int{telegramUser},
 		},
@@ -26,19 +40,39 @@ func main() {
 	// Initialize your exchange
 	binance, err := exchange.NewBinance(ctx, exchange.WithBinanceCredentials(apiKey, secretKey))
 	if err != nil {
-		log.Fatalln(err)
+		log.Fatal().Err(err).Msg("init binance failed.")
 	}
 
-	// Initialize your strategy and bot
-	strategy := new(strategies.CrossEMA)
-	bot, err := tradebot.NewBot(ctx, settings, binance, strategy)
+	db, err := storage.FromFile("tradebot.db")
 	if err != nil {
-		log.Fatalln(err)
+		log.Fatal().Err(err).Msg("init storage failed.")
+	}
+
+	monitor := order.NewMonitor(binance)
+	controller := order.NewController(ctx, binance, db, monitor)
+
+	if settings.Telegram.Enabled {
+		telegram, err := notifier.NewTelegram(controller, settings)
+		if err != nil {
+			log.Fatal().Err(err).Msg("init telegram failed.")
+		}
+		controller.SetNotifier(telegram)
+		telegram.Start()
 	}
 
-	err = bot.Run(ctx)
+	// Initialize your strategy and runtime
+	agent := indicator.NewAgent(ctx, indicator.WithExchange(binance))
+	runtime := strategy.NewRuntime(agent, controller, strategy.WithOrderMonitor(monitor))
+	if err := runtime.AddStrategy(new(strategies.CrossEMA), settings.Pairs...); err != nil {
+		log.Fatal().Err(err).Msg("add strategy failed.")
+	}
+
+	monitor.Start()
+	controller.Start()
+	defer controller.Stop()
+
+	err = runtime.Run()
 	if err != nil {
-		log.Fatalln(err)
+		log.Fatal().Err(err).Msg("run strategies failed.")
 	}
 }
-*/
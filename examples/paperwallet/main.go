@@ -1,37 +1,34 @@
 package main
 
-/*
-func main() {
-	var (
-		ctx             = context.Background()
-		telegramToken   = os.Getenv("TELEGRAM_TOKEN")
-		telegramUser, _ = strconv.Atoi(os.Getenv("TELEGRAM_USER"))
-	)
+import (
+	"context"
 
-	settings := tradebot.Settings{
-		Pairs: []string{
-			"BTCUSDT",
-			"ETHUSDT",
-			"BNBUSDT",
-			"LTCUSDT",
-		},
-		Telegram: tradebot.TelegramSettings{
-			Enabled: true,
-			Token:   telegramToken,
-			Users:   []int{telegramUser},
-		},
+	"github.com/lynbklk/tradebot/examples/strategies"
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/indicator"
+	"github.com/lynbklk/tradebot/pkg/market"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/order"
+	"github.com/lynbklk/tradebot/pkg/plot"
+	plotindicator "github.com/lynbklk/tradebot/pkg/plot/indicator"
+	"github.com/lynbklk/tradebot/pkg/storage"
+	"github.com/lynbklk/tradebot/pkg/strategy"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	ctx := context.Background()
+	pairs := []string{
+		"BTCUSDT",
+		"ETHUSDT",
+		"BNBUSDT",
+		"LTCUSDT",
 	}
 
 	// Use binance for realtime data feed
 	binance, err := exchange.NewBinance(ctx)
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	// creating a storage to save trades
-	storage, err := storage.FromMemory()
-	if err != nil {
-		log.Fatal(err)
+		log.Fatal().Err(err).Msg("init binance failed.")
 	}
 
 	// creating a paper wallet to simulate an exchange waller for fake operataions
@@ -44,43 +41,55 @@ func main() {
 	)
 
 	// initializing my strategy
-	strategy := new(strategies.CrossEMA)
+	crossEMA := new(strategies.CrossEMA)
 
 	chart, err := plot.NewChart(
 		plot.WithIndicators(
-			indicator.EMA(8, "red"),
-			indicator.SMA(21, "blue"),
+			plotindicator.EMA(8, "red"),
+			plotindicator.SMA(21, "blue"),
 		),
+		plot.WithPaperWallet(paperWallet),
 	)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal().Err(err).Msg("init chart failed.")
 	}
 
-	// initializer tradebot
-	bot, err := tradebot.NewBot(
-		ctx,
-		settings,
-		paperWallet,
-		strategy,
-		tradebot.WithStorage(storage),
-		tradebot.WithPaperWallet(paperWallet),
-		tradebot.WithCandleSubscription(chart),
-		tradebot.WithOrderSubscription(chart),
-	)
+	// the paper wallet is wired as the production exchange, it fills orders with the live candles
+	db, err := storage.FromMemory()
 	if err != nil {
-		log.Fatalln(err)
+		log.Fatal().Err(err).Msg("init storage failed.")
+	}
+
+	monitor := order.NewMonitor(paperWallet)
+	controller := order.NewController(ctx, paperWallet, db, monitor)
+	agent := indicator.NewAgent(ctx, indicator.WithExchange(paperWallet))
+
+	for _, pair := range pairs {
+		agent.Watcher.RegistNotifier(market.NewFuncNotifier(pair, crossEMA.Timeframe(), false,
+			func(candle *model.Candle, _ bool) {
+				chart.OnCandle(*candle)
+			}))
 	}
+	paperWallet.SubscribeOrder(chart.OnOrder)
+
+	runtime := strategy.NewRuntime(agent, controller, strategy.WithOrderMonitor(monitor))
+	if err := runtime.AddStrategy(crossEMA, pairs...); err != nil {
+		log.Fatal().Err(err).Msg("add strategy failed.")
+	}
+
+	monitor.Start()
+	controller.Start()
+	defer controller.Stop()
 
 	go func() {
 		err := chart.Start()
 		if err != nil {
-			log.Fatal(err)
+			log.Fatal().Err(err).Msg("start chart failed.")
 		}
 	}()
 
-	err = bot.Run(ctx)
+	err = runtime.Run()
 	if err != nil {
-		log.Fatalln(err)
+		log.Fatal().Err(err).Msg("run strategies failed.")
 	}
 }
-*/
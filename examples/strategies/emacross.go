@@ -1,8 +1,16 @@
 package strategies
 
-/*
+import (
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/indicator"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/strategy"
+	"github.com/rs/zerolog/log"
+)
 
-type CrossEMA struct{}
+type CrossEMA struct {
+	strategy.Base
+}
 
 func (e CrossEMA) Timeframe() string {
 	return "4h"
@@ -12,47 +20,50 @@ func (e CrossEMA) WarmupPeriod() int {
 	return 21
 }
 
-func (e CrossEMA) Indicators(df *tradebot.Dataframe) {
-	df.Metadata["ema8"] = talib.Ema(df.Close, 8)
-	df.Metadata["sma21"] = talib.Sma(df.Close, 21)
+func (e CrossEMA) IndicatorSpecs(_ string) []indicator.Spec {
+	return []indicator.Spec{
+		indicator.EMA("ema8", 8),
+		indicator.SMA("sma21", 21),
+	}
 }
 
-func (e *CrossEMA) OnCandle(df *tradebot.Dataframe, broker service.Broker) {
+func (e CrossEMA) Indicators(_ *model.Dataframe) {}
+
+func (e *CrossEMA) OnCandle(df *model.Dataframe, trader exchange.Trader) {
 	closePrice := df.Close.Last(0)
 
-	assetPosition, quotePosition, err := broker.Position(df.Pair)
+	assetPosition, quotePosition, err := trader.Position(df.Pair)
 	if err != nil {
-		log.Error(err)
+		log.Error().Err(err).Msg("get position failed.")
 		return
 	}
 
 	if quotePosition > 10 && df.Metadata["ema8"].Crossover(df.Metadata["sma21"]) {
-		_, err := broker.CreateOrderMarketQuote(tradebot.SideTypeBuy, df.Pair, quotePosition)
+		_, err := trader.CreateOrderMarketQuote(model.SideTypeBuy, df.Pair, quotePosition)
 		if err != nil {
-			log.WithFields(map[string]interface{}{
-				"pair":  df.Pair,
-				"side":  tradebot.SideTypeBuy,
-				"close": closePrice,
-				"asset": assetPosition,
-				"quote": quotePosition,
-			}).Error(err)
+			log.Error().Err(err).
+				Str("pair", df.Pair).
+				Str("side", string(model.SideTypeBuy)).
+				Float64("close", closePrice).
+				Float64("asset", assetPosition).
+				Float64("quote", quotePosition).
+				Msg("create order failed.")
 		}
 		return
 	}
 
 	if assetPosition > 0 &&
 		df.Metadata["ema8"].Crossunder(df.Metadata["sma21"]) {
-		_, err := broker.CreateOrderMarket(tradebot.SideTypeSell, df.Pair, assetPosition)
+		_, err := trader.CreateOrderMarket(model.SideTypeSell, df.Pair, assetPosition)
 		if err != nil {
-			log.WithFields(map[string]interface{}{
-				"pair":  df.Pair,
-				"side":  tradebot.SideTypeSell,
-				"close": closePrice,
-				"asset": assetPosition,
-				"quote": quotePosition,
-				"size":  assetPosition,
-			}).Error(err)
+			log.Error().Err(err).
+				Str("pair", df.Pair).
+				Str("side", string(model.SideTypeSell)).
+				Float64("close", closePrice).
+				Float64("asset", assetPosition).
+				Float64("quote", quotePosition).
+				Float64("size", assetPosition).
+				Msg("create order failed.")
 		}
 	}
 }
-*/
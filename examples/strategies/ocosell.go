@@ -1,7 +1,16 @@
 package strategies
 
-/*
-type OCOSell struct{}
+import (
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/strategy"
+	"github.com/markcheno/go-talib"
+	"github.com/rs/zerolog/log"
+)
+
+type OCOSell struct {
+	strategy.Base
+}
 
 func (e OCOSell) Timeframe() string {
 	return "1d"
@@ -24,42 +33,41 @@ func (e OCOSell) Indicators(df *model.Dataframe) {
 	)
 }
 
-func (e *OCOSell) OnCandle(df *model.Dataframe, broker service.Broker) {
+func (e *OCOSell) OnCandle(df *model.Dataframe, trader exchange.Trader) {
 	closePrice := df.Close.Last(0)
-	log.Info("New Candle = ", df.Pair, df.LastUpdate, closePrice)
+	log.Info().Msgf("New Candle = %s %s %f", df.Pair, df.LastUpdate, closePrice)
 
-	assetPosition, quotePosition, err := broker.Position(df.Pair)
+	assetPosition, quotePosition, err := trader.Position(df.Pair)
 	if err != nil {
-		log.Error(err)
+		log.Error().Err(err).Msg("get position failed.")
 		return
 	}
 
 	buyAmount := 4000.0
 	if quotePosition > buyAmount && df.Metadata["stoch"].Crossover(df.Metadata["stoch_signal"]) {
 		size := buyAmount / closePrice
-		_, err := broker.CreateOrderMarket(model.SideTypeBuy, df.Pair, size)
+		_, err := trader.CreateOrderMarket(model.SideTypeBuy, df.Pair, size)
 		if err != nil {
-			log.WithFields(map[string]interface{}{
-				"pair":  df.Pair,
-				"side":  model.SideTypeBuy,
-				"close": closePrice,
-				"asset": assetPosition,
-				"quote": quotePosition,
-				"size":  size,
-			}).Error(err)
+			log.Error().Err(err).
+				Str("pair", df.Pair).
+				Str("side", string(model.SideTypeBuy)).
+				Float64("close", closePrice).
+				Float64("asset", assetPosition).
+				Float64("quote", quotePosition).
+				Float64("size", size).
+				Msg("create order failed.")
 		}
 
-		_, err = broker.CreateOrderOCO(model.SideTypeSell, df.Pair, size, closePrice*1.1, closePrice*0.95, closePrice*0.95)
+		_, err = trader.CreateOrderOCO(model.SideTypeSell, df.Pair, size, closePrice*1.1, closePrice*0.95, closePrice*0.95)
 		if err != nil {
-			log.WithFields(map[string]interface{}{
-				"pair":  df.Pair,
-				"side":  model.SideTypeBuy,
-				"close": closePrice,
-				"asset": assetPosition,
-				"quote": quotePosition,
-				"size":  size,
-			}).Error(err)
+			log.Error().Err(err).
+				Str("pair", df.Pair).
+				Str("side", string(model.SideTypeSell)).
+				Float64("close", closePrice).
+				Float64("asset", assetPosition).
+				Float64("quote", quotePosition).
+				Float64("size", size).
+				Msg("create oco order failed.")
 		}
 	}
 }
-*/
@@ -1,8 +1,21 @@
 package strategies
 
-/*
+import (
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/risk"
+	"github.com/lynbklk/tradebot/pkg/strategy"
+	"github.com/markcheno/go-talib"
+	"github.com/rs/zerolog/log"
+)
+
 // https://www.investopedia.com/articles/trading/08/turtle-trading.asp
-type Turtle struct{}
+type Turtle struct {
+	strategy.Base
+
+	// Sizer sizes the entries, half of the equity by default
+	Sizer risk.Sizer
+}
 
 func (e Turtle) Timeframe() string {
 	return "4h"
@@ -12,49 +25,59 @@ func (e Turtle) WarmupPeriod() int {
 	return 40
 }
 
-func (e Turtle) Indicators(df *tradebot.Dataframe) {
+func (e Turtle) Indicators(df *model.Dataframe) {
 	df.Metadata["turtleHighest"] = talib.Max(df.Close, 40)
 	df.Metadata["turtleLowest"] = talib.Min(df.Close, 20)
 }
 
-func (e *Turtle) OnCandle(df *tradebot.Dataframe, broker service.Broker) {
+func (e *Turtle) OnCandle(df *model.Dataframe, trader exchange.Trader) {
 	closePrice := df.Close.Last(0)
 	highest := df.Metadata["turtleHighest"].Last(0)
 	lowest := df.Metadata["turtleLowest"].Last(0)
 
-	assetPosition, quotePosition, err := broker.Position(df.Pair)
+	assetPosition, quotePosition, err := trader.Position(df.Pair)
 	if err != nil {
-		log.Error(err)
+		log.Error().Err(err).Msg("get position failed.")
 		return
 	}
 
 	// If position already open wait till it will be closed
 	if assetPosition == 0 && closePrice >= highest {
-		_, err := broker.CreateOrderMarketQuote(tradebot.SideTypeBuy, df.Pair, quotePosition/2)
+		sizer := e.Sizer
+		if sizer == nil {
+			sizer = risk.FixedFractional{Fraction: 0.5}
+		}
+		size, err := sizer.Size(trader, df.Pair, risk.Entry{Price: closePrice})
+		if err != nil {
+			log.Error().Err(err).Str("pair", df.Pair).Msg("size order failed.")
+			return
+		}
+
+		_, err = trader.CreateOrderMarket(model.SideTypeBuy, df.Pair, size)
 		if err != nil {
-			log.WithFields(map[string]interface{}{
-				"pair":  df.Pair,
-				"side":  tradebot.SideTypeBuy,
-				"close": closePrice,
-				"asset": assetPosition,
-				"quote": quotePosition,
-			}).Error(err)
+			log.Error().Err(err).
+				Str("pair", df.Pair).
+				Str("side", string(model.SideTypeBuy)).
+				Float64("close", closePrice).
+				Float64("asset", assetPosition).
+				Float64("quote", quotePosition).
+				Float64("size", size).
+				Msg("create order failed.")
 		}
 		return
 	}
 
 	if assetPosition > 0 && closePrice <= lowest {
-		_, err := broker.CreateOrderMarket(tradebot.SideTypeSell, df.Pair, assetPosition)
+		_, err := trader.CreateOrderMarket(model.SideTypeSell, df.Pair, assetPosition)
 		if err != nil {
-			log.WithFields(map[string]interface{}{
-				"pair":  df.Pair,
-				"side":  tradebot.SideTypeSell,
-				"close": closePrice,
-				"asset": assetPosition,
-				"quote": quotePosition,
-				"size":  assetPosition,
-			}).Error(err)
+			log.Error().Err(err).
+				Str("pair", df.Pair).
+				Str("side", string(model.SideTypeSell)).
+				Float64("close", closePrice).
+				Float64("asset", assetPosition).
+				Float64("quote", quotePosition).
+				Float64("size", assetPosition).
+				Msg("create order failed.")
 		}
 	}
 }
-*/
@@ -0,0 +1,176 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/indicator"
+	"github.com/lynbklk/tradebot/pkg/market"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/strategy"
+	"github.com/lynbklk/tradebot/pkg/util"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrNoData   = errors.New("backtest: no csv file registered")
+	ErrNoWallet = errors.New("backtest: paper wallet is required")
+)
+
+type Backtester struct {
+	ctx     context.Context
+	files   map[string]string
+	wallet  *exchange.PaperWallet
+	agent   *indicator.Agent
+	runtime *strategy.Runtime
+	// handlers see the candles after the wallet, eg: an order executor
+	handlers []func(model.Candle)
+	candles  int
+	start    time.Time
+	end      time.Time
+}
+
+type Option func(*Backtester)
+
+// WithCsvFile registers a csv file with the candles of a pair in the given timeframe
+func WithCsvFile(pair, timeframe, file string) Option {
+	return func(b *Backtester) {
+		b.files[util.PairTimeframeToKey(pair, timeframe)] = file
+	}
+}
+
+// WithPaperWallet sets the wallet used to execute the orders of the backtest
+func WithPaperWallet(wallet *exchange.PaperWallet) Option {
+	return func(b *Backtester) {
+		b.wallet = wallet
+	}
+}
+
+// WithCandleHandler calls the handler with each candle used to simulate fills, after the
+// wallet and before the strategies
+func WithCandleHandler(handler func(model.Candle)) Option {
+	return func(b *Backtester) {
+		b.handlers = append(b.handlers, handler)
+	}
+}
+
+func NewBacktester(ctx context.Context, options ...Option) (*Backtester, error) {
+	backtester := &Backtester{
+		ctx:   ctx,
+		files: make(map[string]string),
+	}
+	for _, option := range options {
+		option(backtester)
+	}
+
+	if len(backtester.files) == 0 {
+		return nil, ErrNoData
+	}
+	if backtester.wallet == nil {
+		return nil, ErrNoWallet
+	}
+
+	timeframes, err := finestTimeframes(backtester.files)
+	if err != nil {
+		return nil, err
+	}
+
+	// the wallet is registered before any indicator, so pending orders are
+	// filled before strategies see the candle
+	watcher := market.NewCsvWatcher(backtester.files)
+	for pair, timeframe := range timeframes {
+		watcher.RegistNotifier(market.NewFuncNotifier(pair, timeframe, true, backtester.onCandle))
+	}
+	backtester.agent = indicator.NewAgent(ctx, indicator.WithWatcher(watcher))
+	backtester.runtime = strategy.NewRuntime(backtester.agent, backtester.wallet)
+	backtester.wallet.SubscribeOrder(backtester.runtime.OnOrder)
+
+	return backtester, nil
+}
+
+// finestTimeframes returns the smallest timeframe of each pair, the one used to simulate fills
+func finestTimeframes(files map[string]string) (map[string]string, error) {
+	timeframes := make(map[string]string)
+	durations := make(map[string]time.Duration)
+	for key := range files {
+		pair, timeframe := util.PairTimeframeFromKey(key)
+		duration, err := util.TimeframeDuration(timeframe)
+		if err != nil {
+			return nil, err
+		}
+		if current, ok := durations[pair]; !ok || duration < current {
+			durations[pair] = duration
+			timeframes[pair] = timeframe
+		}
+	}
+	return timeframes, nil
+}
+
+func (b *Backtester) onCandle(candle *model.Candle, _ bool) {
+	if b.candles == 0 {
+		b.start = candle.Time
+	}
+	b.candles++
+	b.end = candle.Time
+	b.wallet.OnCandle(*candle)
+	for _, handler := range b.handlers {
+		handler(*candle)
+	}
+}
+
+// Agent returns the indicator agent fed by the csv files
+func (b *Backtester) Agent() *indicator.Agent {
+	return b.agent
+}
+
+// AddStrategy runs the strategy for the given pairs, using the paper wallet as trader
+func (b *Backtester) AddStrategy(strategy strategy.Strategy, pairs ...string) error {
+	return b.runtime.AddStrategy(strategy, pairs...)
+}
+
+func (b *Backtester) Wallet() *exchange.PaperWallet {
+	return b.wallet
+}
+
+// Run replays all candles in chronological order and returns the results of the simulation
+func (b *Backtester) Run() (*Results, error) {
+	log.Info().Msg("[SETUP] Starting backtesting")
+	if err := b.runtime.Run(); err != nil {
+		return nil, err
+	}
+	return b.results(), nil
+}
+
+func (b *Backtester) results() *Results {
+	maxDrawdown, drawdownStart, drawdownEnd := b.wallet.MaxDrawdown()
+	equity := b.wallet.EquityValues()
+
+	finalValue := b.wallet.InitialValue()
+	if len(equity) > 0 {
+		finalValue = equity[len(equity)-1].Value
+	}
+
+	return &Results{
+		Start:         b.start,
+		End:           b.end,
+		Candles:       b.candles,
+		BaseCoin:      b.wallet.BaseCoin(),
+		FillModel:     b.wallet.FillModel().Name(),
+		Slippage:      b.wallet.SlippageModel().Name(),
+		Latency:       b.wallet.Latency().String(),
+		Liquidity:     b.wallet.Liquidity(),
+		InitialValue:  b.wallet.InitialValue(),
+		FinalValue:    finalValue,
+		MarketChange:  b.wallet.MarketChange(),
+		MaxDrawdown:   maxDrawdown,
+		DrawdownStart: drawdownStart,
+		DrawdownEnd:   drawdownEnd,
+		Volume:        b.wallet.Volume(),
+		Fees:          b.wallet.Fees(),
+		Funding:       b.wallet.FundingPnL(),
+		Orders:        b.wallet.Orders(),
+		Equity:        equity,
+	}
+}
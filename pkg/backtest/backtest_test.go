@@ -0,0 +1,186 @@
+package backtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/indicator"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/strategy"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStrategy struct {
+	strategy.Base
+	started  map[string]bool
+	stopped  map[string]bool
+	candles  map[string]int
+	lastTime map[string]int64
+}
+
+func newFakeStrategy() *fakeStrategy {
+	return &fakeStrategy{
+		started:  make(map[string]bool),
+		stopped:  make(map[string]bool),
+		candles:  make(map[string]int),
+		lastTime: make(map[string]int64),
+	}
+}
+
+func (s *fakeStrategy) Timeframe() string {
+	return "1h"
+}
+
+func (s *fakeStrategy) WarmupPeriod() int {
+	return 50
+}
+
+func (s *fakeStrategy) IndicatorSpecs(_ string) []indicator.Spec {
+	return []indicator.Spec{
+		indicator.EMA("ema9", 9),
+		indicator.MACD("macd", 12, 26, 9),
+	}
+}
+
+func (s *fakeStrategy) Indicators(_ *model.Dataframe) {}
+
+func (s *fakeStrategy) OnStart(pair string, _ exchange.Trader) error {
+	s.started[pair] = true
+	return nil
+}
+
+func (s *fakeStrategy) OnCandle(df *model.Dataframe, _ exchange.Trader) {
+	last := df.Time[len(df.Time)-1].Unix()
+	if last < s.lastTime[df.Pair] {
+		panic("candles out of order")
+	}
+	s.lastTime[df.Pair] = last
+	if len(df.Metadata["ema9"]) != len(df.Close) || len(df.Metadata["macd_signal"]) != len(df.Close) {
+		panic("missing indicators")
+	}
+	s.candles[df.Pair]++
+}
+
+func (s *fakeStrategy) OnStop(pair string, _ exchange.Trader) {
+	s.stopped[pair] = true
+}
+
+type multiTimeframeStrategy struct {
+	fakeStrategy
+	checked int
+	err     string
+}
+
+func (s *multiTimeframeStrategy) Timeframes() []string {
+	return []string{"1d"}
+}
+
+func (s *multiTimeframeStrategy) OnCandle(df *model.Dataframe, _ exchange.Trader) {
+	closeTime := df.Time[len(df.Time)-1].Add(time.Hour)
+	daily := df.Timeframes["1d"]
+	if daily == nil {
+		s.err = "missing daily dataframe"
+		return
+	}
+	if len(daily.Time) == 0 {
+		return
+	}
+
+	lastDaily := daily.Time[len(daily.Time)-1]
+	if lastDaily.Add(24 * time.Hour).After(closeTime) {
+		s.err = "look-ahead daily candle " + lastDaily.String() + " at " + closeTime.String()
+	}
+	// the daily candle is notified after the last hourly candle of the day, it is available
+	// from the next hourly candle
+	if closeTime.Sub(lastDaily) > 48*time.Hour && closeTime.Before(time.Unix(1620604800, 0)) {
+		s.err = "missing daily candle at " + closeTime.String()
+	}
+	s.checked++
+}
+
+func TestBacktester(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("missing data", func(t *testing.T) {
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		_, err := NewBacktester(ctx, WithPaperWallet(wallet))
+		require.ErrorIs(t, err, ErrNoData)
+	})
+
+	t.Run("missing wallet", func(t *testing.T) {
+		_, err := NewBacktester(ctx, WithCsvFile("BTCUSDT", "1h", "../../testdata/btc-1h.csv"))
+		require.ErrorIs(t, err, ErrNoWallet)
+	})
+
+	t.Run("replay candles", func(t *testing.T) {
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		backtester, err := NewBacktester(ctx,
+			WithCsvFile("BTCUSDT", "1h", "../../testdata/btc-1h.csv"),
+			WithCsvFile("ETHUSDT", "1h", "../../testdata/eth-1h.csv"),
+			WithPaperWallet(wallet),
+		)
+		require.NoError(t, err)
+
+		fake := newFakeStrategy()
+		require.NoError(t, backtester.AddStrategy(fake, "BTCUSDT", "ETHUSDT"))
+
+		results, err := backtester.Run()
+		require.NoError(t, err)
+		require.Equal(t, 4314*2, results.Candles)
+		require.True(t, fake.started["BTCUSDT"])
+		require.True(t, fake.stopped["ETHUSDT"])
+		// duplicated rows in the csv files update the last candle, so they are not counted on warmup
+		require.Greater(t, fake.candles["BTCUSDT"], 4314-50-10)
+		require.Greater(t, fake.candles["ETHUSDT"], 4314-50-10)
+		require.Equal(t, int64(1605571200), results.Start.Unix())
+		require.Equal(t, 10000.0, results.InitialValue)
+		require.Equal(t, 10000.0, results.FinalValue)
+		require.Empty(t, results.Orders)
+		require.NotEmpty(t, results.String())
+	})
+
+	t.Run("multi timeframe", func(t *testing.T) {
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		backtester, err := NewBacktester(ctx,
+			WithCsvFile("BTCUSDT", "1h", "../../testdata/btc-1h.csv"),
+			WithCsvFile("BTCUSDT", "1d", "../../testdata/btc-1d.csv"),
+			WithPaperWallet(wallet),
+		)
+		require.NoError(t, err)
+
+		multi := &multiTimeframeStrategy{fakeStrategy: *newFakeStrategy()}
+		require.NoError(t, backtester.AddStrategy(multi, "BTCUSDT"))
+
+		results, err := backtester.Run()
+		require.NoError(t, err)
+		require.Empty(t, multi.err)
+		require.Greater(t, multi.checked, 13*24)
+		// daily candles are only used as informative timeframe
+		require.Equal(t, 4314, results.Candles)
+	})
+
+	t.Run("conflicting indicators", func(t *testing.T) {
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		backtester, err := NewBacktester(ctx,
+			WithCsvFile("BTCUSDT", "1h", "../../testdata/btc-1h.csv"),
+			WithPaperWallet(wallet),
+		)
+		require.NoError(t, err)
+
+		require.NoError(t, backtester.AddStrategy(newFakeStrategy(), "BTCUSDT"))
+		err = backtester.AddStrategy(&conflictStrategy{fakeStrategy: *newFakeStrategy()}, "BTCUSDT")
+		var specErr *indicator.SpecError
+		require.ErrorAs(t, err, &specErr)
+		require.Equal(t, "ema9", specErr.Key)
+	})
+}
+
+type conflictStrategy struct {
+	fakeStrategy
+}
+
+func (s *conflictStrategy) IndicatorSpecs(_ string) []indicator.Spec {
+	return []indicator.Spec{indicator.SMA("ema9", 9)}
+}
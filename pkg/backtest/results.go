@@ -0,0 +1,123 @@
+package backtest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/olekukonko/tablewriter"
+)
+
+type Results struct {
+	Start         time.Time
+	End           time.Time
+	Candles       int
+	BaseCoin      string
+	FillModel     string
+	Slippage      string
+	Latency       string
+	Liquidity     float64
+	InitialValue  float64
+	FinalValue    float64
+	MarketChange  float64
+	MaxDrawdown   float64
+	DrawdownStart time.Time
+	DrawdownEnd   time.Time
+	Volume        map[string]float64
+	Fees          map[string]float64
+	Funding       map[string]float64
+	Orders        []model.Order
+	Equity        []exchange.AssetValue
+}
+
+func (r Results) Profit() float64 {
+	return r.FinalValue - r.InitialValue
+}
+
+func (r Results) ProfitPercentage() float64 {
+	if r.InitialValue == 0 {
+		return 0
+	}
+	return r.Profit() / r.InitialValue * 100
+}
+
+func (r Results) TotalVolume() float64 {
+	var total float64
+	for _, volume := range r.Volume {
+		total += volume
+	}
+	return total
+}
+
+func (r Results) FilledOrders() int {
+	var count int
+	for _, order := range r.Orders {
+		if order.Status == model.OrderStatusTypeFilled {
+			count++
+		}
+	}
+	return count
+}
+
+func liquidity(fraction float64) string {
+	if fraction <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%.2f %% of volume", fraction*100)
+}
+
+func (r Results) String() string {
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	data := [][]string{
+		{"Period", fmt.Sprintf("%s - %s", r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339))},
+		{"Candles", strconv.Itoa(r.Candles)},
+		{"Fill Model", r.FillModel},
+		{"Slippage", r.Slippage},
+		{"Latency", r.Latency},
+		{"Liquidity", liquidity(r.Liquidity)},
+		{"Orders", fmt.Sprintf("%d (%d filled)", len(r.Orders), r.FilledOrders())},
+		{"Start Portfolio", fmt.Sprintf("%.2f %s", r.InitialValue, r.BaseCoin)},
+		{"Final Portfolio", fmt.Sprintf("%.2f %s", r.FinalValue, r.BaseCoin)},
+		{"Profit", fmt.Sprintf("%.4f %s (%.2f %%)", r.Profit(), r.BaseCoin, r.ProfitPercentage())},
+		{"Market Change (B&H)", fmt.Sprintf("%.2f %%", r.MarketChange*100)},
+		{"Max Drawdown", fmt.Sprintf("%.2f %%", r.MaxDrawdown*100)},
+	}
+
+	pairs := make([]string, 0, len(r.Volume))
+	for pair := range r.Volume {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	for _, pair := range pairs {
+		data = append(data, []string{"Volume " + pair, fmt.Sprintf("%.2f %s", r.Volume[pair], r.BaseCoin)})
+	}
+	data = append(data, []string{"Volume", fmt.Sprintf("%.2f %s", r.TotalVolume(), r.BaseCoin)})
+
+	assets := make([]string, 0, len(r.Fees))
+	for asset := range r.Fees {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+	for _, asset := range assets {
+		data = append(data, []string{"Fees " + asset, fmt.Sprintf("%.4f %s", r.Fees[asset], asset)})
+	}
+
+	assets = make([]string, 0, len(r.Funding))
+	for asset := range r.Funding {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+	for _, asset := range assets {
+		data = append(data, []string{"Funding PnL " + asset, fmt.Sprintf("%.4f %s", r.Funding[asset], asset)})
+	}
+
+	table.AppendBulk(data)
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT})
+	table.Render()
+	return tableString.String()
+}
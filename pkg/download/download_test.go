@@ -68,7 +68,7 @@ func TestDownloader_download(t *testing.T) {
 		"1d",
 		exchange.PairFeed{
 			Pair:      "BTCUSDT",
-			File:      "../testdata/btc-1d.csv",
+			File:      "../../testdata/btc-1d.csv",
 			Timeframe: "1d",
 		})
 
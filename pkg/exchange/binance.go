@@ -2,12 +2,17 @@ package exchange
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/gorilla/websocket"
 	"github.com/jpillora/backoff"
 	"github.com/lynbklk/tradebot/pkg/model"
 	"github.com/rs/zerolog/log"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,8 +24,23 @@ type Binance struct {
 	HeikinAshi bool
 	APIKey     string
 	APISecret  string
+	baseURL    string
+	streamURL  string
+
+	// client order ids of the next order, see WithClientOrderID
+	clientOrderIDs []string
 }
 
+// binance api errors of the requests sent without knowing their execution status
+const (
+	errCodeUnknown            = -1000
+	errCodeDisconnected       = -1001
+	errCodeUnexpectedResponse = -1006
+	errCodeTimeout            = -1007
+)
+
+const errCodeOrderNotFound = -2013
+
 type BinanceOption func(*Binance)
 
 func WithBinanceCredentials(key, secret string) BinanceOption {
@@ -36,6 +56,15 @@ func WithBinanceHeikinAshiCandle() BinanceOption {
 	}
 }
 
+// WithBinanceBaseURL points the client to another server, eg: a fake for tests.
+// Kline streams are served by the same host under /ws.
+func WithBinanceBaseURL(baseURL string) BinanceOption {
+	return func(b *Binance) {
+		b.baseURL = strings.TrimSuffix(baseURL, "/")
+		b.streamURL = strings.Replace(b.baseURL, "http", "ws", 1) + "/ws"
+	}
+}
+
 func NewBinance(ctx context.Context, options ...BinanceOption) (Exchange, error) {
 	binance.WebsocketKeepalive = true
 	exchange := &Binance{ctx: ctx}
@@ -44,6 +73,9 @@ func NewBinance(ctx context.Context, options ...BinanceOption) (Exchange, error)
 	}
 
 	exchange.client = binance.NewClient(exchange.APIKey, exchange.APISecret)
+	if exchange.baseURL != "" {
+		exchange.client.BaseURL = exchange.baseURL
+	}
 	err := exchange.client.NewPingService().Do(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("binance ping fail: %w", err)
@@ -69,41 +101,67 @@ func NewBinance(ctx context.Context, options ...BinanceOption) (Exchange, error)
 	}
 
 	// Initialize with orders precision and assets limits
-	exchange.assetsInfo = make(map[string]model.AssetInfo)
-	for _, info := range results.Symbols {
-		tradeLimits := model.AssetInfo{
+	exchange.assetsInfo = parseExchangeInfo(results)
+	DefaultRegistry.addAll(exchange.assetsInfo)
+
+	log.Info().Msg("Using Binance Exchange")
+
+	return exchange, nil
+}
+
+func parseExchangeInfo(info *binance.ExchangeInfo) map[string]model.AssetInfo {
+	assetsInfo := make(map[string]model.AssetInfo)
+	for _, info := range info.Symbols {
+		assetsInfo[info.Symbol] = parseFilters(model.AssetInfo{
 			BaseAsset:  info.BaseAsset,
 			QuoteAsset: info.QuoteAsset,
-		}
-		for _, filter := range info.Filters {
-			if typ, ok := filter["filterType"]; ok {
-				if typ == string(binance.SymbolFilterTypeLotSize) {
-					tradeLimits.MinQuantity, _ = strconv.ParseFloat(filter["minQty"].(string), 64)
-					tradeLimits.MaxQuantity, _ = strconv.ParseFloat(filter["maxQty"].(string), 64)
-					tradeLimits.StepSize, _ = strconv.ParseFloat(filter["stepSize"].(string), 64)
-					tradeLimits.QtyDecimalPrecision = model.NumDecPlaces(tradeLimits.StepSize)
-				}
+		}, info.Filters)
+	}
+	return assetsInfo
+}
+
+// parseFilters reads the quantity and price limits of a symbol, shared by the spot and futures markets
+func parseFilters(tradeLimits model.AssetInfo, filters []map[string]interface{}) model.AssetInfo {
+	for _, filter := range filters {
+		if typ, ok := filter["filterType"]; ok {
+			if typ == string(binance.SymbolFilterTypeLotSize) {
+				tradeLimits.MinQuantity, _ = strconv.ParseFloat(filter["minQty"].(string), 64)
+				tradeLimits.MaxQuantity, _ = strconv.ParseFloat(filter["maxQty"].(string), 64)
+				tradeLimits.StepSize, _ = strconv.ParseFloat(filter["stepSize"].(string), 64)
+				tradeLimits.QtyDecimalPrecision = model.NumDecPlaces(tradeLimits.StepSize)
+			}
+
+			if typ == string(binance.SymbolFilterTypePriceFilter) {
+				tradeLimits.MinPrice, _ = strconv.ParseFloat(filter["minPrice"].(string), 64)
+				tradeLimits.MaxPrice, _ = strconv.ParseFloat(filter["maxPrice"].(string), 64)
+				tradeLimits.TickSize, _ = strconv.ParseFloat(filter["tickSize"].(string), 64)
+				tradeLimits.PriceDecimalPrecision = model.NumDecPlaces(tradeLimits.TickSize)
+			}
 
-				if typ == string(binance.SymbolFilterTypePriceFilter) {
-					tradeLimits.MinPrice, _ = strconv.ParseFloat(filter["minPrice"].(string), 64)
-					tradeLimits.MaxPrice, _ = strconv.ParseFloat(filter["maxPrice"].(string), 64)
-					tradeLimits.TickSize, _ = strconv.ParseFloat(filter["tickSize"].(string), 64)
-					tradeLimits.PriceDecimalPrecision = model.NumDecPlaces(tradeLimits.TickSize)
+			if typ == string(binance.SymbolFilterTypeMinNotional) {
+				// the spot filter has minNotional and the futures one notional
+				notional, ok := filter["minNotional"]
+				if !ok {
+					notional = filter["notional"]
+				}
+				if value, ok := notional.(string); ok {
+					tradeLimits.MinNotional, _ = strconv.ParseFloat(value, 64)
 				}
 			}
 		}
-		exchange.assetsInfo[info.Symbol] = tradeLimits
 	}
-
-	log.Info().Msg("Using Binance Exchange")
-
-	return exchange, nil
+	return tradeLimits
 }
 
 func (b *Binance) GetAssetsInfo(pair string) model.AssetInfo {
 	return b.assetsInfo[pair]
 }
 
+// UserInfo returns the maker and taker commissions of the account
+func (b *Binance) UserInfo() UserInfo {
+	return b.userInfo
+}
+
 func (b *Binance) GetLastQuote(ctx context.Context, pair string) (float64, error) {
 	candles, err := b.GetCandlesByLimit(ctx, pair, "1m", 1)
 	if err != nil || len(candles) < 1 {
@@ -169,6 +227,17 @@ func (b *Binance) GetCandlesByLimit(ctx context.Context, pair, period string, li
 }
 
 func (b *Binance) SubscribeCandle(ctx context.Context, pair, period string) (chan *model.Candle, chan error) {
+	return subscribeCandle(ctx, pair, period, b.HeikinAshi, b.wsKlineServe)
+}
+
+// klineServe connects to the kline stream of a symbol, as binance.WsKlineServe
+type klineServe func(symbol, interval string, handler binance.WsKlineHandler,
+	errHandler binance.ErrHandler) (doneC, stopC chan struct{}, err error)
+
+// subscribeCandle streams the candles of a pair, reconnecting with backoff until the context is done
+func subscribeCandle(ctx context.Context, pair, period string, heikinAshi bool,
+	serve klineServe) (chan *model.Candle, chan error) {
+
 	ccandle := make(chan *model.Candle)
 	cerr := make(chan error)
 	ha := model.NewHeikinAshi()
@@ -180,18 +249,23 @@ func (b *Binance) SubscribeCandle(ctx context.Context, pair, period string) (cha
 		}
 
 		for {
-			done, _, err := binance.WsKlineServe(pair, period, func(event *binance.WsKlineEvent) {
+			done, stop, err := serve(pair, period, func(event *binance.WsKlineEvent) {
 				ba.Reset()
 				candle := CandleFromWsKline(pair, event.Kline)
 
-				if candle.Complete && b.HeikinAshi {
+				if candle.Complete && heikinAshi {
 					candle = candle.ToHeikinAshi(ha)
 				}
 
-				ccandle <- &candle
-
+				select {
+				case ccandle <- &candle:
+				case <-ctx.Done():
+				}
 			}, func(err error) {
-				cerr <- err
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+				}
 			})
 			if err != nil {
 				cerr <- err
@@ -202,6 +276,9 @@ func (b *Binance) SubscribeCandle(ctx context.Context, pair, period string) (cha
 
 			select {
 			case <-ctx.Done():
+				// wait the connection to stop before closing the channels
+				close(stop)
+				<-done
 				close(cerr)
 				close(ccandle)
 				return
@@ -214,6 +291,59 @@ func (b *Binance) SubscribeCandle(ctx context.Context, pair, period string) (cha
 	return ccandle, cerr
 }
 
+// wsKlineServe is binance.WsKlineServe, the endpoint of go-binance can't be changed
+func (b *Binance) wsKlineServe(symbol, interval string, handler binance.WsKlineHandler,
+	errHandler binance.ErrHandler) (doneC, stopC chan struct{}, err error) {
+
+	if b.streamURL == "" {
+		return binance.WsKlineServe(symbol, interval, handler, errHandler)
+	}
+	return dialKlineStream(b.streamURL, symbol, interval, handler, errHandler)
+}
+
+// dialKlineStream serves the kline stream of a symbol from another stream url, eg: a fake for tests
+func dialKlineStream(streamURL, symbol, interval string, handler binance.WsKlineHandler,
+	errHandler binance.ErrHandler) (doneC, stopC chan struct{}, err error) {
+
+	endpoint := fmt.Sprintf("%s/%s@kline_%s", streamURL, strings.ToLower(symbol), interval)
+	conn, _, err := websocket.DefaultDialer.Dial(endpoint, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doneC = make(chan struct{})
+	stopC = make(chan struct{})
+	go func() {
+		defer close(doneC)
+		go func() {
+			select {
+			case <-stopC:
+			case <-doneC:
+			}
+			conn.Close()
+		}()
+
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				select {
+				case <-stopC:
+				default:
+					errHandler(err)
+				}
+				return
+			}
+			event := new(binance.WsKlineEvent)
+			if err := json.Unmarshal(message, event); err != nil {
+				errHandler(err)
+				continue
+			}
+			handler(event)
+		}
+	}()
+	return doneC, stopC, nil
+}
+
 func (b *Binance) Account() (model.Account, error) {
 	acc, err := b.client.NewGetAccountService().Do(b.ctx)
 	if err != nil {
@@ -243,7 +373,12 @@ func (b *Binance) Account() (model.Account, error) {
 }
 
 func (b *Binance) Position(pair string) (asset, quote float64, err error) {
-	assetTick, quoteTick := SplitAssetQuote(pair)
+	info, ok := b.assetsInfo[pair]
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: %s", ErrUnknownPair, pair)
+	}
+
+	assetTick, quoteTick := info.BaseAsset, info.QuoteAsset
 	acc, err := b.Account()
 	if err != nil {
 		return 0, 0, err
@@ -268,6 +403,45 @@ func (b *Binance) Order(pair string, id int64) (model.Order, error) {
 	return newOrder(order), nil
 }
 
+// WithClientOrderID returns a view of the exchange sending the next order with the given ids
+func (b *Binance) WithClientOrderID(ids ...string) Trader {
+	view := *b
+	view.clientOrderIDs = ids
+	return &view
+}
+
+// clientOrderID is the id of the given leg of the next order, empty ids are generated by binance
+func (b *Binance) clientOrderID(leg int) string {
+	if leg < len(b.clientOrderIDs) {
+		return b.clientOrderIDs[leg]
+	}
+	return ""
+}
+
+// createOrderService sends the client order id of the next order when it is given
+func (b *Binance) createOrderService() *binance.CreateOrderService {
+	service := b.client.NewCreateOrderService()
+	if id := b.clientOrderID(0); id != "" {
+		service.NewClientOrderID(id)
+	}
+	return service
+}
+
+func (b *Binance) OrderByClientID(pair, id string) (model.Order, error) {
+	order, err := b.client.NewGetOrderService().
+		Symbol(pair).
+		OrigClientOrderID(id).
+		Do(b.ctx)
+	if isAPIError(err, errCodeOrderNotFound) {
+		return model.Order{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return newOrder(order), nil
+}
+
 func (b *Binance) CreateOrderOCO(side model.SideType, pair string,
 	quantity, price, stop, stopLimit float64) ([]model.Order, error) {
 
@@ -277,17 +451,24 @@ func (b *Binance) CreateOrderOCO(side model.SideType, pair string,
 		return nil, err
 	}
 
-	ocoOrder, err := b.client.NewCreateOCOService().
+	service := b.client.NewCreateOCOService().
 		Side(binance.SideType(side)).
 		Quantity(b.formatQuantity(pair, quantity)).
 		Price(b.formatPrice(pair, price)).
 		StopPrice(b.formatPrice(pair, stop)).
 		StopLimitPrice(b.formatPrice(pair, stopLimit)).
 		StopLimitTimeInForce(binance.TimeInForceTypeGTC).
-		Symbol(pair).
-		Do(b.ctx)
+		Symbol(pair)
+	if id := b.clientOrderID(0); id != "" {
+		service.LimitClientOrderID(id)
+	}
+	if id := b.clientOrderID(1); id != "" {
+		service.StopClientOrderID(id)
+	}
+
+	ocoOrder, err := service.Do(b.ctx)
 	if err != nil {
-		return nil, err
+		return nil, requestError(pair, quantity, err)
 	}
 
 	orders := make([]model.Order, 0, len(ocoOrder.Orders))
@@ -295,16 +476,17 @@ func (b *Binance) CreateOrderOCO(side model.SideType, pair string,
 		price, _ := strconv.ParseFloat(order.Price, 64)
 		quantity, _ := strconv.ParseFloat(order.OrigQuantity, 64)
 		item := model.Order{
-			ExchangeID: order.OrderID,
-			CreatedAt:  time.Unix(0, ocoOrder.TransactionTime*int64(time.Millisecond)),
-			UpdatedAt:  time.Unix(0, ocoOrder.TransactionTime*int64(time.Millisecond)),
-			Pair:       pair,
-			Side:       model.SideType(order.Side),
-			Type:       model.OrderType(order.Type),
-			Status:     model.OrderStatusType(order.Status),
-			Price:      price,
-			Quantity:   quantity,
-			GroupID:    &order.OrderListID,
+			ExchangeID:    order.OrderID,
+			ClientOrderID: order.ClientOrderID,
+			CreatedAt:     time.Unix(0, ocoOrder.TransactionTime*int64(time.Millisecond)),
+			UpdatedAt:     time.Unix(0, ocoOrder.TransactionTime*int64(time.Millisecond)),
+			Pair:          pair,
+			Side:          model.SideType(order.Side),
+			Type:          model.OrderType(order.Type),
+			Status:        model.OrderStatusType(order.Status),
+			Price:         price,
+			Quantity:      quantity,
+			GroupID:       &order.OrderListID,
 		}
 
 		if item.Type == model.OrderTypeStopLossLimit || item.Type == model.OrderTypeStopLoss {
@@ -325,7 +507,7 @@ func (b *Binance) CreateOrderLimit(side model.SideType, pair string,
 		return model.Order{}, err
 	}
 
-	order, err := b.client.NewCreateOrderService().
+	order, err := b.createOrderService().
 		Symbol(pair).
 		Type(binance.OrderTypeLimit).
 		TimeInForce(binance.TimeInForceTypeGTC).
@@ -334,7 +516,7 @@ func (b *Binance) CreateOrderLimit(side model.SideType, pair string,
 		Price(b.formatPrice(pair, limit)).
 		Do(b.ctx)
 	if err != nil {
-		return model.Order{}, err
+		return model.Order{}, requestError(pair, quantity, err)
 	}
 
 	price, err := strconv.ParseFloat(order.Price, 64)
@@ -348,15 +530,16 @@ func (b *Binance) CreateOrderLimit(side model.SideType, pair string,
 	}
 
 	return model.Order{
-		ExchangeID: order.OrderID,
-		CreatedAt:  time.Unix(0, order.TransactTime*int64(time.Millisecond)),
-		UpdatedAt:  time.Unix(0, order.TransactTime*int64(time.Millisecond)),
-		Pair:       pair,
-		Side:       model.SideType(order.Side),
-		Type:       model.OrderType(order.Type),
-		Status:     model.OrderStatusType(order.Status),
-		Price:      price,
-		Quantity:   quantity,
+		ExchangeID:    order.OrderID,
+		ClientOrderID: order.ClientOrderID,
+		CreatedAt:     time.Unix(0, order.TransactTime*int64(time.Millisecond)),
+		UpdatedAt:     time.Unix(0, order.TransactTime*int64(time.Millisecond)),
+		Pair:          pair,
+		Side:          model.SideType(order.Side),
+		Type:          model.OrderType(order.Type),
+		Status:        model.OrderStatusType(order.Status),
+		Price:         price,
+		Quantity:      quantity,
 	}, nil
 }
 
@@ -366,7 +549,7 @@ func (b *Binance) CreateOrderMarket(side model.SideType, pair string, quantity f
 		return model.Order{}, err
 	}
 
-	order, err := b.client.NewCreateOrderService().
+	order, err := b.createOrderService().
 		Symbol(pair).
 		Type(binance.OrderTypeMarket).
 		Side(binance.SideType(side)).
@@ -374,7 +557,7 @@ func (b *Binance) CreateOrderMarket(side model.SideType, pair string, quantity f
 		NewOrderRespType(binance.NewOrderRespTypeFULL).
 		Do(b.ctx)
 	if err != nil {
-		return model.Order{}, err
+		return model.Order{}, requestError(pair, quantity, err)
 	}
 
 	cost, err := strconv.ParseFloat(order.CummulativeQuoteQuantity, 64)
@@ -387,16 +570,23 @@ func (b *Binance) CreateOrderMarket(side model.SideType, pair string, quantity f
 		return model.Order{}, err
 	}
 
+	fee, feeAsset := fillsFee(order.Fills)
+
 	return model.Order{
-		ExchangeID: order.OrderID,
-		CreatedAt:  time.Unix(0, order.TransactTime*int64(time.Millisecond)),
-		UpdatedAt:  time.Unix(0, order.TransactTime*int64(time.Millisecond)),
-		Pair:       order.Symbol,
-		Side:       model.SideType(order.Side),
-		Type:       model.OrderType(order.Type),
-		Status:     model.OrderStatusType(order.Status),
-		Price:      cost / quantity,
-		Quantity:   quantity,
+		ExchangeID:    order.OrderID,
+		ClientOrderID: order.ClientOrderID,
+		CreatedAt:     time.Unix(0, order.TransactTime*int64(time.Millisecond)),
+		UpdatedAt:     time.Unix(0, order.TransactTime*int64(time.Millisecond)),
+		Pair:          order.Symbol,
+		Side:          model.SideType(order.Side),
+		Type:          model.OrderType(order.Type),
+		Status:        model.OrderStatusType(order.Status),
+		Price:         cost / quantity,
+		Quantity:      quantity,
+		Fee:           fee,
+		FeeAsset:      feeAsset,
+
+		ExecutedQuantity: quantity,
 	}, nil
 }
 
@@ -406,7 +596,7 @@ func (b *Binance) CreateOrderMarketQuote(side model.SideType, pair string, quant
 		return model.Order{}, err
 	}
 
-	order, err := b.client.NewCreateOrderService().
+	order, err := b.createOrderService().
 		Symbol(pair).
 		Type(binance.OrderTypeMarket).
 		Side(binance.SideType(side)).
@@ -414,7 +604,7 @@ func (b *Binance) CreateOrderMarketQuote(side model.SideType, pair string, quant
 		NewOrderRespType(binance.NewOrderRespTypeFULL).
 		Do(b.ctx)
 	if err != nil {
-		return model.Order{}, err
+		return model.Order{}, requestError(pair, quantity, err)
 	}
 
 	cost, err := strconv.ParseFloat(order.CummulativeQuoteQuantity, 64)
@@ -427,16 +617,23 @@ func (b *Binance) CreateOrderMarketQuote(side model.SideType, pair string, quant
 		return model.Order{}, err
 	}
 
+	fee, feeAsset := fillsFee(order.Fills)
+
 	return model.Order{
-		ExchangeID: order.OrderID,
-		CreatedAt:  time.Unix(0, order.TransactTime*int64(time.Millisecond)),
-		UpdatedAt:  time.Unix(0, order.TransactTime*int64(time.Millisecond)),
-		Pair:       order.Symbol,
-		Side:       model.SideType(order.Side),
-		Type:       model.OrderType(order.Type),
-		Status:     model.OrderStatusType(order.Status),
-		Price:      cost / quantity,
-		Quantity:   quantity,
+		ExchangeID:    order.OrderID,
+		ClientOrderID: order.ClientOrderID,
+		CreatedAt:     time.Unix(0, order.TransactTime*int64(time.Millisecond)),
+		UpdatedAt:     time.Unix(0, order.TransactTime*int64(time.Millisecond)),
+		Pair:          order.Symbol,
+		Side:          model.SideType(order.Side),
+		Type:          model.OrderType(order.Type),
+		Status:        model.OrderStatusType(order.Status),
+		Price:         cost / quantity,
+		Quantity:      quantity,
+		Fee:           fee,
+		FeeAsset:      feeAsset,
+
+		ExecutedQuantity: quantity,
 	}, nil
 }
 
@@ -446,33 +643,42 @@ func (b *Binance) CreateOrderStop(pair string, quantity float64, limit float64)
 		return model.Order{}, err
 	}
 
-	order, err := b.client.NewCreateOrderService().Symbol(pair).
+	order, err := b.createOrderService().Symbol(pair).
 		Type(binance.OrderTypeStopLoss).
-		TimeInForce(binance.TimeInForceTypeGTC).
 		Side(binance.SideTypeSell).
 		Quantity(b.formatQuantity(pair, quantity)).
-		Price(b.formatPrice(pair, limit)).
+		StopPrice(b.formatPrice(pair, limit)).
 		Do(b.ctx)
 	if err != nil {
-		return model.Order{}, err
+		return model.Order{}, requestError(pair, quantity, err)
 	}
 
-	price, _ := strconv.ParseFloat(order.Price, 64)
 	quantity, _ = strconv.ParseFloat(order.OrigQuantity, 64)
 
 	return model.Order{
-		ExchangeID: order.OrderID,
-		CreatedAt:  time.Unix(0, order.TransactTime*int64(time.Millisecond)),
-		UpdatedAt:  time.Unix(0, order.TransactTime*int64(time.Millisecond)),
-		Pair:       pair,
-		Side:       model.SideType(order.Side),
-		Type:       model.OrderType(order.Type),
-		Status:     model.OrderStatusType(order.Status),
-		Price:      price,
-		Quantity:   quantity,
+		ExchangeID:    order.OrderID,
+		ClientOrderID: order.ClientOrderID,
+		CreatedAt:     time.Unix(0, order.TransactTime*int64(time.Millisecond)),
+		UpdatedAt:     time.Unix(0, order.TransactTime*int64(time.Millisecond)),
+		Pair:          pair,
+		Side:          model.SideType(order.Side),
+		Type:          model.OrderType(order.Type),
+		Status:        model.OrderStatusType(order.Status),
+		Price:         limit,
+		Stop:          &limit,
+		Quantity:      quantity,
 	}, nil
 }
 
+// CreateOrderTrailingStop is not supported by the spot api of the client
+func (b *Binance) CreateOrderTrailingStop(pair string, quantity float64, _ model.Trailing) (model.Order, error) {
+	return model.Order{}, &OrderError{
+		Err:      fmt.Errorf("%w: trailing stop", ErrOrderNotSupported),
+		Pair:     pair,
+		Quantity: quantity,
+	}
+}
+
 func (b *Binance) Cancel(order model.Order) error {
 	_, err := b.client.NewCancelOrderService().
 		Symbol(order.Pair).
@@ -482,7 +688,19 @@ func (b *Binance) Cancel(order model.Order) error {
 }
 
 func (b *Binance) validate(pair string, quantity float64) error {
-	info, ok := b.assetsInfo[pair]
+	return validateQuantity(b.assetsInfo, pair, quantity)
+}
+
+func (b *Binance) formatPrice(pair string, value float64) string {
+	return formatPrice(b.assetsInfo, pair, value)
+}
+
+func (b *Binance) formatQuantity(pair string, value float64) string {
+	return formatQuantity(b.assetsInfo, pair, value)
+}
+
+func validateQuantity(assetsInfo map[string]model.AssetInfo, pair string, quantity float64) error {
+	info, ok := assetsInfo[pair]
 	if !ok {
 		return ErrInvalidAsset
 	}
@@ -498,17 +716,17 @@ func (b *Binance) validate(pair string, quantity float64) error {
 	return nil
 }
 
-func (b *Binance) formatPrice(pair string, value float64) string {
+func formatPrice(assetsInfo map[string]model.AssetInfo, pair string, value float64) string {
 	precision := -1
-	if limits, ok := b.assetsInfo[pair]; ok {
+	if limits, ok := assetsInfo[pair]; ok {
 		precision = int(limits.PriceDecimalPrecision)
 	}
 	return strconv.FormatFloat(value, 'f', precision, 64)
 }
 
-func (b *Binance) formatQuantity(pair string, value float64) string {
+func formatQuantity(assetsInfo map[string]model.AssetInfo, pair string, value float64) string {
 	precision := -1
-	if limits, ok := b.assetsInfo[pair]; ok {
+	if limits, ok := assetsInfo[pair]; ok {
 		precision = int(limits.QtyDecimalPrecision)
 	}
 	return strconv.FormatFloat(value, 'f', precision, 64)
@@ -531,27 +749,64 @@ func (b *Binance) Orders(pair string, limit int) ([]model.Order, error) {
 	return orders, nil
 }
 
+// requestError marks the errors of the order requests whose execution is unknown, eg: timeouts
+// or server errors, the order may have been created
+func requestError(pair string, quantity float64, err error) error {
+	var apiError *common.APIError
+	if errors.As(err, &apiError) {
+		switch apiError.Code {
+		case 0, errCodeUnknown, errCodeDisconnected, errCodeUnexpectedResponse, errCodeTimeout:
+		default:
+			return err
+		}
+	}
+
+	return &OrderError{
+		Err:      fmt.Errorf("%w: %v", ErrStatusUnknown, err),
+		Pair:     pair,
+		Quantity: quantity,
+	}
+}
+
+// fillsFee sums the commission of the fills, paid in a single asset
+func fillsFee(fills []*binance.Fill) (fee float64, asset string) {
+	for _, fill := range fills {
+		commission, err := strconv.ParseFloat(fill.Commission, 64)
+		if err != nil {
+			log.Error().Err(err).Msg("binance parse commission failed.")
+			continue
+		}
+		fee += commission
+		asset = fill.CommissionAsset
+	}
+	return fee, asset
+}
+
 func newOrder(order *binance.Order) model.Order {
-	var price float64
+	price, _ := strconv.ParseFloat(order.Price, 64)
+	quantity, _ := strconv.ParseFloat(order.OrigQuantity, 64)
 	cost, _ := strconv.ParseFloat(order.CummulativeQuoteQuantity, 64)
-	quantity, _ := strconv.ParseFloat(order.ExecutedQuantity, 64)
-	if cost > 0 && quantity > 0 {
-		price = cost / quantity
-	} else {
-		price, _ = strconv.ParseFloat(order.Price, 64)
-		quantity, _ = strconv.ParseFloat(order.OrigQuantity, 64)
+	executed, _ := strconv.ParseFloat(order.ExecutedQuantity, 64)
+	if cost > 0 && executed > 0 {
+		price = cost / executed
+	}
+	if quantity == 0 {
+		quantity = executed
 	}
 
 	return model.Order{
-		ExchangeID: order.OrderID,
-		Pair:       order.Symbol,
-		CreatedAt:  time.Unix(0, order.Time*int64(time.Millisecond)),
-		UpdatedAt:  time.Unix(0, order.UpdateTime*int64(time.Millisecond)),
-		Side:       model.SideType(order.Side),
-		Type:       model.OrderType(order.Type),
-		Status:     model.OrderStatusType(order.Status),
-		Price:      price,
-		Quantity:   quantity,
+		ExchangeID:    order.OrderID,
+		ClientOrderID: order.ClientOrderID,
+		Pair:          order.Symbol,
+		CreatedAt:     time.Unix(0, order.Time*int64(time.Millisecond)),
+		UpdatedAt:     time.Unix(0, order.UpdateTime*int64(time.Millisecond)),
+		Side:          model.SideType(order.Side),
+		Type:          model.OrderType(order.Type),
+		Status:        model.OrderStatusType(order.Status),
+		Price:         price,
+		Quantity:      quantity,
+
+		ExecutedQuantity: executed,
 	}
 }
 
@@ -0,0 +1,815 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+// MarginType is the margin mode of a futures pair
+type MarginType string
+
+var (
+	MarginTypeIsolated MarginType = "ISOLATED"
+	MarginTypeCrossed  MarginType = "CROSSED"
+)
+
+// binance api errors returned when the setting is already applied
+const (
+	errCodeNoNeedToChangeMarginType   = -4046
+	errCodeNoNeedToChangePositionSide = -4059
+)
+
+// FuturesPosition is an open position of a futures pair
+type FuturesPosition struct {
+	Pair             string
+	Side             model.PositionSideType
+	Quantity         float64
+	EntryPrice       float64
+	MarkPrice        float64
+	LiquidationPrice float64
+	UnrealizedProfit float64
+	Leverage         int
+	MarginType       MarginType
+}
+
+// FundingRate is the funding rate of a perpetual pair paid at the given time
+type FundingRate struct {
+	Pair string
+	Rate float64
+	Time time.Time
+}
+
+// BinanceFutures trades the USDⓈ-M perpetual futures of Binance. The Trader methods
+// keep the spot semantics: buys open or increase the long position of a pair and
+// sells only reduce it, shorts are opened with OpenShort or the futures orders.
+type BinanceFutures struct {
+	ctx        context.Context
+	client     *futures.Client
+	assetsInfo map[string]model.AssetInfo
+	hedgeMode  bool
+	HeikinAshi bool
+	APIKey     string
+	APISecret  string
+	baseURL    string
+	streamURL  string
+
+	// client order id of the next order, see WithClientOrderID
+	clientOrderID string
+}
+
+type BinanceFuturesOption func(*BinanceFutures)
+
+func WithBinanceFuturesCredentials(key, secret string) BinanceFuturesOption {
+	return func(b *BinanceFutures) {
+		b.APIKey = key
+		b.APISecret = secret
+	}
+}
+
+func WithBinanceFuturesHeikinAshiCandle() BinanceFuturesOption {
+	return func(b *BinanceFutures) {
+		b.HeikinAshi = true
+	}
+}
+
+// WithBinanceFuturesBaseURL points the client to another server, eg: a fake for tests.
+// Kline streams are served by the same host under /ws.
+func WithBinanceFuturesBaseURL(baseURL string) BinanceFuturesOption {
+	return func(b *BinanceFutures) {
+		b.baseURL = strings.TrimSuffix(baseURL, "/")
+		b.streamURL = strings.Replace(b.baseURL, "http", "ws", 1) + "/ws"
+	}
+}
+
+// FuturesOrderOption sets the futures parameters of an order
+type FuturesOrderOption func(*futuresOrderParams)
+
+type futuresOrderParams struct {
+	reduceOnly   bool
+	positionSide model.PositionSideType
+	callbackRate float64
+}
+
+// WithReduceOnly only reduces the position of the pair, hedge mode orders reduce
+// a position when they trade against its side
+func WithReduceOnly() FuturesOrderOption {
+	return func(params *futuresOrderParams) {
+		params.reduceOnly = true
+	}
+}
+
+// WithPositionSide trades the long or the short position of the pair, in one-way
+// mode it only marks the order for the ledger
+func WithPositionSide(side model.PositionSideType) FuturesOrderOption {
+	return func(params *futuresOrderParams) {
+		params.positionSide = side
+	}
+}
+
+func NewBinanceFutures(ctx context.Context, options ...BinanceFuturesOption) (*BinanceFutures, error) {
+	futures.WebsocketKeepalive = true
+	exchange := &BinanceFutures{ctx: ctx}
+	for _, option := range options {
+		option(exchange)
+	}
+
+	exchange.client = futures.NewClient(exchange.APIKey, exchange.APISecret)
+	if exchange.baseURL != "" {
+		exchange.client.BaseURL = exchange.baseURL
+	}
+	err := exchange.client.NewPingService().Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("binance futures ping fail: %w", err)
+	}
+
+	// If user credentials are present
+	if exchange.APIKey != "" && exchange.APISecret != "" {
+		mode, err := exchange.client.NewGetPositionModeService().Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		exchange.hedgeMode = mode.DualSidePosition
+	}
+
+	results, err := exchange.client.NewExchangeInfoService().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize with orders precision and assets limits
+	exchange.assetsInfo = make(map[string]model.AssetInfo)
+	for _, info := range results.Symbols {
+		exchange.assetsInfo[info.Symbol] = parseFilters(model.AssetInfo{
+			BaseAsset:  info.BaseAsset,
+			QuoteAsset: info.QuoteAsset,
+		}, info.Filters)
+	}
+	DefaultRegistry.addAll(exchange.assetsInfo)
+
+	log.Info().Msg("Using Binance Futures Exchange")
+
+	return exchange, nil
+}
+
+func (b *BinanceFutures) GetAssetsInfo(pair string) model.AssetInfo {
+	return b.assetsInfo[pair]
+}
+
+// HedgeMode tells if the account holds a long and a short position for each pair
+func (b *BinanceFutures) HedgeMode() bool {
+	return b.hedgeMode
+}
+
+// SetHedgeMode switches the account between the hedge and the one-way position modes
+func (b *BinanceFutures) SetHedgeMode(enabled bool) error {
+	err := b.client.NewChangePositionModeService().DualSide(enabled).Do(b.ctx)
+	if err != nil && !isAPIError(err, errCodeNoNeedToChangePositionSide) {
+		return err
+	}
+	b.hedgeMode = enabled
+	return nil
+}
+
+// SetLeverage changes the initial leverage of the pair
+func (b *BinanceFutures) SetLeverage(pair string, leverage int) error {
+	_, err := b.client.NewChangeLeverageService().
+		Symbol(pair).
+		Leverage(leverage).
+		Do(b.ctx)
+	return err
+}
+
+// SetMarginType changes the margin type of the pair
+func (b *BinanceFutures) SetMarginType(pair string, marginType MarginType) error {
+	err := b.client.NewChangeMarginTypeService().
+		Symbol(pair).
+		MarginType(futures.MarginType(marginType)).
+		Do(b.ctx)
+	if err != nil && !isAPIError(err, errCodeNoNeedToChangeMarginType) {
+		return err
+	}
+	return nil
+}
+
+// MarkPrice returns the mark price of the pair, used to value the positions
+func (b *BinanceFutures) MarkPrice(pair string) (float64, error) {
+	index, err := b.premiumIndex(pair)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(index.MarkPrice, 64)
+}
+
+// FundingRate returns the last funding rate of the pair and the time of the next funding
+func (b *BinanceFutures) FundingRate(pair string) (rate float64, next time.Time, err error) {
+	index, err := b.premiumIndex(pair)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	rate, err = strconv.ParseFloat(index.LastFundingRate, 64)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return rate, time.Unix(0, index.NextFundingTime*int64(time.Millisecond)), nil
+}
+
+// FundingRates returns the funding rate history of the pair in the period
+func (b *BinanceFutures) FundingRates(pair string, start, end time.Time) ([]FundingRate, error) {
+	const limit = 1000
+
+	rates := make([]FundingRate, 0)
+	from := start.UnixNano() / int64(time.Millisecond)
+	for {
+		data, err := b.client.NewFundingRateService().
+			Symbol(pair).
+			StartTime(from).
+			EndTime(end.UnixNano() / int64(time.Millisecond)).
+			Limit(limit).
+			Do(b.ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range data {
+			rate, err := strconv.ParseFloat(d.FundingRate, 64)
+			if err != nil {
+				return nil, err
+			}
+			rates = append(rates, FundingRate{
+				Pair: pair,
+				Rate: rate,
+				Time: time.Unix(0, d.FundingTime*int64(time.Millisecond)),
+			})
+		}
+
+		if len(data) < limit {
+			return rates, nil
+		}
+		from = data[len(data)-1].FundingTime + 1
+	}
+}
+
+func (b *BinanceFutures) premiumIndex(pair string) (*futures.PremiumIndex, error) {
+	indexes, err := b.client.NewPremiumIndexService().Symbol(pair).Do(b.ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPair, pair)
+	}
+	return indexes[0], nil
+}
+
+func (b *BinanceFutures) GetLastQuote(ctx context.Context, pair string) (float64, error) {
+	candles, err := b.GetCandlesByLimit(ctx, pair, "1m", 1)
+	if err != nil || len(candles) < 1 {
+		return 0, err
+	}
+	return candles[0].Close, nil
+}
+
+func (b *BinanceFutures) GetCandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	candles := make([]model.Candle, 0)
+	klineService := b.client.NewKlinesService()
+	ha := model.NewHeikinAshi()
+
+	data, err := klineService.Symbol(pair).
+		Interval(period).
+		StartTime(start.UnixNano() / int64(time.Millisecond)).
+		EndTime(end.UnixNano() / int64(time.Millisecond)).
+		Do(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range data {
+		candle := CandleFromKline(pair, binance.Kline(*d))
+
+		if b.HeikinAshi {
+			candle = candle.ToHeikinAshi(ha)
+		}
+
+		candles = append(candles, candle)
+	}
+
+	return candles, nil
+}
+
+func (b *BinanceFutures) GetCandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	candles := make([]model.Candle, 0)
+	klineService := b.client.NewKlinesService()
+	ha := model.NewHeikinAshi()
+
+	data, err := klineService.Symbol(pair).
+		Interval(period).
+		Limit(limit + 1).
+		Do(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range data {
+		candle := CandleFromKline(pair, binance.Kline(*d))
+
+		if b.HeikinAshi {
+			candle = candle.ToHeikinAshi(ha)
+		}
+
+		candles = append(candles, candle)
+	}
+
+	// discard last candle, because it is incomplete
+	return candles[:len(candles)-1], nil
+}
+
+func (b *BinanceFutures) SubscribeCandle(ctx context.Context, pair, period string) (chan *model.Candle, chan error) {
+	return subscribeCandle(ctx, pair, period, b.HeikinAshi, b.wsKlineServe)
+}
+
+// wsKlineServe is futures.WsKlineServe with the events of the spot market
+func (b *BinanceFutures) wsKlineServe(symbol, interval string, handler binance.WsKlineHandler,
+	errHandler binance.ErrHandler) (doneC, stopC chan struct{}, err error) {
+
+	if b.streamURL != "" {
+		return dialKlineStream(b.streamURL, symbol, interval, handler, errHandler)
+	}
+	return futures.WsKlineServe(symbol, interval, func(event *futures.WsKlineEvent) {
+		handler(&binance.WsKlineEvent{
+			Event:  event.Event,
+			Time:   event.Time,
+			Symbol: event.Symbol,
+			Kline:  binance.WsKline(event.Kline),
+		})
+	}, futures.ErrHandler(errHandler))
+}
+
+// Account returns the margin balance of the assets, the wallet balance with the
+// unrealized profit, locked by the initial margin of the positions and open orders
+func (b *BinanceFutures) Account() (model.Account, error) {
+	acc, err := b.client.NewGetAccountService().Do(b.ctx)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	balances := make([]model.Balance, 0)
+	for _, asset := range acc.Assets {
+		balance, err := parseFloats(asset.MarginBalance, asset.PositionInitialMargin, asset.OpenOrderInitialMargin)
+		if err != nil {
+			return model.Account{}, err
+		}
+		locked := balance[1] + balance[2]
+		balances = append(balances, model.Balance{
+			Tick: asset.Asset,
+			Free: balance[0] - locked,
+			Lock: locked,
+		})
+	}
+
+	return model.Account{
+		Balances: balances,
+	}, nil
+}
+
+// Position returns the net position of the pair, negative when short, and the
+// margin balance of the quote asset
+func (b *BinanceFutures) Position(pair string) (asset, quote float64, err error) {
+	info, ok := b.assetsInfo[pair]
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: %s", ErrUnknownPair, pair)
+	}
+
+	positions, err := b.Positions(pair)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, position := range positions {
+		if position.Side == model.PositionSideTypeShort {
+			asset -= position.Quantity
+		} else {
+			asset += position.Quantity
+		}
+	}
+
+	acc, err := b.Account()
+	if err != nil {
+		return 0, 0, err
+	}
+	quoteBalance := acc.Balance(info.QuoteAsset)
+
+	return asset, quoteBalance.Free + quoteBalance.Lock, nil
+}
+
+// Positions returns the open positions of the pair, both sides in hedge mode
+func (b *BinanceFutures) Positions(pair string) ([]FuturesPosition, error) {
+	risks, err := b.client.NewGetPositionRiskService().Symbol(pair).Do(b.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make([]FuturesPosition, 0)
+	for _, risk := range risks {
+		values, err := parseFloats(risk.PositionAmt, risk.EntryPrice, risk.MarkPrice,
+			risk.LiquidationPrice, risk.UnRealizedProfit)
+		if err != nil {
+			return nil, err
+		}
+		if values[0] == 0 {
+			continue
+		}
+
+		leverage, _ := strconv.Atoi(risk.Leverage)
+		marginType := MarginTypeCrossed
+		if strings.EqualFold(risk.MarginType, string(MarginTypeIsolated)) {
+			marginType = MarginTypeIsolated
+		}
+		position := FuturesPosition{
+			Pair:             risk.Symbol,
+			Side:             model.PositionSideTypeLong,
+			Quantity:         math.Abs(values[0]),
+			EntryPrice:       values[1],
+			MarkPrice:        values[2],
+			LiquidationPrice: values[3],
+			UnrealizedProfit: values[4],
+			Leverage:         leverage,
+			MarginType:       marginType,
+		}
+		if risk.PositionSide == string(futures.PositionSideTypeShort) ||
+			risk.PositionSide == string(futures.PositionSideTypeBoth) && values[0] < 0 {
+			position.Side = model.PositionSideTypeShort
+		}
+		positions = append(positions, position)
+	}
+	return positions, nil
+}
+
+func (b *BinanceFutures) Order(pair string, id int64) (model.Order, error) {
+	order, err := b.client.NewGetOrderService().
+		Symbol(pair).
+		OrderID(id).
+		Do(b.ctx)
+
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return newFuturesOrder(order), nil
+}
+
+// WithClientOrderID returns a view of the exchange sending the next order with the given id,
+// the futures market has no OCO orders
+func (b *BinanceFutures) WithClientOrderID(ids ...string) Trader {
+	view := *b
+	view.clientOrderID = ""
+	if len(ids) > 0 {
+		view.clientOrderID = ids[0]
+	}
+	return &view
+}
+
+func (b *BinanceFutures) OrderByClientID(pair, id string) (model.Order, error) {
+	order, err := b.client.NewGetOrderService().
+		Symbol(pair).
+		OrigClientOrderID(id).
+		Do(b.ctx)
+	if isAPIError(err, errCodeOrderNotFound) {
+		return model.Order{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return newFuturesOrder(order), nil
+}
+
+func (b *BinanceFutures) Orders(pair string, limit int) ([]model.Order, error) {
+	result, err := b.client.NewListOrdersService().
+		Symbol(pair).
+		Limit(limit).
+		Do(b.ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]model.Order, 0)
+	for _, order := range result {
+		orders = append(orders, newFuturesOrder(order))
+	}
+	return orders, nil
+}
+
+// CreateOrderOCO is not supported by the futures market, use a limit and a stop reduce-only orders
+func (b *BinanceFutures) CreateOrderOCO(_ model.SideType, pair string,
+	quantity, _, _, _ float64) ([]model.Order, error) {
+
+	return nil, &OrderError{
+		Err:      fmt.Errorf("%w: OCO", ErrOrderNotSupported),
+		Pair:     pair,
+		Quantity: quantity,
+	}
+}
+
+func (b *BinanceFutures) CreateOrderLimit(side model.SideType, pair string,
+	quantity float64, limit float64) (model.Order, error) {
+	return b.CreateFuturesOrderLimit(side, pair, quantity, limit, b.spotOptions(side)...)
+}
+
+func (b *BinanceFutures) CreateOrderMarket(side model.SideType, pair string, quantity float64) (model.Order, error) {
+	return b.CreateFuturesOrderMarket(side, pair, quantity, b.spotOptions(side)...)
+}
+
+// CreateOrderMarketQuote trades the quantity worth the quote amount at the mark price
+func (b *BinanceFutures) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	price, err := b.MarkPrice(pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	quantity := quote / price
+	if step := b.assetsInfo[pair].StepSize; step > 0 {
+		quantity = math.Floor(quantity/step) * step
+	}
+	return b.CreateOrderMarket(side, pair, quantity)
+}
+
+// CreateOrderStop sells the long position at market when the price reaches the limit
+func (b *BinanceFutures) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	return b.CreateFuturesOrderStop(model.SideTypeSell, pair, quantity, limit, b.spotOptions(model.SideTypeSell)...)
+}
+
+// CreateOrderTrailingStop sells the long position at market when the mark price falls
+// the callback rate from its high, price offsets are not supported
+func (b *BinanceFutures) CreateOrderTrailingStop(pair string, quantity float64,
+	trailing model.Trailing) (model.Order, error) {
+
+	if trailing.Offset != 0 {
+		return model.Order{}, &OrderError{
+			Err:      fmt.Errorf("%w: trailing stop offset", ErrOrderNotSupported),
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+	return b.CreateFuturesOrderTrailingStop(model.SideTypeSell, pair, quantity, trailing.Rate,
+		b.spotOptions(model.SideTypeSell)...)
+}
+
+// spotOptions trades the long position, sells only reduce it
+func (b *BinanceFutures) spotOptions(side model.SideType) []FuturesOrderOption {
+	if b.hedgeMode {
+		return []FuturesOrderOption{WithPositionSide(model.PositionSideTypeLong)}
+	}
+	if side == model.SideTypeSell {
+		return []FuturesOrderOption{WithReduceOnly()}
+	}
+	return nil
+}
+
+// shortOptions trades the short position, buys only reduce it
+func (b *BinanceFutures) shortOptions(side model.SideType) []FuturesOrderOption {
+	options := []FuturesOrderOption{WithPositionSide(model.PositionSideTypeShort)}
+	if !b.hedgeMode && side == model.SideTypeBuy {
+		options = append(options, WithReduceOnly())
+	}
+	return options
+}
+
+// OpenShort sells the pair at market, opening or increasing the short position
+func (b *BinanceFutures) OpenShort(pair string, size float64) (model.Order, error) {
+	return b.CreateFuturesOrderMarket(model.SideTypeSell, pair, size, b.shortOptions(model.SideTypeSell)...)
+}
+
+// CloseShort buys the pair at market, reducing the short position
+func (b *BinanceFutures) CloseShort(pair string, size float64) (model.Order, error) {
+	return b.CreateFuturesOrderMarket(model.SideTypeBuy, pair, size, b.shortOptions(model.SideTypeBuy)...)
+}
+
+// MarginLevel is the margin balance over the maintenance margin of the account,
+// the positions are liquidated when it reaches 1
+func (b *BinanceFutures) MarginLevel() (float64, error) {
+	acc, err := b.client.NewGetAccountService().Do(b.ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	values, err := parseFloats(acc.TotalMarginBalance, acc.TotalMaintMargin)
+	if err != nil {
+		return 0, err
+	}
+	if values[1] == 0 {
+		return math.Inf(1), nil
+	}
+	return values[0] / values[1], nil
+}
+
+// CreateFuturesOrderMarket trades the quantity at market
+func (b *BinanceFutures) CreateFuturesOrderMarket(side model.SideType, pair string, quantity float64,
+	options ...FuturesOrderOption) (model.Order, error) {
+	return b.createOrder(futures.OrderTypeMarket, side, pair, quantity, 0, 0, options)
+}
+
+// CreateFuturesOrderLimit trades the quantity at the limit price or better
+func (b *BinanceFutures) CreateFuturesOrderLimit(side model.SideType, pair string, quantity, limit float64,
+	options ...FuturesOrderOption) (model.Order, error) {
+	return b.createOrder(futures.OrderTypeLimit, side, pair, quantity, limit, 0, options)
+}
+
+// CreateFuturesOrderStop trades the quantity at market when the mark price reaches the stop
+func (b *BinanceFutures) CreateFuturesOrderStop(side model.SideType, pair string, quantity, stop float64,
+	options ...FuturesOrderOption) (model.Order, error) {
+	return b.createOrder(futures.OrderTypeStopMarket, side, pair, quantity, 0, stop, options)
+}
+
+// CreateFuturesOrderTrailingStop trades the quantity at market when the mark price reverses
+// the callback rate from its best price, eg: 0.01 for 1 %
+func (b *BinanceFutures) CreateFuturesOrderTrailingStop(side model.SideType, pair string, quantity,
+	callbackRate float64, options ...FuturesOrderOption) (model.Order, error) {
+
+	if !model.TrailingRate(callbackRate).Valid() {
+		return model.Order{}, &OrderError{
+			Err:      ErrInvalidTrailing,
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+
+	options = append(options, func(params *futuresOrderParams) {
+		params.callbackRate = callbackRate
+	})
+	return b.createOrder(futures.OrderTypeTrailingStopMarket, side, pair, quantity, 0, 0, options)
+}
+
+func (b *BinanceFutures) createOrder(kind futures.OrderType, side model.SideType, pair string,
+	quantity, price, stop float64, options []FuturesOrderOption) (model.Order, error) {
+
+	err := validateQuantity(b.assetsInfo, pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	var params futuresOrderParams
+	for _, option := range options {
+		option(&params)
+	}
+
+	service := b.client.NewCreateOrderService().
+		Symbol(pair).
+		Type(kind).
+		Side(futures.SideType(side)).
+		Quantity(formatQuantity(b.assetsInfo, pair, quantity)).
+		NewOrderResponseType(futures.NewOrderRespTypeRESULT)
+	if price > 0 {
+		service.Price(formatPrice(b.assetsInfo, pair, price)).TimeInForce(futures.TimeInForceTypeGTC)
+	}
+	if stop > 0 {
+		service.StopPrice(formatPrice(b.assetsInfo, pair, stop)).WorkingType(futures.WorkingTypeMarkPrice)
+	}
+
+	if params.callbackRate > 0 {
+		service.CallbackRate(strconv.FormatFloat(params.callbackRate*100, 'f', 1, 64)).
+			WorkingType(futures.WorkingTypeMarkPrice)
+	}
+
+	// hedge mode orders reduce a position when they trade against its side
+	if b.hedgeMode {
+		positionSide := params.positionSide
+		if positionSide == "" {
+			positionSide = model.PositionSideTypeLong
+		}
+		service.PositionSide(futures.PositionSideType(positionSide))
+	} else if params.reduceOnly {
+		service.ReduceOnly(true)
+	}
+	if b.clientOrderID != "" {
+		service.NewClientOrderID(b.clientOrderID)
+	}
+
+	response, err := service.Do(b.ctx)
+	if err != nil {
+		return model.Order{}, requestError(pair, quantity, err)
+	}
+
+	order := newFuturesOrder(&futures.Order{
+		Symbol:           response.Symbol,
+		OrderID:          response.OrderID,
+		ClientOrderID:    response.ClientOrderID,
+		Price:            response.Price,
+		OrigQuantity:     response.OrigQuantity,
+		ExecutedQuantity: response.ExecutedQuantity,
+		CumQuote:         response.CumQuote,
+		Status:           response.Status,
+		Type:             response.Type,
+		Side:             response.Side,
+		StopPrice:        response.StopPrice,
+		Time:             response.UpdateTime,
+		UpdateTime:       response.UpdateTime,
+		AvgPrice:         response.AvgPrice,
+		ActivatePrice:    response.ActivatePrice,
+		PriceRate:        response.PriceRate,
+		PositionSide:     response.PositionSide,
+	})
+	if params.positionSide != "" {
+		order.PositionSide = params.positionSide
+	}
+	return order, nil
+}
+
+func (b *BinanceFutures) Cancel(order model.Order) error {
+	_, err := b.client.NewCancelOrderService().
+		Symbol(order.Pair).
+		OrderID(order.ExchangeID).
+		Do(b.ctx)
+	return err
+}
+
+// futuresOrderTypes maps the futures orders to the spot types of the same behavior
+var futuresOrderTypes = map[futures.OrderType]model.OrderType{
+	futures.OrderTypeStopMarket:         model.OrderTypeStopLoss,
+	futures.OrderTypeStop:               model.OrderTypeStopLossLimit,
+	futures.OrderTypeTakeProfitMarket:   model.OrderTypeTakeProfit,
+	futures.OrderTypeTakeProfit:         model.OrderTypeTakeProfitLimit,
+	futures.OrderTypeTrailingStopMarket: model.OrderTypeTrailingStop,
+}
+
+func newFuturesOrder(order *futures.Order) model.Order {
+	price, _ := strconv.ParseFloat(order.Price, 64)
+	quantity, _ := strconv.ParseFloat(order.OrigQuantity, 64)
+	executed, _ := strconv.ParseFloat(order.ExecutedQuantity, 64)
+	average, _ := strconv.ParseFloat(order.AvgPrice, 64)
+	if average > 0 && executed > 0 {
+		price = average
+	}
+
+	kind := model.OrderType(order.Type)
+	if spotType, ok := futuresOrderTypes[order.Type]; ok {
+		kind = spotType
+	}
+
+	result := model.Order{
+		ExchangeID:    order.OrderID,
+		ClientOrderID: order.ClientOrderID,
+		Pair:          order.Symbol,
+		CreatedAt:     time.Unix(0, order.Time*int64(time.Millisecond)),
+		UpdatedAt:     time.Unix(0, order.UpdateTime*int64(time.Millisecond)),
+		Side:          model.SideType(order.Side),
+		Type:          kind,
+		Status:        model.OrderStatusType(order.Status),
+		Price:         price,
+		Quantity:      quantity,
+
+		ExecutedQuantity: executed,
+	}
+
+	if stop, _ := strconv.ParseFloat(order.StopPrice, 64); stop > 0 {
+		result.Stop = &stop
+		if result.Price == 0 {
+			result.Price = stop
+		}
+	}
+	if rate, _ := strconv.ParseFloat(order.PriceRate, 64); rate > 0 {
+		result.Trailing = &model.Trailing{Rate: rate / 100}
+		if result.Price == 0 {
+			result.Price, _ = strconv.ParseFloat(order.ActivatePrice, 64)
+		}
+	}
+	if order.PositionSide != futures.PositionSideTypeBoth {
+		result.PositionSide = model.PositionSideType(order.PositionSide)
+	}
+	return result
+}
+
+// parseFloats parses the decimal strings of the api, empty strings are zero
+func parseFloats(values ...string) ([]float64, error) {
+	result := make([]float64, len(values))
+	for i, value := range values {
+		if value == "" {
+			continue
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = number
+	}
+	return result, nil
+}
+
+func isAPIError(err error, code int64) bool {
+	var apiError *common.APIError
+	return errors.As(err, &apiError) && apiError.Code == code
+}
@@ -0,0 +1,948 @@
+package binancetest
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/lynbklk/tradebot/pkg/model"
+)
+
+const (
+	// defaultLeverage is the initial leverage of the futures pairs
+	defaultLeverage = 20
+	// maintenanceRate is the maintenance margin of the positions, over their notional value
+	maintenanceRate = 0.004
+	// fundingInterval is the time between two fundings of the perpetual pairs
+	fundingInterval = 8 * time.Hour
+	// positionDust is the remaining amount considered as a closed position
+	positionDust = 1e-12
+)
+
+// futuresAccount is the USDⓈ-M futures wallet, the positions are valued at the last price,
+// used as mark price, and they are never liquidated
+type futuresAccount struct {
+	balances   map[string]float64
+	positions  map[string]*position
+	orders     []*futuresOrder
+	leverage   map[string]int
+	marginType map[string]futures.MarginType
+	funding    map[string]float64
+	dualSide   bool
+}
+
+func newFuturesAccount() *futuresAccount {
+	return &futuresAccount{
+		balances:   make(map[string]float64),
+		positions:  make(map[string]*position),
+		leverage:   make(map[string]int),
+		marginType: make(map[string]futures.MarginType),
+		funding:    make(map[string]float64),
+	}
+}
+
+// position is the amount of a pair held by a position side, negative when short
+type position struct {
+	pair   string
+	side   futures.PositionSideType
+	amount float64
+	entry  float64
+}
+
+type futuresOrder struct {
+	id           int64
+	clientID     string
+	pair         string
+	side         futures.SideType
+	positionSide futures.PositionSideType
+	kind         futures.OrderType
+	status       futures.OrderStatusType
+	price        float64
+	stop         float64
+	callbackRate float64
+	activation   float64
+	extreme      float64
+	quantity     float64
+	executed     float64
+	cost         float64
+	reduceOnly   bool
+	createdAt    time.Time
+	updatedAt    time.Time
+}
+
+// WithFuturesBalance sets the wallet balance of an asset in the futures account
+func WithFuturesBalance(asset string, amount float64) Option {
+	return func(s *Server) {
+		s.futures.balances[asset] = amount
+	}
+}
+
+// WithFundingRate sets the funding rate of a perpetual pair, paid every 8 hours
+func WithFundingRate(pair string, rate float64) Option {
+	return func(s *Server) {
+		s.futures.funding[pair] = rate
+	}
+}
+
+var (
+	errReduceOnly            = &apiError{http.StatusBadRequest, -2022, "ReduceOnly Order is rejected."}
+	errInsufficientMargin    = &apiError{http.StatusBadRequest, -2019, "Margin is insufficient."}
+	errWouldTrigger          = &apiError{http.StatusBadRequest, -2021, "Order would immediately trigger."}
+	errInvalidCallbackRate   = &apiError{http.StatusBadRequest, -1130, "Data sent for parameter 'callbackRate' is not valid."}
+	errPositionSide          = &apiError{http.StatusBadRequest, -4061, "Order's position side does not match user's setting."}
+	errReduceOnlyNotRequired = &apiError{http.StatusBadRequest, -1106, "Parameter 'reduceOnly' sent when not required."}
+	errNoNeedMarginType      = &apiError{http.StatusBadRequest, -4046, "No need to change margin type."}
+	errMarginTypePosition    = &apiError{http.StatusBadRequest, -4048, "Margin type cannot be changed if there exists position."}
+	errNoNeedPositionSide    = &apiError{http.StatusBadRequest, -4059, "No need to change position side."}
+	errPositionSidePosition  = &apiError{http.StatusBadRequest, -4068, "Position side cannot be changed if there exists position."}
+)
+
+func (o *futuresOrder) futuresOrder() *futures.Order {
+	var timeInForce futures.TimeInForceType
+	if o.kind == futures.OrderTypeLimit {
+		timeInForce = futures.TimeInForceTypeGTC
+	}
+
+	var average float64
+	if o.executed > 0 {
+		average = o.cost / o.executed
+	}
+
+	return &futures.Order{
+		Symbol:           o.pair,
+		OrderID:          o.id,
+		ClientOrderID:    o.clientID,
+		Price:            formatFloat(o.price),
+		ReduceOnly:       o.reduceOnly,
+		OrigQuantity:     formatFloat(o.quantity),
+		ExecutedQuantity: formatFloat(o.executed),
+		CumQuantity:      formatFloat(o.executed),
+		CumQuote:         formatFloat(o.cost),
+		Status:           o.status,
+		TimeInForce:      timeInForce,
+		Type:             o.kind,
+		Side:             o.side,
+		StopPrice:        formatFloat(o.stop),
+		ActivatePrice:    formatFloat(o.activation),
+		PriceRate:        formatFloat(o.callbackRate),
+		Time:             milliseconds(o.createdAt),
+		UpdateTime:       milliseconds(o.updatedAt),
+		WorkingType:      futures.WorkingTypeMarkPrice,
+		AvgPrice:         formatFloat(average),
+		OrigType:         string(o.kind),
+		PositionSide:     o.positionSide,
+	}
+}
+
+// pairs returns the known pairs in alphabetical order
+func (s *Server) pairs() []string {
+	pairs := make([]string, 0, len(s.assetsInfo))
+	for pair := range s.assetsInfo {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+func (s *Server) position(pair string, side futures.PositionSideType) *position {
+	key := pair + ":" + string(side)
+	if _, ok := s.futures.positions[key]; !ok {
+		s.futures.positions[key] = &position{pair: pair, side: side}
+	}
+	return s.futures.positions[key]
+}
+
+func (s *Server) leverage(pair string) int {
+	if leverage, ok := s.futures.leverage[pair]; ok {
+		return leverage
+	}
+	return defaultLeverage
+}
+
+// sortedPositions returns the positions of the pair, or all the positions, in a stable order
+func (s *Server) sortedPositions(pair string) []*position {
+	sides := []futures.PositionSideType{futures.PositionSideTypeBoth}
+	if s.futures.dualSide {
+		sides = []futures.PositionSideType{futures.PositionSideTypeLong, futures.PositionSideTypeShort}
+	}
+
+	pairs := []string{pair}
+	if pair == "" {
+		pairs = s.pairs()
+	}
+
+	positions := make([]*position, 0, len(pairs)*len(sides))
+	for _, pair := range pairs {
+		for _, side := range sides {
+			positions = append(positions, s.position(pair, side))
+		}
+	}
+	return positions
+}
+
+// margins returns the unrealized profit and the margins of the positions and open orders in the quote asset
+func (s *Server) margins(quote string) (unrealized, positionMargin, orderMargin, maintMargin float64) {
+	for _, p := range s.futures.positions {
+		if p.amount == 0 || s.assetsInfo[p.pair].QuoteAsset != quote {
+			continue
+		}
+		mark := s.lastPrice[p.pair]
+		unrealized += p.amount * (mark - p.entry)
+		positionMargin += math.Abs(p.amount) * mark / float64(s.leverage(p.pair))
+		maintMargin += math.Abs(p.amount) * mark * maintenanceRate
+	}
+	for _, o := range s.futures.orders {
+		if o.status != futures.OrderStatusTypeNew || s.reduces(o) || s.assetsInfo[o.pair].QuoteAsset != quote {
+			continue
+		}
+		orderMargin += o.quantity * o.orderPrice() / float64(s.leverage(o.pair))
+	}
+	return unrealized, positionMargin, orderMargin, maintMargin
+}
+
+func (s *Server) availableMargin(quote string) float64 {
+	unrealized, positionMargin, orderMargin, _ := s.margins(quote)
+	return s.futures.balances[quote] + unrealized - positionMargin - orderMargin
+}
+
+// orderPrice is the expected execution price of a resting order
+func (o *futuresOrder) orderPrice() float64 {
+	if o.price > 0 {
+		return o.price
+	}
+	return o.stop
+}
+
+// signed is the quantity added to the position amount by the order
+func (o *futuresOrder) signed(quantity float64) float64 {
+	if o.side == futures.SideTypeSell {
+		return -quantity
+	}
+	return quantity
+}
+
+// reducible returns the quantity of the order closing the position, an order
+// of the position side closes it when it trades against it
+func (s *Server) reducible(o *futuresOrder) float64 {
+	p := s.position(o.pair, o.positionSide)
+	if p.amount*o.signed(1) >= 0 {
+		return 0
+	}
+	return math.Min(o.quantity, math.Abs(p.amount))
+}
+
+// reduces tells if the order can't increase the position, hedge mode orders
+// against their position side only reduce it
+func (s *Server) reduces(o *futuresOrder) bool {
+	return o.reduceOnly ||
+		o.positionSide == futures.PositionSideTypeLong && o.side == futures.SideTypeSell ||
+		o.positionSide == futures.PositionSideTypeShort && o.side == futures.SideTypeBuy
+}
+
+// fillFutures executes the order at the price, realizing the profit of the closed quantity
+func (s *Server) fillFutures(o *futuresOrder, price float64) {
+	quantity := o.quantity
+	if s.reduces(o) {
+		quantity = s.reducible(o)
+	}
+
+	p := s.position(o.pair, o.positionSide)
+	quote := s.assetsInfo[o.pair].QuoteAsset
+	amount := o.signed(quantity)
+	if p.amount*amount < 0 {
+		closed := math.Min(math.Abs(amount), math.Abs(p.amount))
+		direction := math.Copysign(1, p.amount)
+		s.futures.balances[quote] += closed * (price - p.entry) * direction
+		p.amount -= direction * closed
+		amount += direction * closed
+		if math.Abs(p.amount) < positionDust {
+			p.amount, p.entry = 0, 0
+		}
+	}
+	if math.Abs(amount) > positionDust {
+		p.entry = (p.entry*math.Abs(p.amount) + price*math.Abs(amount)) / (math.Abs(p.amount) + math.Abs(amount))
+		p.amount += amount
+	}
+
+	o.executed = quantity
+	o.cost = quantity * price
+	o.status = futures.OrderStatusTypeFilled
+	o.updatedAt = time.Now()
+}
+
+// triggered returns the execution price when the candle reaches the order
+func (o *futuresOrder) triggered(candle model.Candle) (float64, bool) {
+	buy := o.side == futures.SideTypeBuy
+	switch o.kind {
+	case futures.OrderTypeLimit:
+		if buy && candle.Low <= o.price || !buy && candle.High >= o.price {
+			return o.price, true
+		}
+	case futures.OrderTypeStopMarket, futures.OrderTypeTrailingStopMarket:
+		if buy && candle.High >= o.stop || !buy && candle.Low <= o.stop {
+			return o.stop, true
+		}
+	case futures.OrderTypeTakeProfitMarket:
+		if buy && candle.Low <= o.stop || !buy && candle.High >= o.stop {
+			return o.stop, true
+		}
+	}
+	return 0, false
+}
+
+// trail moves the stop of a trailing order with the best price reached by the candle
+func (o *futuresOrder) trail(candle model.Candle) {
+	if o.kind != futures.OrderTypeTrailingStopMarket {
+		return
+	}
+	if o.side == futures.SideTypeSell {
+		o.extreme = math.Max(o.extreme, candle.High)
+		o.stop = o.extreme * (1 - o.callbackRate/100)
+		return
+	}
+	o.extreme = math.Min(o.extreme, candle.Low)
+	o.stop = o.extreme * (1 + o.callbackRate/100)
+}
+
+// updateFutures fills the futures orders reached by the candle, the orders
+// reducing a closed position expire
+func (s *Server) updateFutures(pair string, candle model.Candle) {
+	for _, o := range s.futures.orders {
+		if o.pair != pair || o.status != futures.OrderStatusTypeNew {
+			continue
+		}
+		price, ok := o.triggered(candle)
+		if !ok {
+			o.trail(candle)
+			continue
+		}
+
+		if s.reduces(o) && s.reducible(o) == 0 {
+			o.status = futures.OrderStatusTypeExpired
+			o.updatedAt = time.Now()
+			continue
+		}
+		s.fillFutures(o, price)
+	}
+}
+
+func (s *Server) createFuturesOrder(r *http.Request) (*futuresOrder, error) {
+	p := &params{r: r}
+	pair := p.string("symbol")
+	side := futures.SideType(p.string("side"))
+	kind := futures.OrderType(p.string("type"))
+	if p.err != nil {
+		return nil, p.err
+	}
+	if _, ok := s.assetsInfo[pair]; !ok {
+		return nil, errInvalidSymbol
+	}
+	if side != futures.SideTypeBuy && side != futures.SideTypeSell {
+		return nil, errInvalidSide
+	}
+
+	positionSide := futures.PositionSideType(r.FormValue("positionSide"))
+	if positionSide == "" {
+		positionSide = futures.PositionSideTypeBoth
+	}
+	if s.futures.dualSide == (positionSide == futures.PositionSideTypeBoth) {
+		return nil, errPositionSide
+	}
+	reduceOnly := r.FormValue("reduceOnly") == "true"
+	if reduceOnly && s.futures.dualSide {
+		return nil, errReduceOnlyNotRequired
+	}
+
+	s.counter++
+	clientID := r.FormValue("newClientOrderId")
+	if clientID == "" {
+		clientID = fmt.Sprintf("fake%d", s.counter)
+	}
+
+	now := time.Now()
+	o := &futuresOrder{
+		id:           s.counter,
+		clientID:     clientID,
+		pair:         pair,
+		side:         side,
+		positionSide: positionSide,
+		kind:         kind,
+		status:       futures.OrderStatusTypeNew,
+		reduceOnly:   reduceOnly,
+		createdAt:    now,
+		updatedAt:    now,
+	}
+
+	switch kind {
+	case futures.OrderTypeMarket:
+		o.quantity = p.float("quantity")
+	case futures.OrderTypeLimit:
+		o.quantity = p.float("quantity")
+		o.price = p.float("price")
+	case futures.OrderTypeStopMarket, futures.OrderTypeTakeProfitMarket:
+		o.quantity = p.float("quantity")
+		o.stop = p.float("stopPrice")
+	case futures.OrderTypeTrailingStopMarket:
+		o.quantity = p.float("quantity")
+		o.callbackRate = p.float("callbackRate")
+		if o.callbackRate < 0.1 || o.callbackRate > 5 {
+			return nil, errInvalidCallbackRate
+		}
+		o.activation = s.lastPrice[pair]
+		if value := r.FormValue("activationPrice"); value != "" {
+			o.activation = p.float("activationPrice")
+		}
+		o.extreme = o.activation
+		o.trail(model.Candle{High: o.activation, Low: o.activation})
+	default:
+		return nil, errInvalidType
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	if err := s.checkFilters(pair, o.quantity, o.price, o.stop); err != nil {
+		return nil, err
+	}
+
+	last := s.lastPrice[pair]
+	price := o.orderPrice()
+	if price == 0 {
+		price = last
+	}
+
+	if s.reduces(o) {
+		if s.reducible(o) == 0 {
+			return nil, errReduceOnly
+		}
+	} else {
+		opened := o.quantity - s.reducible(o)
+		if opened*price/float64(s.leverage(pair)) > s.availableMargin(s.assetsInfo[pair].QuoteAsset) {
+			return nil, errInsufficientMargin
+		}
+	}
+
+	buy := side == futures.SideTypeBuy
+	switch kind {
+	case futures.OrderTypeMarket:
+		s.fillFutures(o, last)
+	case futures.OrderTypeLimit:
+		if buy && o.price >= last || !buy && o.price <= last {
+			s.fillFutures(o, last)
+		}
+	case futures.OrderTypeStopMarket:
+		if buy && o.stop <= last || !buy && o.stop >= last {
+			return nil, errWouldTrigger
+		}
+	case futures.OrderTypeTakeProfitMarket:
+		if buy && o.stop >= last || !buy && o.stop <= last {
+			return nil, errWouldTrigger
+		}
+	}
+
+	s.futures.orders = append(s.futures.orders, o)
+	return o, nil
+}
+
+func (s *Server) findFuturesOrder(r *http.Request) (*futuresOrder, error) {
+	pair := r.FormValue("symbol")
+	id := parseInt(r.FormValue("orderId"))
+	clientID := r.FormValue("origClientOrderId")
+	if id == 0 && clientID == "" {
+		return nil, errMandatory("orderId")
+	}
+
+	for _, o := range s.futures.orders {
+		if o.pair != pair {
+			continue
+		}
+		if id != 0 && o.id == id || id == 0 && o.clientID == clientID {
+			return o, nil
+		}
+	}
+	return nil, errOrderNotFound
+}
+
+func (s *Server) handleFuturesExchangeInfo(w http.ResponseWriter, _ *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	pairs := s.pairs()
+
+	info := futures.ExchangeInfo{
+		Timezone:   "UTC",
+		ServerTime: milliseconds(time.Now()),
+		Symbols:    make([]futures.Symbol, 0, len(pairs)),
+	}
+	for _, pair := range pairs {
+		asset := s.assetsInfo[pair]
+		info.Symbols = append(info.Symbols, futures.Symbol{
+			Symbol:            pair,
+			Pair:              pair,
+			ContractType:      "PERPETUAL",
+			Status:            "TRADING",
+			PricePrecision:    int(asset.PriceDecimalPrecision),
+			QuantityPrecision: int(asset.QtyDecimalPrecision),
+			BaseAsset:         asset.BaseAsset,
+			QuoteAsset:        asset.QuoteAsset,
+			MarginAsset:       asset.QuoteAsset,
+			Filters: []map[string]interface{}{
+				{
+					"filterType": string(futures.SymbolFilterTypePrice),
+					"minPrice":   formatFloat(asset.MinPrice),
+					"maxPrice":   formatFloat(asset.MaxPrice),
+					"tickSize":   formatFloat(asset.TickSize),
+				},
+				{
+					"filterType": string(futures.SymbolFilterTypeLotSize),
+					"minQty":     formatFloat(asset.MinQuantity),
+					"maxQty":     formatFloat(asset.MaxQuantity),
+					"stepSize":   formatFloat(asset.StepSize),
+				},
+				{
+					"filterType": string(futures.SymbolFilterTypeMinNotional),
+					"notional":   formatFloat(asset.MinNotional),
+				},
+			},
+		})
+	}
+	writeJSON(w, info)
+}
+
+// nextFunding is the first funding time after t
+func nextFunding(t time.Time) time.Time {
+	return t.Truncate(fundingInterval).Add(fundingInterval)
+}
+
+func (s *Server) premiumIndex(pair string) *futures.PremiumIndex {
+	now := time.Now()
+	return &futures.PremiumIndex{
+		Symbol:          pair,
+		MarkPrice:       formatFloat(s.lastPrice[pair]),
+		LastFundingRate: formatFloat(s.futures.funding[pair]),
+		NextFundingTime: milliseconds(nextFunding(now)),
+		Time:            milliseconds(now),
+	}
+}
+
+// handlePremiumIndex returns the mark price and the funding rate of a pair, or of all the pairs
+func (s *Server) handlePremiumIndex(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	if pair := r.FormValue("symbol"); pair != "" {
+		if _, ok := s.assetsInfo[pair]; !ok {
+			writeAPIError(w, errInvalidSymbol)
+			return
+		}
+		writeJSON(w, s.premiumIndex(pair))
+		return
+	}
+
+	indexes := make([]*futures.PremiumIndex, 0, len(s.assetsInfo))
+	for _, pair := range s.pairs() {
+		indexes = append(indexes, s.premiumIndex(pair))
+	}
+	writeJSON(w, indexes)
+}
+
+// handleFundingRate returns the fundings of the period at the configured rate,
+// the most recent ones without a start time
+func (s *Server) handleFundingRate(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	p := &params{r: r}
+	pair := p.string("symbol")
+	if p.err != nil {
+		writeAPIError(w, p.err)
+		return
+	}
+
+	limit := 100
+	if value := r.FormValue("limit"); value != "" {
+		limit = int(parseInt(value))
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+
+	end := time.Now()
+	if value := r.FormValue("endTime"); value != "" {
+		end = time.Unix(0, parseInt(value)*int64(time.Millisecond))
+	}
+	start := end.Truncate(fundingInterval).Add(-time.Duration(limit-1) * fundingInterval)
+	if value := r.FormValue("startTime"); value != "" {
+		start = nextFunding(time.Unix(0, (parseInt(value)-1)*int64(time.Millisecond)))
+	}
+
+	rates := make([]*futures.FundingRate, 0, limit)
+	for t := start; !t.After(end) && len(rates) < limit; t = t.Add(fundingInterval) {
+		rates = append(rates, &futures.FundingRate{
+			Symbol:      pair,
+			FundingRate: formatFloat(s.futures.funding[pair]),
+			FundingTime: milliseconds(t),
+		})
+	}
+	writeJSON(w, rates)
+}
+
+func (s *Server) handleFuturesAccount(w http.ResponseWriter, _ *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	assets := make([]string, 0, len(s.futures.balances))
+	for asset := range s.futures.balances {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+
+	account := futures.Account{
+		CanDeposit:  true,
+		CanTrade:    true,
+		CanWithdraw: true,
+		UpdateTime:  milliseconds(time.Now()),
+	}
+	var totals [6]float64
+	for _, asset := range assets {
+		wallet := s.futures.balances[asset]
+		unrealized, positionMargin, orderMargin, maintMargin := s.margins(asset)
+		available := wallet + unrealized - positionMargin - orderMargin
+		account.Assets = append(account.Assets, &futures.AccountAsset{
+			Asset:                  asset,
+			InitialMargin:          formatFloat(positionMargin + orderMargin),
+			MaintMargin:            formatFloat(maintMargin),
+			MarginBalance:          formatFloat(wallet + unrealized),
+			MaxWithdrawAmount:      formatFloat(math.Max(0, available)),
+			OpenOrderInitialMargin: formatFloat(orderMargin),
+			PositionInitialMargin:  formatFloat(positionMargin),
+			UnrealizedProfit:       formatFloat(unrealized),
+			WalletBalance:          formatFloat(wallet),
+		})
+		for i, value := range []float64{wallet, unrealized, positionMargin, orderMargin, maintMargin, available} {
+			totals[i] += value
+		}
+	}
+	account.TotalWalletBalance = formatFloat(totals[0])
+	account.TotalUnrealizedProfit = formatFloat(totals[1])
+	account.TotalMarginBalance = formatFloat(totals[0] + totals[1])
+	account.TotalPositionInitialMargin = formatFloat(totals[2])
+	account.TotalOpenOrderInitialMargin = formatFloat(totals[3])
+	account.TotalInitialMargin = formatFloat(totals[2] + totals[3])
+	account.TotalMaintMargin = formatFloat(totals[4])
+	account.MaxWithdrawAmount = formatFloat(math.Max(0, totals[5]))
+
+	for _, p := range s.sortedPositions("") {
+		if p.amount == 0 {
+			continue
+		}
+		mark := s.lastPrice[p.pair]
+		account.Positions = append(account.Positions, &futures.AccountPosition{
+			Isolated:              s.futures.marginType[p.pair] == futures.MarginTypeIsolated,
+			Leverage:              strconv.Itoa(s.leverage(p.pair)),
+			InitialMargin:         formatFloat(math.Abs(p.amount) * mark / float64(s.leverage(p.pair))),
+			MaintMargin:           formatFloat(math.Abs(p.amount) * mark * maintenanceRate),
+			PositionInitialMargin: formatFloat(math.Abs(p.amount) * mark / float64(s.leverage(p.pair))),
+			Symbol:                p.pair,
+			UnrealizedProfit:      formatFloat(p.amount * (mark - p.entry)),
+			EntryPrice:            formatFloat(p.entry),
+			PositionSide:          p.side,
+			PositionAmt:           formatFloat(p.amount),
+			Notional:              formatFloat(p.amount * mark),
+			UpdateTime:            milliseconds(time.Now()),
+		})
+	}
+	writeJSON(w, account)
+}
+
+// liquidationPrice is the price where the margin of the position reaches the maintenance
+// margin, cross positions use the whole wallet balance and ignore the other positions
+func (s *Server) liquidationPrice(p *position) float64 {
+	if p.amount == 0 {
+		return 0
+	}
+
+	margin := s.futures.balances[s.assetsInfo[p.pair].QuoteAsset]
+	if s.futures.marginType[p.pair] == futures.MarginTypeIsolated {
+		margin = math.Abs(p.amount) * p.entry / float64(s.leverage(p.pair))
+	}
+	price := (p.amount*p.entry - margin) / (p.amount - maintenanceRate*math.Abs(p.amount))
+	return math.Max(0, price)
+}
+
+func (s *Server) handlePositionRisk(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	pair := r.FormValue("symbol")
+	if _, ok := s.assetsInfo[pair]; pair != "" && !ok {
+		writeAPIError(w, errInvalidSymbol)
+		return
+	}
+
+	risks := make([]*futures.PositionRisk, 0)
+	for _, p := range s.sortedPositions(pair) {
+		marginType := "cross"
+		var isolated float64
+		if s.futures.marginType[p.pair] == futures.MarginTypeIsolated {
+			marginType = "isolated"
+			isolated = math.Abs(p.amount) * p.entry / float64(s.leverage(p.pair))
+		}
+
+		mark := s.lastPrice[p.pair]
+		risks = append(risks, &futures.PositionRisk{
+			EntryPrice:       formatFloat(p.entry),
+			MarginType:       marginType,
+			IsAutoAddMargin:  "false",
+			IsolatedMargin:   formatFloat(isolated),
+			Leverage:         strconv.Itoa(s.leverage(p.pair)),
+			LiquidationPrice: formatFloat(s.liquidationPrice(p)),
+			MarkPrice:        formatFloat(mark),
+			MaxNotionalValue: "1000000",
+			PositionAmt:      formatFloat(p.amount),
+			Symbol:           p.pair,
+			UnRealizedProfit: formatFloat(p.amount * (mark - p.entry)),
+			PositionSide:     string(p.side),
+			Notional:         formatFloat(p.amount * mark),
+			IsolatedWallet:   formatFloat(isolated),
+		})
+	}
+	writeJSON(w, risks)
+}
+
+func (s *Server) handleFuturesOrder(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	switch r.Method {
+	case http.MethodPost:
+		if s.fail(w, false) {
+			return
+		}
+		o, err := s.createFuturesOrder(r)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		if s.fail(w, true) {
+			return
+		}
+
+		order := o.futuresOrder()
+		writeJSON(w, futures.CreateOrderResponse{
+			Symbol:           order.Symbol,
+			OrderID:          order.OrderID,
+			ClientOrderID:    order.ClientOrderID,
+			Price:            order.Price,
+			OrigQuantity:     order.OrigQuantity,
+			ExecutedQuantity: order.ExecutedQuantity,
+			CumQuote:         order.CumQuote,
+			ReduceOnly:       order.ReduceOnly,
+			Status:           order.Status,
+			StopPrice:        order.StopPrice,
+			TimeInForce:      order.TimeInForce,
+			Type:             order.Type,
+			Side:             order.Side,
+			UpdateTime:       order.UpdateTime,
+			WorkingType:      order.WorkingType,
+			ActivatePrice:    order.ActivatePrice,
+			PriceRate:        order.PriceRate,
+			AvgPrice:         order.AvgPrice,
+			PositionSide:     order.PositionSide,
+		})
+	case http.MethodGet:
+		o, err := s.findFuturesOrder(r)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeJSON(w, o.futuresOrder())
+	case http.MethodDelete:
+		o, err := s.findFuturesOrder(r)
+		if err == errOrderNotFound || err == nil && o.status != futures.OrderStatusTypeNew {
+			err = errUnknownOrder
+		}
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		o.status = futures.OrderStatusTypeCanceled
+		o.updatedAt = time.Now()
+
+		order := o.futuresOrder()
+		writeJSON(w, futures.CancelOrderResponse{
+			ClientOrderID:    order.ClientOrderID,
+			CumQuantity:      order.CumQuantity,
+			CumQuote:         order.CumQuote,
+			ExecutedQuantity: order.ExecutedQuantity,
+			OrderID:          order.OrderID,
+			OrigQuantity:     order.OrigQuantity,
+			Price:            order.Price,
+			ReduceOnly:       order.ReduceOnly,
+			Side:             order.Side,
+			Status:           order.Status,
+			StopPrice:        order.StopPrice,
+			Symbol:           order.Symbol,
+			TimeInForce:      order.TimeInForce,
+			Type:             order.Type,
+			UpdateTime:       order.UpdateTime,
+			WorkingType:      order.WorkingType,
+			OrigType:         order.OrigType,
+			PositionSide:     order.PositionSide,
+		})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleFuturesOpenOrders(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	pair := r.FormValue("symbol")
+	orders := make([]*futures.Order, 0)
+	for _, o := range s.futures.orders {
+		if o.status == futures.OrderStatusTypeNew && (pair == "" || o.pair == pair) {
+			orders = append(orders, o.futuresOrder())
+		}
+	}
+	writeJSON(w, orders)
+}
+
+// handleFuturesAllOrders returns the orders from orderId, or the most recent ones
+func (s *Server) handleFuturesAllOrders(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	p := &params{r: r}
+	pair := p.string("symbol")
+	if p.err != nil {
+		writeAPIError(w, p.err)
+		return
+	}
+
+	limit := 500
+	if value := r.FormValue("limit"); value != "" {
+		limit = int(parseInt(value))
+	}
+	from := parseInt(r.FormValue("orderId"))
+
+	orders := make([]*futures.Order, 0)
+	for _, o := range s.futures.orders {
+		if o.pair == pair && o.id >= from {
+			orders = append(orders, o.futuresOrder())
+		}
+	}
+	if len(orders) > limit {
+		if from > 0 {
+			orders = orders[:limit]
+		} else {
+			orders = orders[len(orders)-limit:]
+		}
+	}
+	writeJSON(w, orders)
+}
+
+func (s *Server) handleLeverage(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	p := &params{r: r}
+	pair := p.string("symbol")
+	leverage := int(p.float("leverage"))
+	if p.err != nil {
+		writeAPIError(w, p.err)
+		return
+	}
+	if _, ok := s.assetsInfo[pair]; !ok {
+		writeAPIError(w, errInvalidSymbol)
+		return
+	}
+	if leverage < 1 || leverage > 125 {
+		writeAPIError(w, &apiError{http.StatusBadRequest, -4028, fmt.Sprintf("Leverage %d is not valid", leverage)})
+		return
+	}
+
+	s.futures.leverage[pair] = leverage
+	writeJSON(w, futures.SymbolLeverage{
+		Leverage:         leverage,
+		MaxNotionalValue: "1000000",
+		Symbol:           pair,
+	})
+}
+
+// hasPosition tells if the pair, or any pair, has an open position or order
+func (s *Server) hasPosition(pair string) bool {
+	for _, p := range s.futures.positions {
+		if p.amount != 0 && (pair == "" || p.pair == pair) {
+			return true
+		}
+	}
+	for _, o := range s.futures.orders {
+		if o.status == futures.OrderStatusTypeNew && (pair == "" || o.pair == pair) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleMarginType(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	p := &params{r: r}
+	pair := p.string("symbol")
+	marginType := futures.MarginType(p.string("marginType"))
+	if p.err != nil {
+		writeAPIError(w, p.err)
+		return
+	}
+	if _, ok := s.assetsInfo[pair]; !ok {
+		writeAPIError(w, errInvalidSymbol)
+		return
+	}
+
+	current, ok := s.futures.marginType[pair]
+	if !ok {
+		current = futures.MarginTypeCrossed
+	}
+	switch {
+	case marginType != futures.MarginTypeCrossed && marginType != futures.MarginTypeIsolated:
+		writeAPIError(w, errMandatory("marginType"))
+	case marginType == current:
+		writeAPIError(w, errNoNeedMarginType)
+	case s.hasPosition(pair):
+		writeAPIError(w, errMarginTypePosition)
+	default:
+		s.futures.marginType[pair] = marginType
+		writeJSON(w, map[string]interface{}{"code": 200, "msg": "success"})
+	}
+}
+
+func (s *Server) handlePositionMode(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	if r.Method == http.MethodGet {
+		writeJSON(w, futures.PositionMode{DualSidePosition: s.futures.dualSide})
+		return
+	}
+
+	p := &params{r: r}
+	dualSide := p.string("dualSidePosition") == "true"
+	switch {
+	case p.err != nil:
+		writeAPIError(w, p.err)
+	case dualSide == s.futures.dualSide:
+		writeAPIError(w, errNoNeedPositionSide)
+	case s.hasPosition(""):
+		writeAPIError(w, errPositionSidePosition)
+	default:
+		s.futures.dualSide = dualSide
+		writeJSON(w, map[string]interface{}{"code": 200, "msg": "success"})
+	}
+}
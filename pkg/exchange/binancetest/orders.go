@@ -0,0 +1,627 @@
+package binancetest
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/lynbklk/tradebot/pkg/model"
+)
+
+// funds locked by an open order, shared by the orders of an oco list
+type funds struct {
+	asset  string
+	amount float64
+}
+
+type order struct {
+	id        int64
+	listID    int64
+	clientID  string
+	pair      string
+	side      binance.SideType
+	kind      binance.OrderType
+	status    binance.OrderStatusType
+	price     float64
+	stop      float64
+	quantity  float64
+	executed  float64
+	cost      float64
+	locked    *funds
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+func (o *order) binanceOrder() *binance.Order {
+	var timeInForce binance.TimeInForceType
+	if o.kind == binance.OrderTypeLimit || o.kind == binance.OrderTypeStopLossLimit {
+		timeInForce = binance.TimeInForceTypeGTC
+	}
+
+	return &binance.Order{
+		Symbol:                   o.pair,
+		OrderID:                  o.id,
+		OrderListId:              o.listID,
+		ClientOrderID:            o.clientID,
+		Price:                    formatFloat(o.price),
+		OrigQuantity:             formatFloat(o.quantity),
+		ExecutedQuantity:         formatFloat(o.executed),
+		CummulativeQuoteQuantity: formatFloat(o.cost),
+		Status:                   o.status,
+		TimeInForce:              timeInForce,
+		Type:                     o.kind,
+		Side:                     o.side,
+		StopPrice:                formatFloat(o.stop),
+		IcebergQuantity:          "0",
+		Time:                     milliseconds(o.createdAt),
+		UpdateTime:               milliseconds(o.updatedAt),
+		IsWorking:                o.status == binance.OrderStatusTypeNew,
+		OrigQuoteOrderQuantity:   "0",
+	}
+}
+
+func (o *order) report() *binance.OCOOrderReport {
+	order := o.binanceOrder()
+	return &binance.OCOOrderReport{
+		Symbol:                   order.Symbol,
+		OrderID:                  order.OrderID,
+		OrderListID:              order.OrderListId,
+		ClientOrderID:            order.ClientOrderID,
+		TransactionTime:          order.Time,
+		Price:                    order.Price,
+		OrigQuantity:             order.OrigQuantity,
+		ExecutedQuantity:         order.ExecutedQuantity,
+		CummulativeQuoteQuantity: order.CummulativeQuoteQuantity,
+		Status:                   order.Status,
+		TimeInForce:              order.TimeInForce,
+		Type:                     order.Type,
+		Side:                     order.Side,
+		StopPrice:                order.StopPrice,
+		IcebergQuantity:          order.IcebergQuantity,
+	}
+}
+
+// triggered returns the execution price when the candle reaches the order
+func (o *order) triggered(candle model.Candle) (float64, bool) {
+	switch o.kind {
+	case binance.OrderTypeLimit, binance.OrderTypeLimitMaker:
+		if o.side == binance.SideTypeBuy && candle.Low <= o.price ||
+			o.side == binance.SideTypeSell && candle.High >= o.price {
+			return o.price, true
+		}
+	case binance.OrderTypeStopLoss, binance.OrderTypeStopLossLimit:
+		if o.side == binance.SideTypeBuy && candle.High >= o.stop ||
+			o.side == binance.SideTypeSell && candle.Low <= o.stop {
+			if o.kind == binance.OrderTypeStopLoss {
+				return o.stop, true
+			}
+			return o.price, true
+		}
+	}
+	return 0, false
+}
+
+// updatePrice moves the market of the pair to the candle, filling the open orders it reaches
+func (s *Server) updatePrice(pair string, candle model.Candle) {
+	s.lastPrice[pair] = candle.Close
+	for _, o := range s.orders {
+		if o.pair != pair || o.status != binance.OrderStatusTypeNew {
+			continue
+		}
+		price, ok := o.triggered(candle)
+		if !ok {
+			continue
+		}
+
+		s.fill(o, price)
+		if o.listID < 0 {
+			continue
+		}
+		for _, other := range s.orders {
+			if other.listID == o.listID && other.status == binance.OrderStatusTypeNew {
+				other.status = binance.OrderStatusTypeExpired
+				other.updatedAt = o.updatedAt
+			}
+		}
+	}
+	s.updateFutures(pair, candle)
+}
+
+func (s *Server) lock(o *order, asset string, amount float64) error {
+	b := s.balance(asset)
+	if b.Free < amount {
+		return errInsufficientBalance
+	}
+	b.Free -= amount
+	b.Locked += amount
+	o.locked = &funds{asset: asset, amount: amount}
+	return nil
+}
+
+func (s *Server) release(o *order) {
+	if o.locked == nil || o.locked.amount == 0 {
+		return
+	}
+	b := s.balance(o.locked.asset)
+	b.Locked -= o.locked.amount
+	b.Free += o.locked.amount
+	o.locked.amount = 0
+}
+
+func (s *Server) fill(o *order, price float64) {
+	info := s.assetsInfo[o.pair]
+	s.release(o)
+
+	o.executed = o.quantity
+	o.cost = o.quantity * price
+	o.status = binance.OrderStatusTypeFilled
+	o.updatedAt = time.Now()
+
+	if o.side == binance.SideTypeBuy {
+		s.balance(info.QuoteAsset).Free -= o.cost
+		s.balance(info.BaseAsset).Free += o.quantity
+	} else {
+		s.balance(info.BaseAsset).Free -= o.quantity
+		s.balance(info.QuoteAsset).Free += o.cost
+	}
+}
+
+// apiError is an error response of the binance api
+type apiError struct {
+	status  int
+	code    int64
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+var (
+	errInsufficientBalance = &apiError{http.StatusBadRequest, -2010, "Account has insufficient balance for requested action."}
+	errDuplicateOrder      = &apiError{http.StatusBadRequest, -2010, "Duplicate order sent."}
+	errImmediateTrigger    = &apiError{http.StatusBadRequest, -2010, "Stop price would trigger immediately."}
+	errImmediateMatch      = &apiError{http.StatusBadRequest, -2010, "Order would immediately match and take."}
+	errPriceRelationship   = &apiError{http.StatusBadRequest, -2010, "The relationship of the prices for the orders is not correct."}
+	errUnknownOrder        = &apiError{http.StatusBadRequest, -2011, "Unknown order sent."}
+	errOrderNotFound       = &apiError{http.StatusBadRequest, -2013, "Order does not exist."}
+	errInvalidSymbol       = &apiError{http.StatusBadRequest, -1121, "Invalid symbol."}
+	errInvalidSide         = &apiError{http.StatusBadRequest, -1117, "Invalid side."}
+	errInvalidType         = &apiError{http.StatusBadRequest, -1116, "Invalid orderType."}
+	errLotSize             = &apiError{http.StatusBadRequest, -1013, "Filter failure: LOT_SIZE"}
+	errPriceFilter         = &apiError{http.StatusBadRequest, -1013, "Filter failure: PRICE_FILTER"}
+	errTimeout             = &apiError{http.StatusServiceUnavailable, -1007,
+		"Timeout waiting for response from backend server. Send status unknown; execution status unknown."}
+)
+
+func errMandatory(param string) error {
+	return &apiError{http.StatusBadRequest, -1102,
+		fmt.Sprintf("Mandatory parameter '%s' was not sent, was empty/null, or malformed.", param)}
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	if e, ok := err.(*apiError); ok {
+		writeError(w, e.status, e.code, e.message)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, -1000, err.Error())
+}
+
+// params reads the request parameters, both from query and form body
+type params struct {
+	r   *http.Request
+	err error
+}
+
+func (p *params) string(name string) string {
+	value := p.r.FormValue(name)
+	if value == "" && p.err == nil {
+		p.err = errMandatory(name)
+	}
+	return value
+}
+
+func (p *params) float(name string) float64 {
+	value := p.string(name)
+	if value == "" {
+		return 0
+	}
+	result := parseFloat(value)
+	if result <= 0 && p.err == nil {
+		p.err = errMandatory(name)
+	}
+	return result
+}
+
+func (s *Server) newOrder(pair string, side binance.SideType, kind binance.OrderType, clientID string) (*order, error) {
+	if _, ok := s.assetsInfo[pair]; !ok {
+		return nil, errInvalidSymbol
+	}
+	if side != binance.SideTypeBuy && side != binance.SideTypeSell {
+		return nil, errInvalidSide
+	}
+
+	s.counter++
+	if clientID == "" {
+		clientID = fmt.Sprintf("fake%d", s.counter)
+	}
+	for _, o := range s.orders {
+		if o.clientID == clientID && o.status == binance.OrderStatusTypeNew {
+			return nil, errDuplicateOrder
+		}
+	}
+
+	now := time.Now()
+	o := &order{
+		id:        s.counter,
+		listID:    -1,
+		clientID:  clientID,
+		pair:      pair,
+		side:      side,
+		kind:      kind,
+		status:    binance.OrderStatusTypeNew,
+		createdAt: now,
+		updatedAt: now,
+	}
+	return o, nil
+}
+
+func (s *Server) validate(o *order) error {
+	return s.checkFilters(o.pair, o.quantity, o.price, o.stop)
+}
+
+// checkFilters validates the quantity and the prices of an order, zero prices are not set
+func (s *Server) checkFilters(pair string, quantity float64, prices ...float64) error {
+	info := s.assetsInfo[pair]
+	if quantity < info.MinQuantity || quantity > info.MaxQuantity {
+		return errLotSize
+	}
+	for _, price := range prices {
+		if price != 0 && (price < info.MinPrice || price > info.MaxPrice) {
+			return errPriceFilter
+		}
+	}
+	return nil
+}
+
+// lockOrder locks the funds of an order resting in the book, buy orders lock the quote asset
+func (s *Server) lockOrder(o *order, price float64) error {
+	info := s.assetsInfo[o.pair]
+	if o.side == binance.SideTypeBuy {
+		return s.lock(o, info.QuoteAsset, o.quantity*price)
+	}
+	return s.lock(o, info.BaseAsset, o.quantity)
+}
+
+func (s *Server) createOrder(r *http.Request) (*order, error) {
+	p := &params{r: r}
+	pair := p.string("symbol")
+	side := binance.SideType(p.string("side"))
+	kind := binance.OrderType(p.string("type"))
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	o, err := s.newOrder(pair, side, kind, r.FormValue("newClientOrderId"))
+	if err != nil {
+		return nil, err
+	}
+
+	last := s.lastPrice[pair]
+	switch kind {
+	case binance.OrderTypeMarket:
+		if quote := r.FormValue("quoteOrderQty"); quote != "" && last > 0 {
+			o.quantity = parseFloat(quote) / last
+		} else {
+			o.quantity = p.float("quantity")
+		}
+	case binance.OrderTypeLimit, binance.OrderTypeLimitMaker:
+		o.quantity = p.float("quantity")
+		o.price = p.float("price")
+	case binance.OrderTypeStopLoss:
+		o.quantity = p.float("quantity")
+		o.stop = p.float("stopPrice")
+	case binance.OrderTypeStopLossLimit:
+		o.quantity = p.float("quantity")
+		o.price = p.float("price")
+		o.stop = p.float("stopPrice")
+	default:
+		return nil, errInvalidType
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	if err := s.validate(o); err != nil {
+		return nil, err
+	}
+
+	info := s.assetsInfo[pair]
+	crossed := o.side == binance.SideTypeBuy && o.price >= last || o.side == binance.SideTypeSell && o.price <= last
+	switch kind {
+	case binance.OrderTypeMarket:
+		if side == binance.SideTypeBuy && s.balance(info.QuoteAsset).Free < o.quantity*last ||
+			side == binance.SideTypeSell && s.balance(info.BaseAsset).Free < o.quantity {
+			return nil, errInsufficientBalance
+		}
+		s.fill(o, last)
+	case binance.OrderTypeLimit, binance.OrderTypeLimitMaker:
+		if crossed && kind == binance.OrderTypeLimitMaker {
+			return nil, errImmediateMatch
+		}
+		if err := s.lockOrder(o, o.price); err != nil {
+			return nil, err
+		}
+		if crossed {
+			s.fill(o, last)
+		}
+	case binance.OrderTypeStopLoss, binance.OrderTypeStopLossLimit:
+		if o.side == binance.SideTypeBuy && o.stop <= last || o.side == binance.SideTypeSell && o.stop >= last {
+			return nil, errImmediateTrigger
+		}
+		price := o.price
+		if price == 0 {
+			price = o.stop
+		}
+		if err := s.lockOrder(o, price); err != nil {
+			return nil, err
+		}
+	}
+
+	s.orders = append(s.orders, o)
+	return o, nil
+}
+
+func (s *Server) findOrder(r *http.Request) (*order, error) {
+	pair := r.FormValue("symbol")
+	id := parseInt(r.FormValue("orderId"))
+	clientID := r.FormValue("origClientOrderId")
+	if id == 0 && clientID == "" {
+		return nil, errMandatory("orderId")
+	}
+
+	for _, o := range s.orders {
+		if o.pair != pair {
+			continue
+		}
+		if id != 0 && o.id == id || id == 0 && o.clientID == clientID {
+			return o, nil
+		}
+	}
+	return nil, errOrderNotFound
+}
+
+func (s *Server) handleOrder(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	switch r.Method {
+	case http.MethodPost:
+		if s.fail(w, false) {
+			return
+		}
+		o, err := s.createOrder(r)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		if s.fail(w, true) {
+			return
+		}
+
+		order := o.binanceOrder()
+		response := binance.CreateOrderResponse{
+			Symbol:                   order.Symbol,
+			OrderID:                  order.OrderID,
+			ClientOrderID:            order.ClientOrderID,
+			TransactTime:             order.Time,
+			Price:                    order.Price,
+			OrigQuantity:             order.OrigQuantity,
+			ExecutedQuantity:         order.ExecutedQuantity,
+			CummulativeQuoteQuantity: order.CummulativeQuoteQuantity,
+			Status:                   order.Status,
+			TimeInForce:              order.TimeInForce,
+			Type:                     order.Type,
+			Side:                     order.Side,
+		}
+		if o.status == binance.OrderStatusTypeFilled {
+			response.Fills = []*binance.Fill{{
+				Price:           formatFloat(o.cost / o.executed),
+				Quantity:        order.ExecutedQuantity,
+				Commission:      "0",
+				CommissionAsset: s.assetsInfo[o.pair].QuoteAsset,
+			}}
+		}
+		writeJSON(w, response)
+	case http.MethodGet:
+		o, err := s.findOrder(r)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeJSON(w, o.binanceOrder())
+	case http.MethodDelete:
+		o, err := s.findOrder(r)
+		if err == errOrderNotFound || err == nil && o.status != binance.OrderStatusTypeNew {
+			err = errUnknownOrder
+		}
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		for _, other := range s.orders {
+			if other == o || o.listID >= 0 && other.listID == o.listID && other.status == binance.OrderStatusTypeNew {
+				s.release(other)
+				other.status = binance.OrderStatusTypeCanceled
+				other.updatedAt = time.Now()
+			}
+		}
+
+		order := o.binanceOrder()
+		writeJSON(w, binance.CancelOrderResponse{
+			Symbol:                   order.Symbol,
+			OrigClientOrderID:        order.ClientOrderID,
+			OrderID:                  order.OrderID,
+			OrderListID:              order.OrderListId,
+			ClientOrderID:            order.ClientOrderID,
+			TransactTime:             order.UpdateTime,
+			Price:                    order.Price,
+			OrigQuantity:             order.OrigQuantity,
+			ExecutedQuantity:         order.ExecutedQuantity,
+			CummulativeQuoteQuantity: order.CummulativeQuoteQuantity,
+			Status:                   order.Status,
+			TimeInForce:              order.TimeInForce,
+			Type:                     order.Type,
+			Side:                     order.Side,
+		})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleOrderOCO creates a limit maker and a stop loss sharing the same locked funds
+func (s *Server) handleOrderOCO(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.fail(w, false) {
+		return
+	}
+
+	p := &params{r: r}
+	pair := p.string("symbol")
+	side := binance.SideType(p.string("side"))
+	quantity := p.float("quantity")
+	price := p.float("price")
+	stop := p.float("stopPrice")
+	if p.err != nil {
+		writeAPIError(w, p.err)
+		return
+	}
+
+	stopKind := binance.OrderTypeStopLoss
+	stopLimit := parseFloat(r.FormValue("stopLimitPrice"))
+	if stopLimit > 0 {
+		stopKind = binance.OrderTypeStopLossLimit
+	}
+
+	last := s.lastPrice[pair]
+	if side == binance.SideTypeSell && !(price > last && last > stop) ||
+		side == binance.SideTypeBuy && !(price < last && last < stop) {
+		writeAPIError(w, errPriceRelationship)
+		return
+	}
+
+	stopOrder, err := s.newOrder(pair, side, stopKind, r.FormValue("stopClientOrderId"))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	stopOrder.quantity, stopOrder.price, stopOrder.stop = quantity, stopLimit, stop
+
+	limitOrder, err := s.newOrder(pair, side, binance.OrderTypeLimitMaker, r.FormValue("limitClientOrderId"))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	limitOrder.quantity, limitOrder.price = quantity, price
+
+	for _, o := range []*order{stopOrder, limitOrder} {
+		if err := s.validate(o); err != nil {
+			writeAPIError(w, err)
+			return
+		}
+	}
+
+	lockPrice := math.Max(price, math.Max(stop, stopLimit))
+	if err := s.lockOrder(limitOrder, lockPrice); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	s.lists++
+	stopOrder.listID, limitOrder.listID = s.lists, s.lists
+	stopOrder.locked = limitOrder.locked
+	s.orders = append(s.orders, stopOrder, limitOrder)
+	if s.fail(w, true) {
+		return
+	}
+
+	listClientID := r.FormValue("listClientOrderId")
+	if listClientID == "" {
+		listClientID = fmt.Sprintf("fakelist%d", s.lists)
+	}
+
+	response := binance.CreateOCOResponse{
+		OrderListID:       s.lists,
+		ContingencyType:   "OCO",
+		ListStatusType:    "EXEC_STARTED",
+		ListOrderStatus:   "EXECUTING",
+		ListClientOrderID: listClientID,
+		TransactionTime:   milliseconds(limitOrder.createdAt),
+		Symbol:            pair,
+	}
+	for _, o := range []*order{stopOrder, limitOrder} {
+		response.Orders = append(response.Orders, &binance.OCOOrder{
+			Symbol:        o.pair,
+			OrderID:       o.id,
+			ClientOrderID: o.clientID,
+		})
+		response.OrderReports = append(response.OrderReports, o.report())
+	}
+	writeJSON(w, response)
+}
+
+func (s *Server) handleOpenOrders(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	pair := r.FormValue("symbol")
+	orders := make([]*binance.Order, 0)
+	for _, o := range s.orders {
+		if o.status == binance.OrderStatusTypeNew && (pair == "" || o.pair == pair) {
+			orders = append(orders, o.binanceOrder())
+		}
+	}
+	writeJSON(w, orders)
+}
+
+// handleAllOrders returns the orders from orderId, or the most recent ones
+func (s *Server) handleAllOrders(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	p := &params{r: r}
+	pair := p.string("symbol")
+	if p.err != nil {
+		writeAPIError(w, p.err)
+		return
+	}
+
+	limit := 500
+	if value := r.FormValue("limit"); value != "" {
+		limit = int(parseInt(value))
+	}
+	from := parseInt(r.FormValue("orderId"))
+
+	orders := make([]*binance.Order, 0)
+	for _, o := range s.orders {
+		if o.pair == pair && o.id >= from {
+			orders = append(orders, o.binanceOrder())
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].OrderID < orders[j].OrderID
+	})
+	if len(orders) > limit {
+		if from > 0 {
+			orders = orders[:limit]
+		} else {
+			orders = orders[len(orders)-limit:]
+		}
+	}
+	writeJSON(w, orders)
+}
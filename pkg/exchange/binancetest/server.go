@@ -0,0 +1,545 @@
+// Package binancetest provides an in-process fake of the Binance API for tests,
+// serving the REST endpoints and kline streams used by go-binance from csv candles.
+package binancetest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/gorilla/websocket"
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/util"
+)
+
+// quoteAssets are used to split pairs without asset info, in order of precedence
+var quoteAssets = []string{"USDT", "BUSD", "USDC", "BTC", "ETH", "BNB"}
+
+type balance struct {
+	Free   float64
+	Locked float64
+}
+
+// feed is the candles of a pair and timeframe, the candles before position are already closed
+type feed struct {
+	pair        string
+	timeframe   string
+	candles     []model.Candle
+	position    int
+	subscribers map[*websocket.Conn]bool
+	streaming   bool
+}
+
+type Server struct {
+	sync.Mutex
+	server     *httptest.Server
+	files      map[string]string
+	feeds      map[string]*feed
+	assetsInfo map[string]model.AssetInfo
+	balances   map[string]*balance
+	orders     []*order
+	futures    *futuresAccount
+	counter    int64
+	lists      int64
+	failures   int
+	failAfter  bool
+	lastPrice  map[string]float64
+	start      time.Time
+	interval   time.Duration
+	upgrader   websocket.Upgrader
+	done       chan struct{}
+}
+
+type Option func(*Server)
+
+// WithCsvFile replays the candles of the pair and timeframe, in the format of the download command
+func WithCsvFile(pair, timeframe, file string) Option {
+	return func(s *Server) {
+		s.files[util.PairTimeframeToKey(pair, timeframe)] = file
+	}
+}
+
+// WithAssetInfo sets the limits of a pair, pairs without it are split by a known quote asset
+func WithAssetInfo(pair string, info model.AssetInfo) Option {
+	return func(s *Server) {
+		s.assetsInfo[pair] = info
+	}
+}
+
+// WithBalance sets the free amount of an asset in the account
+func WithBalance(asset string, amount float64) Option {
+	return func(s *Server) {
+		s.balances[asset] = &balance{Free: amount}
+	}
+}
+
+// WithStartTime marks the candles closed until the given time as history,
+// available in klines requests, the following ones are streamed
+func WithStartTime(start time.Time) Option {
+	return func(s *Server) {
+		s.start = start
+	}
+}
+
+// WithStreamInterval is the delay between two streamed candles
+func WithStreamInterval(interval time.Duration) Option {
+	return func(s *Server) {
+		s.interval = interval
+	}
+}
+
+// NewServer starts the fake server, it must be closed by the caller
+func NewServer(options ...Option) (*Server, error) {
+	s := &Server{
+		files:      make(map[string]string),
+		feeds:      make(map[string]*feed),
+		assetsInfo: make(map[string]model.AssetInfo),
+		balances:   make(map[string]*balance),
+		lastPrice:  make(map[string]float64),
+		futures:    newFuturesAccount(),
+		interval:   10 * time.Millisecond,
+		done:       make(chan struct{}),
+	}
+	for _, option := range options {
+		option(s)
+	}
+
+	for key, file := range s.files {
+		pair, timeframe := util.PairTimeframeFromKey(key)
+		if err := s.load(pair, timeframe, file); err != nil {
+			return nil, err
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/ping", s.handlePing)
+	mux.HandleFunc("/api/v3/time", s.handleTime)
+	mux.HandleFunc("/api/v3/exchangeInfo", s.handleExchangeInfo)
+	mux.HandleFunc("/api/v3/klines", s.handleKlines)
+	mux.HandleFunc("/api/v3/account", s.signed(s.handleAccount))
+	mux.HandleFunc("/api/v3/order", s.signed(s.handleOrder))
+	mux.HandleFunc("/api/v3/order/oco", s.signed(s.handleOrderOCO))
+	mux.HandleFunc("/api/v3/openOrders", s.signed(s.handleOpenOrders))
+	mux.HandleFunc("/api/v3/allOrders", s.signed(s.handleAllOrders))
+	mux.HandleFunc("/fapi/v1/ping", s.handlePing)
+	mux.HandleFunc("/fapi/v1/time", s.handleTime)
+	mux.HandleFunc("/fapi/v1/exchangeInfo", s.handleFuturesExchangeInfo)
+	mux.HandleFunc("/fapi/v1/klines", s.handleKlines)
+	mux.HandleFunc("/fapi/v1/premiumIndex", s.handlePremiumIndex)
+	mux.HandleFunc("/fapi/v1/fundingRate", s.handleFundingRate)
+	mux.HandleFunc("/fapi/v1/account", s.signed(s.handleFuturesAccount))
+	mux.HandleFunc("/fapi/v2/positionRisk", s.signed(s.handlePositionRisk))
+	mux.HandleFunc("/fapi/v1/order", s.signed(s.handleFuturesOrder))
+	mux.HandleFunc("/fapi/v1/openOrders", s.signed(s.handleFuturesOpenOrders))
+	mux.HandleFunc("/fapi/v1/allOrders", s.signed(s.handleFuturesAllOrders))
+	mux.HandleFunc("/fapi/v1/leverage", s.signed(s.handleLeverage))
+	mux.HandleFunc("/fapi/v1/marginType", s.signed(s.handleMarginType))
+	mux.HandleFunc("/fapi/v1/positionSide/dual", s.signed(s.handlePositionMode))
+	mux.HandleFunc("/ws/", s.handleStream)
+	s.server = httptest.NewServer(mux)
+
+	return s, nil
+}
+
+// FailOrders fails the next count order requests with a timeout of unknown execution status,
+// after creating the orders when created is true, as if the response was lost
+func (s *Server) FailOrders(count int, created bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.failures, s.failAfter = count, created
+}
+
+// fail answers an order request with the next failure of FailOrders, before or after
+// the creation of the order
+func (s *Server) fail(w http.ResponseWriter, created bool) bool {
+	if s.failures == 0 || s.failAfter != created {
+		return false
+	}
+	s.failures--
+	writeAPIError(w, errTimeout)
+	return true
+}
+
+// URL is the base url of the REST api, streams are served under the same host
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Close stops the streams and the server
+func (s *Server) Close() {
+	s.Lock()
+	close(s.done)
+	for _, feed := range s.feeds {
+		for conn := range feed.subscribers {
+			conn.Close()
+		}
+	}
+	s.Unlock()
+	s.server.Close()
+}
+
+func (s *Server) load(pair, timeframe, file string) error {
+	csvFeed, err := exchange.NewCSVFeed(timeframe, exchange.PairFeed{
+		Pair:      pair,
+		File:      file,
+		Timeframe: timeframe,
+	})
+	if err != nil {
+		return err
+	}
+
+	duration, err := util.TimeframeDuration(timeframe)
+	if err != nil {
+		return err
+	}
+
+	candles := csvFeed.CandlePairTimeFrame[util.PairTimeframeToKey(pair, timeframe)]
+	position := sort.Search(len(candles), func(i int) bool {
+		return candles[i].Time.Add(duration).After(s.start)
+	})
+	if position > 0 {
+		s.updatePrice(pair, candles[position-1])
+	}
+
+	s.feeds[util.PairTimeframeToKey(pair, timeframe)] = &feed{
+		pair:        pair,
+		timeframe:   timeframe,
+		candles:     candles,
+		position:    position,
+		subscribers: make(map[*websocket.Conn]bool),
+	}
+	if _, ok := s.assetsInfo[pair]; !ok {
+		s.assetsInfo[pair] = defaultAssetInfo(pair)
+	}
+	return nil
+}
+
+func defaultAssetInfo(pair string) model.AssetInfo {
+	info := model.AssetInfo{
+		MinPrice:              0.01,
+		MaxPrice:              1000000,
+		MinQuantity:           0.00001,
+		MaxQuantity:           9000,
+		StepSize:              0.00001,
+		TickSize:              0.01,
+		QtyDecimalPrecision:   5,
+		PriceDecimalPrecision: 2,
+	}
+	for _, quote := range quoteAssets {
+		if strings.HasSuffix(pair, quote) && len(pair) > len(quote) {
+			info.BaseAsset = strings.TrimSuffix(pair, quote)
+			info.QuoteAsset = quote
+			break
+		}
+	}
+	return info
+}
+
+func (s *Server) signed(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-MBX-APIKEY") == "" {
+			writeError(w, http.StatusUnauthorized, -2014, "API-key format invalid.")
+			return
+		}
+
+		// go-binance sends the parameters of delete requests in the body, ignored by ParseForm
+		if r.Method == http.MethodDelete {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, -1000, err.Error())
+				return
+			}
+			r.PostForm, _ = url.ParseQuery(string(body))
+		}
+		handler(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, code int64, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(common.APIError{Code: code, Message: message})
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func milliseconds(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func (s *Server) handlePing(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, struct{}{})
+}
+
+func (s *Server) handleTime(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]int64{"serverTime": milliseconds(time.Now())})
+}
+
+func (s *Server) handleExchangeInfo(w http.ResponseWriter, _ *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	pairs := make([]string, 0, len(s.assetsInfo))
+	for pair := range s.assetsInfo {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+
+	info := binance.ExchangeInfo{
+		Timezone:   "UTC",
+		ServerTime: milliseconds(time.Now()),
+		Symbols:    make([]binance.Symbol, 0, len(pairs)),
+	}
+	for _, pair := range pairs {
+		asset := s.assetsInfo[pair]
+		info.Symbols = append(info.Symbols, binance.Symbol{
+			Symbol:               pair,
+			Status:               "TRADING",
+			BaseAsset:            asset.BaseAsset,
+			QuoteAsset:           asset.QuoteAsset,
+			OcoAllowed:           true,
+			IsSpotTradingAllowed: true,
+			Filters: []map[string]interface{}{
+				{
+					"filterType": string(binance.SymbolFilterTypePriceFilter),
+					"minPrice":   formatFloat(asset.MinPrice),
+					"maxPrice":   formatFloat(asset.MaxPrice),
+					"tickSize":   formatFloat(asset.TickSize),
+				},
+				{
+					"filterType": string(binance.SymbolFilterTypeLotSize),
+					"minQty":     formatFloat(asset.MinQuantity),
+					"maxQty":     formatFloat(asset.MaxQuantity),
+					"stepSize":   formatFloat(asset.StepSize),
+				},
+				{
+					"filterType":  string(binance.SymbolFilterTypeMinNotional),
+					"minNotional": formatFloat(asset.MinNotional),
+				},
+			},
+			Permissions: []string{"SPOT"},
+		})
+	}
+	writeJSON(w, info)
+}
+
+// handleKlines returns the closed candles and the current one, as the last element
+func (s *Server) handleKlines(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	s.Lock()
+	defer s.Unlock()
+
+	feed, ok := s.feeds[util.PairTimeframeToKey(query.Get("symbol"), query.Get("interval"))]
+	if !ok {
+		writeError(w, http.StatusBadRequest, -1121, "Invalid symbol.")
+		return
+	}
+
+	limit := 500
+	if value := query.Get("limit"); value != "" {
+		limit, _ = strconv.Atoi(value)
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+
+	duration, _ := util.TimeframeDuration(feed.timeframe)
+	available := feed.candles[:feed.position]
+	if feed.position < len(feed.candles) {
+		available = feed.candles[:feed.position+1]
+	}
+
+	candles := make([]model.Candle, 0, limit)
+	for _, candle := range available {
+		if start := query.Get("startTime"); start != "" && milliseconds(candle.Time) < parseInt(start) {
+			continue
+		}
+		if end := query.Get("endTime"); end != "" && milliseconds(candle.Time) > parseInt(end) {
+			continue
+		}
+		candles = append(candles, candle)
+	}
+	if len(candles) > limit {
+		if query.Get("startTime") != "" {
+			candles = candles[:limit]
+		} else {
+			candles = candles[len(candles)-limit:]
+		}
+	}
+
+	klines := make([][]interface{}, 0, len(candles))
+	for _, candle := range candles {
+		klines = append(klines, []interface{}{
+			milliseconds(candle.Time),
+			formatFloat(candle.Open),
+			formatFloat(candle.High),
+			formatFloat(candle.Low),
+			formatFloat(candle.Close),
+			formatFloat(candle.Volume),
+			milliseconds(candle.Time.Add(duration)) - 1,
+			formatFloat(candle.Volume * candle.Close),
+			candle.Trades,
+			"0",
+			"0",
+			"0",
+		})
+	}
+	writeJSON(w, klines)
+}
+
+func parseInt(value string) int64 {
+	result, _ := strconv.ParseInt(value, 10, 64)
+	return result
+}
+
+func parseFloat(value string) float64 {
+	result, _ := strconv.ParseFloat(value, 64)
+	return result
+}
+
+// handleStream serves /ws/<symbol>@kline_<interval>, all subscribers of a feed receive the same candles
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	stream := strings.TrimPrefix(r.URL.Path, "/ws/")
+	parts := strings.Split(stream, "@kline_")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.Lock()
+	feed, ok := s.feeds[util.PairTimeframeToKey(strings.ToUpper(parts[0]), parts[1])]
+	s.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s.Lock()
+	feed.subscribers[conn] = true
+	if !feed.streaming {
+		feed.streaming = true
+		go s.stream(feed)
+	}
+	s.Unlock()
+
+	// discard client messages until the connection is closed
+	go func() {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				s.Lock()
+				delete(feed.subscribers, conn)
+				s.Unlock()
+				conn.Close()
+				return
+			}
+		}
+	}()
+}
+
+func (s *Server) stream(feed *feed) {
+	duration, _ := util.TimeframeDuration(feed.timeframe)
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-time.After(s.interval):
+		}
+
+		s.Lock()
+		if feed.position >= len(feed.candles) {
+			s.Unlock()
+			return
+		}
+		candle := feed.candles[feed.position]
+		feed.position++
+		s.updatePrice(feed.pair, candle)
+
+		event := binance.WsKlineEvent{
+			Event:  "kline",
+			Time:   milliseconds(candle.Time.Add(duration)),
+			Symbol: feed.pair,
+			Kline: binance.WsKline{
+				StartTime: milliseconds(candle.Time),
+				EndTime:   milliseconds(candle.Time.Add(duration)) - 1,
+				Symbol:    feed.pair,
+				Interval:  feed.timeframe,
+				Open:      formatFloat(candle.Open),
+				Close:     formatFloat(candle.Close),
+				High:      formatFloat(candle.High),
+				Low:       formatFloat(candle.Low),
+				Volume:    formatFloat(candle.Volume),
+				TradeNum:  candle.Trades,
+				IsFinal:   true,
+			},
+		}
+		subscribers := make([]*websocket.Conn, 0, len(feed.subscribers))
+		for conn := range feed.subscribers {
+			subscribers = append(subscribers, conn)
+		}
+		s.Unlock()
+
+		for _, conn := range subscribers {
+			if err := conn.WriteJSON(event); err != nil {
+				conn.Close()
+			}
+		}
+	}
+}
+
+func (s *Server) balance(asset string) *balance {
+	if _, ok := s.balances[asset]; !ok {
+		s.balances[asset] = &balance{}
+	}
+	return s.balances[asset]
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, _ *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	assets := make([]string, 0, len(s.balances))
+	for asset := range s.balances {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+
+	account := binance.Account{
+		CanTrade:    true,
+		CanDeposit:  true,
+		CanWithdraw: true,
+		UpdateTime:  uint64(milliseconds(time.Now())),
+		AccountType: "SPOT",
+		Balances:    make([]binance.Balance, 0, len(assets)),
+		Permissions: []string{"SPOT"},
+	}
+	for _, asset := range assets {
+		account.Balances = append(account.Balances, binance.Balance{
+			Asset:  asset,
+			Free:   formatFloat(s.balances[asset].Free),
+			Locked: formatFloat(s.balances[asset].Locked),
+		})
+	}
+	writeJSON(w, account)
+}
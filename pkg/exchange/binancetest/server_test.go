@@ -0,0 +1,393 @@
+package binancetest
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	// the file starts at 2020-11-17 00:00 UTC, ten candles are history
+	start := time.Date(2020, 11, 17, 10, 0, 0, 0, time.UTC)
+	server, err := NewServer(
+		WithCsvFile("BTCUSDT", "1h", "../../../testdata/btc-1h.csv"),
+		WithBalance("USDT", 10000),
+		WithStartTime(start),
+		WithStreamInterval(time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("without credentials", func(t *testing.T) {
+		binance, err := exchange.NewBinance(ctx, exchange.WithBinanceBaseURL(server.URL()))
+		require.NoError(t, err)
+		require.Equal(t, "BTC", binance.GetAssetsInfo("BTCUSDT").BaseAsset)
+
+		_, err = binance.Account()
+		require.Error(t, err)
+	})
+
+	t.Run("registry refresh", func(t *testing.T) {
+		registry := exchange.NewRegistry()
+		require.NoError(t, registry.Refresh(ctx, exchange.WithBinanceBaseURL(server.URL())))
+
+		asset, quote, err := registry.Split("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, "BTC", asset)
+		require.Equal(t, "USDT", quote)
+	})
+
+	binance, err := exchange.NewBinance(ctx,
+		exchange.WithBinanceBaseURL(server.URL()),
+		exchange.WithBinanceCredentials("key", "secret"))
+	require.NoError(t, err)
+
+	t.Run("asset info", func(t *testing.T) {
+		info := binance.GetAssetsInfo("BTCUSDT")
+		require.Equal(t, "BTC", info.BaseAsset)
+		require.Equal(t, "USDT", info.QuoteAsset)
+		require.Equal(t, 0.00001, info.StepSize)
+		require.Equal(t, int64(2), info.PriceDecimalPrecision)
+	})
+
+	t.Run("history candles", func(t *testing.T) {
+		candles, err := binance.GetCandlesByLimit(ctx, "BTCUSDT", "1h", 5)
+		require.NoError(t, err)
+		require.Len(t, candles, 5)
+		require.Equal(t, start.Add(-time.Hour), candles[4].Time.UTC())
+
+		candles, err = binance.GetCandlesByPeriod(ctx, "BTCUSDT", "1h", start.Add(-10*time.Hour), start.Add(-time.Hour))
+		require.NoError(t, err)
+		require.Len(t, candles, 10)
+	})
+
+	var last float64
+	t.Run("market order", func(t *testing.T) {
+		candles, err := binance.GetCandlesByLimit(ctx, "BTCUSDT", "1h", 1)
+		require.NoError(t, err)
+		last = candles[0].Close
+
+		order, err := binance.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 0.5)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, last, order.Price)
+
+		account, err := binance.Account()
+		require.NoError(t, err)
+		require.Equal(t, 0.5, account.Balance("BTC").Free)
+		require.InDelta(t, 10000-0.5*last, account.Balance("USDT").Free, 1e-6)
+
+		_, err = binance.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 10)
+		require.Error(t, err)
+
+		_, err = binance.CreateOrderTrailingStop("BTCUSDT", 0.5, model.TrailingRate(0.01))
+		require.ErrorIs(t, err, exchange.ErrOrderNotSupported)
+	})
+
+	t.Run("limit order", func(t *testing.T) {
+		order, err := binance.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 0.1, last*2)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+
+		account, err := binance.Account()
+		require.NoError(t, err)
+		require.Equal(t, 0.1, account.Balance("BTC").Lock)
+
+		require.NoError(t, binance.Cancel(order))
+		order, err = binance.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+
+		account, err = binance.Account()
+		require.NoError(t, err)
+		require.Equal(t, 0.5, account.Balance("BTC").Free)
+		require.Equal(t, 0.0, account.Balance("BTC").Lock)
+
+		require.Error(t, binance.Cancel(order))
+	})
+
+	t.Run("oco order filled by stream", func(t *testing.T) {
+		orders, err := binance.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 0.2,
+			last*1.01, last*0.99, last*0.99)
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+
+		candles, _ := binance.SubscribeCandle(ctx, "BTCUSDT", "1h")
+		var closed bool
+		for candle := range candles {
+			require.True(t, candle.Complete)
+			if candle.High >= last*1.01 || candle.Low <= last*0.99 {
+				closed = true
+				break
+			}
+		}
+		require.True(t, closed)
+
+		statuses := make(map[model.OrderStatusType]int)
+		for _, order := range orders {
+			order, err := binance.Order("BTCUSDT", order.ExchangeID)
+			require.NoError(t, err)
+			statuses[order.Status]++
+		}
+		require.Equal(t, map[model.OrderStatusType]int{
+			model.OrderStatusTypeFilled:  1,
+			model.OrderStatusTypeExpired: 1,
+		}, statuses)
+
+		all, err := binance.(*exchange.Binance).Orders("BTCUSDT", 10)
+		require.NoError(t, err)
+		require.Len(t, all, 4)
+	})
+
+	t.Run("client order ids", func(t *testing.T) {
+		trader := binance.(exchange.ClientOrderTrader)
+
+		// the response of the created order is lost
+		server.FailOrders(1, true)
+		_, err := trader.WithClientOrderID("bot-1").CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 0.1, last*2)
+		require.ErrorIs(t, err, exchange.ErrStatusUnknown)
+
+		order, err := trader.OrderByClientID("BTCUSDT", "bot-1")
+		require.NoError(t, err)
+		require.Equal(t, "bot-1", order.ClientOrderID)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+
+		// rejected as a duplicate while open
+		_, err = trader.WithClientOrderID("bot-1").CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 0.1, last*2)
+		require.Error(t, err)
+		require.NotErrorIs(t, err, exchange.ErrStatusUnknown)
+		require.NoError(t, binance.Cancel(order))
+
+		_, err = trader.OrderByClientID("BTCUSDT", "bot-2")
+		require.ErrorIs(t, err, exchange.ErrOrderNotFound)
+	})
+
+	t.Run("paper wallet with live feed", func(t *testing.T) {
+		var wallet exchange.Exchange = exchange.NewPaperWallet(ctx, "USDT",
+			exchange.WithPaperAsset("USDT", 10000),
+			exchange.WithDataFeed(binance))
+		require.Equal(t, 0.00001, wallet.GetAssetsInfo("BTCUSDT").StepSize)
+
+		candles, err := wallet.GetCandlesByLimit(ctx, "BTCUSDT", "1h", 1)
+		require.NoError(t, err)
+
+		order, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 0.01, candles[0].Close*2)
+		require.NoError(t, err)
+
+		subscription, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stream, _ := wallet.SubscribeCandle(subscription, "BTCUSDT", "1h")
+		<-stream
+
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 0.01, asset)
+	})
+}
+
+func TestServer_Futures(t *testing.T) {
+	start := time.Date(2020, 11, 17, 10, 0, 0, 0, time.UTC)
+	server, err := NewServer(
+		WithCsvFile("BTCUSDT", "1h", "../../../testdata/btc-1h.csv"),
+		WithFuturesBalance("USDT", 10000),
+		WithFundingRate("BTCUSDT", 0.0001),
+		WithStartTime(start),
+		WithStreamInterval(time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	futures, err := exchange.NewBinanceFutures(ctx,
+		exchange.WithBinanceFuturesBaseURL(server.URL()),
+		exchange.WithBinanceFuturesCredentials("key", "secret"))
+	require.NoError(t, err)
+	require.Implements(t, (*exchange.Exchange)(nil), futures)
+	require.Implements(t, (*exchange.MarginTrader)(nil), futures)
+	require.False(t, futures.HedgeMode())
+	require.Equal(t, "USDT", futures.GetAssetsInfo("BTCUSDT").QuoteAsset)
+
+	candles, err := futures.GetCandlesByLimit(ctx, "BTCUSDT", "1h", 5)
+	require.NoError(t, err)
+	require.Len(t, candles, 5)
+	last := candles[4].Close
+
+	t.Run("mark price and funding", func(t *testing.T) {
+		price, err := futures.MarkPrice("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, last, price)
+
+		rate, next, err := futures.FundingRate("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 0.0001, rate)
+		require.True(t, next.After(time.Now()))
+
+		rates, err := futures.FundingRates("BTCUSDT", start, start.Add(24*time.Hour))
+		require.NoError(t, err)
+		require.Len(t, rates, 3)
+		require.Equal(t, start.Add(6*time.Hour), rates[0].Time.UTC())
+	})
+
+	t.Run("leverage and margin type", func(t *testing.T) {
+		require.NoError(t, futures.SetLeverage("BTCUSDT", 10))
+		require.Error(t, futures.SetLeverage("BTCUSDT", 500))
+		require.NoError(t, futures.SetMarginType("BTCUSDT", exchange.MarginTypeIsolated))
+		require.NoError(t, futures.SetMarginType("BTCUSDT", exchange.MarginTypeIsolated))
+	})
+
+	t.Run("long and short positions", func(t *testing.T) {
+		// sells only reduce the long position
+		_, err := futures.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+		require.Error(t, err)
+
+		order, err := futures.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, last, order.Price)
+		require.Equal(t, 1.0, order.ExecutedQuantity)
+
+		asset, quote, err := futures.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 1.0, asset)
+		require.InDelta(t, 10000, quote, 1e-6)
+
+		positions, err := futures.Positions("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, positions, 1)
+		require.Equal(t, model.PositionSideTypeLong, positions[0].Side)
+		require.Equal(t, last, positions[0].EntryPrice)
+		require.Equal(t, 10, positions[0].Leverage)
+		require.Equal(t, exchange.MarginTypeIsolated, positions[0].MarginType)
+		require.Less(t, positions[0].LiquidationPrice, last)
+
+		account, err := futures.Account()
+		require.NoError(t, err)
+		require.InDelta(t, last/10, account.Balance("USDT").Lock, 1e-6)
+		require.InDelta(t, 10000, account.Equity(), 1e-6)
+
+		level, err := futures.MarginLevel()
+		require.NoError(t, err)
+		require.InDelta(t, 10000/(last*0.004), level, 1e-6)
+
+		// the short sells the long position and one more unit
+		order, err = futures.OpenShort("BTCUSDT", 2)
+		require.NoError(t, err)
+		require.Equal(t, model.PositionSideTypeShort, order.PositionSide)
+
+		asset, _, err = futures.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, -1.0, asset)
+
+		// reduce-only orders are limited to the position
+		order, err = futures.CloseShort("BTCUSDT", 3)
+		require.NoError(t, err)
+		require.Equal(t, 3.0, order.Quantity)
+		require.Equal(t, 1.0, order.ExecutedQuantity)
+
+		asset, _, err = futures.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 0.0, asset)
+
+		level, err = futures.MarginLevel()
+		require.NoError(t, err)
+		require.True(t, math.IsInf(level, 1))
+
+		_, err = futures.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1000)
+		require.Error(t, err)
+
+		_, err = futures.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, last*1.1, last*0.9, last*0.9)
+		require.ErrorIs(t, err, exchange.ErrOrderNotSupported)
+	})
+
+	t.Run("hedge mode", func(t *testing.T) {
+		require.NoError(t, futures.SetHedgeMode(true))
+		require.True(t, futures.HedgeMode())
+
+		order, err := futures.OpenShort("BTCUSDT", 1)
+		require.NoError(t, err)
+		require.Equal(t, model.PositionSideTypeShort, order.PositionSide)
+
+		order, err = futures.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 0.5)
+		require.NoError(t, err)
+		require.Equal(t, model.PositionSideTypeLong, order.PositionSide)
+
+		positions, err := futures.Positions("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, positions, 2)
+
+		asset, _, err := futures.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, -0.5, asset)
+
+		// the position mode can't change with open positions
+		require.Error(t, futures.SetHedgeMode(false))
+	})
+
+	t.Run("stop order filled by stream", func(t *testing.T) {
+		order, err := futures.CreateOrderStop("BTCUSDT", 0.5, last*0.99)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		require.Equal(t, model.OrderTypeStopLoss, order.Type)
+		require.InDelta(t, last*0.99, *order.Stop, 0.01)
+
+		candles, _ := futures.SubscribeCandle(ctx, "BTCUSDT", "1h")
+		var stopped bool
+		for candle := range candles {
+			if candle.Low <= last*0.99 {
+				stopped = true
+				break
+			}
+		}
+		require.True(t, stopped)
+
+		order, err = futures.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, model.PositionSideTypeLong, order.PositionSide)
+
+		orders, err := futures.Orders("BTCUSDT", 10)
+		require.NoError(t, err)
+		require.Len(t, orders, 6)
+	})
+
+	t.Run("trailing stop", func(t *testing.T) {
+		_, err := futures.CreateOrderTrailingStop("BTCUSDT", 0.5, model.TrailingOffset(100))
+		require.ErrorIs(t, err, exchange.ErrOrderNotSupported)
+		_, err = futures.CreateOrderTrailingStop("BTCUSDT", 0.5, model.TrailingRate(0))
+		require.ErrorIs(t, err, exchange.ErrInvalidTrailing)
+
+		_, err = futures.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 0.5)
+		require.NoError(t, err)
+		order, err := futures.CreateOrderTrailingStop("BTCUSDT", 0.5, model.TrailingRate(0.01))
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeTrailingStop, order.Type)
+		require.Equal(t, model.TrailingRate(0.01), *order.Trailing)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+
+		candles, _ := futures.SubscribeCandle(ctx, "BTCUSDT", "1h")
+		for range candles {
+			order, err = futures.Order("BTCUSDT", order.ExchangeID)
+			require.NoError(t, err)
+			if order.Status == model.OrderStatusTypeFilled {
+				break
+			}
+		}
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, model.TrailingRate(0.01), *order.Trailing)
+		require.InDelta(t, *order.Stop, order.Price, 1e-6)
+	})
+}
@@ -28,8 +28,14 @@ type CSVFeed struct {
 	CandlePairTimeFrame map[string][]model.Candle
 }
 
+// GetAssetsInfo returns the assets of the pair from the DefaultRegistry with no trading limits,
+// the assets are empty when the pair is unknown
 func (c CSVFeed) GetAssetsInfo(pair string) model.AssetInfo {
-	asset, quote := SplitAssetQuote(pair)
+	return backtestAssetInfo(pair)
+}
+
+func backtestAssetInfo(pair string) model.AssetInfo {
+	asset, quote, _ := SplitAssetQuote(pair)
 	return model.AssetInfo{
 		BaseAsset:             asset,
 		QuoteAsset:            quote,
@@ -250,13 +256,13 @@ func (c *CSVFeed) GetCandlesByLimit(_ context.Context, pair, timeframe string, l
 	return result, nil
 }
 
-func (c CSVFeed) SubscribeCandle(_ context.Context, pair, timeframe string) (chan model.Candle, chan error) {
-	ccandle := make(chan model.Candle)
+func (c CSVFeed) SubscribeCandle(_ context.Context, pair, timeframe string) (chan *model.Candle, chan error) {
+	ccandle := make(chan *model.Candle)
 	cerr := make(chan error)
 	key := c.feedTimeframeKey(pair, timeframe)
 	go func() {
-		for _, candle := range c.CandlePairTimeFrame[key] {
-			ccandle <- candle
+		for i := range c.CandlePairTimeFrame[key] {
+			ccandle <- &c.CandlePairTimeFrame[key][i]
 		}
 		close(ccandle)
 		close(cerr)
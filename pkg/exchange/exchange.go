@@ -23,9 +23,32 @@ type Trader interface {
 	CreateOrderMarket(side model.SideType, pair string, size float64) (model.Order, error)
 	CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error)
 	CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error)
+	// CreateOrderTrailingStop sells at market when the price falls the trailing distance from its high
+	CreateOrderTrailingStop(pair string, quantity float64, trailing model.Trailing) (model.Order, error)
 	Cancel(model.Order) error
 }
 
+// MarginTrader is a Trader able to borrow assets to open short positions
+type MarginTrader interface {
+	Trader
+	// OpenShort borrows the base asset of the pair and sells it at market
+	OpenShort(pair string, size float64) (model.Order, error)
+	// CloseShort buys the base asset of the pair at market and repays the debt
+	CloseShort(pair string, size float64) (model.Order, error)
+	// MarginLevel is the value of the assets over the value of the debt
+	MarginLevel() (float64, error)
+}
+
+// ClientOrderTrader is a Trader sending the orders with the client order ids of the caller
+type ClientOrderTrader interface {
+	Trader
+	// WithClientOrderID returns a trader sending the next order with the given id, the
+	// limit maker then the stop of an OCO take one id each
+	WithClientOrderID(ids ...string) Trader
+	// OrderByClientID returns ErrOrderNotFound when the exchange does not know the id
+	OrderByClientID(pair, id string) (model.Order, error)
+}
+
 type Exchange interface {
 	Feeder
 	Trader
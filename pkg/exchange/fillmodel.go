@@ -0,0 +1,161 @@
+package exchange
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/xhit/go-str2duration/v2"
+)
+
+// FillModel simulates the prices traded inside a candle, the paper wallet fills
+// the pending orders in the order their prices are reached
+type FillModel interface {
+	Name() string
+	// Path returns the prices traded by the candle in chronological order,
+	// as seen by the orders of the given side
+	Path(candle model.Candle, side model.SideType) []float64
+	// TradeThrough tells if limit prices must be crossed, not only touched, to be filled
+	TradeThrough() bool
+}
+
+type pathFillModel struct {
+	name         string
+	path         func(candle model.Candle, side model.SideType) []float64
+	tradeThrough bool
+}
+
+func (m pathFillModel) Name() string {
+	return m.name
+}
+
+func (m pathFillModel) Path(candle model.Candle, side model.SideType) []float64 {
+	return m.path(candle, side)
+}
+
+func (m pathFillModel) TradeThrough() bool {
+	return m.tradeThrough
+}
+
+func openHighLowClose(candle model.Candle) []float64 {
+	return []float64{candle.Open, candle.High, candle.Low, candle.Close}
+}
+
+func openLowHighClose(candle model.Candle) []float64 {
+	return []float64{candle.Open, candle.Low, candle.High, candle.Close}
+}
+
+// CloseFillModel only uses the close price of the candle
+func CloseFillModel() FillModel {
+	return pathFillModel{
+		name: "close",
+		path: func(candle model.Candle, _ model.SideType) []float64 {
+			return []float64{candle.Close}
+		},
+	}
+}
+
+// OHLCFillModel assumes the price goes from the open to the high, then to the low and the close
+func OHLCFillModel() FillModel {
+	return pathFillModel{
+		name: "open-high-low-close",
+		path: func(candle model.Candle, _ model.SideType) []float64 {
+			return openHighLowClose(candle)
+		},
+	}
+}
+
+// OLHCFillModel assumes the price goes from the open to the low, then to the high and the close
+func OLHCFillModel() FillModel {
+	return pathFillModel{
+		name: "open-low-high-close",
+		path: func(candle model.Candle, _ model.SideType) []float64 {
+			return openLowHighClose(candle)
+		},
+	}
+}
+
+// PessimisticFillModel takes the worst case of each candle: the price moves against
+// the orders first, so stops are reached before take profits, and limits are only
+// filled when the price trades through them
+func PessimisticFillModel() FillModel {
+	return pathFillModel{
+		name: "pessimistic",
+		path: func(candle model.Candle, side model.SideType) []float64 {
+			if side == model.SideTypeSell {
+				return openLowHighClose(candle)
+			}
+			return openHighLowClose(candle)
+		},
+		tradeThrough: true,
+	}
+}
+
+// ReplayFillModel replays the candles of a lower timeframe inside each candle,
+// candles without lower timeframe data use the fallback model
+type ReplayFillModel struct {
+	duration time.Duration
+	fallback FillModel
+	candles  map[string][]model.Candle
+}
+
+// NewReplayFillModel loads the lower timeframe csv files used inside the candles of the given timeframe
+func NewReplayFillModel(timeframe string, fallback FillModel, feeds ...PairFeed) (*ReplayFillModel, error) {
+	duration, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		return nil, err
+	}
+
+	replay := &ReplayFillModel{
+		duration: duration,
+		fallback: fallback,
+		candles:  make(map[string][]model.Candle),
+	}
+
+	for _, feed := range feeds {
+		csvFeed, err := NewCSVFeed(feed.Timeframe, feed)
+		if err != nil {
+			return nil, err
+		}
+
+		candles := csvFeed.CandlePairTimeFrame[csvFeed.feedTimeframeKey(feed.Pair, feed.Timeframe)]
+		sort.SliceStable(candles, func(i, j int) bool {
+			return candles[i].Time.Before(candles[j].Time)
+		})
+		replay.candles[feed.Pair] = candles
+	}
+
+	return replay, nil
+}
+
+func (m *ReplayFillModel) Name() string {
+	return fmt.Sprintf("replay (fallback %s)", m.fallback.Name())
+}
+
+func (m *ReplayFillModel) TradeThrough() bool {
+	return m.fallback.TradeThrough()
+}
+
+func (m *ReplayFillModel) Path(candle model.Candle, side model.SideType) []float64 {
+	candles := m.candles[candle.Pair]
+	start := sort.Search(len(candles), func(i int) bool {
+		return !candles[i].Time.Before(candle.Time)
+	})
+
+	end := candle.Time.Add(m.duration)
+	path := make([]float64, 0)
+	for i := start; i < len(candles) && candles[i].Time.Before(end); i++ {
+		// a bullish candle is more likely to reach its low before its high
+		if candles[i].Close >= candles[i].Open {
+			path = append(path, openLowHighClose(candles[i])...)
+		} else {
+			path = append(path, openHighLowClose(candles[i])...)
+		}
+	}
+
+	if len(path) == 0 {
+		return m.fallback.Path(candle, side)
+	}
+	return path
+}
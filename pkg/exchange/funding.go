@@ -0,0 +1,108 @@
+package exchange
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+// LoadFundingRates reads the funding rates of a perpetual pair from a csv file,
+// each line with the funding timestamp in seconds and the rate, eg: 1605571200,0.0001
+func LoadFundingRates(pair, file string) ([]FundingRate, error) {
+	csvFile, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer csvFile.Close()
+
+	lines, err := csv.NewReader(csvFile).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make([]FundingRate, 0, len(lines))
+	for _, line := range lines {
+		if len(line) < 2 {
+			return nil, fmt.Errorf("invalid funding rate line: %v", line)
+		}
+
+		timestamp, err := strconv.ParseInt(line[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		rate, err := strconv.ParseFloat(line[1], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		rates = append(rates, FundingRate{
+			Pair: pair,
+			Rate: rate,
+			Time: time.Unix(timestamp, 0).UTC(),
+		})
+	}
+	return rates, nil
+}
+
+// WithPaperFunding settles the funding rates of perpetual pairs, the holdings of the base
+// asset of a pair, net of its debt, are the position paying the funding when it is long
+func WithPaperFunding(rates ...FundingRate) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		for _, rate := range rates {
+			wallet.funding[rate.Pair] = append(wallet.funding[rate.Pair], rate)
+		}
+		for pair := range wallet.funding {
+			sort.SliceStable(wallet.funding[pair], func(i, j int) bool {
+				return wallet.funding[pair][i].Time.Before(wallet.funding[pair][j].Time)
+			})
+		}
+	}
+}
+
+// FundingPnL returns the fundings received, negative when paid, by quote asset
+func (p *PaperWallet) FundingPnL() map[string]float64 {
+	p.Lock()
+	defer p.Unlock()
+
+	pnl := make(map[string]float64, len(p.fundingPnL))
+	for asset, value := range p.fundingPnL {
+		pnl[asset] = value
+	}
+	return pnl
+}
+
+// payFunding settles the fundings of the candle pair until its open time, valued at the open
+func (p *PaperWallet) payFunding(candle model.Candle) {
+	rates := p.funding[candle.Pair]
+	if p.fundingNext[candle.Pair] >= len(rates) {
+		return
+	}
+
+	asset, quote, err := SplitAssetQuote(candle.Pair)
+	if err != nil {
+		log.Error().Err(err).Msg("wallet funding failed.")
+		return
+	}
+	if _, ok := p.assets[quote]; !ok {
+		p.assets[quote] = &assetInfo{}
+	}
+
+	for i := p.fundingNext[candle.Pair]; i < len(rates) && !rates[i].Time.After(candle.Time); i++ {
+		var position float64
+		if info, ok := p.assets[asset]; ok {
+			position = info.Free + info.Lock - p.borrowed[asset] - p.interest[asset]
+		}
+
+		amount := -rates[i].Rate * position * candle.Open
+		p.assets[quote].Free += amount
+		p.fundingPnL[quote] += amount
+		p.fundingNext[candle.Pair] = i + 1
+	}
+}
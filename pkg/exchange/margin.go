@@ -0,0 +1,317 @@
+package exchange
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+// debtDust is the remaining debt considered as repaid
+const debtDust = 1e-9
+
+// MarginConfig enables the margin mode of the paper wallet, where the base asset
+// of a pair can be borrowed to open short positions
+type MarginConfig struct {
+	// Interest is the daily interest rate of the borrowed assets, eg: 0.0002 for 0.02 %
+	Interest float64
+	// BorrowLevel is the minimum margin level after a borrow, 1.5 by default (3x leverage)
+	BorrowLevel float64
+	// LiquidationLevel is the margin level where the debt is bought back, 1.1 by default
+	LiquidationLevel float64
+}
+
+// WithPaperMargin enables borrowing, the margin level is the value of the assets
+// over the value of the debt, both valued in the base coin
+func WithPaperMargin(config MarginConfig) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		if config.BorrowLevel == 0 {
+			config.BorrowLevel = 1.5
+		}
+		if config.LiquidationLevel == 0 {
+			config.LiquidationLevel = 1.1
+		}
+		wallet.margin = &config
+	}
+}
+
+// assetPrice is the price of an asset in the base coin, the price of the given pair is replaced
+func (p *PaperWallet) assetPrice(asset, pair string, price float64) float64 {
+	if asset == p.baseCoin {
+		return 1
+	}
+	if asset+p.baseCoin == pair {
+		return price
+	}
+	return p.lastCandle[asset+p.baseCoin].Close
+}
+
+// marginValues returns the value of the assets and the value of the debt in the base coin
+func (p *PaperWallet) marginValues(pair string, price float64) (assets, debt float64) {
+	for asset, info := range p.assets {
+		assets += (info.Free + info.Lock) * p.assetPrice(asset, pair, price)
+	}
+	for asset, borrowed := range p.borrowed {
+		debt += (borrowed + p.interest[asset]) * p.assetPrice(asset, pair, price)
+	}
+	return assets, debt
+}
+
+// marginLevel is the margin level with the price of the given pair, infinite without debt
+func (p *PaperWallet) marginLevel(pair string, price float64) float64 {
+	assets, debt := p.marginValues(pair, price)
+	if debt == 0 {
+		return math.Inf(1)
+	}
+	return assets / debt
+}
+
+// MarginLevel returns the margin level at the last prices, infinite without debt
+func (p *PaperWallet) MarginLevel() (float64, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.margin == nil {
+		return 0, ErrMarginDisabled
+	}
+	return p.marginLevel("", 0), nil
+}
+
+// LiquidationPrice returns the price of the pair where the margin level reaches the
+// liquidation level, with the other prices unchanged. It is zero when the price of
+// the pair cannot liquidate the account.
+func (p *PaperWallet) LiquidationPrice(pair string) (float64, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.margin == nil {
+		return 0, ErrMarginDisabled
+	}
+	return p.liquidationPrice(pair), nil
+}
+
+func (p *PaperWallet) liquidationPrice(pair string) float64 {
+	asset, _, err := SplitAssetQuote(pair)
+	if err != nil || asset+p.baseCoin != pair {
+		return 0
+	}
+
+	var held float64
+	if info, ok := p.assets[asset]; ok {
+		held = info.Free + info.Lock
+	}
+	owed := p.borrowed[asset] + p.interest[asset]
+
+	// assets and debt without the asset of the pair
+	price := p.lastCandle[pair].Close
+	assets, debt := p.marginValues("", 0)
+	assets -= held * price
+	debt -= owed * price
+
+	level := p.margin.LiquidationLevel
+	divisor := level*owed - held
+	if divisor <= 0 {
+		return 0
+	}
+	return math.Max(0, (assets-level*debt)/divisor)
+}
+
+// OpenShort borrows the base asset of the pair and sells it at market, the borrow
+// must keep the margin level over the borrow level
+func (p *PaperWallet) OpenShort(pair string, size float64) (model.Order, error) {
+	defer p.notify()
+	p.Lock()
+	defer p.Unlock()
+
+	if p.margin == nil {
+		return model.Order{}, ErrMarginDisabled
+	}
+
+	asset, _, err := SplitAssetQuote(pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	// the sale increases the assets and the debt by the same value
+	assets, debt := p.marginValues("", 0)
+	value := size * p.assetPrice(asset, "", 0)
+	if (assets+value)/(debt+value) < p.margin.BorrowLevel {
+		return model.Order{}, &OrderError{
+			Err:      ErrInsufficientMargin,
+			Pair:     pair,
+			Quantity: size,
+		}
+	}
+
+	p.borrow(asset, pair, size)
+	order, err := p.createOrderMarket(model.SideTypeSell, pair, size, model.PositionSideTypeShort)
+	if err != nil {
+		p.repay(asset, size)
+		return model.Order{}, err
+	}
+	return order, nil
+}
+
+// CloseShort buys the base asset of the pair at market and repays the debt with it,
+// closing the whole borrowed quantity also buys the accrued interest
+func (p *PaperWallet) CloseShort(pair string, size float64) (model.Order, error) {
+	defer p.notify()
+	p.Lock()
+	defer p.Unlock()
+
+	if p.margin == nil {
+		return model.Order{}, ErrMarginDisabled
+	}
+
+	asset, _, err := SplitAssetQuote(pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	borrowed := p.borrowed[asset]
+	if borrowed == 0 {
+		return model.Order{}, &OrderError{
+			Err:      ErrInvalidQuantity,
+			Pair:     pair,
+			Quantity: size,
+		}
+	}
+
+	quantity := math.Min(size, borrowed)
+	if quantity == borrowed {
+		quantity += p.interest[asset]
+	}
+	return p.createOrderMarket(model.SideTypeBuy, pair, quantity, model.PositionSideTypeShort)
+}
+
+func (p *PaperWallet) borrow(asset, pair string, quantity float64) {
+	if _, ok := p.assets[asset]; !ok {
+		p.assets[asset] = &assetInfo{}
+	}
+	if p.borrowed[asset] == 0 {
+		p.accruedAt[asset] = p.lastCandle[pair].Time
+	}
+
+	p.borrowed[asset] += quantity
+	p.assets[asset].Free += quantity
+	p.marginPairs[asset] = pair
+}
+
+// repay pays the interest and then the borrowed quantity with the free asset
+func (p *PaperWallet) repay(asset string, quantity float64) {
+	info, ok := p.assets[asset]
+	if !ok {
+		return
+	}
+
+	amount := math.Min(quantity, info.Free)
+	interest := math.Min(amount, p.interest[asset])
+	principal := math.Min(amount-interest, p.borrowed[asset])
+	info.Free -= interest + principal
+	p.interest[asset] -= interest
+	p.borrowed[asset] -= principal
+
+	if p.borrowed[asset] <= debtDust && p.interest[asset] <= debtDust {
+		delete(p.borrowed, asset)
+		delete(p.interest, asset)
+		delete(p.accruedAt, asset)
+	}
+}
+
+// accrue charges the interest of the borrowed base asset of the candle since the last accrual
+func (p *PaperWallet) accrue(candle model.Candle) {
+	asset, _, err := SplitAssetQuote(candle.Pair)
+	if err != nil || p.borrowed[asset] == 0 {
+		return
+	}
+
+	elapsed := candle.Time.Sub(p.accruedAt[asset])
+	if elapsed <= 0 {
+		return
+	}
+
+	interest := p.borrowed[asset] * p.margin.Interest * elapsed.Hours() / 24
+	p.interest[asset] += interest
+	p.interestPaid[asset] += interest
+	p.accruedAt[asset] = candle.Time
+}
+
+// liquidate buys back all the debt when the margin level reaches the liquidation level
+// with the high of the candle. The debt of the candle pair is bought at the liquidation
+// price, or at the open of a gap, and the quote balance may become negative.
+func (p *PaperWallet) liquidate(candle model.Candle) []int {
+	if p.margin == nil || len(p.borrowed) == 0 ||
+		p.marginLevel(candle.Pair, candle.High) >= p.margin.LiquidationLevel {
+		return nil
+	}
+
+	liquidationPrice := math.Min(candle.High, math.Max(p.liquidationPrice(candle.Pair), candle.Open))
+	log.Warn().Msgf("[LIQUIDATION] margin level of %s under %.2f", candle.Pair, p.margin.LiquidationLevel)
+	p.liquidations++
+
+	assets := make([]string, 0, len(p.borrowed))
+	for asset := range p.borrowed {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+
+	var updated []int
+	for _, asset := range assets {
+		pair := p.marginPairs[asset]
+		_, quote, err := SplitAssetQuote(pair)
+		if err != nil {
+			log.Error().Err(err).Msg("wallet liquidation failed.")
+			continue
+		}
+
+		price := p.lastCandle[pair].Close
+		if pair == candle.Pair {
+			price = liquidationPrice
+		}
+
+		debt := p.borrowed[asset] + p.interest[asset]
+		if needed := debt - p.assets[asset].Free; needed > 0 {
+			if _, ok := p.assets[quote]; !ok {
+				p.assets[quote] = &assetInfo{}
+			}
+
+			order := model.Order{
+				ExchangeID:       p.ID(),
+				CreatedAt:        candle.Time,
+				UpdatedAt:        candle.Time,
+				Pair:             pair,
+				Side:             model.SideTypeBuy,
+				Type:             model.OrderTypeMarket,
+				Status:           model.OrderStatusTypeFilled,
+				Price:            price,
+				Quantity:         needed,
+				ExecutedQuantity: needed,
+				PositionSide:     model.PositionSideTypeShort,
+			}
+			p.assets[quote].Free -= needed * price
+			p.assets[asset].Free += needed
+			p.chargeFee(&order, quote, needed*price, p.takerFee)
+			p.volume[pair] += needed * price
+			p.orders = append(p.orders, order)
+			updated = append(updated, len(p.orders)-1)
+		}
+		p.repay(asset, debt)
+	}
+	return updated
+}
+
+// marginSummary prints the debt, the interest and the liquidations of the margin mode
+func (p *PaperWallet) marginSummary() {
+	fmt.Println("------ MARGIN -----")
+	for asset, borrowed := range p.borrowed {
+		fmt.Printf("BORROWED %s    = %.4f %s\n", asset, borrowed+p.interest[asset], asset)
+	}
+	for asset, interest := range p.interestPaid {
+		fmt.Printf("INTEREST %s    = %.4f %s\n", asset, interest, asset)
+	}
+	fmt.Printf("MARGIN LEVEL    = %.2f\n", p.marginLevel("", 0))
+	fmt.Printf("LIQUIDATIONS    = %d\n", p.liquidations)
+	fmt.Println()
+}
@@ -2,11 +2,12 @@ package exchange
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/lynbklk/tradebot/pkg/model"
 	"github.com/rs/zerolog/log"
+	"github.com/xhit/go-str2duration/v2"
 	"math"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +23,35 @@ type AssetValue struct {
 	Value float64
 }
 
+// Latency delays the orders until they reach the simulated exchange, after a number
+// of new candles and a duration measured with the candle times
+type Latency struct {
+	Candles  int
+	Duration time.Duration
+}
+
+func (l Latency) String() string {
+	switch {
+	case l.Candles > 0 && l.Duration > 0:
+		return fmt.Sprintf("%d candles and %s", l.Candles, l.Duration)
+	case l.Candles > 0:
+		return fmt.Sprintf("%d candles", l.Candles)
+	case l.Duration > 0:
+		return l.Duration.String()
+	default:
+		return "none"
+	}
+}
+
+// pendingOrder is an order sent to the exchange and not received yet, or a
+// market order waiting for the liquidity of the next candles
+type pendingOrder struct {
+	candles  int
+	activeAt time.Time
+	seen     time.Time
+	lock     float64
+}
+
 type PaperWallet struct {
 	sync.Mutex
 	ctx          context.Context
@@ -29,6 +59,29 @@ type PaperWallet struct {
 	counter      int64
 	takerFee     float64
 	makerFee     float64
+	feeAsset     string
+	feeDiscount  float64
+	fees         map[string]float64
+	feeReserve   map[int64]float64
+	lockPrice    map[int64]float64
+	fillModel    FillModel
+	slippage     SlippageModel
+	latency      Latency
+	pending      map[int64]*pendingOrder
+	trailingHigh map[int64]float64
+	liquidity    float64
+	traded       map[string]float64
+	tradedTime   map[string]time.Time
+	margin       *MarginConfig
+	borrowed     map[string]float64
+	interest     map[string]float64
+	interestPaid map[string]float64
+	accruedAt    map[string]time.Time
+	marginPairs  map[string]string
+	liquidations int
+	funding      map[string][]FundingRate
+	fundingNext  map[string]int
+	fundingPnL   map[string]float64
 	initialValue float64
 	feeder       Feeder
 	orders       []model.Order
@@ -37,22 +90,19 @@ type PaperWallet struct {
 	volume       map[string]float64
 	lastCandle   map[string]model.Candle
 	fistCandle   map[string]model.Candle
+	timeframe    map[string]time.Duration
 	assetValues  map[string][]AssetValue
 	equityValues []AssetValue
+	subscribers  []func(model.Order)
+	updates      []model.Order
 }
 
-func (p *PaperWallet) AssetsInfo(pair string) model.AssetInfo {
-	asset, quote := SplitAssetQuote(pair)
-	return model.AssetInfo{
-		BaseAsset:             asset,
-		QuoteAsset:            quote,
-		MaxPrice:              math.MaxFloat64,
-		MaxQuantity:           math.MaxFloat64,
-		StepSize:              0.00000001,
-		TickSize:              0.00000001,
-		QtyDecimalPrecision:   8,
-		PriceDecimalPrecision: 8,
+// GetAssetsInfo returns the limits of the wrapped feeder, or no limits without feeder
+func (p *PaperWallet) GetAssetsInfo(pair string) model.AssetInfo {
+	if p.feeder != nil {
+		return p.feeder.GetAssetsInfo(pair)
 	}
+	return backtestAssetInfo(pair)
 }
 
 type PaperWalletOption func(*PaperWallet)
@@ -73,6 +123,53 @@ func WithPaperFee(maker, taker float64) PaperWalletOption {
 	}
 }
 
+// WithPaperUserInfo charges the maker and taker commissions of an exchange account
+func WithPaperUserInfo(info UserInfo) PaperWalletOption {
+	return WithPaperFee(info.MakerCommission, info.TakerCommission)
+}
+
+// WithPaperFeeAsset pays the fees with an asset, eg: BNB, with a discount between 0 and 1.
+// The fee is converted with the last price of the asset in the quote of the order and
+// it is paid in the quote asset when there is no price or no balance.
+func WithPaperFeeAsset(asset string, discount float64) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.feeAsset = asset
+		wallet.feeDiscount = discount
+	}
+}
+
+// WithPaperFillModel sets how orders are filled inside a candle, open-high-low-close by default
+func WithPaperFillModel(fillModel FillModel) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.fillModel = fillModel
+	}
+}
+
+// WithPaperSlippage sets the slippage of market and stop fills, none by default
+func WithPaperSlippage(slippage SlippageModel) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.slippage = slippage
+	}
+}
+
+// WithPaperLatency delays the orders until the given number of new candles is received
+// and the duration has passed since the order creation, the order is then filled with
+// the prices of the candle where it arrives
+func WithPaperLatency(candles int, duration time.Duration) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.latency = Latency{Candles: candles, Duration: duration}
+	}
+}
+
+// WithPaperLiquidity caps the quantity filled in each candle at a fraction of its volume,
+// orders over the cap stay PARTIALLY_FILLED until the next candles fill the rest
+func WithPaperLiquidity(fraction float64) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.liquidity = fraction
+	}
+}
+
+// WithDataFeed wraps a feeder, eg: Binance, to provide the market data of the wallet
 func WithDataFeed(feeder Feeder) PaperWalletOption {
 	return func(wallet *PaperWallet) {
 		wallet.feeder = feeder
@@ -87,8 +184,26 @@ func NewPaperWallet(ctx context.Context, baseCoin string, options ...PaperWallet
 		assets:       make(map[string]*assetInfo),
 		fistCandle:   make(map[string]model.Candle),
 		lastCandle:   make(map[string]model.Candle),
+		timeframe:    make(map[string]time.Duration),
 		avgPrice:     make(map[string]float64),
 		volume:       make(map[string]float64),
+		fees:         make(map[string]float64),
+		feeReserve:   make(map[int64]float64),
+		lockPrice:    make(map[int64]float64),
+		fillModel:    OHLCFillModel(),
+		slippage:     NoSlippage(),
+		pending:      make(map[int64]*pendingOrder),
+		trailingHigh: make(map[int64]float64),
+		traded:       make(map[string]float64),
+		tradedTime:   make(map[string]time.Time),
+		borrowed:     make(map[string]float64),
+		interest:     make(map[string]float64),
+		interestPaid: make(map[string]float64),
+		accruedAt:    make(map[string]time.Time),
+		marginPairs:  make(map[string]string),
+		funding:      make(map[string][]FundingRate),
+		fundingNext:  make(map[string]int),
+		fundingPnL:   make(map[string]float64),
 		assetValues:  make(map[string][]AssetValue),
 		equityValues: make([]AssetValue, 0),
 	}
@@ -109,6 +224,9 @@ func (p *PaperWallet) ID() int64 {
 }
 
 func (p *PaperWallet) Pairs() []string {
+	p.Lock()
+	defer p.Unlock()
+
 	pairs := make([]string, 0)
 	for pair := range p.assets {
 		pairs = append(pairs, pair)
@@ -116,19 +234,177 @@ func (p *PaperWallet) Pairs() []string {
 	return pairs
 }
 
-func (p *PaperWallet) LastQuote(ctx context.Context, pair string) (float64, error) {
-	return p.feeder.GetLastQuote(ctx, pair)
+// GetLastQuote returns the quote of the wrapped feeder, or the close of the last candle without feeder
+func (p *PaperWallet) GetLastQuote(ctx context.Context, pair string) (float64, error) {
+	if p.feeder != nil {
+		return p.feeder.GetLastQuote(ctx, pair)
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	candle, ok := p.lastCandle[pair]
+	if !ok {
+		return 0, fmt.Errorf("%w: no quote of %s", ErrNoFeeder, pair)
+	}
+	return candle.Close, nil
+}
+
+// FillModel returns the model used to fill the orders inside a candle
+func (p *PaperWallet) FillModel() FillModel {
+	return p.fillModel
+}
+
+// SlippageModel returns the slippage applied to market and stop fills
+func (p *PaperWallet) SlippageModel() SlippageModel {
+	return p.slippage
+}
+
+// Latency returns the delay of the orders until they reach the simulated exchange
+func (p *PaperWallet) Latency() Latency {
+	return p.latency
+}
+
+// Liquidity returns the fraction of the candle volume that can be filled, zero when unlimited
+func (p *PaperWallet) Liquidity() float64 {
+	return p.liquidity
+}
+
+func (p *PaperWallet) BaseCoin() string {
+	return p.baseCoin
+}
+
+func (p *PaperWallet) InitialValue() float64 {
+	return p.initialValue
+}
+
+func (p *PaperWallet) Orders() []model.Order {
+	p.Lock()
+	defer p.Unlock()
+
+	orders := make([]model.Order, len(p.orders))
+	copy(orders, p.orders)
+	return orders
+}
+
+func (p *PaperWallet) Volume() map[string]float64 {
+	p.Lock()
+	defer p.Unlock()
+
+	volume := make(map[string]float64, len(p.volume))
+	for pair, value := range p.volume {
+		volume[pair] = value
+	}
+	return volume
+}
+
+// UserInfo returns the maker and taker fees charged by the wallet
+func (p *PaperWallet) UserInfo() UserInfo {
+	return UserInfo{MakerCommission: p.makerFee, TakerCommission: p.takerFee}
+}
+
+// Fees returns the total fees paid by asset
+func (p *PaperWallet) Fees() map[string]float64 {
+	p.Lock()
+	defer p.Unlock()
+
+	fees := make(map[string]float64, len(p.fees))
+	for asset, value := range p.fees {
+		fees[asset] = value
+	}
+	return fees
+}
+
+// feeCharge returns the asset and the amount paid for a fee valued in the quote asset
+func (p *PaperWallet) feeCharge(quote string, fee float64) (string, float64) {
+	if p.feeAsset == "" || fee == 0 {
+		return quote, fee
+	}
+
+	discounted := fee * (1 - p.feeDiscount)
+	if p.feeAsset == quote {
+		return quote, discounted
+	}
+
+	candle, ok := p.lastCandle[p.feeAsset+quote]
+	if !ok || candle.Close <= 0 {
+		return quote, fee
+	}
+
+	amount := discounted / candle.Close
+	if info, ok := p.assets[p.feeAsset]; !ok || info.Free < amount {
+		return quote, fee
+	}
+	return p.feeAsset, amount
+}
+
+// quoteFeeRate is the rate paid in the quote asset, zero when the fee asset pays it
+func (p *PaperWallet) quoteFeeRate(quote string, volume, rate float64) float64 {
+	asset, amount := p.feeCharge(quote, volume*rate)
+	if asset != quote || volume == 0 {
+		return 0
+	}
+	return amount / volume
+}
+
+// chargeFee deducts the fee of a fill from the free balance and records it on the order
+func (p *PaperWallet) chargeFee(order *model.Order, quote string, volume, rate float64) {
+	asset, amount := p.feeCharge(quote, volume*rate)
+	if amount == 0 {
+		return
+	}
+
+	if _, ok := p.assets[asset]; !ok {
+		p.assets[asset] = &assetInfo{}
+	}
+	p.assets[asset].Free -= amount
+	p.fees[asset] += amount
+	order.Fee += amount
+	order.FeeAsset = asset
+}
+
+// MarketChange is the average buy and hold return of all pairs seen by the wallet
+func (p *PaperWallet) MarketChange() float64 {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.marketChange()
+}
+
+func (p *PaperWallet) marketChange() float64 {
+	if len(p.fistCandle) == 0 {
+		return 0
+	}
+
+	var marketChange float64
+	for pair, first := range p.fistCandle {
+		marketChange += (p.lastCandle[pair].Close - first.Close) / first.Close
+	}
+	return marketChange / float64(len(p.fistCandle))
 }
 
 func (p *PaperWallet) AssetValues(pair string) []AssetValue {
+	p.Lock()
+	defer p.Unlock()
+
 	return p.assetValues[pair]
 }
 
 func (p *PaperWallet) EquityValues() []AssetValue {
+	p.Lock()
+	defer p.Unlock()
+
 	return p.equityValues
 }
 
 func (p *PaperWallet) MaxDrawdown() (float64, time.Time, time.Time) {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.maxDrawdown()
+}
+
+func (p *PaperWallet) maxDrawdown() (float64, time.Time, time.Time) {
 	if len(p.equityValues) < 1 {
 		return 0, time.Time{}, time.Time{}
 	}
@@ -168,32 +444,39 @@ func (p *PaperWallet) MaxDrawdown() (float64, time.Time, time.Time) {
 }
 
 func (p *PaperWallet) Summary() {
+	p.Lock()
+	defer p.Unlock()
+
 	var (
-		total        float64
-		marketChange float64
-		volume       float64
+		total  float64
+		volume float64
 	)
 
 	fmt.Println("-- FINAL WALLET --")
 	for pair, price := range p.avgPrice {
-		asset, quote := SplitAssetQuote(pair)
-		quantity := p.assets[asset].Free + p.assets[asset].Lock
+		asset, quote, err := SplitAssetQuote(pair)
+		if err != nil {
+			log.Error().Err(err).Msg("wallet summary failed.")
+			continue
+		}
+		quantity := p.assets[asset].Free + p.assets[asset].Lock - p.borrowed[asset] - p.interest[asset]
 		total += quantity * price
-		marketChange += (p.lastCandle[pair].Close - p.fistCandle[pair].Close) / p.fistCandle[pair].Close
 		fmt.Printf("%.4f %s = %.4f %s\n", quantity, asset, total, quote)
 	}
 
-	avgMarketChange := marketChange / float64(len(p.avgPrice))
 	baseCoinValue := p.assets[p.baseCoin].Free + p.assets[p.baseCoin].Lock
 	profit := total + baseCoinValue - p.initialValue
 	fmt.Printf("%.4f %s\n", baseCoinValue, p.baseCoin)
 	fmt.Println()
-	maxDrawDown, _, _ := p.MaxDrawdown()
+	maxDrawDown, _, _ := p.maxDrawdown()
 	fmt.Println("----- RETURNS -----")
 	fmt.Printf("START PORTFOLIO     = %.2f %s\n", p.initialValue, p.baseCoin)
 	fmt.Printf("FINAL PORTFOLIO     = %.2f %s\n", total+baseCoinValue, p.baseCoin)
 	fmt.Printf("GROSS PROFIT        =  %f %s (%.2f%%)\n", profit, p.baseCoin, profit/p.initialValue*100)
-	fmt.Printf("MARKET CHANGE (B&H) =  %.2f%%\n", avgMarketChange*100)
+	for asset, pnl := range p.fundingPnL {
+		fmt.Printf("FUNDING PNL         =  %f %s\n", pnl, asset)
+	}
+	fmt.Printf("MARKET CHANGE (B&H) =  %.2f%%\n", p.marketChange()*100)
 	fmt.Println()
 	fmt.Println("------ RISK -------")
 	fmt.Printf("MAX DRAWDOWN = %.2f %%\n", maxDrawDown*100)
@@ -204,7 +487,14 @@ func (p *PaperWallet) Summary() {
 		fmt.Printf("%s         = %.2f %s\n", pair, vol, p.baseCoin)
 	}
 	fmt.Printf("TOTAL           = %.2f %s\n", volume, p.baseCoin)
-	fmt.Printf("COSTS (0.001*V) = %.2f %s (ESTIMATION) \n", volume*0.001, p.baseCoin)
+	fmt.Println()
+	if p.margin != nil {
+		p.marginSummary()
+	}
+	fmt.Println("------- FEES ------")
+	for asset, fee := range p.fees {
+		fmt.Printf("%s         = %.4f %s\n", asset, fee, asset)
+	}
 	fmt.Println("-------------------")
 }
 
@@ -222,114 +512,497 @@ func (p *PaperWallet) lockFunds(asset string, amount float64) error {
 	return nil
 }
 
+// SubscribeOrder registers a callback for each update of the orders of the wallet, from
+// their creation to their fill or cancel
+func (p *PaperWallet) SubscribeOrder(callback func(model.Order)) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.subscribers = append(p.subscribers, callback)
+}
+
+// publish queues the updates of orders for the subscribers, sent by notify after the lock
+func (p *PaperWallet) publish(orders ...model.Order) {
+	if len(p.subscribers) > 0 {
+		p.updates = append(p.updates, orders...)
+	}
+}
+
+// notify sends the queued updates without the lock, so subscribers are able to create new orders
+func (p *PaperWallet) notify() {
+	p.Lock()
+	updates, subscribers := p.updates, p.subscribers
+	p.updates = nil
+	p.Unlock()
+
+	for _, order := range updates {
+		for _, subscriber := range subscribers {
+			subscriber(order)
+		}
+	}
+}
+
 func (p *PaperWallet) OnCandle(candle model.Candle) {
+	defer p.notify()
 	p.Lock()
 	defer p.Unlock()
 
+	p.publish(p.onCandle(candle)...)
+}
+
+// trigger returns the step of the path where the order is reached and its fill price.
+// Limits are filled at their price, stops at the stop price or at the open of a gap and
+// delayed market orders at the first price.
+func (p *PaperWallet) trigger(order model.Order, path []float64) (step int, price float64, taker, ok bool) {
+	reached := func(value, limit float64, above bool) bool {
+		if above {
+			return value > limit || (!p.fillModel.TradeThrough() && value == limit)
+		}
+		return value < limit || (!p.fillModel.TradeThrough() && value == limit)
+	}
+
+	high := p.trailingHigh[order.ExchangeID]
+	for step, value := range path {
+		switch {
+		case order.Type == model.OrderTypeMarket:
+			return step, value, true, true
+		case order.Status == model.OrderStatusTypePartiallyFilled && order.Stop != nil:
+			// a triggered stop fills the rest at market
+			return step, value, true, true
+		case order.Side == model.SideTypeBuy && (order.Type == model.OrderTypeLimit ||
+			order.Type == model.OrderTypeLimitMaker):
+			if reached(value, order.Price, false) {
+				return step, order.Price, false, true
+			}
+		case order.Side == model.SideTypeBuy && order.Stop != nil && (order.Type == model.OrderTypeStopLoss ||
+			order.Type == model.OrderTypeStopLossLimit):
+			if value >= *order.Stop && step == 0 {
+				return step, math.Max(value, *order.Stop), true, true
+			}
+			if value >= *order.Stop {
+				return step, *order.Stop, true, true
+			}
+		case order.Side == model.SideTypeSell && (order.Type == model.OrderTypeLimit ||
+			order.Type == model.OrderTypeLimitMaker ||
+			order.Type == model.OrderTypeTakeProfit ||
+			order.Type == model.OrderTypeTakeProfitLimit):
+			if reached(value, order.Price, true) {
+				return step, order.Price, false, true
+			}
+		case order.Side == model.SideTypeSell && order.Stop != nil && (order.Type == model.OrderTypeStopLoss ||
+			order.Type == model.OrderTypeStopLossLimit):
+			if value <= *order.Stop && step == 0 {
+				return step, math.Min(value, *order.Stop), true, true
+			}
+			if value <= *order.Stop {
+				return step, *order.Stop, true, true
+			}
+		case order.Type == model.OrderTypeTrailingStop && order.Trailing != nil:
+			// the stop follows the high of the path before it is reached
+			high = math.Max(high, value)
+			stop := order.Trailing.Stop(high)
+			if value <= stop && step == 0 {
+				return step, math.Min(value, stop), true, true
+			}
+			if value <= stop {
+				return step, stop, true, true
+			}
+		}
+	}
+	return 0, 0, false, false
+}
+
+// arrived tells if a pending order reached the exchange with the candle
+func (p *PaperWallet) arrived(order model.Order, candle model.Candle) bool {
+	pending, ok := p.pending[order.ExchangeID]
+	if !ok {
+		return true
+	}
+
+	if candle.Time.After(pending.seen) {
+		pending.candles--
+		pending.seen = candle.Time
+	}
+	if pending.candles > 0 || candle.Time.Before(pending.activeAt) {
+		return false
+	}
+
+	if order.Type != model.OrderTypeMarket {
+		delete(p.pending, order.ExchangeID)
+	}
+	return true
+}
+
+// submit sends a new order to the exchange, delayed by the latency of the wallet
+func (p *PaperWallet) submit(order model.Order, lock float64) {
+	if p.latency.Candles > 0 || p.latency.Duration > 0 {
+		candles := p.latency.Candles
+		if candles == 0 {
+			candles = 1
+		}
+		p.pending[order.ExchangeID] = &pendingOrder{
+			candles:  candles,
+			activeAt: order.CreatedAt.Add(p.latency.Duration),
+			seen:     order.CreatedAt,
+			lock:     lock,
+		}
+	}
+	p.orders = append(p.orders, order)
+	p.publish(order)
+}
+
+// take returns the quantity of the pair still tradable in the candle, up to the given
+// quantity, and consumes it from the liquidity of the candle
+func (p *PaperWallet) take(candle model.Candle, quantity float64) float64 {
+	if p.liquidity <= 0 {
+		return quantity
+	}
+
+	if !p.tradedTime[candle.Pair].Equal(candle.Time) {
+		p.tradedTime[candle.Pair] = candle.Time
+		p.traded[candle.Pair] = 0
+	}
+
+	quantity = math.Max(0, math.Min(quantity, p.liquidity*candle.Volume-p.traded[candle.Pair]))
+	p.traded[candle.Pair] += quantity
+	return quantity
+}
+
+// execute records a fill of the order, the price of market orders is the average of their fills
+func execute(order *model.Order, price, quantity float64, t time.Time) {
+	if order.Type == model.OrderTypeMarket {
+		order.Price = (order.Price*order.ExecutedQuantity + price*quantity) / (order.ExecutedQuantity + quantity)
+	}
+
+	order.ExecutedQuantity += quantity
+	order.UpdatedAt = t
+	order.Status = model.OrderStatusTypePartiallyFilled
+	if order.Quantity-order.ExecutedQuantity <= order.Quantity*1e-9 {
+		order.ExecutedQuantity = order.Quantity
+		order.Status = model.OrderStatusTypeFilled
+	}
+}
+
+// lockRemaining locks the funds of the quantity not executed of a market order,
+// estimated with the given price, and returns the amount locked
+func (p *PaperWallet) lockRemaining(order *model.Order, asset, quote string, price float64) (float64, error) {
+	remaining := order.Quantity - order.ExecutedQuantity
+	if order.Side == model.SideTypeSell {
+		return remaining, p.lockFunds(asset, remaining)
+	}
+
+	cost := remaining * price
+	amount := cost + cost*p.quoteFeeRate(quote, cost, p.takerFee)
+	if err := p.lockFunds(quote, amount); err != nil {
+		return 0, &OrderError{
+			Err:      ErrInsufficientFunds,
+			Pair:     order.Pair,
+			Quantity: remaining,
+		}
+	}
+	return amount, nil
+}
+
+// release unlocks the funds locked by a market order
+func (p *PaperWallet) release(order model.Order, asset, quote string, amount float64) {
+	if order.Side == model.SideTypeSell {
+		quote = asset
+	}
+	p.assets[quote].Lock -= amount
+	p.assets[quote].Free += amount
+}
+
+// fillMarketOrder fills a market order with the liquidity of the candle, the rest
+// waits for the next candle with its funds locked
+func (p *PaperWallet) fillMarketOrder(order *model.Order, price float64, candle model.Candle) error {
+	asset, quote, err := SplitAssetQuote(order.Pair)
+	if err != nil {
+		return err
+	}
+
+	if pending, ok := p.pending[order.ExchangeID]; ok {
+		p.release(*order, asset, quote, pending.lock)
+		delete(p.pending, order.ExchangeID)
+	}
+
+	quantity := p.take(candle, order.Quantity-order.ExecutedQuantity)
+	if quantity > 0 {
+		fillPrice := slippagePrice(p.slippage, order.Side, price, quantity, candle)
+		if err := p.fillMarket(order, asset, quote, fillPrice, quantity); err != nil {
+			return err
+		}
+
+		// the asset bought by a short close repays the debt
+		if order.PositionSide == model.PositionSideTypeShort && order.Side == model.SideTypeBuy {
+			p.repay(asset, quantity)
+		}
+	}
+
+	if order.Status == model.OrderStatusTypeFilled {
+		return nil
+	}
+
+	lock, err := p.lockRemaining(order, asset, quote, price)
+	if err != nil {
+		return err
+	}
+	p.pending[order.ExchangeID] = &pendingOrder{candles: 1, seen: candle.Time, lock: lock}
+	return nil
+}
+
+// cancelPending releases the funds locked by a waiting market order
+func (p *PaperWallet) cancelPending(order model.Order) {
+	pending, ok := p.pending[order.ExchangeID]
+	if !ok {
+		return
+	}
+	delete(p.pending, order.ExchangeID)
+	if order.Type != model.OrderTypeMarket {
+		return
+	}
+
+	asset, quote, err := SplitAssetQuote(order.Pair)
+	if err != nil {
+		return
+	}
+	p.release(order, asset, quote, pending.lock)
+}
+
+// simulated tells if the candle drives the fills and the equity of the wallet, only the
+// complete candles of the finest timeframe of each pair do: the high and low of a partial
+// candle or of a larger timeframe may be reached before the orders are created
+func (p *PaperWallet) simulated(candle model.Candle) bool {
+	if !candle.Complete {
+		return false
+	}
+
+	var duration time.Duration
+	if candle.Timeframe != "" {
+		var err error
+		duration, err = str2duration.ParseDuration(candle.Timeframe)
+		if err != nil {
+			log.Error().Err(err).Msgf("wallet candle of %s ignored.", candle.Pair)
+			return false
+		}
+	}
+	finest, ok := p.timeframe[candle.Pair]
+	if !ok || duration < finest {
+		p.timeframe[candle.Pair] = duration
+		return true
+	}
+	return duration == finest
+}
+
+func (p *PaperWallet) onCandle(candle model.Candle) []model.Order {
+	var updated []int
+
+	if !p.simulated(candle) {
+		return nil
+	}
+
 	p.lastCandle[candle.Pair] = candle
 	if _, ok := p.fistCandle[candle.Pair]; !ok {
 		p.fistCandle[candle.Pair] = candle
 	}
+	p.payFunding(candle)
+
+	type fill struct {
+		index int
+		step  int
+		price float64
+		taker bool
+		path  []float64
+	}
 
+	fills := make([]fill, 0)
 	for i, order := range p.orders {
-		if order.Pair != candle.Pair || order.Status != model.OrderStatusTypeNew {
+		if order.Pair != candle.Pair || !p.arrived(order, candle) || (order.Status != model.OrderStatusTypeNew &&
+			order.Status != model.OrderStatusTypePartiallyFilled) {
 			continue
 		}
 
-		if _, ok := p.volume[candle.Pair]; !ok {
-			p.volume[candle.Pair] = 0
+		path := p.fillModel.Path(candle, order.Side)
+		step, price, taker, ok := p.trigger(order, path)
+		if ok {
+			fills = append(fills, fill{index: i, step: step, price: price, taker: taker, path: path})
+		} else if order.Type == model.OrderTypeTrailingStop {
+			p.trail(&p.orders[i], path)
 		}
+	}
+
+	// orders are filled in the order their prices are reached, the first leg of an OCO wins
+	sort.SliceStable(fills, func(i, j int) bool {
+		return fills[i].step < fills[j].step
+	})
 
-		asset, quote := SplitAssetQuote(order.Pair)
-		if order.Side == model.SideTypeBuy && order.Price >= candle.Close {
+	for _, fill := range fills {
+		i, order := fill.index, p.orders[fill.index]
+		if order.Status != model.OrderStatusTypeNew && order.Status != model.OrderStatusTypePartiallyFilled {
+			continue
+		}
+
+		asset, quote, err := SplitAssetQuote(order.Pair)
+		if err != nil {
+			log.Error().Err(err).Msg("wallet fill failed.")
+			continue
+		}
+
+		if order.Type == model.OrderTypeMarket {
+			if err := p.fillMarketOrder(&p.orders[i], fill.price, candle); err != nil {
+				log.Warn().Err(err).Msgf("market order %d not filled", order.ExchangeID)
+				p.orders[i].UpdatedAt = candle.Time
+				p.orders[i].Status = model.OrderStatusTypeRejected
+				if p.orders[i].ExecutedQuantity > 0 {
+					p.orders[i].Status = model.OrderStatusTypeExpired
+				}
+			}
+			if p.orders[i].Status != order.Status || p.orders[i].ExecutedQuantity != order.ExecutedQuantity {
+				updated = append(updated, i)
+			}
+			continue
+		}
+
+		remaining := order.Quantity - order.ExecutedQuantity
+		quantity := p.take(candle, remaining)
+		if quantity <= 0 {
+			continue
+		}
+
+		feeRate := p.makerFee
+		if fill.taker {
+			feeRate = p.takerFee
+			fill.price = slippagePrice(p.slippage, order.Side, fill.price, quantity, candle)
+		}
+
+		// Cancel other orders from same group, once the first fill happens, the funds
+		// shared by the legs stay with the filled one
+		if order.GroupID != nil && order.Status == model.OrderStatusTypeNew {
+			for j, groupOrder := range p.orders {
+				if groupOrder.GroupID != nil && *groupOrder.GroupID == *order.GroupID &&
+					groupOrder.ExchangeID != order.ExchangeID {
+					p.orders[j].Status = model.OrderStatusTypeCanceled
+					p.orders[j].UpdatedAt = candle.Time
+					delete(p.pending, groupOrder.ExchangeID)
+					delete(p.feeReserve, groupOrder.ExchangeID)
+					delete(p.lockPrice, groupOrder.ExchangeID)
+					updated = append(updated, j)
+					break
+				}
+			}
+		}
+
+		if order.Side == model.SideTypeBuy {
 			if _, ok := p.assets[asset]; !ok {
 				p.assets[asset] = &assetInfo{}
 			}
 
 			actualQty := p.assets[asset].Free + p.assets[asset].Lock
-			orderVolume := order.Price * order.Quantity
+			orderVolume := fill.price * quantity
 			walletValue := p.avgPrice[candle.Pair] * actualQty
 
 			p.volume[candle.Pair] += orderVolume
-			p.orders[i].UpdatedAt = candle.Time
-			p.orders[i].Status = model.OrderStatusTypeFilled
-			p.avgPrice[candle.Pair] = (walletValue + orderVolume) / (actualQty + order.Quantity)
-			p.assets[asset].Free = p.assets[asset].Free + order.Quantity
-			p.assets[quote].Lock = p.assets[quote].Lock - orderVolume
-		}
-
-		if order.Side == model.SideTypeSell {
-			var orderPrice float64
-			if (order.Type == model.OrderTypeLimit ||
-				order.Type == model.OrderTypeLimitMaker ||
-				order.Type == model.OrderTypeTakeProfit ||
-				order.Type == model.OrderTypeTakeProfitLimit) &&
-				candle.High >= order.Price {
-				orderPrice = order.Price
-			} else if (order.Type == model.OrderTypeStopLossLimit ||
-				order.Type == model.OrderTypeStopLoss) &&
-				candle.Low <= *order.Stop {
-				orderPrice = *order.Stop
-			} else {
-				continue
+			p.avgPrice[candle.Pair] = (walletValue + orderVolume) / (actualQty + quantity)
+			p.assets[asset].Free = p.assets[asset].Free + quantity
+
+			// the fee reserved with the order is released before charging the actual fee,
+			// with the funds locked above the fill price
+			reserve := p.feeReserve[order.ExchangeID] * quantity / remaining
+			p.feeReserve[order.ExchangeID] -= reserve
+			locked := p.locked(order, quantity)
+			p.assets[quote].Lock = p.assets[quote].Lock - locked - reserve
+			p.assets[quote].Free = p.assets[quote].Free + reserve + locked - orderVolume
+			p.chargeFee(&p.orders[i], quote, orderVolume, feeRate)
+			execute(&p.orders[i], fill.price, quantity, candle.Time)
+			if p.orders[i].Status == model.OrderStatusTypeFilled {
+				delete(p.feeReserve, order.ExchangeID)
+				delete(p.lockPrice, order.ExchangeID)
 			}
+			updated = append(updated, i)
+			continue
+		}
 
-			// Cancel other orders from same group
-			if order.GroupID != nil {
-				for j, groupOrder := range p.orders {
-					if groupOrder.GroupID != nil && *groupOrder.GroupID == *order.GroupID &&
-						groupOrder.ExchangeID != order.ExchangeID {
-						p.orders[j].Status = model.OrderStatusTypeCanceled
-						p.orders[j].UpdatedAt = candle.Time
-						break
-					}
-				}
-			}
+		// a triggered trailing stop keeps the stop it was reached at
+		if order.Type == model.OrderTypeTrailingStop && order.Status == model.OrderStatusTypeNew {
+			p.trail(&p.orders[i], fill.path[:fill.step+1])
+			delete(p.trailingHigh, order.ExchangeID)
+		}
 
-			if _, ok := p.assets[quote]; !ok {
-				p.assets[quote] = &assetInfo{}
-			}
+		if _, ok := p.assets[quote]; !ok {
+			p.assets[quote] = &assetInfo{}
+		}
 
-			orderVolume := order.Quantity * orderPrice
-			profitValue := order.Quantity*orderPrice - order.Quantity*p.avgPrice[candle.Pair]
-			percentage := profitValue / (order.Quantity * p.avgPrice[candle.Pair])
-			log.Info().Msgf("PROFIT = %.4f %s (%.2f %%)", profitValue, quote, percentage*100)
+		orderVolume := quantity * fill.price
+		profitValue := quantity*fill.price - quantity*p.avgPrice[candle.Pair]
+		percentage := profitValue / (quantity * p.avgPrice[candle.Pair])
+		log.Info().Msgf("PROFIT = %.4f %s (%.2f %%)", profitValue, quote, percentage*100)
+
+		p.volume[candle.Pair] += orderVolume
+		p.assets[asset].Lock = p.assets[asset].Lock - quantity
+		p.assets[quote].Free = p.assets[quote].Free + orderVolume
+		p.chargeFee(&p.orders[i], quote, orderVolume, feeRate)
+		execute(&p.orders[i], fill.price, quantity, candle.Time)
+		updated = append(updated, i)
+	}
 
-			p.volume[candle.Pair] += orderVolume
-			p.orders[i].UpdatedAt = candle.Time
-			p.orders[i].Status = model.OrderStatusTypeFilled
-			p.assets[asset].Lock = p.assets[asset].Lock - order.Quantity
-			p.assets[quote].Free = p.assets[quote].Free + order.Quantity*orderPrice
+	if p.margin != nil {
+		if candle.Complete {
+			p.accrue(candle)
 		}
+		updated = append(updated, p.liquidate(candle)...)
 	}
 
 	if candle.Complete {
 		var total float64
 		for asset, info := range p.assets {
-			amount := info.Free + info.Lock
+			amount := info.Free + info.Lock - p.borrowed[asset] - p.interest[asset]
 			pair := strings.ToUpper(asset + p.baseCoin)
 			total += amount * p.lastCandle[pair].Close
-			p.assetValues[asset] = append(p.assetValues[asset], AssetValue{
+			p.assetValues[asset] = appendValue(p.assetValues[asset], AssetValue{
 				Time:  candle.Time,
 				Value: amount * p.lastCandle[pair].Close,
 			})
 		}
 
 		baseCoinInfo := p.assets[p.baseCoin]
-		p.equityValues = append(p.equityValues, AssetValue{
+		p.equityValues = appendValue(p.equityValues, AssetValue{
 			Time:  candle.Time,
 			Value: total + baseCoinInfo.Lock + baseCoinInfo.Free,
 		})
 	}
+
+	orders := make([]model.Order, 0, len(updated))
+	for _, i := range updated {
+		orders = append(orders, p.orders[i])
+	}
+	return orders
+}
+
+// appendValue appends a value to the series, the candles of the other pairs closed at the
+// same time update the last value
+func appendValue(values []AssetValue, value AssetValue) []AssetValue {
+	if last := len(values) - 1; last >= 0 && values[last].Time.Equal(value.Time) {
+		values[last] = value
+		return values
+	}
+	return append(values, value)
 }
 
 func (p *PaperWallet) Account() (model.Account, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.account()
+}
+
+func (p *PaperWallet) account() (model.Account, error) {
 	balances := make([]model.Balance, 0)
 	for pair, info := range p.assets {
 		balances = append(balances, model.Balance{
-			Tick: pair,
-			Free: info.Free,
-			Lock: info.Lock,
+			Tick:     pair,
+			Free:     info.Free,
+			Lock:     info.Lock,
+			Borrowed: p.borrowed[pair],
+			Interest: p.interest[pair],
 		})
 	}
 
@@ -342,8 +1015,12 @@ func (p *PaperWallet) Position(pair string) (asset, quote float64, err error) {
 	p.Lock()
 	defer p.Unlock()
 
-	assetTick, quoteTick := SplitAssetQuote(pair)
-	acc, err := p.Account()
+	assetTick, quoteTick, err := SplitAssetQuote(pair)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	acc, err := p.account()
 	if err != nil {
 		return 0, 0, err
 	}
@@ -356,12 +1033,24 @@ func (p *PaperWallet) Position(pair string) (asset, quote float64, err error) {
 
 func (p *PaperWallet) CreateOrderOCO(side model.SideType, pair string,
 	size, price, stop, stopLimit float64) ([]model.Order, error) {
+	defer p.notify()
 	p.Lock()
 	defer p.Unlock()
 
-	asset, _ := SplitAssetQuote(pair)
+	asset, quote, err := SplitAssetQuote(pair)
+	if err != nil {
+		return nil, err
+	}
 
-	err := p.lockFunds(asset, size)
+	// a buy locks the quote of the highest price of its legs
+	var reserve, lockPrice float64
+	if side == model.SideTypeSell {
+		err = p.lockFunds(asset, size)
+	} else {
+		lockPrice = math.Max(price, math.Max(stop, stopLimit))
+		reserve = size * lockPrice * p.quoteFeeRate(quote, size*lockPrice, p.takerFee)
+		err = p.lockFunds(quote, size*lockPrice+reserve)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -395,7 +1084,14 @@ func (p *PaperWallet) CreateOrderOCO(side model.SideType, pair string,
 		GroupID:    &groupID,
 		RefPrice:   p.lastCandle[pair].Close,
 	}
-	p.orders = append(p.orders, limitMaker, stopOrder)
+	if side == model.SideTypeBuy {
+		for _, order := range []model.Order{limitMaker, stopOrder} {
+			p.feeReserve[order.ExchangeID] = reserve
+			p.lockPrice[order.ExchangeID] = lockPrice
+		}
+	}
+	p.submit(limitMaker, 0)
+	p.submit(stopOrder, 0)
 
 	return []model.Order{limitMaker, stopOrder}, nil
 }
@@ -403,17 +1099,24 @@ func (p *PaperWallet) CreateOrderOCO(side model.SideType, pair string,
 func (p *PaperWallet) CreateOrderLimit(side model.SideType, pair string,
 	size float64, limit float64) (model.Order, error) {
 
+	defer p.notify()
 	p.Lock()
 	defer p.Unlock()
 
-	asset, quote := SplitAssetQuote(pair)
+	asset, quote, err := SplitAssetQuote(pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	var reserve float64
 	if side == model.SideTypeSell {
 		err := p.lockFunds(asset, size)
 		if err != nil {
 			return model.Order{}, err
 		}
 	} else {
-		err := p.lockFunds(quote, size*limit)
+		reserve = size * limit * p.quoteFeeRate(quote, size*limit, p.makerFee)
+		err := p.lockFunds(quote, size*limit+reserve)
 		if err != nil {
 			return model.Order{}, err
 		}
@@ -429,23 +1132,32 @@ func (p *PaperWallet) CreateOrderLimit(side model.SideType, pair string,
 		Price:      limit,
 		Quantity:   size,
 	}
-	p.orders = append(p.orders, order)
+	if reserve > 0 {
+		p.feeReserve[order.ExchangeID] = reserve
+	}
+	p.submit(order, 0)
 	return order, nil
 }
 
 func (p *PaperWallet) CreateOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
+	defer p.notify()
 	p.Lock()
 	defer p.Unlock()
 
-	return p.createOrderMarket(side, pair, size)
+	return p.createOrderMarket(side, pair, size, "")
 }
 
 func (p *PaperWallet) CreateOrderStop(pair string, size float64, limit float64) (model.Order, error) {
+	defer p.notify()
 	p.Lock()
 	defer p.Unlock()
 
-	asset, _ := SplitAssetQuote(pair)
-	err := p.lockFunds(asset, size)
+	asset, _, err := SplitAssetQuote(pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	err = p.lockFunds(asset, size)
 	if err != nil {
 		return model.Order{}, err
 	}
@@ -462,17 +1174,126 @@ func (p *PaperWallet) CreateOrderStop(pair string, size float64, limit float64)
 		Stop:       &limit,
 		Quantity:   size,
 	}
+	p.submit(order, 0)
+	return order, nil
+}
+
+// CreateOrderTrailingStop sells at market when the price falls the trailing distance from the
+// high reached since the order creation, the high-water mark is followed through the path of
+// the fill model of each candle
+func (p *PaperWallet) CreateOrderTrailingStop(pair string, size float64, trailing model.Trailing) (model.Order, error) {
+	defer p.notify()
+	p.Lock()
+	defer p.Unlock()
+
+	if !trailing.Valid() {
+		return model.Order{}, &OrderError{
+			Err:      ErrInvalidTrailing,
+			Pair:     pair,
+			Quantity: size,
+		}
+	}
+
+	asset, _, err := SplitAssetQuote(pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	err = p.lockFunds(asset, size)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	candle := p.lastCandle[pair]
+	stop := trailing.Stop(candle.Close)
+	order := model.Order{
+		ExchangeID: p.ID(),
+		CreatedAt:  candle.Time,
+		UpdatedAt:  candle.Time,
+		Pair:       pair,
+		Side:       model.SideTypeSell,
+		Type:       model.OrderTypeTrailingStop,
+		Status:     model.OrderStatusTypeNew,
+		Price:      stop,
+		Stop:       &stop,
+		Trailing:   &trailing,
+		Quantity:   size,
+	}
+	p.trailingHigh[order.ExchangeID] = candle.Close
+	p.submit(order, 0)
+	return order, nil
+}
+
+// trail raises the high-water mark of a trailing stop with the path of a candle and moves its stop
+func (p *PaperWallet) trail(order *model.Order, path []float64) {
+	high := p.trailingHigh[order.ExchangeID]
+	for _, value := range path {
+		high = math.Max(high, value)
+	}
+	if high == p.trailingHigh[order.ExchangeID] {
+		return
+	}
+
+	stop := order.Trailing.Stop(high)
+	p.trailingHigh[order.ExchangeID] = high
+	order.Price = stop
+	order.Stop = &stop
+}
+
+func (p *PaperWallet) createOrderMarket(side model.SideType, pair string, size float64,
+	positionSide model.PositionSideType) (model.Order, error) {
+	asset, quote, err := SplitAssetQuote(pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	candle := p.lastCandle[pair]
+	order := model.Order{
+		ExchangeID: p.ID(),
+		CreatedAt:  candle.Time,
+		UpdatedAt:  candle.Time,
+		Pair:       pair,
+		Side:       side,
+		Type:       model.OrderTypeMarket,
+		Status:     model.OrderStatusTypeNew,
+		Price:      candle.Close,
+		Quantity:   size,
+
+		PositionSide: positionSide,
+	}
+
+	// the funds of the whole order are checked with the last price
+	lock, err := p.lockRemaining(&order, asset, quote, candle.Close)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	// a delayed order keeps the funds locked until it arrives
+	if p.latency.Candles > 0 || p.latency.Duration > 0 {
+		p.submit(order, lock)
+		return order, nil
+	}
+
+	p.release(order, asset, quote, lock)
+	if err := p.fillMarketOrder(&order, candle.Close, candle); err != nil {
+		if order.ExecutedQuantity == 0 {
+			return model.Order{}, err
+		}
+		log.Warn().Err(err).Msgf("market order %d not filled", order.ExchangeID)
+		order.Status = model.OrderStatusTypeExpired
+	}
 	p.orders = append(p.orders, order)
+	p.publish(order)
 	return order, nil
 }
 
-func (p *PaperWallet) createOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
-	asset, quote := SplitAssetQuote(pair)
-	if side == model.SideTypeSell {
+// fillMarket executes a quantity of a market order at the price with the free balances
+func (p *PaperWallet) fillMarket(order *model.Order, asset, quote string, price, size float64) error {
+	if order.Side == model.SideTypeSell {
 		if value, ok := p.assets[asset]; !ok || value.Free < size {
-			return model.Order{}, &OrderError{
+			return &OrderError{
 				Err:      ErrInsufficientFunds,
-				Pair:     pair,
+				Pair:     order.Pair,
 				Quantity: size,
 			}
 		}
@@ -480,12 +1301,14 @@ func (p *PaperWallet) createOrderMarket(side model.SideType, pair string, size f
 			p.assets[quote] = &assetInfo{}
 		}
 		p.assets[asset].Free = p.assets[asset].Free - size
-		p.assets[quote].Free = p.assets[quote].Free + p.lastCandle[pair].Close*size
+		p.assets[quote].Free = p.assets[quote].Free + price*size
 	} else {
-		if value, ok := p.assets[quote]; !ok || value.Free < size*p.lastCandle[pair].Close {
-			return model.Order{}, &OrderError{
+		cost := size * price
+		quoteFee := cost * p.quoteFeeRate(quote, cost, p.takerFee)
+		if value, ok := p.assets[quote]; !ok || value.Free < cost+quoteFee {
+			return &OrderError{
 				Err:      ErrInsufficientFunds,
-				Pair:     pair,
+				Pair:     order.Pair,
 				Quantity: size,
 			}
 		}
@@ -493,70 +1316,157 @@ func (p *PaperWallet) createOrderMarket(side model.SideType, pair string, size f
 			p.assets[asset] = &assetInfo{}
 		}
 		actualQty := p.assets[asset].Free + p.assets[asset].Lock
-		p.avgPrice[pair] = (p.avgPrice[pair]*actualQty + p.lastCandle[pair].Close*size) / (actualQty + size)
-		p.assets[quote].Free = p.assets[quote].Free - (size * p.lastCandle[pair].Close)
+		p.avgPrice[order.Pair] = (p.avgPrice[order.Pair]*actualQty + cost) / (actualQty + size)
+		p.assets[quote].Free = p.assets[quote].Free - cost
 		p.assets[asset].Free = p.assets[asset].Free + size
 	}
-
-	if _, ok := p.volume[pair]; !ok {
-		p.volume[pair] = 0
-	}
-
-	p.volume[pair] += p.lastCandle[pair].Close * size
-
-	order := model.Order{
-		ExchangeID: p.ID(),
-		CreatedAt:  p.lastCandle[pair].Time,
-		UpdatedAt:  p.lastCandle[pair].Time,
-		Pair:       pair,
-		Side:       side,
-		Type:       model.OrderTypeMarket,
-		Status:     model.OrderStatusTypeFilled,
-		Price:      p.lastCandle[pair].Close,
-		Quantity:   size,
-	}
-	p.orders = append(p.orders, order)
-	return order, nil
+	p.chargeFee(order, quote, size*price, p.takerFee)
+	execute(order, price, size, p.lastCandle[order.Pair].Time)
+	p.volume[order.Pair] += price * size
+	return nil
 }
 
+// CreateOrderMarketQuote spends the given quote amount, fees paid in the quote asset included
 func (p *PaperWallet) CreateOrderMarketQuote(side model.SideType, pair string,
 	quantity float64) (model.Order, error) {
+	defer p.notify()
 	p.Lock()
 	defer p.Unlock()
 
-	return p.createOrderMarket(side, pair, quantity/p.lastCandle[pair].Close)
+	_, quote, err := SplitAssetQuote(pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	if side == model.SideTypeBuy {
+		quantity /= 1 + p.quoteFeeRate(quote, quantity, p.takerFee)
+	}
+
+	// the size is estimated with the slippage of the quote amount at the last price
+	candle := p.lastCandle[pair]
+	price := slippagePrice(p.slippage, side, candle.Close, quantity/candle.Close, candle)
+	return p.createOrderMarket(side, pair, quantity/price, "")
 }
 
+// Cancel cancels an open order and releases the funds of its quantity not executed,
+// the legs of an OCO are canceled together
 func (p *PaperWallet) Cancel(order model.Order) error {
+	defer p.notify()
 	p.Lock()
 	defer p.Unlock()
 
 	for i, o := range p.orders {
-		if o.ExchangeID == order.ExchangeID {
-			p.orders[i].Status = model.OrderStatusTypeCanceled
+		if o.ExchangeID != order.ExchangeID {
+			continue
+		}
+		if o.Status != model.OrderStatusTypeNew && o.Status != model.OrderStatusTypePartiallyFilled {
+			return nil
 		}
+
+		// a waiting market order keeps its funds with the pending order
+		p.cancelPending(o)
+		if o.Type != model.OrderTypeMarket {
+			p.unlock(o)
+		}
+		delete(p.trailingHigh, o.ExchangeID)
+
+		for j, other := range p.orders {
+			if j == i || o.GroupID == nil || other.GroupID == nil || *other.GroupID != *o.GroupID ||
+				other.Status != model.OrderStatusTypeNew {
+				continue
+			}
+			p.orders[j].Status = model.OrderStatusTypeCanceled
+			p.orders[j].UpdatedAt = p.lastCandle[o.Pair].Time
+			delete(p.feeReserve, other.ExchangeID)
+			delete(p.lockPrice, other.ExchangeID)
+			p.publish(p.orders[j])
+		}
+		p.orders[i].Status = model.OrderStatusTypeCanceled
+		p.orders[i].UpdatedAt = p.lastCandle[o.Pair].Time
+		p.publish(p.orders[i])
+		return nil
 	}
 	return nil
 }
 
+// unlock releases the funds locked by the quantity not executed of an order, with the
+// fee reserved by a limit buy. The legs of an OCO share the funds of a single leg.
+func (p *PaperWallet) unlock(order model.Order) {
+	asset, quote, err := SplitAssetQuote(order.Pair)
+	if err != nil {
+		return
+	}
+
+	remaining := order.Quantity - order.ExecutedQuantity
+	if order.Side == model.SideTypeSell {
+		p.release(order, asset, quote, remaining)
+		return
+	}
+
+	p.release(order, asset, quote, p.locked(order, remaining)+p.feeReserve[order.ExchangeID])
+	delete(p.feeReserve, order.ExchangeID)
+	delete(p.lockPrice, order.ExchangeID)
+}
+
+// locked is the quote locked by a quantity of a buy order, at the price of the order or
+// at the lock price of an OCO
+func (p *PaperWallet) locked(order model.Order, quantity float64) float64 {
+	if price, ok := p.lockPrice[order.ExchangeID]; ok {
+		return quantity * price
+	}
+	return quantity * order.Price
+}
+
 func (p *PaperWallet) Order(pair string, id int64) (model.Order, error) {
+	p.Lock()
+	defer p.Unlock()
+
 	for _, order := range p.orders {
 		if order.ExchangeID == id {
 			return order, nil
 		}
 	}
-	return model.Order{}, errors.New("order not found")
+	return model.Order{}, ErrOrderNotFound
 }
 
-func (p *PaperWallet) CandlesByPeriod(ctx context.Context, pair, period string,
+func (p *PaperWallet) GetCandlesByPeriod(ctx context.Context, pair, period string,
 	start, end time.Time) ([]model.Candle, error) {
+	if p.feeder == nil {
+		return nil, ErrNoFeeder
+	}
 	return p.feeder.GetCandlesByPeriod(ctx, pair, period, start, end)
 }
 
-func (p *PaperWallet) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+func (p *PaperWallet) GetCandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	if p.feeder == nil {
+		return nil, ErrNoFeeder
+	}
 	return p.feeder.GetCandlesByLimit(ctx, pair, period, limit)
 }
 
-func (p *PaperWallet) CandlesSubscription(ctx context.Context, pair, timeframe string) (chan *model.Candle, chan error) {
-	return p.feeder.SubscribeCandle(ctx, pair, timeframe)
+// SubscribeCandle forwards the candles of the wrapped feeder, each candle is
+// applied to the wallet before it is received by the subscriber
+func (p *PaperWallet) SubscribeCandle(ctx context.Context, pair, timeframe string) (chan *model.Candle, chan error) {
+	if p.feeder == nil {
+		ccandle, cerr := make(chan *model.Candle), make(chan error, 1)
+		cerr <- ErrNoFeeder
+		close(ccandle)
+		close(cerr)
+		return ccandle, cerr
+	}
+
+	candles, errs := p.feeder.SubscribeCandle(ctx, pair, timeframe)
+	ccandle := make(chan *model.Candle)
+	go func() {
+		defer close(ccandle)
+		for candle := range candles {
+			p.OnCandle(*candle)
+			select {
+			case ccandle <- candle:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ccandle, errs
 }
@@ -0,0 +1,854 @@
+package exchange
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaperWallet_Fees(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(pair string, hour int, price float64) model.Candle {
+		return model.Candle{
+			Pair:     pair,
+			Time:     start.Add(time.Duration(hour) * time.Hour),
+			Open:     price,
+			High:     price,
+			Low:      price,
+			Close:    price,
+			Complete: true,
+		}
+	}
+
+	t.Run("quote asset", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 1000), WithPaperFee(0.001, 0.002))
+		wallet.OnCandle(candle("BTCUSDT", 0, 100))
+
+		// all the balance is spent, fee included
+		order, err := wallet.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSDT", 1000)
+		require.NoError(t, err)
+		require.Equal(t, "USDT", order.FeeAsset)
+		require.InDelta(t, 1000, order.Quantity*order.Price+order.Fee, 1e-9)
+		require.InDelta(t, 0, wallet.assets["USDT"].Free, 1e-9)
+
+		_, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.ErrorIs(t, err.(*OrderError).Err, ErrInsufficientFunds)
+
+		limit, err := wallet.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", order.Quantity, 110)
+		require.NoError(t, err)
+		wallet.OnCandle(candle("BTCUSDT", 1, 120))
+
+		filled, err := wallet.Order("BTCUSDT", limit.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, filled.Status)
+		require.InDelta(t, order.Quantity*110*0.001, filled.Fee, 1e-9)
+		require.InDelta(t, order.Quantity*110-filled.Fee, wallet.assets["USDT"].Free, 1e-9)
+		require.InDelta(t, order.Fee+filled.Fee, wallet.Fees()["USDT"], 1e-9)
+	})
+
+	t.Run("limit buy reserves the fee", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 1000), WithPaperFee(0.001, 0.001))
+		wallet.OnCandle(candle("BTCUSDT", 0, 100))
+
+		order, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 5, 90)
+		require.NoError(t, err)
+		require.InDelta(t, 450.45, wallet.assets["USDT"].Lock, 1e-9)
+
+		wallet.OnCandle(candle("BTCUSDT", 1, 90))
+		filled, err := wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.InDelta(t, 0.45, filled.Fee, 1e-9)
+		require.InDelta(t, 0, wallet.assets["USDT"].Lock, 1e-9)
+		require.InDelta(t, 1000-450-0.45, wallet.assets["USDT"].Free, 1e-9)
+	})
+
+	t.Run("fee asset with discount", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 1000), WithPaperAsset("BNB", 1),
+			WithPaperFee(0.001, 0.001), WithPaperFeeAsset("BNB", 0.25))
+		wallet.OnCandle(candle("BNBUSDT", 0, 10))
+		wallet.OnCandle(candle("BTCUSDT", 0, 100))
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 5)
+		require.NoError(t, err)
+		require.Equal(t, "BNB", order.FeeAsset)
+		require.InDelta(t, 500*0.001*0.75/10, order.Fee, 1e-9)
+		require.InDelta(t, 500, wallet.assets["USDT"].Free, 1e-9)
+		require.InDelta(t, 1-order.Fee, wallet.assets["BNB"].Free, 1e-9)
+
+		// without enough BNB the fee is paid in the quote asset
+		wallet.assets["BNB"].Free = 0
+		order, err = wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 5)
+		require.NoError(t, err)
+		require.Equal(t, "USDT", order.FeeAsset)
+		require.InDelta(t, 0.5, order.Fee, 1e-9)
+	})
+}
+
+func TestPaperWallet_FillModel(t *testing.T) {
+	start := time.Date(2021, 5, 13, 0, 0, 0, 0, time.UTC)
+	candle := model.Candle{
+		Pair:     "BTCUSDT",
+		Time:     start,
+		Open:     100,
+		High:     120,
+		Low:      80,
+		Close:    100,
+		Complete: true,
+	}
+
+	// an OCO with both legs reached by the same candle
+	oco := func(t *testing.T, fillModel FillModel) (model.Order, model.Order) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 0), WithPaperAsset("BTC", 1), WithPaperFillModel(fillModel))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(-time.Hour), Close: 100, Complete: true})
+
+		orders, err := wallet.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 110, 90, 90)
+		require.NoError(t, err)
+		wallet.OnCandle(candle)
+
+		takeProfit, err := wallet.Order("BTCUSDT", orders[0].ExchangeID)
+		require.NoError(t, err)
+		stopLoss, err := wallet.Order("BTCUSDT", orders[1].ExchangeID)
+		require.NoError(t, err)
+		return takeProfit, stopLoss
+	}
+
+	t.Run("open high low close", func(t *testing.T) {
+		takeProfit, stopLoss := oco(t, OHLCFillModel())
+		require.Equal(t, model.OrderStatusTypeFilled, takeProfit.Status)
+		require.Equal(t, model.OrderStatusTypeCanceled, stopLoss.Status)
+	})
+
+	t.Run("open low high close", func(t *testing.T) {
+		takeProfit, stopLoss := oco(t, OLHCFillModel())
+		require.Equal(t, model.OrderStatusTypeCanceled, takeProfit.Status)
+		require.Equal(t, model.OrderStatusTypeFilled, stopLoss.Status)
+	})
+
+	t.Run("pessimistic", func(t *testing.T) {
+		takeProfit, stopLoss := oco(t, PessimisticFillModel())
+		require.Equal(t, model.OrderStatusTypeCanceled, takeProfit.Status)
+		require.Equal(t, model.OrderStatusTypeFilled, stopLoss.Status)
+
+		// limits touched but not traded through are not filled
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 1000), WithPaperFillModel(PessimisticFillModel()))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(-time.Hour), Close: 100, Complete: true})
+		order, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 80)
+		require.NoError(t, err)
+		wallet.OnCandle(candle)
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		takeProfit, stopLoss := oco(t, CloseFillModel())
+		require.Equal(t, model.OrderStatusTypeNew, takeProfit.Status)
+		require.Equal(t, model.OrderStatusTypeNew, stopLoss.Status)
+	})
+
+	t.Run("stop filled at the open of a gap", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 0), WithPaperAsset("BTC", 1))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(-time.Hour), Close: 100, Complete: true})
+		order, err := wallet.CreateOrderStop("BTCUSDT", 1, 90)
+		require.NoError(t, err)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start, Open: 85, High: 95, Low: 80, Close: 90, Complete: true})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.InDelta(t, 85, wallet.assets["USDT"].Free, 1e-9)
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		fillModel, err := NewReplayFillModel("1d", OHLCFillModel(), PairFeed{
+			Pair:      "BTCUSDT",
+			File:      "../../testdata/btc-1h-2021-05-13.csv",
+			Timeframe: "1h",
+		})
+		require.NoError(t, err)
+		require.Equal(t, "replay (fallback open-high-low-close)", fillModel.Name())
+
+		feed, err := NewCSVFeed("1d", PairFeed{
+			Pair:      "BTCUSDT",
+			File:      "../../testdata/btc-1d-2021-05-13.csv",
+			Timeframe: "1d",
+		})
+		require.NoError(t, err)
+		daily := feed.CandlePairTimeFrame["BTCUSDT--1d"][0]
+
+		path := fillModel.Path(daily, model.SideTypeSell)
+		require.Len(t, path, 24*4)
+		require.Equal(t, daily.Open, path[0])
+
+		// the daily low is reached before its high inside the hourly candles
+		low, high := -1, -1
+		for i, price := range path {
+			if price == daily.Low && low < 0 {
+				low = i
+			}
+			if price == daily.High && high < 0 {
+				high = i
+			}
+		}
+		require.Less(t, low, high)
+
+		// candles without hourly data use the fallback
+		next := daily
+		next.Time = next.Time.Add(24 * time.Hour)
+		require.Equal(t, []float64{next.Open, next.High, next.Low, next.Close}, fillModel.Path(next, model.SideTypeSell))
+	})
+}
+
+func TestPaperWallet_Slippage(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := model.Candle{Pair: "BTCUSDT", Time: start, Open: 100, High: 100, Low: 100,
+		Close: 100, Volume: 10, Complete: true}
+
+	t.Run("fixed", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 1000), WithPaperSlippage(FixedSlippage(10)))
+		wallet.OnCandle(candle)
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		require.InDelta(t, 100.1, order.Price, 1e-9)
+		require.InDelta(t, 1000-100.1, wallet.assets["USDT"].Free, 1e-9)
+
+		order, err = wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+		require.NoError(t, err)
+		require.InDelta(t, 99.9, order.Price, 1e-9)
+	})
+
+	t.Run("spread", func(t *testing.T) {
+		require.InDelta(t, 0.001, SpreadSlippage(20).Rate(1, candle), 1e-12)
+	})
+
+	t.Run("volume", func(t *testing.T) {
+		slippage := VolumeSlippage(0.1, 0.05)
+		require.InDelta(t, 0.01, slippage.Rate(1, candle), 1e-12)
+		require.InDelta(t, 0.05, slippage.Rate(10, candle), 1e-12)
+		require.InDelta(t, 0.05, slippage.Rate(1, model.Candle{}), 1e-12)
+	})
+
+	t.Run("market quote spends the amount", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 1000), WithPaperSlippage(FixedSlippage(50)))
+		wallet.OnCandle(candle)
+
+		order, err := wallet.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSDT", 1000)
+		require.NoError(t, err)
+		require.InDelta(t, 1000, order.Price*order.Quantity, 1e-9)
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 0), WithPaperAsset("BTC", 1), WithPaperSlippage(FixedSlippage(100)))
+		wallet.OnCandle(candle)
+
+		_, err := wallet.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 110, 90, 90)
+		require.NoError(t, err)
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Hour), Open: 95, High: 95,
+			Low: 85, Close: 85, Volume: 10, Complete: true})
+		require.InDelta(t, 89.1, wallet.assets["USDT"].Free, 1e-9)
+	})
+}
+
+func TestPaperWallet_Latency(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hour int, open, close float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hour) * time.Hour),
+			Open: open, High: math.Max(open, close), Low: math.Min(open, close), Close: close, Complete: true}
+	}
+
+	t.Run("candles", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 1000), WithPaperLatency(2, 0))
+		wallet.OnCandle(candle(0, 100, 100))
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		require.InDelta(t, 100, wallet.assets["USDT"].Lock, 1e-9)
+
+		wallet.OnCandle(candle(1, 105, 110))
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+
+		// filled at the open of the candle where the order arrives
+		wallet.OnCandle(candle(2, 120, 130))
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.InDelta(t, 120, order.Price, 1e-9)
+		require.InDelta(t, 0, wallet.assets["USDT"].Lock, 1e-9)
+		require.InDelta(t, 880, wallet.assets["USDT"].Free, 1e-9)
+		require.InDelta(t, 1, wallet.assets["BTC"].Free, 1e-9)
+	})
+
+	t.Run("duration", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 0), WithPaperAsset("BTC", 1), WithPaperLatency(0, 90*time.Minute))
+		wallet.OnCandle(candle(0, 100, 100))
+
+		order, err := wallet.CreateOrderStop("BTCUSDT", 1, 90)
+		require.NoError(t, err)
+
+		// the stop is not on the exchange yet
+		wallet.OnCandle(candle(1, 100, 80))
+		wallet.OnCandle(candle(2, 85, 95))
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.InDelta(t, 85, wallet.assets["USDT"].Free, 1e-9)
+	})
+
+	t.Run("rejected without funds at arrival", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 100), WithPaperLatency(1, 0))
+		wallet.OnCandle(candle(0, 100, 100))
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		wallet.OnCandle(candle(1, 110, 110))
+
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeRejected, order.Status)
+		require.InDelta(t, 100, wallet.assets["USDT"].Free, 1e-9)
+		require.InDelta(t, 0, wallet.assets["USDT"].Lock, 1e-9)
+	})
+
+	t.Run("cancel releases the funds", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 100), WithPaperLatency(1, 0))
+		wallet.OnCandle(candle(0, 100, 100))
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		require.NoError(t, wallet.Cancel(order))
+		require.InDelta(t, 100, wallet.assets["USDT"].Free, 1e-9)
+		require.InDelta(t, 0, wallet.assets["USDT"].Lock, 1e-9)
+	})
+}
+
+func TestPaperWallet_Liquidity(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hour int, low, high float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hour) * time.Hour),
+			Open: 100, High: high, Low: low, Close: 100, Volume: 10, Complete: true}
+	}
+
+	wallet := NewPaperWallet(context.Background(), "USDT",
+		WithPaperAsset("USDT", 0), WithPaperAsset("BTC", 2), WithPaperLiquidity(0.1))
+	wallet.OnCandle(candle(0, 100, 100))
+
+	orders, err := wallet.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 2, 110, 90, 90)
+	require.NoError(t, err)
+
+	// the first fill of a leg cancels the other one
+	wallet.OnCandle(candle(1, 100, 115))
+	takeProfit, err := wallet.Order("BTCUSDT", orders[0].ExchangeID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypePartiallyFilled, takeProfit.Status)
+	require.Equal(t, 1.0, takeProfit.ExecutedQuantity)
+	stopLoss, err := wallet.Order("BTCUSDT", orders[1].ExchangeID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeCanceled, stopLoss.Status)
+	require.InDelta(t, 110, wallet.assets["USDT"].Free, 1e-9)
+	require.InDelta(t, 1, wallet.assets["BTC"].Lock, 1e-9)
+
+	// the price must reach the limit again to fill the rest
+	wallet.OnCandle(candle(2, 85, 100))
+	takeProfit, err = wallet.Order("BTCUSDT", orders[0].ExchangeID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypePartiallyFilled, takeProfit.Status)
+
+	wallet.OnCandle(candle(3, 100, 110))
+	takeProfit, err = wallet.Order("BTCUSDT", orders[0].ExchangeID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, takeProfit.Status)
+	require.Equal(t, 2.0, takeProfit.ExecutedQuantity)
+	require.InDelta(t, 220, wallet.assets["USDT"].Free, 1e-9)
+	require.InDelta(t, 0, wallet.assets["BTC"].Lock, 1e-9)
+}
+
+func TestPaperWallet_BuyOCO(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hour int, low, high float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hour) * time.Hour),
+			Open: 100, High: high, Low: low, Close: 100, Volume: 10, Complete: true}
+	}
+
+	t.Run("limit below the price", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 200))
+		wallet.OnCandle(candle(0, 100, 100))
+
+		orders, err := wallet.CreateOrderOCO(model.SideTypeBuy, "BTCUSDT", 1, 90, 110, 111)
+		require.NoError(t, err)
+		require.InDelta(t, 111, wallet.assets["USDT"].Lock, 1e-9)
+
+		wallet.OnCandle(candle(1, 85, 100))
+		limit, err := wallet.Order("BTCUSDT", orders[0].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, limit.Status)
+		stop, err := wallet.Order("BTCUSDT", orders[1].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, stop.Status)
+
+		// the quote locked above the fill price is released
+		require.InDelta(t, 0, wallet.assets["USDT"].Lock, 1e-9)
+		require.InDelta(t, 110, wallet.assets["USDT"].Free, 1e-9)
+		require.InDelta(t, 1, wallet.assets["BTC"].Free, 1e-9)
+	})
+
+	t.Run("stop above the price", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 200))
+		wallet.OnCandle(candle(0, 100, 100))
+
+		orders, err := wallet.CreateOrderOCO(model.SideTypeBuy, "BTCUSDT", 1, 90, 110, 111)
+		require.NoError(t, err)
+
+		wallet.OnCandle(candle(1, 100, 115))
+		stop, err := wallet.Order("BTCUSDT", orders[1].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, stop.Status)
+		require.InDelta(t, 0, wallet.assets["USDT"].Lock, 1e-9)
+		require.InDelta(t, 90, wallet.assets["USDT"].Free, 1e-9)
+	})
+}
+
+func TestPaperWallet_Cancel(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hour int, low, high float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hour) * time.Hour),
+			Open: 100, High: high, Low: low, Close: 100, Volume: 10, Complete: true}
+	}
+
+	t.Run("limit buy partially filled", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 1000), WithPaperFee(0.001, 0.001), WithPaperLiquidity(0.1))
+		wallet.OnCandle(candle(0, 100, 100))
+
+		order, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 3, 90)
+		require.NoError(t, err)
+		wallet.OnCandle(candle(1, 85, 100))
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypePartiallyFilled, order.Status)
+
+		require.NoError(t, wallet.Cancel(order))
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+		require.InDelta(t, 0, wallet.assets["USDT"].Lock, 1e-9)
+		require.InDelta(t, 1000-90-0.09, wallet.assets["USDT"].Free, 1e-9)
+		require.InDelta(t, 1, wallet.assets["BTC"].Free, 1e-9)
+
+		// a canceled order is not released twice
+		require.NoError(t, wallet.Cancel(order))
+		require.InDelta(t, 1000-90-0.09, wallet.assets["USDT"].Free, 1e-9)
+	})
+
+	t.Run("oco partially filled", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 0), WithPaperAsset("BTC", 2), WithPaperLiquidity(0.1))
+		wallet.OnCandle(candle(0, 100, 100))
+
+		orders, err := wallet.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 2, 110, 90, 90)
+		require.NoError(t, err)
+		wallet.OnCandle(candle(1, 100, 115))
+
+		require.NoError(t, wallet.Cancel(orders[0]))
+		require.InDelta(t, 0, wallet.assets["BTC"].Lock, 1e-9)
+		require.InDelta(t, 1, wallet.assets["BTC"].Free, 1e-9)
+		require.InDelta(t, 110, wallet.assets["USDT"].Free, 1e-9)
+	})
+
+	t.Run("oco canceled with its stop", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			WithPaperAsset("USDT", 0), WithPaperAsset("BTC", 2))
+		wallet.OnCandle(candle(0, 100, 100))
+
+		orders, err := wallet.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 2, 110, 90, 90)
+		require.NoError(t, err)
+		require.NoError(t, wallet.Cancel(orders[1]))
+		for _, order := range orders {
+			order, err := wallet.Order("BTCUSDT", order.ExchangeID)
+			require.NoError(t, err)
+			require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+		}
+		require.InDelta(t, 0, wallet.assets["BTC"].Lock, 1e-9)
+		require.InDelta(t, 2, wallet.assets["BTC"].Free, 1e-9)
+	})
+
+	t.Run("filled order", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+		wallet.OnCandle(candle(0, 100, 100))
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		require.NoError(t, wallet.Cancel(order))
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.InDelta(t, 1, wallet.assets["BTC"].Free, 1e-9)
+	})
+}
+
+func TestPaperWallet_Margin(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hours int, open, high, close float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hours) * time.Hour),
+			Open: open, High: high, Low: math.Min(open, close), Close: close, Complete: true}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100))
+		wallet.OnCandle(candle(0, 100, 100, 100))
+		_, err := wallet.OpenShort("BTCUSDT", 1)
+		require.ErrorIs(t, err, ErrMarginDisabled)
+	})
+
+	t.Run("open and close with interest", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100),
+			WithPaperMargin(MarginConfig{Interest: 0.001}))
+		wallet.OnCandle(candle(0, 100, 100, 100))
+
+		_, err := wallet.OpenShort("BTCUSDT", 3)
+		require.ErrorIs(t, err.(*OrderError).Err, ErrInsufficientMargin)
+
+		order, err := wallet.OpenShort("BTCUSDT", 1)
+		require.NoError(t, err)
+		require.Equal(t, model.PositionSideTypeShort, order.PositionSide)
+		require.Equal(t, model.SideTypeSell, order.Side)
+
+		level, err := wallet.MarginLevel()
+		require.NoError(t, err)
+		require.InDelta(t, 2, level, 1e-9)
+
+		liquidation, err := wallet.LiquidationPrice("BTCUSDT")
+		require.NoError(t, err)
+		require.InDelta(t, 200/1.1, liquidation, 1e-9)
+
+		wallet.OnCandle(candle(24, 100, 100, 90))
+		account, err := wallet.Account()
+		require.NoError(t, err)
+		require.InDelta(t, 1, account.Balance("BTC").Borrowed, 1e-9)
+		require.InDelta(t, 0.001, account.Balance("BTC").Interest, 1e-9)
+
+		order, err = wallet.CloseShort("BTCUSDT", 1)
+		require.NoError(t, err)
+		require.InDelta(t, 1.001, order.Quantity, 1e-9)
+		require.InDelta(t, 200-1.001*90, wallet.assets["USDT"].Free, 1e-9)
+		require.InDelta(t, 0, wallet.assets["BTC"].Free, 1e-9)
+
+		account, err = wallet.Account()
+		require.NoError(t, err)
+		require.Equal(t, 0.0, account.Balance("BTC").Borrowed)
+		require.Equal(t, 0.0, account.Balance("BTC").Interest)
+	})
+
+	t.Run("liquidation", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100),
+			WithPaperMargin(MarginConfig{}))
+		wallet.OnCandle(candle(0, 100, 100, 100))
+
+		_, err := wallet.OpenShort("BTCUSDT", 1)
+		require.NoError(t, err)
+
+		wallet.OnCandle(candle(1, 150, 170, 160))
+		require.Len(t, wallet.Orders(), 1)
+
+		// bought back at the liquidation price
+		wallet.OnCandle(candle(2, 160, 190, 170))
+		orders := wallet.Orders()
+		require.Len(t, orders, 2)
+		require.Equal(t, model.SideTypeBuy, orders[1].Side)
+		require.Equal(t, model.OrderStatusTypeFilled, orders[1].Status)
+		require.InDelta(t, 200/1.1, orders[1].Price, 1e-9)
+		require.InDelta(t, 200-200/1.1, wallet.assets["USDT"].Free, 1e-9)
+
+		level, err := wallet.MarginLevel()
+		require.NoError(t, err)
+		require.True(t, math.IsInf(level, 1))
+	})
+}
+
+func TestPaperWallet_Funding(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hours int, open, close float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hours) * time.Hour),
+			Open: open, High: math.Max(open, close), Low: math.Min(open, close), Close: close, Complete: true}
+	}
+	rates := []FundingRate{
+		{Pair: "BTCUSDT", Rate: -0.002, Time: start.Add(16 * time.Hour)},
+		{Pair: "BTCUSDT", Rate: 0.001, Time: start.Add(8 * time.Hour)},
+	}
+
+	t.Run("long pays positive rates", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100),
+			WithPaperFunding(rates...))
+		wallet.OnCandle(candle(0, 100, 100))
+
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		require.InDelta(t, 0, wallet.assets["USDT"].Free, 1e-9)
+
+		wallet.OnCandle(candle(8, 110, 110))
+		require.InDelta(t, -0.11, wallet.assets["USDT"].Free, 1e-9)
+
+		wallet.OnCandle(candle(16, 120, 120))
+		require.InDelta(t, 0.13, wallet.assets["USDT"].Free, 1e-9)
+		require.InDelta(t, 0.13, wallet.FundingPnL()["USDT"], 1e-9)
+
+		// rates are settled only once
+		wallet.OnCandle(candle(17, 120, 120))
+		require.InDelta(t, 0.13, wallet.FundingPnL()["USDT"], 1e-9)
+	})
+
+	t.Run("short receives positive rates", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100),
+			WithPaperMargin(MarginConfig{}), WithPaperFunding(rates...))
+		wallet.OnCandle(candle(0, 100, 100))
+
+		_, err := wallet.OpenShort("BTCUSDT", 1)
+		require.NoError(t, err)
+
+		wallet.OnCandle(candle(8, 110, 110))
+		require.InDelta(t, 200.11, wallet.assets["USDT"].Free, 1e-9)
+		require.InDelta(t, 0.11, wallet.FundingPnL()["USDT"], 1e-9)
+	})
+
+	t.Run("no position", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100),
+			WithPaperFunding(rates...))
+		wallet.OnCandle(candle(0, 100, 100))
+		wallet.OnCandle(candle(16, 100, 100))
+		require.Equal(t, 100.0, wallet.assets["USDT"].Free)
+		require.Equal(t, map[string]float64{"USDT": 0}, wallet.FundingPnL())
+	})
+
+	t.Run("load from csv", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "btc-funding.csv")
+		require.NoError(t, os.WriteFile(file, []byte("1609459200,0.0001\n1609488000,-0.00025\n"), 0o600))
+
+		rates, err := LoadFundingRates("BTCUSDT", file)
+		require.NoError(t, err)
+		require.Equal(t, []FundingRate{
+			{Pair: "BTCUSDT", Rate: 0.0001, Time: start},
+			{Pair: "BTCUSDT", Rate: -0.00025, Time: start.Add(8 * time.Hour)},
+		}, rates)
+
+		_, err = LoadFundingRates("BTCUSDT", filepath.Join(t.TempDir(), "missing.csv"))
+		require.Error(t, err)
+	})
+}
+
+func TestPaperWallet_TrailingStop(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hours int, open, high, low, close float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hours) * time.Hour),
+			Open: open, High: high, Low: low, Close: close, Complete: true}
+	}
+	setup := func(options ...PaperWalletOption) *PaperWallet {
+		options = append(options, WithPaperAsset("USDT", 100))
+		wallet := NewPaperWallet(context.Background(), "USDT", options...)
+		wallet.OnCandle(candle(0, 100, 100, 100, 100))
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		return wallet
+	}
+
+	t.Run("invalid distance", func(t *testing.T) {
+		wallet := setup()
+		for _, trailing := range []model.Trailing{{}, {Rate: 1}, {Rate: 0.1, Offset: 1}, {Offset: -1}} {
+			_, err := wallet.CreateOrderTrailingStop("BTCUSDT", 1, trailing)
+			require.ErrorIs(t, err, ErrInvalidTrailing)
+		}
+	})
+
+	t.Run("follow the high", func(t *testing.T) {
+		wallet := setup()
+		order, err := wallet.CreateOrderTrailingStop("BTCUSDT", 1, model.TrailingRate(0.1))
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeTrailingStop, order.Type)
+		require.InDelta(t, 90, *order.Stop, 1e-9)
+		require.Equal(t, 1.0, wallet.assets["BTC"].Lock)
+
+		wallet.OnCandle(candle(1, 100, 120, 110, 115))
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		require.InDelta(t, 108, *order.Stop, 1e-9)
+
+		wallet.OnCandle(candle(2, 115, 118, 100, 105))
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.InDelta(t, 108, order.Price, 1e-9)
+		require.InDelta(t, 108, wallet.assets["USDT"].Free, 1e-9)
+		require.Equal(t, 0.0, wallet.assets["BTC"].Lock)
+	})
+
+	t.Run("path of the fill model", func(t *testing.T) {
+		// the high is reached before the low
+		wallet := setup()
+		order, err := wallet.CreateOrderTrailingStop("BTCUSDT", 1, model.TrailingRate(0.1))
+		require.NoError(t, err)
+		wallet.OnCandle(candle(1, 100, 120, 105, 115))
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.InDelta(t, 108, order.Price, 1e-9)
+
+		// the low is reached before the high
+		wallet = setup(WithPaperFillModel(OLHCFillModel()))
+		order, err = wallet.CreateOrderTrailingStop("BTCUSDT", 1, model.TrailingRate(0.1))
+		require.NoError(t, err)
+		wallet.OnCandle(candle(1, 100, 120, 105, 115))
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		require.InDelta(t, 108, *order.Stop, 1e-9)
+	})
+
+	t.Run("offset with gap", func(t *testing.T) {
+		wallet := setup()
+		order, err := wallet.CreateOrderTrailingStop("BTCUSDT", 1, model.TrailingOffset(5))
+		require.NoError(t, err)
+		require.InDelta(t, 95, *order.Stop, 1e-9)
+
+		wallet.OnCandle(candle(1, 90, 92, 88, 91))
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.InDelta(t, 90, wallet.assets["USDT"].Free, 1e-9)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		wallet := setup()
+		order, err := wallet.CreateOrderTrailingStop("BTCUSDT", 1, model.TrailingRate(0.1))
+		require.NoError(t, err)
+		require.NoError(t, wallet.Cancel(order))
+		require.Empty(t, wallet.trailingHigh)
+	})
+}
+
+func TestPaperWallet_ConcurrentReads(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hours int, price float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hours) * time.Hour),
+			Open: price, High: price + 1, Low: price - 1, Close: price, Complete: true}
+	}
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+		WithPaperFunding(FundingRate{Pair: "BTCUSDT", Rate: 0.001, Time: start.Add(8 * time.Hour)}))
+	wallet.OnCandle(candle(0, 100))
+	_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+	_, err = wallet.CreateOrderTrailingStop("BTCUSDT", 1, model.TrailingRate(0.5))
+	require.NoError(t, err)
+
+	// the reports are read while the candles are fed, eg: by a live chart
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for hours := 1; hours <= 24; hours++ {
+			wallet.OnCandle(candle(hours, 100+float64(hours)))
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		wallet.MarketChange()
+		wallet.MaxDrawdown()
+		wallet.EquityValues()
+		wallet.AssetValues("BTC")
+		wallet.FundingPnL()
+	}
+	require.InDelta(t, 0.24, wallet.MarketChange(), 1e-9)
+}
+
+func TestPaperWallet_Timeframes(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(timeframe string, minutes int, low float64, complete bool) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Timeframe: timeframe, Time: start.Add(time.Duration(minutes) * time.Minute),
+			Open: 100, High: 100, Low: low, Close: 100, Volume: 10, Complete: complete}
+	}
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+	wallet.OnCandle(candle("1m", 0, 100, true))
+
+	order, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 90)
+	require.NoError(t, err)
+
+	// the low of the hour and of the partial minute may be reached before the order
+	wallet.OnCandle(candle("1h", 0, 80, true))
+	wallet.OnCandle(candle("1m", 1, 80, false))
+	wallet.OnCandle(candle("1m", 1, 95, true))
+	order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeNew, order.Status)
+
+	wallet.OnCandle(candle("1m", 2, 85, true))
+	order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+
+	// one equity value by minute
+	require.Len(t, wallet.EquityValues(), 3)
+}
+
+func TestPaperWallet_SubscribeOrder(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hour int, low float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hour) * time.Hour),
+			Open: 100, High: 100, Low: low, Close: 100, Volume: 10, Complete: true}
+	}
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+	wallet.OnCandle(candle(0, 100))
+
+	var updates []model.Order
+	wallet.SubscribeOrder(func(order model.Order) {
+		updates = append(updates, order)
+		// subscribers create orders like the strategies
+		if order.Type == model.OrderTypeMarket {
+			_, err := wallet.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 1, 120)
+			require.NoError(t, err)
+		}
+	})
+
+	// the market order is filled at its creation
+	_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+	require.Len(t, updates, 2)
+	require.Equal(t, model.OrderStatusTypeFilled, updates[0].Status)
+	require.Equal(t, model.OrderStatusTypeNew, updates[1].Status)
+
+	limit, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 90)
+	require.NoError(t, err)
+	wallet.OnCandle(candle(1, 85))
+	require.NoError(t, wallet.Cancel(updates[1]))
+
+	statuses := make([]model.OrderStatusType, 0, len(updates))
+	for _, order := range updates[2:] {
+		statuses = append(statuses, order.Status)
+	}
+	require.Equal(t, []model.OrderStatusType{model.OrderStatusTypeNew, model.OrderStatusTypeFilled,
+		model.OrderStatusTypeCanceled}, statuses)
+	require.Equal(t, limit.ExchangeID, updates[3].ExchangeID)
+}
@@ -0,0 +1,290 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrUnknownPair    = errors.New("unknown pair")
+	ErrInvalidPairMap = errors.New("invalid pair metadata")
+)
+
+//go:embed pairs.json
+var defaultPairs []byte
+
+// DefaultRegistry is used by SplitAssetQuote. It starts with an embedded snapshot
+// and receives the pairs of every Binance exchange created by the process.
+var DefaultRegistry = NewRegistry()
+
+func init() {
+	if err := DefaultRegistry.Load(bytes.NewReader(defaultPairs), ".json"); err != nil {
+		log.Error().Err(err).Msg("load default pairs failed.")
+	}
+}
+
+var registryCSVHeader = []string{
+	"pair", "base_asset", "quote_asset", "min_price", "max_price", "min_quantity",
+	"max_quantity", "step_size", "tick_size", "qty_decimal_precision", "price_decimal_precision",
+	"min_notional",
+}
+
+// Registry keeps the metadata of the trading pairs, so splitting a pair does not
+// depend on a network call
+type Registry struct {
+	sync.RWMutex
+	pairs map[string]model.AssetInfo
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		pairs: make(map[string]model.AssetInfo),
+	}
+}
+
+// Add registers or replaces the metadata of a pair
+func (r *Registry) Add(pair string, info model.AssetInfo) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.pairs[pair] = info
+}
+
+// AssetInfo returns the metadata of a pair or ErrUnknownPair
+func (r *Registry) AssetInfo(pair string) (model.AssetInfo, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	info, ok := r.pairs[pair]
+	if !ok {
+		return model.AssetInfo{}, fmt.Errorf("%w: %s", ErrUnknownPair, pair)
+	}
+	return info, nil
+}
+
+// Split returns the base and quote assets of a pair
+func (r *Registry) Split(pair string) (asset, quote string, err error) {
+	info, err := r.AssetInfo(pair)
+	if err != nil {
+		return "", "", err
+	}
+	return info.BaseAsset, info.QuoteAsset, nil
+}
+
+// Pairs returns the registered pairs sorted by name
+func (r *Registry) Pairs() []string {
+	r.RLock()
+	defer r.RUnlock()
+
+	pairs := make([]string, 0, len(r.pairs))
+	for pair := range r.pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// Populate registers the metadata given by a feeder, pairs without assets are rejected
+func (r *Registry) Populate(feeder Feeder, pairs ...string) error {
+	for _, pair := range pairs {
+		info := feeder.GetAssetsInfo(pair)
+		if info.BaseAsset == "" || info.QuoteAsset == "" {
+			return fmt.Errorf("%w: %s", ErrUnknownPair, pair)
+		}
+		r.Add(pair, info)
+	}
+	return nil
+}
+
+// Refresh downloads the metadata of all pairs from Binance exchange info
+func (r *Registry) Refresh(ctx context.Context, options ...BinanceOption) error {
+	exchange := &Binance{}
+	for _, option := range options {
+		option(exchange)
+	}
+
+	client := binance.NewClient("", "")
+	if exchange.baseURL != "" {
+		client.BaseURL = exchange.baseURL
+	}
+
+	info, err := client.NewExchangeInfoService().Do(ctx)
+	if err != nil {
+		return fmt.Errorf("binance exchange info: %w", err)
+	}
+
+	r.addAll(parseExchangeInfo(info))
+	return nil
+}
+
+func (r *Registry) addAll(pairs map[string]model.AssetInfo) {
+	r.Lock()
+	defer r.Unlock()
+
+	for pair, info := range pairs {
+		r.pairs[pair] = info
+	}
+}
+
+// LoadFile reads a JSON or CSV snapshot, the format is given by the file extension
+func (r *Registry) LoadFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return r.Load(f, filepath.Ext(file))
+}
+
+// Load reads a snapshot in the format of the extension, ".json" or ".csv"
+func (r *Registry) Load(reader io.Reader, ext string) error {
+	var (
+		pairs map[string]model.AssetInfo
+		err   error
+	)
+
+	switch strings.ToLower(ext) {
+	case ".json":
+		err = json.NewDecoder(reader).Decode(&pairs)
+	case ".csv":
+		pairs, err = readRegistryCSV(reader)
+	default:
+		return fmt.Errorf("%w: unsupported format %s", ErrInvalidPairMap, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPairMap, err)
+	}
+
+	for pair, info := range pairs {
+		if info.BaseAsset == "" || info.QuoteAsset == "" {
+			return fmt.Errorf("%w: missing assets of %s", ErrInvalidPairMap, pair)
+		}
+	}
+
+	r.addAll(pairs)
+	return nil
+}
+
+// SaveFile writes a snapshot of the registry, the format is given by the file extension
+func (r *Registry) SaveFile(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	if err := r.Save(f, filepath.Ext(file)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Save writes a snapshot in the format of the extension, ".json" or ".csv"
+func (r *Registry) Save(writer io.Writer, ext string) error {
+	r.RLock()
+	defer r.RUnlock()
+
+	switch strings.ToLower(ext) {
+	case ".json":
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r.pairs)
+	case ".csv":
+		return writeRegistryCSV(writer, r.pairs)
+	default:
+		return fmt.Errorf("%w: unsupported format %s", ErrInvalidPairMap, ext)
+	}
+}
+
+func readRegistryCSV(reader io.Reader) (map[string]model.AssetInfo, error) {
+	lines, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make(map[string]model.AssetInfo)
+	for i, line := range lines {
+		if i == 0 && line[0] == registryCSVHeader[0] {
+			continue
+		}
+		if len(line) < 3 {
+			return nil, fmt.Errorf("line %d: expected at least pair, base and quote asset", i+1)
+		}
+
+		info := model.AssetInfo{BaseAsset: line[1], QuoteAsset: line[2]}
+		floats := []*float64{
+			&info.MinPrice, &info.MaxPrice, &info.MinQuantity,
+			&info.MaxQuantity, &info.StepSize, &info.TickSize,
+		}
+		for j, value := range line[3:] {
+			if value == "" {
+				continue
+			}
+			if j < len(floats) {
+				*floats[j], err = strconv.ParseFloat(value, 64)
+			} else if j == len(floats) {
+				info.QtyDecimalPrecision, err = strconv.ParseInt(value, 10, 64)
+			} else if j == len(floats)+1 {
+				info.PriceDecimalPrecision, err = strconv.ParseInt(value, 10, 64)
+			} else if j == len(floats)+2 {
+				info.MinNotional, err = strconv.ParseFloat(value, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+		}
+		pairs[line[0]] = info
+	}
+	return pairs, nil
+}
+
+func writeRegistryCSV(writer io.Writer, pairs map[string]model.AssetInfo) error {
+	names := make([]string, 0, len(pairs))
+	for pair := range pairs {
+		names = append(names, pair)
+	}
+	sort.Strings(names)
+
+	formatFloat := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	w := csv.NewWriter(writer)
+	if err := w.Write(registryCSVHeader); err != nil {
+		return err
+	}
+	for _, pair := range names {
+		info := pairs[pair]
+		err := w.Write([]string{
+			pair, info.BaseAsset, info.QuoteAsset,
+			formatFloat(info.MinPrice), formatFloat(info.MaxPrice),
+			formatFloat(info.MinQuantity), formatFloat(info.MaxQuantity),
+			formatFloat(info.StepSize), formatFloat(info.TickSize),
+			strconv.FormatInt(info.QtyDecimalPrecision, 10),
+			strconv.FormatInt(info.PriceDecimalPrecision, 10),
+			formatFloat(info.MinNotional),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
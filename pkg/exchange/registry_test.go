@@ -0,0 +1,59 @@
+package exchange
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Run("default snapshot", func(t *testing.T) {
+		asset, quote, err := SplitAssetQuote("ETHBTC")
+		require.NoError(t, err)
+		require.Equal(t, "ETH", asset)
+		require.Equal(t, "BTC", quote)
+
+		_, _, err = SplitAssetQuote("UNKNOWN")
+		require.ErrorIs(t, err, ErrUnknownPair)
+	})
+
+	t.Run("save and load", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.Add("BTCUSDT", model.AssetInfo{
+			BaseAsset:             "BTC",
+			QuoteAsset:            "USDT",
+			MinPrice:              0.01,
+			MaxPrice:              1000000,
+			MinQuantity:           0.00001,
+			MaxQuantity:           9000,
+			StepSize:              0.00001,
+			TickSize:              0.01,
+			QtyDecimalPrecision:   5,
+			PriceDecimalPrecision: 2,
+			MinNotional:           10,
+		})
+
+		for _, file := range []string{"pairs.json", "pairs.csv"} {
+			file = filepath.Join(t.TempDir(), file)
+			require.NoError(t, registry.SaveFile(file))
+
+			loaded := NewRegistry()
+			require.NoError(t, loaded.LoadFile(file))
+			require.Equal(t, registry.pairs, loaded.pairs, file)
+		}
+
+		require.ErrorIs(t, registry.SaveFile(filepath.Join(t.TempDir(), "pairs.txt")), ErrInvalidPairMap)
+	})
+
+	t.Run("populate from feeder", func(t *testing.T) {
+		feed, err := NewCSVFeed("1h", PairFeed{Pair: "BTCUSDT", File: "../../testdata/btc-1h.csv", Timeframe: "1h"})
+		require.NoError(t, err)
+
+		registry := NewRegistry()
+		require.NoError(t, registry.Populate(feed, "BTCUSDT"))
+		require.Equal(t, []string{"BTCUSDT"}, registry.Pairs())
+		require.ErrorIs(t, registry.Populate(feed, "UNKNOWN"), ErrUnknownPair)
+	})
+}
@@ -0,0 +1,84 @@
+package exchange
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+)
+
+// SlippageModel estimates the price paid by the orders taking liquidity,
+// the paper wallet applies it to market and stop fills
+type SlippageModel interface {
+	Name() string
+	// Rate returns the fraction of the price lost by a fill of the quantity in the candle
+	Rate(quantity float64, candle model.Candle) float64
+}
+
+type rateSlippage struct {
+	name string
+	rate func(quantity float64, candle model.Candle) float64
+}
+
+func (s rateSlippage) Name() string {
+	return s.name
+}
+
+func (s rateSlippage) Rate(quantity float64, candle model.Candle) float64 {
+	return s.rate(quantity, candle)
+}
+
+// NoSlippage fills the orders at the reference price
+func NoSlippage() SlippageModel {
+	return rateSlippage{
+		name: "none",
+		rate: func(float64, model.Candle) float64 {
+			return 0
+		},
+	}
+}
+
+// FixedSlippage loses the same basis points in every fill
+func FixedSlippage(bps float64) SlippageModel {
+	return rateSlippage{
+		name: fmt.Sprintf("fixed %g bps", bps),
+		rate: func(float64, model.Candle) float64 {
+			return bps / 10000
+		},
+	}
+}
+
+// SpreadSlippage crosses half of a bid-ask spread given in basis points
+func SpreadSlippage(bps float64) SlippageModel {
+	return rateSlippage{
+		name: fmt.Sprintf("spread %g bps", bps),
+		rate: func(float64, model.Candle) float64 {
+			return bps / 2 / 10000
+		},
+	}
+}
+
+// VolumeSlippage grows with the share of the candle volume traded by the order,
+// impact is the slippage of an order trading the whole volume, eg: 0.1 for 10%,
+// and the slippage never exceeds max
+func VolumeSlippage(impact, max float64) SlippageModel {
+	return rateSlippage{
+		name: fmt.Sprintf("volume impact %g (max %g)", impact, max),
+		rate: func(quantity float64, candle model.Candle) float64 {
+			if candle.Volume <= 0 {
+				return max
+			}
+			return math.Min(impact*quantity/candle.Volume, max)
+		},
+	}
+}
+
+// slippagePrice applies the slippage against the side of the order
+func slippagePrice(slippage SlippageModel, side model.SideType, price, quantity float64,
+	candle model.Candle) float64 {
+	rate := slippage.Rate(quantity, candle)
+	if side == model.SideTypeBuy {
+		return price * (1 + rate)
+	}
+	return price * (1 - rate)
+}
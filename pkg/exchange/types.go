@@ -1,18 +1,24 @@
 package exchange
 
 import (
-	"context"
 	"errors"
 	"fmt"
-	"github.com/adshao/go-binance/v2"
-	"github.com/rs/zerolog/log"
-	"sync"
 )
 
 var (
-	ErrInvalidQuantity   = errors.New("invalid quantity")
-	ErrInsufficientFunds = errors.New("insufficient funds or locked")
-	ErrInvalidAsset      = errors.New("invalid asset")
+	ErrInvalidQuantity    = errors.New("invalid quantity")
+	ErrInsufficientFunds  = errors.New("insufficient funds or locked")
+	ErrInvalidAsset       = errors.New("invalid asset")
+	ErrNoFeeder           = errors.New("paper wallet without data feed")
+	ErrMarginDisabled     = errors.New("margin trading disabled")
+	ErrInsufficientMargin = errors.New("insufficient margin")
+	ErrOrderNotSupported  = errors.New("order not supported")
+	ErrInvalidTrailing    = errors.New("invalid trailing distance")
+	ErrOrderNotFound      = errors.New("order not found")
+
+	// ErrStatusUnknown is an order request failed without knowing if the order was created,
+	// eg: a timeout, the order must be looked up by its client order id
+	ErrStatusUnknown = errors.New("order status unknown")
 )
 
 // UserInfo user
@@ -32,32 +38,11 @@ func (o *OrderError) Error() string {
 	return fmt.Sprintf("order error: %v", o.Err)
 }
 
-type AssetQuote struct {
-	Quote string
-	Asset string
+func (o *OrderError) Unwrap() error {
+	return o.Err
 }
 
-var (
-	once              sync.Once
-	pairAssetQuoteMap = make(map[string]AssetQuote)
-)
-
-func SplitAssetQuote(pair string) (asset string, quote string) {
-	once.Do(func() {
-		client := binance.NewClient("", "")
-		info, err := client.NewExchangeInfoService().Do(context.Background())
-		if err != nil {
-			log.Fatal().Msgf("failed to get exchange info: %v", err)
-		}
-
-		for _, info := range info.Symbols {
-			pairAssetQuoteMap[info.Symbol] = AssetQuote{
-				Quote: info.QuoteAsset,
-				Asset: info.BaseAsset,
-			}
-		}
-	})
-
-	data := pairAssetQuoteMap[pair]
-	return data.Asset, data.Quote
+// SplitAssetQuote returns the base and quote assets of a pair known by the DefaultRegistry
+func SplitAssetQuote(pair string) (asset string, quote string, err error) {
+	return DefaultRegistry.Split(pair)
 }
@@ -11,18 +11,39 @@ import (
 type Notifier func(*Indicator)
 
 type Agent struct {
-	ExchangeWatcher market.Watcher
-	Indicators      map[string]*Indicator
-	Notifiers       map[string][]Notifier
-	mutex           sync.Mutex
-	ctx             context.Context
+	Watcher    market.Watcher
+	Indicators map[string]*Indicator
+	Notifiers  map[string][]Notifier
+	mutex      sync.Mutex
+	ctx        context.Context
+	window     int
 }
 
 type AgentOption func(agent *Agent)
 
 func WithExchange(exchange exchange.Exchange) AgentOption {
 	return func(agent *Agent) {
-		agent.ExchangeWatcher = market.NewExchangeWatcher(agent.ctx, exchange)
+		agent.Watcher = market.NewExchangeWatcher(agent.ctx, exchange)
+	}
+}
+
+// WithCsvFiles replays candles from csv files, keyed by util.PairTimeframeToKey
+func WithCsvFiles(files map[string]string) AgentOption {
+	return func(agent *Agent) {
+		agent.Watcher = market.NewCsvWatcher(files)
+	}
+}
+
+func WithWatcher(watcher market.Watcher) AgentOption {
+	return func(agent *Agent) {
+		agent.Watcher = watcher
+	}
+}
+
+// WithRollingWindow bounds the dataframes of the indicators to the last candles, see WithWindow
+func WithRollingWindow(size int) AgentOption {
+	return func(agent *Agent) {
+		agent.window = size
 	}
 }
 
@@ -40,9 +61,9 @@ func NewAgent(ctx context.Context, options ...AgentOption) *Agent {
 
 func (a *Agent) Run() {
 	for _, indicator := range a.Indicators {
-		a.ExchangeWatcher.RegistNotifier(indicator)
+		a.Watcher.RegistNotifier(indicator)
 	}
-	a.ExchangeWatcher.Watch()
+	a.Watcher.Watch()
 }
 
 func (a *Agent) Regist(pair string, timeframe string, notifier Notifier) {
@@ -50,13 +71,33 @@ func (a *Agent) Regist(pair string, timeframe string, notifier Notifier) {
 	defer a.mutex.Unlock()
 	key := util.PairTimeframeToKey(pair, timeframe)
 
+	a.addIndicator(pair, timeframe)
+	a.Notifiers[key] = append(a.Notifiers[key], notifier)
+}
+
+// AddIndicator makes sure the agent feeds the pair and timeframe, without a notifier
+func (a *Agent) AddIndicator(pair string, timeframe string) *Indicator {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.addIndicator(pair, timeframe)
+}
+
+// AddSpecs declares indicators to be computed on the pair and timeframe
+func (a *Agent) AddSpecs(pair string, timeframe string, specs ...Spec) error {
+	return a.AddIndicator(pair, timeframe).AddSpecs(specs...)
+}
+
+func (a *Agent) addIndicator(pair string, timeframe string) *Indicator {
+	key := util.PairTimeframeToKey(pair, timeframe)
 	if _, ok := a.Indicators[key]; !ok {
 		a.Indicators[key] = NewIndicator(
 			WithPairTimeframe(pair, timeframe),
 			WithCandleClose(true),
+			WithWindow(a.window),
 			WithAgent(a))
 	}
-	a.Notifiers[key] = append(a.Notifiers[key], notifier)
+	return a.Indicators[key]
 }
 
 func (a *Agent) Notify(key string) {
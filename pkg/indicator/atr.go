@@ -0,0 +1,45 @@
+package indicator
+
+import (
+	"fmt"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/markcheno/go-talib"
+)
+
+// ATR declares an average true range
+func ATR(key string, period int) Spec {
+	return &atr{
+		key:    key,
+		Period: period,
+	}
+}
+
+type atr struct {
+	key    string
+	Period int
+}
+
+func (a atr) Key() string {
+	return a.key
+}
+
+func (a atr) Name() string {
+	return fmt.Sprintf("ATR(%d)", a.Period)
+}
+
+func (a atr) WarmupPeriod() int {
+	return a.Period + 1
+}
+
+func (a atr) Keys() []string {
+	return []string{a.key}
+}
+
+func (a atr) Stream() Stream {
+	return newStream(&atrStream{period: a.Period})
+}
+
+func (a atr) Calculate(df *model.Dataframe) {
+	df.Metadata[a.key] = talib.Atr(df.High, df.Low, df.Close, a.Period)
+}
@@ -0,0 +1,49 @@
+package indicator
+
+import (
+	"fmt"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/markcheno/go-talib"
+)
+
+// BollingerBands declares bollinger bands over a simple moving average of the close price,
+// filling the keys <key>_upper, <key>_middle and <key>_lower
+func BollingerBands(key string, period int, deviation float64) Spec {
+	return &bollingerBands{
+		key:       key,
+		Period:    period,
+		Deviation: deviation,
+	}
+}
+
+type bollingerBands struct {
+	key       string
+	Period    int
+	Deviation float64
+}
+
+func (bb bollingerBands) Key() string {
+	return bb.key
+}
+
+func (bb bollingerBands) Name() string {
+	return fmt.Sprintf("BB(%d, %.1f)", bb.Period, bb.Deviation)
+}
+
+func (bb bollingerBands) WarmupPeriod() int {
+	return bb.Period
+}
+
+func (bb bollingerBands) Keys() []string {
+	return []string{bb.key + "_upper", bb.key + "_middle", bb.key + "_lower"}
+}
+
+func (bb bollingerBands) Stream() Stream {
+	return newStream(&bbandsStream{deviation: bb.Deviation, sma: newSmaStream(bb.Period)})
+}
+
+func (bb bollingerBands) Calculate(df *model.Dataframe) {
+	df.Metadata[bb.key+"_upper"], df.Metadata[bb.key+"_middle"], df.Metadata[bb.key+"_lower"] =
+		talib.BBands(df.Close, bb.Period, bb.Deviation, bb.Deviation, talib.SMA)
+}
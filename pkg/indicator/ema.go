@@ -0,0 +1,46 @@
+package indicator
+
+import (
+	"fmt"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/markcheno/go-talib"
+)
+
+// EMA declares an exponential moving average of the close price
+func EMA(key string, period int) Spec {
+	return &ema{
+		key:    key,
+		Period: period,
+	}
+}
+
+type ema struct {
+	key    string
+	Period int
+}
+
+func (e ema) Key() string {
+	return e.key
+}
+
+func (e ema) Name() string {
+	return fmt.Sprintf("EMA(%d)", e.Period)
+}
+
+func (e ema) WarmupPeriod() int {
+	return e.Period
+}
+
+func (e ema) Keys() []string {
+	return []string{e.key}
+}
+
+func (e ema) Stream() Stream {
+	s := newEmaStream(e.Period)
+	return newStream(valueStream{calculateFunc: s.calculate, commitFunc: s.commit})
+}
+
+func (e ema) Calculate(df *model.Dataframe) {
+	df.Metadata[e.key] = talib.Ema(df.Close, e.Period)
+}
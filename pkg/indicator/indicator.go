@@ -4,16 +4,22 @@ import (
 	"fmt"
 	"github.com/lynbklk/tradebot/pkg/model"
 	"github.com/lynbklk/tradebot/pkg/util"
-	"github.com/markcheno/go-talib"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Indicator struct {
+	sync.RWMutex
 	Pair          string
 	Timeframe     string
 	OnCandleClose bool
 	Dataframe     *model.Dataframe
 	Agent         *Agent
+	Specs         []Spec
+	streams       map[string]Stream
+	window        int
+	warmupPeriod  int
 }
 
 type Option func(*Indicator)
@@ -28,6 +34,7 @@ func WithPairTimeframe(pair string, timeframe string) Option {
 	return func(indicator *Indicator) {
 		indicator.Pair = pair
 		indicator.Dataframe.Pair = pair
+		indicator.Dataframe.Timeframe = timeframe
 		indicator.Timeframe = timeframe
 	}
 }
@@ -38,11 +45,20 @@ func WithCandleClose(close bool) Option {
 	}
 }
 
+// WithWindow keeps only the last candles in the dataframe, never less than the warmup period.
+// Zero keeps all candles.
+func WithWindow(size int) Option {
+	return func(indicator *Indicator) {
+		indicator.window = size
+	}
+}
+
 func NewIndicator(options ...Option) *Indicator {
 	indicator := &Indicator{
 		Dataframe: &model.Dataframe{
 			Metadata: make(map[string]model.Series),
 		},
+		streams: make(map[string]Stream),
 	}
 	for _, option := range options {
 		option(indicator)
@@ -61,14 +77,85 @@ func (i *Indicator) IsOnCandleClose() bool {
 	return i.OnCandleClose
 }
 
+// WarmupPeriod is the number of candles to preload, the largest period required by specs and subscribers
+func (i *Indicator) WarmupPeriod() int {
+	i.RLock()
+	defer i.RUnlock()
+
+	return i.warmupPeriod
+}
+
+// SetWarmupPeriod raises the warmup period, it never decreases
+func (i *Indicator) SetWarmupPeriod(period int) {
+	i.Lock()
+	defer i.Unlock()
+
+	if period > i.warmupPeriod {
+		i.warmupPeriod = period
+	}
+}
+
+// AddSpecs adds the specs to the union of computed indicators, a spec already
+// declared with the same key and name is ignored
+func (i *Indicator) AddSpecs(specs ...Spec) error {
+	i.Lock()
+	defer i.Unlock()
+
+	for _, spec := range specs {
+		var found bool
+		for _, current := range i.Specs {
+			if current.Key() != spec.Key() {
+				continue
+			}
+			if current.Name() != spec.Name() {
+				return &SpecError{Key: spec.Key(), Current: current.Name(), Declared: spec.Name()}
+			}
+			found = true
+			break
+		}
+		if found {
+			continue
+		}
+
+		i.Specs = append(i.Specs, spec)
+		if s, ok := spec.(StreamSpec); ok {
+			i.addStream(s)
+		}
+		if spec.WarmupPeriod() > i.warmupPeriod {
+			i.warmupPeriod = spec.WarmupPeriod()
+		}
+	}
+	return nil
+}
+
 func (i *Indicator) Notify(candle *model.Candle, preload bool) {
-	i.updateDataframe(candle)
-	if !preload && len(i.Dataframe.Close) >= 30 {
+	i.Lock()
+	added := i.updateDataframe(candle)
+	i.updateStreams(candle, added)
+	if !preload {
 		i.updateMetaData()
+	}
+	i.truncate()
+	i.Unlock()
+
+	if !preload {
 		i.Agent.Notify(util.PairTimeframeToKey(i.Pair, i.Timeframe))
 	}
 }
 
+// Snapshot returns a copy of the dataframe with the candles closed until the given time,
+// it is safe to call while the indicator receives new candles
+func (i *Indicator) Snapshot(until time.Time) (*model.Dataframe, error) {
+	duration, err := util.TimeframeDuration(i.Timeframe)
+	if err != nil {
+		return nil, err
+	}
+
+	i.RLock()
+	defer i.RUnlock()
+	return i.Dataframe.Until(until, duration), nil
+}
+
 func (i *Indicator) GetValue(t string, period int) model.Series {
 	key := fmt.Sprintf("%s%d", strings.ToLower(t), period)
 	return i.Dataframe.Metadata[key]
@@ -78,7 +165,8 @@ func (i *Indicator) GetDataframe() *model.Dataframe {
 	return i.Dataframe
 }
 
-func (i *Indicator) updateDataframe(candle *model.Candle) {
+// updateDataframe returns true when the candle is new, false when it updates the last one
+func (i *Indicator) updateDataframe(candle *model.Candle) bool {
 	if len(i.Dataframe.Time) > 0 && candle.Time.Equal(i.Dataframe.Time[len(i.Dataframe.Time)-1]) {
 		last := len(i.Dataframe.Time) - 1
 		i.Dataframe.Close[last] = candle.Close
@@ -87,20 +175,90 @@ func (i *Indicator) updateDataframe(candle *model.Candle) {
 		i.Dataframe.Low[last] = candle.Low
 		i.Dataframe.Volume[last] = candle.Volume
 		i.Dataframe.Time[last] = candle.Time
-	} else {
-		i.Dataframe.Close = append(i.Dataframe.Close, candle.Close)
-		i.Dataframe.Open = append(i.Dataframe.Open, candle.Open)
-		i.Dataframe.High = append(i.Dataframe.High, candle.High)
-		i.Dataframe.Low = append(i.Dataframe.Low, candle.Low)
-		i.Dataframe.Volume = append(i.Dataframe.Volume, candle.Volume)
-		i.Dataframe.Time = append(i.Dataframe.Time, candle.Time)
-		i.Dataframe.LastUpdate = candle.Time
+		return false
+	}
+
+	i.Dataframe.Close = append(i.Dataframe.Close, candle.Close)
+	i.Dataframe.Open = append(i.Dataframe.Open, candle.Open)
+	i.Dataframe.High = append(i.Dataframe.High, candle.High)
+	i.Dataframe.Low = append(i.Dataframe.Low, candle.Low)
+	i.Dataframe.Volume = append(i.Dataframe.Volume, candle.Volume)
+	i.Dataframe.Time = append(i.Dataframe.Time, candle.Time)
+	i.Dataframe.LastUpdate = candle.Time
+	return true
+}
+
+// addStream replays the candles already in the dataframe, the values of a stream start with the first one
+func (i *Indicator) addStream(spec StreamSpec) {
+	stream := spec.Stream()
+	keys := spec.Keys()
+	series := make([]model.Series, len(keys))
+	for row := range i.Dataframe.Time {
+		values := stream.Next(model.Candle{
+			Pair:   i.Pair,
+			Time:   i.Dataframe.Time[row],
+			Open:   i.Dataframe.Open[row],
+			Close:  i.Dataframe.Close[row],
+			Low:    i.Dataframe.Low[row],
+			High:   i.Dataframe.High[row],
+			Volume: i.Dataframe.Volume[row],
+		})
+		for j := range keys {
+			series[j] = append(series[j], values[j])
+		}
+	}
+	for j, key := range keys {
+		i.Dataframe.Metadata[key] = series[j]
+	}
+	i.streams[spec.Key()] = stream
+}
+
+func (i *Indicator) updateStreams(candle *model.Candle, added bool) {
+	for _, spec := range i.Specs {
+		stream, ok := i.streams[spec.Key()]
+		if !ok {
+			continue
+		}
+
+		var values []float64
+		if added {
+			values = stream.Next(*candle)
+		} else {
+			values = stream.Update(*candle)
+		}
+		for j, key := range spec.(StreamSpec).Keys() {
+			series := i.Dataframe.Metadata[key]
+			if added || len(series) == 0 {
+				i.Dataframe.Metadata[key] = append(series, values[j])
+			} else {
+				series[len(series)-1] = values[j]
+			}
+		}
+	}
+}
+
+func (i *Indicator) truncate() {
+	if i.window <= 0 {
+		return
+	}
+
+	size := i.window
+	if i.warmupPeriod > size {
+		size = i.warmupPeriod
 	}
+	i.Dataframe.Truncate(size)
 }
 
+// updateMetaData calculates the specs without stream over the whole dataframe
 func (i *Indicator) updateMetaData() {
-	params := util.TimeframePeriods[i.Timeframe]
-	for _, param := range params {
-		i.Dataframe.Metadata[fmt.Sprintf("ema%d", param)] = talib.Ema(i.Dataframe.Close, param)
+	for _, spec := range i.Specs {
+		if _, ok := i.streams[spec.Key()]; ok {
+			continue
+		}
+		// not enough candles yet, the metadata keys stay unset
+		if len(i.Dataframe.Close) < spec.WarmupPeriod() {
+			continue
+		}
+		spec.Calculate(i.Dataframe)
 	}
 }
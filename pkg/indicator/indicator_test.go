@@ -0,0 +1,106 @@
+package indicator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func loadCandles(t *testing.T) []model.Candle {
+	feed, err := exchange.NewCSVFeed("1h", exchange.PairFeed{
+		Pair:      "BTCUSDT",
+		File:      "../../testdata/btc-1h.csv",
+		Timeframe: "1h",
+	})
+	require.NoError(t, err)
+	return feed.CandlePairTimeFrame["BTCUSDT--1h"]
+}
+
+func streamSpecs() []Spec {
+	return []Spec{
+		EMA("ema9", 9),
+		SMA("sma21", 21),
+		RSI("rsi14", 14),
+		MACD("macd", 12, 26, 9),
+		BollingerBands("bb", 20, 2),
+		ATR("atr14", 14),
+		Stoch("stoch", 14, 3, 3),
+	}
+}
+
+func TestIndicator_Stream(t *testing.T) {
+	candles := loadCandles(t)
+
+	t.Run("match batch values", func(t *testing.T) {
+		indicator := NewIndicator(WithPairTimeframe("BTCUSDT", "1h"), WithAgent(NewAgent(context.Background())))
+		require.NoError(t, indicator.AddSpecs(streamSpecs()...))
+		for i := range candles {
+			indicator.Notify(&candles[i], i < 100)
+		}
+
+		df := indicator.GetDataframe()
+		batch := &model.Dataframe{
+			Close:    df.Close,
+			Open:     df.Open,
+			High:     df.High,
+			Low:      df.Low,
+			Volume:   df.Volume,
+			Metadata: make(map[string]model.Series),
+		}
+		for _, spec := range streamSpecs() {
+			spec.Calculate(batch)
+			for _, key := range spec.(StreamSpec).Keys() {
+				require.Len(t, df.Metadata[key], len(df.Close), key)
+				require.Equal(t, batch.Metadata[key], df.Metadata[key], key)
+			}
+		}
+	})
+
+	t.Run("update last candle", func(t *testing.T) {
+		indicator := NewIndicator(WithPairTimeframe("BTCUSDT", "1h"), WithAgent(NewAgent(context.Background())))
+		require.NoError(t, indicator.AddSpecs(streamSpecs()...))
+		for i := range candles[:200] {
+			partial := candles[i]
+			partial.Close, partial.High, partial.Low = partial.Open, partial.Open, partial.Open
+			indicator.Notify(&partial, false)
+			indicator.Notify(&candles[i], false)
+		}
+
+		df := indicator.GetDataframe()
+		require.Len(t, df.Close, 200)
+		batch := &model.Dataframe{Close: df.Close, High: df.High, Low: df.Low, Metadata: make(map[string]model.Series)}
+		for _, spec := range streamSpecs() {
+			spec.Calculate(batch)
+			for _, key := range spec.(StreamSpec).Keys() {
+				require.Equal(t, batch.Metadata[key], df.Metadata[key], key)
+			}
+		}
+	})
+
+	t.Run("rolling window", func(t *testing.T) {
+		full := NewIndicator(WithPairTimeframe("BTCUSDT", "1h"), WithAgent(NewAgent(context.Background())))
+		require.NoError(t, full.AddSpecs(streamSpecs()...))
+		window := NewIndicator(WithPairTimeframe("BTCUSDT", "1h"), WithAgent(NewAgent(context.Background())),
+			WithWindow(50))
+		require.NoError(t, window.AddSpecs(streamSpecs()...))
+		require.Equal(t, 34, window.WarmupPeriod())
+
+		for i := range candles {
+			full.Notify(&candles[i], false)
+			window.Notify(&candles[i], false)
+		}
+
+		df := window.GetDataframe()
+		expected := full.GetDataframe()
+		require.Len(t, df.Close, 50)
+		require.Equal(t, expected.Time[len(expected.Time)-50:], df.Time)
+		for _, spec := range streamSpecs() {
+			for _, key := range spec.(StreamSpec).Keys() {
+				require.Equal(t, expected.Metadata[key].LastValues(50), df.Metadata[key].Values(), key)
+			}
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package indicator
+
+import (
+	"fmt"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/markcheno/go-talib"
+)
+
+// MACD declares a moving average convergence divergence of the close price,
+// filling the keys <key>, <key>_signal and <key>_hist
+func MACD(key string, fast, slow, signal int) Spec {
+	return &macd{
+		key:    key,
+		Fast:   fast,
+		Slow:   slow,
+		Signal: signal,
+	}
+}
+
+type macd struct {
+	key    string
+	Fast   int
+	Slow   int
+	Signal int
+}
+
+func (m macd) Key() string {
+	return m.key
+}
+
+func (m macd) Name() string {
+	return fmt.Sprintf("MACD(%d, %d, %d)", m.Fast, m.Slow, m.Signal)
+}
+
+func (m macd) WarmupPeriod() int {
+	return m.Slow + m.Signal - 1
+}
+
+func (m macd) Keys() []string {
+	return []string{m.key, m.key + "_signal", m.key + "_hist"}
+}
+
+func (m macd) Stream() Stream {
+	return newStream(newMacdStream(m.Fast, m.Slow, m.Signal))
+}
+
+func (m macd) Calculate(df *model.Dataframe) {
+	df.Metadata[m.key], df.Metadata[m.key+"_signal"], df.Metadata[m.key+"_hist"] =
+		talib.Macd(df.Close, m.Fast, m.Slow, m.Signal)
+}
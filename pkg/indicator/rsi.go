@@ -0,0 +1,45 @@
+package indicator
+
+import (
+	"fmt"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/markcheno/go-talib"
+)
+
+// RSI declares a relative strength index of the close price
+func RSI(key string, period int) Spec {
+	return &rsi{
+		key:    key,
+		Period: period,
+	}
+}
+
+type rsi struct {
+	key    string
+	Period int
+}
+
+func (r rsi) Key() string {
+	return r.key
+}
+
+func (r rsi) Name() string {
+	return fmt.Sprintf("RSI(%d)", r.Period)
+}
+
+func (r rsi) WarmupPeriod() int {
+	return r.Period + 1
+}
+
+func (r rsi) Keys() []string {
+	return []string{r.key}
+}
+
+func (r rsi) Stream() Stream {
+	return newStream(&rsiStream{period: r.Period})
+}
+
+func (r rsi) Calculate(df *model.Dataframe) {
+	df.Metadata[r.key] = talib.Rsi(df.Close, r.Period)
+}
@@ -0,0 +1,52 @@
+package indicator
+
+import (
+	"fmt"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/markcheno/go-talib"
+)
+
+// SMA declares a simple moving average of the close price
+func SMA(key string, period int) Spec {
+	return &sma{
+		key:    key,
+		Period: period,
+	}
+}
+
+type sma struct {
+	key    string
+	Period int
+}
+
+func (s sma) Key() string {
+	return s.key
+}
+
+func (s sma) Name() string {
+	return fmt.Sprintf("SMA(%d)", s.Period)
+}
+
+func (s sma) WarmupPeriod() int {
+	return s.Period
+}
+
+func (s sma) Keys() []string {
+	return []string{s.key}
+}
+
+func (s sma) Stream() Stream {
+	sma := newSmaStream(s.Period)
+	return newStream(valueStream{
+		calculateFunc: func(value float64) float64 {
+			mean, _ := sma.calculate(value)
+			return mean
+		},
+		commitFunc: sma.commit,
+	})
+}
+
+func (s sma) Calculate(df *model.Dataframe) {
+	df.Metadata[s.key] = talib.Sma(df.Close, s.Period)
+}
@@ -0,0 +1,31 @@
+package indicator
+
+import (
+	"fmt"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+)
+
+// Spec is an indicator declared by a strategy, computed by the Indicator of its pair and timeframe
+type Spec interface {
+	// Key is the metadata key filled by the spec, specs with more than one output
+	// use it as prefix. eg: macd, macd_signal, macd_hist
+	Key() string
+	// Name describes the indicator and its parameters. eg: EMA(9)
+	Name() string
+	// WarmupPeriod is the minimum number of candles to calculate the indicator
+	WarmupPeriod() int
+	// Calculate fills the dataframe metadata with the indicator values
+	Calculate(df *model.Dataframe)
+}
+
+// SpecError is returned when two subscribers declare the same key with different indicators
+type SpecError struct {
+	Key      string
+	Current  string
+	Declared string
+}
+
+func (e *SpecError) Error() string {
+	return fmt.Sprintf("indicator key %s already declared as %s, got %s", e.Key, e.Current, e.Declared)
+}
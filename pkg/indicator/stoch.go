@@ -0,0 +1,55 @@
+package indicator
+
+import (
+	"fmt"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/markcheno/go-talib"
+)
+
+// Stoch declares a stochastic oscillator with simple moving averages,
+// filling the keys <key>_k and <key>_d
+func Stoch(key string, fastK, slowK, slowD int) Spec {
+	return &stoch{
+		key:   key,
+		FastK: fastK,
+		SlowK: slowK,
+		SlowD: slowD,
+	}
+}
+
+type stoch struct {
+	key   string
+	FastK int
+	SlowK int
+	SlowD int
+}
+
+func (s stoch) Key() string {
+	return s.key
+}
+
+func (s stoch) Name() string {
+	return fmt.Sprintf("STOCH(%d, %d, %d)", s.FastK, s.SlowK, s.SlowD)
+}
+
+func (s stoch) WarmupPeriod() int {
+	return s.FastK + s.SlowK + s.SlowD - 2
+}
+
+func (s stoch) Keys() []string {
+	return []string{s.key + "_k", s.key + "_d"}
+}
+
+func (s stoch) Stream() Stream {
+	return newStream(&stochStream{
+		fastK: s.FastK,
+		slowK: newSmaStream(s.SlowK),
+		slowD: newSmaStream(s.SlowD),
+	})
+}
+
+func (s stoch) Calculate(df *model.Dataframe) {
+	df.Metadata[s.key+"_k"], df.Metadata[s.key+"_d"] =
+		talib.Stoch(df.High, df.Low, df.Close, s.FastK, s.SlowK, talib.SMA, s.SlowD, talib.SMA)
+}
@@ -0,0 +1,373 @@
+package indicator
+
+import (
+	"math"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+)
+
+// StreamSpec is a spec calculated incrementally, one candle at a time,
+// with the same values of its batch Calculate
+type StreamSpec interface {
+	Spec
+	// Keys are the metadata keys filled by the spec, in the order of the stream values
+	Keys() []string
+	// Stream creates the state of the indicator for a single dataframe
+	Stream() Stream
+}
+
+// Stream keeps the state of an incremental indicator
+type Stream interface {
+	// Next calculates the values of a new candle
+	Next(candle model.Candle) []float64
+	// Update recalculates the values of the last candle with its new prices
+	Update(candle model.Candle) []float64
+}
+
+// stepper calculates the values of a candle without changing its state,
+// a candle is committed only when the next one arrives
+type stepper interface {
+	calculate(candle model.Candle) []float64
+	commit(candle model.Candle)
+}
+
+type stream struct {
+	stepper
+	pending *model.Candle
+}
+
+func newStream(s stepper) Stream {
+	return &stream{stepper: s}
+}
+
+func (s *stream) Next(candle model.Candle) []float64 {
+	if s.pending != nil {
+		s.commit(*s.pending)
+	}
+	s.pending = &candle
+	return s.calculate(candle)
+}
+
+func (s *stream) Update(candle model.Candle) []float64 {
+	s.pending = &candle
+	return s.calculate(candle)
+}
+
+// emaStream is seeded with the simple average of the first period values, as talib.Ema
+type emaStream struct {
+	period int
+	k      float64
+	count  int
+	sum    float64
+	value  float64
+}
+
+func newEmaStream(period int) *emaStream {
+	return &emaStream{
+		period: period,
+		k:      2.0 / float64(period+1),
+	}
+}
+
+func (s *emaStream) calculate(value float64) float64 {
+	switch {
+	case s.count < s.period-1:
+		return 0
+	case s.count == s.period-1:
+		return (s.sum + value) / float64(s.period)
+	default:
+		return ((value - s.value) * s.k) + s.value
+	}
+}
+
+func (s *emaStream) commit(value float64) {
+	if s.count < s.period-1 {
+		s.sum += value
+	} else {
+		s.value = s.calculate(value)
+	}
+	s.count++
+}
+
+// smaStream keeps the running totals of talib.Sma and talib.Var
+type smaStream struct {
+	period int
+	count  int
+	values []float64
+	total  float64
+	total2 float64
+}
+
+func newSmaStream(period int) *smaStream {
+	return &smaStream{period: period}
+}
+
+func (s *smaStream) ready() bool {
+	return s.count >= s.period-1
+}
+
+func (s *smaStream) calculate(value float64) (mean, variance float64) {
+	if !s.ready() {
+		return 0, 0
+	}
+	mean = (s.total + value) / float64(s.period)
+	mean2 := (s.total2 + value*value) / float64(s.period)
+	return mean, mean2 - mean*mean
+}
+
+func (s *smaStream) commit(value float64) {
+	if s.ready() {
+		trailing := value
+		if len(s.values) > 0 {
+			trailing = s.values[0]
+		}
+		s.total = (s.total + value) - trailing
+		s.total2 = (s.total2 + value*value) - trailing*trailing
+	} else {
+		s.total += value
+		s.total2 += value * value
+	}
+
+	s.values = append(s.values, value)
+	if len(s.values) > s.period-1 {
+		s.values = s.values[1:]
+	}
+	s.count++
+}
+
+// rsiStream applies the wilder smoothing of talib.Rsi
+type rsiStream struct {
+	period int
+	count  int
+	last   float64
+	gain   float64
+	loss   float64
+}
+
+func (s *rsiStream) next(value float64) (gain, loss float64) {
+	gain, loss = s.gain, s.loss
+	if s.count > s.period {
+		gain *= float64(s.period - 1)
+		loss *= float64(s.period - 1)
+	}
+
+	diff := value - s.last
+	if diff < 0 {
+		loss -= diff
+	} else {
+		gain += diff
+	}
+
+	if s.count >= s.period {
+		gain /= float64(s.period)
+		loss /= float64(s.period)
+	}
+	return gain, loss
+}
+
+func (s *rsiStream) calculate(candle model.Candle) []float64 {
+	if s.period < 2 || s.count < s.period {
+		return []float64{0}
+	}
+
+	gain, loss := s.next(candle.Close)
+	total := gain + loss
+	if -0.00000000000001 < total && total < 0.00000000000001 {
+		return []float64{0}
+	}
+	return []float64{100.0 * (gain / total)}
+}
+
+func (s *rsiStream) commit(candle model.Candle) {
+	if s.count > 0 {
+		s.gain, s.loss = s.next(candle.Close)
+	}
+	s.last = candle.Close
+	s.count++
+}
+
+func trueRange(candle model.Candle, lastClose float64) float64 {
+	greatest := candle.High - candle.Low
+	if value := math.Abs(lastClose - candle.High); value > greatest {
+		greatest = value
+	}
+	if value := math.Abs(lastClose - candle.Low); value > greatest {
+		greatest = value
+	}
+	return greatest
+}
+
+// atrStream applies the wilder smoothing of talib.Atr over the true range
+type atrStream struct {
+	period    int
+	count     int
+	lastClose float64
+	sum       float64
+	value     float64
+}
+
+func (s *atrStream) next(candle model.Candle) float64 {
+	if s.count == 0 || s.period < 1 {
+		return 0
+	}
+
+	tr := trueRange(candle, s.lastClose)
+	switch {
+	case s.period == 1:
+		return tr
+	case s.count < s.period:
+		return 0
+	case s.count == s.period:
+		return (s.sum + tr) / float64(s.period)
+	default:
+		return ((s.value * (float64(s.period) - 1.0)) + tr) / float64(s.period)
+	}
+}
+
+func (s *atrStream) calculate(candle model.Candle) []float64 {
+	return []float64{s.next(candle)}
+}
+
+func (s *atrStream) commit(candle model.Candle) {
+	if s.count > 0 && s.count < s.period {
+		s.sum += trueRange(candle, s.lastClose)
+	} else {
+		s.value = s.next(candle)
+	}
+	s.lastClose = candle.Close
+	s.count++
+}
+
+// macdStream follows talib.Macd, the signal is an average of the zero padded macd line
+type macdStream struct {
+	count    int
+	lookback int
+	fast     *emaStream
+	slow     *emaStream
+	signal   *emaStream
+}
+
+func newMacdStream(fast, slow, signal int) *macdStream {
+	if slow < fast {
+		fast, slow = slow, fast
+	}
+	return &macdStream{
+		lookback: signal - 1 + slow - 1,
+		fast:     newEmaStream(fast),
+		slow:     newEmaStream(slow),
+		signal:   newEmaStream(signal),
+	}
+}
+
+func (s *macdStream) line(value float64) float64 {
+	if s.count < s.lookback-1 {
+		return 0
+	}
+	return s.fast.calculate(value) - s.slow.calculate(value)
+}
+
+func (s *macdStream) calculate(candle model.Candle) []float64 {
+	macd := s.line(candle.Close)
+	signal := s.signal.calculate(macd)
+	var hist float64
+	if s.count >= s.lookback {
+		hist = macd - signal
+	}
+	return []float64{macd, signal, hist}
+}
+
+func (s *macdStream) commit(candle model.Candle) {
+	s.signal.commit(s.line(candle.Close))
+	s.fast.commit(candle.Close)
+	s.slow.commit(candle.Close)
+	s.count++
+}
+
+// bbandsStream follows talib.BBands with a simple moving average
+type bbandsStream struct {
+	deviation float64
+	sma       *smaStream
+}
+
+func (s *bbandsStream) calculate(candle model.Candle) []float64 {
+	middle, variance := s.sma.calculate(candle.Close)
+	var deviation float64
+	if !(variance < 0.00000000000001) {
+		deviation = math.Sqrt(variance) * s.deviation
+	}
+	return []float64{middle + deviation, middle, middle - deviation}
+}
+
+func (s *bbandsStream) commit(candle model.Candle) {
+	s.sma.commit(candle.Close)
+}
+
+// stochStream follows talib.Stoch with simple moving averages
+type stochStream struct {
+	fastK int
+	count int
+	highs []float64
+	lows  []float64
+	slowK *smaStream
+	slowD *smaStream
+}
+
+func (s *stochStream) fast(candle model.Candle) float64 {
+	highest, lowest := candle.High, candle.Low
+	for i := range s.highs {
+		highest = math.Max(highest, s.highs[i])
+		lowest = math.Min(lowest, s.lows[i])
+	}
+
+	diff := (highest - lowest) / 100.0
+	if diff == 0 {
+		return 0
+	}
+	return (candle.Close - lowest) / diff
+}
+
+func (s *stochStream) calculate(candle model.Candle) []float64 {
+	if s.count < s.fastK-1 || !s.slowK.ready() {
+		return []float64{0, 0}
+	}
+
+	k, _ := s.slowK.calculate(s.fast(candle))
+	if !s.slowD.ready() {
+		return []float64{0, 0}
+	}
+	d, _ := s.slowD.calculate(k)
+	return []float64{k, d}
+}
+
+func (s *stochStream) commit(candle model.Candle) {
+	if s.count >= s.fastK-1 {
+		fast := s.fast(candle)
+		if s.slowK.ready() {
+			k, _ := s.slowK.calculate(fast)
+			s.slowD.commit(k)
+		}
+		s.slowK.commit(fast)
+	}
+
+	s.highs = append(s.highs, candle.High)
+	s.lows = append(s.lows, candle.Low)
+	if len(s.highs) > s.fastK-1 {
+		s.highs = s.highs[1:]
+		s.lows = s.lows[1:]
+	}
+	s.count++
+}
+
+// valueStream adapts a single value stream of the close price
+type valueStream struct {
+	calculateFunc func(float64) float64
+	commitFunc    func(float64)
+}
+
+func (s valueStream) calculate(candle model.Candle) []float64 {
+	return []float64{s.calculateFunc(candle.Close)}
+}
+
+func (s valueStream) commit(candle model.Candle) {
+	s.commitFunc(candle.Close)
+}
@@ -11,15 +11,6 @@ import (
 	"time"
 )
 
-var (
-	TimeframeValue = map[string]int{
-		"m": 1,
-		"h": 2,
-		"d": 3,
-		"w": 4,
-	}
-)
-
 type CsvWatcher struct {
 	Feeds     map[string]*CsvFeed
 	Notifiers map[string][]Notifier
@@ -30,11 +21,9 @@ type CsvWatcher struct {
 type CsvFeed struct {
 	Pair      string
 	Timeframe string
-	Data      chan *model.Candle
-	Err       chan error
+	Duration  time.Duration
 	File      string
 	Buf       [][]string
-	eof       bool
 }
 
 type CandleIndex struct {
@@ -44,7 +33,10 @@ type CandleIndex struct {
 
 func NewCsvWatcher(files map[string]string) Watcher {
 	return &CsvWatcher{
-		Files: files,
+		Feeds:     make(map[string]*CsvFeed),
+		Notifiers: make(map[string][]Notifier),
+		Files:     files,
+		Keys:      set.NewLinkedHashSetString(),
 	}
 }
 
@@ -111,18 +103,27 @@ func (w *CsvWatcher) isCandleEnd(keyCandles map[string]*model.Candle) bool {
 	return true
 }
 
-func (w *CsvWatcher) largeTimevalCandle(first *model.Candle, second *model.Candle) bool {
-	if first.Time.Equal(second.Time) {
-		tf1, tf2 := first.Timeframe, second.Timeframe
-		tv1, tv2 := tf1[len(tf1)-1:], tf2[len(tf2)-1:]
-		if tv1 != tv2 {
-			return TimeframeValue[tv1] > TimeframeValue[tv2]
+// closeTime is the time in which the candle of the given feed is closed
+func (w *CsvWatcher) closeTime(key string, candle *model.Candle) time.Time {
+	return candle.Time.Add(w.Feeds[key].Duration)
+}
+
+// laterCandle reports whether the first candle must be notified after the second one.
+// Candles are ordered by close time, so no candle is seen before it is closed. Candles
+// closed at the same time are ordered from the smallest timeframe to the largest one,
+// then the fills of the period are simulated on the finest timeframe before the higher
+// timeframe candle is notified. The candles of the same timeframe are ordered by feed
+// key, so each run notifies the pairs in the same order.
+func (w *CsvWatcher) laterCandle(firstKey string, first *model.Candle, secondKey string, second *model.Candle) bool {
+	firstClose, secondClose := w.closeTime(firstKey, first), w.closeTime(secondKey, second)
+	if firstClose.Equal(secondClose) {
+		firstDuration, secondDuration := w.Feeds[firstKey].Duration, w.Feeds[secondKey].Duration
+		if firstDuration == secondDuration {
+			return firstKey > secondKey
 		}
-		tn1, _ := strconv.Atoi(tf1[0 : len(tf1)-1])
-		tn2, _ := strconv.Atoi(tf2[0 : len(tf2)-1])
-		return tn1 > tn2
+		return firstDuration > secondDuration
 	}
-	return first.Time.After(second.Time)
+	return firstClose.After(secondClose)
 }
 
 func (w *CsvWatcher) getLatestCandle(keyCandles map[string]*CandleIndex) (string, *model.Candle, bool) {
@@ -131,7 +132,8 @@ func (w *CsvWatcher) getLatestCandle(keyCandles map[string]*CandleIndex) (string
 		if candleIndex == nil {
 			continue
 		}
-		if len(latestKey) == 0 || w.largeTimevalCandle(keyCandles[latestKey].candle, keyCandles[key].candle) {
+		if len(latestKey) == 0 ||
+			w.laterCandle(latestKey, keyCandles[latestKey].candle, key, candleIndex.candle) {
 			latestKey = key
 		}
 	}
@@ -142,17 +144,23 @@ func (w *CsvWatcher) getLatestCandle(keyCandles map[string]*CandleIndex) (string
 }
 
 func (w *CsvWatcher) Watch() {
+	w.connect()
 	keyCandles := make(map[string]*CandleIndex)
-	for key, _ := range w.Feeds {
+	for key := range w.Feeds {
 		candle, err := w.readOneCandleFromBuf(key, 0)
 		if err != nil {
 			log.Fatal().Err(err).Msgf("read one line failed. key: %s", key)
 		}
+		if candle == nil {
+			continue
+		}
 		keyCandles[key] = &CandleIndex{
 			candle: candle,
 			index:  0,
 		}
 	}
+	log.Info().Msg("Data feed connected.")
+
 	for {
 		key, candle, end := w.getLatestCandle(keyCandles)
 		if end {
@@ -161,8 +169,22 @@ func (w *CsvWatcher) Watch() {
 		for _, notifier := range w.Notifiers[key] {
 			notifier.Notify(candle, false)
 		}
+
+		index := keyCandles[key].index + 1
+		next, err := w.readOneCandleFromBuf(key, index)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("read one line failed. key: %s", key)
+		}
+		if next == nil {
+			keyCandles[key] = nil
+			continue
+		}
+		keyCandles[key] = &CandleIndex{
+			candle: next,
+			index:  index,
+		}
 	}
-	log.Info().Msg("Data feed connected.")
+	log.Info().Msg("Data feed finished.")
 }
 
 func (w *CsvWatcher) connect() {
@@ -177,13 +199,16 @@ func (w *CsvWatcher) connect() {
 		if err != nil {
 			log.Fatal().Msgf("read csv file failed. file: %s", file)
 		}
+		duration, err := util.TimeframeDuration(timeframe)
+		if err != nil {
+			log.Fatal().Msgf("invalid timeframe. key: %s", key)
+		}
 		w.Feeds[key] = &CsvFeed{
 			Pair:      pair,
 			Timeframe: timeframe,
+			Duration:  duration,
 			Buf:       csvLines,
-			Data:      make(chan *model.Candle),
 			File:      file,
-			eof:       false,
 		}
 	}
 }
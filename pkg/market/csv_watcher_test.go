@@ -0,0 +1,60 @@
+package market
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCsvWatcher_Watch(t *testing.T) {
+	dir := t.TempDir()
+	lines := "1605571200,10,11,9,12,100\n1605574800,11,12,10,13,100\n1605578400,12,13,11,14,100\n"
+	files := make(map[string]string)
+	for _, pair := range []string{"ETHUSDT", "BTCUSDT"} {
+		file := filepath.Join(dir, pair+".csv")
+		require.NoError(t, os.WriteFile(file, []byte(lines), 0600))
+		files[util.PairTimeframeToKey(pair, "1h")] = file
+	}
+
+	// the pairs sharing the timestamps are notified in the same order on each run
+	for run := 0; run < 10; run++ {
+		var pairs []string
+		watcher := NewCsvWatcher(files)
+		for _, pair := range []string{"ETHUSDT", "BTCUSDT"} {
+			watcher.RegistNotifier(NewFuncNotifier(pair, "1h", true, func(candle *model.Candle, _ bool) {
+				pairs = append(pairs, candle.Pair)
+			}))
+		}
+		watcher.Watch()
+		require.Equal(t, []string{"BTCUSDT", "ETHUSDT", "BTCUSDT", "ETHUSDT", "BTCUSDT", "ETHUSDT"}, pairs)
+	}
+}
+
+func TestCsvWatcher_Timeframes(t *testing.T) {
+	dir := t.TempDir()
+	files := make(map[string]string)
+	for timeframe, lines := range map[string]string{
+		"1h": "1605571200,10,11,9,12,100\n1605574800,11,12,10,13,100\n1605578400,12,13,11,14,100\n",
+		"2h": "1605571200,10,12,9,13,200\n",
+	} {
+		file := filepath.Join(dir, timeframe+".csv")
+		require.NoError(t, os.WriteFile(file, []byte(lines), 0600))
+		files[util.PairTimeframeToKey("BTCUSDT", timeframe)] = file
+	}
+
+	// the 2h candle is closed with the second 1h candle, the finest timeframe is notified first
+	var timeframes []string
+	watcher := NewCsvWatcher(files)
+	for _, timeframe := range []string{"1h", "2h"} {
+		timeframe := timeframe
+		watcher.RegistNotifier(NewFuncNotifier("BTCUSDT", timeframe, true, func(_ *model.Candle, _ bool) {
+			timeframes = append(timeframes, timeframe)
+		}))
+	}
+	watcher.Watch()
+	require.Equal(t, []string{"1h", "1h", "2h", "1h"}, timeframes)
+}
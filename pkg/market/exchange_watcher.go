@@ -7,9 +7,7 @@ import (
 	"github.com/lynbklk/tradebot/pkg/model"
 	"github.com/lynbklk/tradebot/pkg/util"
 	"github.com/rs/zerolog/log"
-	"strings"
 	"sync"
-	"time"
 )
 
 type ExchangeWatcher struct {
@@ -20,6 +18,9 @@ type ExchangeWatcher struct {
 	Keys      *set.LinkedHashSetString
 }
 
+// maxPreload is the largest number of candles fetched by a single klines request
+const maxPreload = 999
+
 type ExchangeFeed struct {
 	Pair      string
 	Timeframe string
@@ -81,16 +82,25 @@ func (w *ExchangeWatcher) connect() {
 	for key := range w.Keys.Iter() {
 		pair, timeframe := util.PairTimeframeFromKey(key)
 		// preload
-		days := -1
-		if strings.HasSuffix(timeframe, "d") {
-			periods := util.TimeframePeriods[timeframe]
-			days = 0 - periods[len(periods)-1] - 2
+		var warmup int
+		for _, notifier := range w.Notifiers[key] {
+			if n, ok := notifier.(WarmupNotifier); ok && n.WarmupPeriod() > warmup {
+				warmup = n.WarmupPeriod()
+			}
+		}
+		if warmup > maxPreload {
+			warmup = maxPreload
 		}
-		candles, _ := w.Exchange.GetCandlesByPeriod(w.ctx, pair, timeframe, time.Now().AddDate(0, 0, days), time.Now())
-		log.Info().Msgf("preload candles, pair: %s, timeframe: %s, len: %d", pair, timeframe, len(candles))
-		for _, candle := range candles {
-			for _, notifier := range w.Notifiers[key] {
-				notifier.Notify(&candle, true)
+		if warmup > 0 {
+			candles, err := w.Exchange.GetCandlesByLimit(w.ctx, pair, timeframe, warmup)
+			if err != nil {
+				log.Error().Err(err).Msgf("preload candles failed, pair: %s, timeframe: %s", pair, timeframe)
+			}
+			log.Info().Msgf("preload candles, pair: %s, timeframe: %s, len: %d", pair, timeframe, len(candles))
+			for i := range candles {
+				for _, notifier := range w.Notifiers[key] {
+					notifier.Notify(&candles[i], true)
+				}
 			}
 		}
 		// subscribe
@@ -14,3 +14,39 @@ type Notifier interface {
 	Notify(candle *model.Candle, preload bool)
 	IsOnCandleClose() bool
 }
+
+// WarmupNotifier is implemented by notifiers that need past candles before the first live one
+type WarmupNotifier interface {
+	Notifier
+	WarmupPeriod() int
+}
+
+type FuncNotifier struct {
+	DataInfo      model.DataInfo
+	OnCandleClose bool
+	Func          func(candle *model.Candle, preload bool)
+}
+
+// NewFuncNotifier adapts a plain callback to the Notifier interface
+func NewFuncNotifier(pair, timeframe string, onCandleClose bool, fn func(*model.Candle, bool)) Notifier {
+	return &FuncNotifier{
+		DataInfo: model.DataInfo{
+			Pair:      pair,
+			Timeframe: timeframe,
+		},
+		OnCandleClose: onCandleClose,
+		Func:          fn,
+	}
+}
+
+func (n *FuncNotifier) GetDataInfo() model.DataInfo {
+	return n.DataInfo
+}
+
+func (n *FuncNotifier) Notify(candle *model.Candle, preload bool) {
+	n.Func(candle, preload)
+}
+
+func (n *FuncNotifier) IsOnCandleClose() bool {
+	return n.OnCandleClose
+}
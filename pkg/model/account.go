@@ -4,6 +4,10 @@ type Balance struct {
 	Tick string
 	Free float64
 	Lock float64
+
+	// Borrowed and Interest are the debt of the asset in margin accounts
+	Borrowed float64
+	Interest float64
 }
 
 type Account struct {
@@ -25,6 +29,7 @@ func (a Account) Equity() float64 {
 	for _, balance := range a.Balances {
 		total += balance.Free
 		total += balance.Lock
+		total -= balance.Borrowed + balance.Interest
 	}
 
 	return total
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+type BracketStatusType string
+
+var (
+	BracketStatusTypePending  BracketStatusType = "PENDING"
+	BracketStatusTypeOpen     BracketStatusType = "OPEN"
+	BracketStatusTypeClosed   BracketStatusType = "CLOSED"
+	BracketStatusTypeCanceled BracketStatusType = "CANCELED"
+	// BracketStatusTypeFailed is a filled entry with its exits rejected, the position is
+	// not protected
+	BracketStatusTypeFailed BracketStatusType = "FAILED"
+)
+
+// Bracket is an entry protected by a take profit and a stop loss. The exits are an OCO
+// of the opposite side, placed for the filled quantity once the entry is done.
+// Orders are referenced by their storage ids, zero until they are placed.
+type Bracket struct {
+	ID       int64             `db:"id" json:"id"`
+	Pair     string            `db:"pair" json:"pair"`
+	Side     SideType          `db:"side" json:"side"`
+	Status   BracketStatusType `db:"status" json:"status"`
+	Quantity float64           `db:"quantity" json:"quantity"`
+
+	// Entry is the limit price of the entry, zero for a market entry
+	Entry      float64 `db:"entry" json:"entry"`
+	TakeProfit float64 `db:"take_profit" json:"take_profit"`
+	Stop       float64 `db:"stop" json:"stop"`
+	StopLimit  float64 `db:"stop_limit" json:"stop_limit"`
+
+	EntryID      int64 `db:"entry_id" json:"entry_id"`
+	TakeProfitID int64 `db:"take_profit_id" json:"take_profit_id"`
+	StopID       int64 `db:"stop_id" json:"stop_id"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Active tells if the bracket waits for its entry or its exits
+func (b Bracket) Active() bool {
+	return b.Status == BracketStatusTypePending || b.Status == BracketStatusTypeOpen
+}
+
+func (b Bracket) String() string {
+	return fmt.Sprintf("[%s] %s %s | ID: %d, %f x $%f, TP: $%f, SL: $%f",
+		b.Status, b.Side, b.Pair, b.ID, b.Quantity, b.Entry, b.TakeProfit, b.Stop)
+}
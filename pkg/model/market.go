@@ -13,20 +13,22 @@ type DataInfo struct {
 }
 
 type AssetInfo struct {
-	BaseAsset             string
-	QuoteAsset            string
-	MinPrice              float64
-	MaxPrice              float64
-	MinQuantity           float64
-	MaxQuantity           float64
-	StepSize              float64
-	TickSize              float64
-	QtyDecimalPrecision   int64
-	PriceDecimalPrecision int64
+	BaseAsset             string  `json:"base_asset"`
+	QuoteAsset            string  `json:"quote_asset"`
+	MinPrice              float64 `json:"min_price"`
+	MaxPrice              float64 `json:"max_price"`
+	MinQuantity           float64 `json:"min_quantity"`
+	MaxQuantity           float64 `json:"max_quantity"`
+	StepSize              float64 `json:"step_size"`
+	MinNotional           float64 `json:"min_notional,omitempty"`
+	TickSize              float64 `json:"tick_size"`
+	QtyDecimalPrecision   int64   `json:"qty_decimal_precision"`
+	PriceDecimalPrecision int64   `json:"price_decimal_precision"`
 }
 
 type Dataframe struct {
 	Pair       string
+	Timeframe  string
 	Close      Series
 	Open       Series
 	High       Series
@@ -35,6 +37,81 @@ type Dataframe struct {
 	Time       []time.Time
 	LastUpdate time.Time
 	Metadata   map[string]Series
+
+	// Timeframes holds the other timeframes of the pair for multi timeframe strategies,
+	// only with the candles already closed at the close of the last candle of this dataframe
+	Timeframes map[string]*Dataframe
+}
+
+// Until returns a copy of the dataframe with only the candles closed until the given time.
+// The duration is the timeframe length, used to calculate the close time of each candle.
+func (df *Dataframe) Until(t time.Time, duration time.Duration) *Dataframe {
+	size := sort.Search(len(df.Time), func(i int) bool {
+		return df.Time[i].Add(duration).After(t)
+	})
+
+	result := &Dataframe{
+		Pair:      df.Pair,
+		Timeframe: df.Timeframe,
+		Close:     copySeries(df.Close, size),
+		Open:      copySeries(df.Open, size),
+		High:      copySeries(df.High, size),
+		Low:       copySeries(df.Low, size),
+		Volume:    copySeries(df.Volume, size),
+		Time:      make([]time.Time, size),
+		Metadata:  make(map[string]Series, len(df.Metadata)),
+	}
+	copy(result.Time, df.Time[:size])
+	if size > 0 {
+		result.LastUpdate = result.Time[size-1]
+	}
+
+	// metadata series are aligned to the end of the dataframe
+	for key, series := range df.Metadata {
+		offset := len(df.Time) - len(series)
+		if offset < 0 || size-offset < 0 {
+			continue
+		}
+		result.Metadata[key] = copySeries(series, size-offset)
+	}
+
+	return result
+}
+
+// Truncate keeps only the last size candles and the metadata values aligned with them
+func (df *Dataframe) Truncate(size int) {
+	total := len(df.Time)
+	if size <= 0 || total <= size {
+		return
+	}
+
+	start := total - size
+	df.Close = df.Close[start:]
+	df.Open = df.Open[start:]
+	df.High = df.High[start:]
+	df.Low = df.Low[start:]
+	df.Volume = df.Volume[start:]
+	df.Time = df.Time[start:]
+
+	for key, series := range df.Metadata {
+		drop := start - (total - len(series))
+		if drop <= 0 {
+			continue
+		}
+		if drop > len(series) {
+			drop = len(series)
+		}
+		df.Metadata[key] = series[drop:]
+	}
+}
+
+func copySeries(series Series, size int) Series {
+	if size > len(series) {
+		size = len(series)
+	}
+	result := make(Series, size)
+	copy(result, series[:size])
+	return result
 }
 
 type Candle struct {
@@ -8,6 +8,7 @@ import (
 type SideType string
 type OrderType string
 type OrderStatusType string
+type PositionSideType string
 
 var (
 	SideTypeBuy  SideType = "BUY"
@@ -20,7 +21,9 @@ var (
 	OrderTypeStopLossLimit   OrderType = "STOP_LOSS_LIMIT"
 	OrderTypeTakeProfit      OrderType = "TAKE_PROFIT"
 	OrderTypeTakeProfitLimit OrderType = "TAKE_PROFIT_LIMIT"
+	OrderTypeTrailingStop    OrderType = "TRAILING_STOP"
 
+	OrderStatusTypePendingNew      OrderStatusType = "PENDING_NEW"
 	OrderStatusTypeNew             OrderStatusType = "NEW"
 	OrderStatusTypePartiallyFilled OrderStatusType = "PARTIALLY_FILLED"
 	OrderStatusTypeFilled          OrderStatusType = "FILLED"
@@ -28,6 +31,9 @@ var (
 	OrderStatusTypePendingCancel   OrderStatusType = "PENDING_CANCEL"
 	OrderStatusTypeRejected        OrderStatusType = "REJECTED"
 	OrderStatusTypeExpired         OrderStatusType = "EXPIRED"
+
+	PositionSideTypeLong  PositionSideType = "LONG"
+	PositionSideTypeShort PositionSideType = "SHORT"
 )
 
 type Order struct {
@@ -40,19 +46,75 @@ type Order struct {
 	Price      float64         `db:"price" json:"price"`
 	Quantity   float64         `db:"quantity" json:"quantity"`
 
+	// ClientOrderID is the id of the order sent to the exchange, the status of an order
+	// is PENDING_NEW until it is confirmed by the exchange
+	ClientOrderID string `db:"client_order_id" json:"client_order_id,omitempty"`
+
+	// ExecutedQuantity is the quantity filled so far, Price is the average
+	// execution price of market orders
+	ExecutedQuantity float64 `db:"executed_quantity" json:"executed_quantity"`
+
+	// Fee is the commission paid by the order, in the FeeAsset
+	Fee      float64 `db:"fee" json:"fee"`
+	FeeAsset string  `db:"fee_asset" json:"fee_asset"`
+
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 
+	// PositionSide is SHORT for the orders opening or closing a short position,
+	// empty for spot orders
+	PositionSide PositionSideType `db:"position_side" json:"position_side"`
+
 	// OCO Orders only
 	Stop    *float64 `db:"stop" json:"stop"`
 	GroupID *int64   `db:"group_id" json:"group_id"`
 
+	// Trailing stop orders only, Stop is the current stop price
+	Trailing *Trailing `db:"-" json:"trailing,omitempty"`
+
 	// Internal use (Plot)
 	RefPrice float64 `json:"-"`
 	Profit   float64 `json:"-"`
 	Candle   Candle  `json:"-"`
 }
 
+// Trailing is the distance of a trailing stop from the best price reached since its creation,
+// either a callback rate of the price, eg: 0.01 for 1 %, or a price offset
+type Trailing struct {
+	Rate   float64 `json:"rate,omitempty"`
+	Offset float64 `json:"offset,omitempty"`
+}
+
+func TrailingRate(rate float64) Trailing {
+	return Trailing{Rate: rate}
+}
+
+func TrailingOffset(offset float64) Trailing {
+	return Trailing{Offset: offset}
+}
+
+// Valid reports if the distance is either a rate between 0 and 1 or a positive offset
+func (t Trailing) Valid() bool {
+	if t.Rate != 0 {
+		return t.Offset == 0 && t.Rate > 0 && t.Rate < 1
+	}
+	return t.Offset > 0
+}
+
+// Stop returns the stop price of a sell trailing stop below the given high price
+func (t Trailing) Stop(high float64) float64 {
+	return high*(1-t.Rate) - t.Offset
+}
+
+// Executed returns the filled quantity, orders filled without
+// executed quantity, eg: created before it was recorded, are filled in full
+func (o Order) Executed() float64 {
+	if o.ExecutedQuantity == 0 && o.Status == OrderStatusTypeFilled {
+		return o.Quantity
+	}
+	return o.ExecutedQuantity
+}
+
 func (o Order) String() string {
 	return fmt.Sprintf("[%s] %s %s | ID: %d, Type: %s, %f x $%f (~$%.f)",
 		o.Status, o.Side, o.Pair, o.ID, o.Type, o.Quantity, o.Price, o.Quantity*o.Price)
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+type PositionStatusType string
+
+var (
+	PositionStatusTypeOpen   PositionStatusType = "OPEN"
+	PositionStatusTypeClosed PositionStatusType = "CLOSED"
+)
+
+// Position is the quantity of a pair held by the bot, built from the filled orders.
+// Short positions, opened by selling borrowed assets, have the SHORT side.
+type Position struct {
+	ID       int64              `db:"id" json:"id"`
+	Pair     string             `db:"pair" json:"pair"`
+	Status   PositionStatusType `db:"status" json:"status"`
+	Side     PositionSideType   `db:"side" json:"side"`
+	Quantity float64            `db:"quantity" json:"quantity"`
+	AvgPrice float64            `db:"avg_price" json:"avg_price"`
+
+	// EntryFee is the fee of the entries not yet allocated to trades, in the quote asset
+	EntryFee float64 `db:"entry_fee" json:"entry_fee"`
+	// Fees is the total fee paid by the position, in the quote asset
+	Fees        float64 `db:"fees" json:"fees"`
+	RealizedPnL float64 `db:"realized_pnl" json:"realized_pnl"`
+
+	OpenedAt  time.Time  `db:"opened_at" json:"opened_at"`
+	UpdatedAt time.Time  `db:"updated_at" json:"updated_at"`
+	ClosedAt  *time.Time `db:"closed_at" json:"closed_at"`
+}
+
+// IsShort tells if the position profits from a falling price
+func (p Position) IsShort() bool {
+	return p.Side == PositionSideTypeShort
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("[%s] %s | ID: %d, %f x $%f, PnL: %f",
+		p.Status, p.Pair, p.ID, p.Quantity, p.AvgPrice, p.RealizedPnL)
+}
+
+// Trade is the exit of a position quantity, from its average entry to the exit fill
+type Trade struct {
+	ID         int64   `db:"id" json:"id"`
+	PositionID int64   `db:"position_id" json:"position_id"`
+	OrderID    int64   `db:"order_id" json:"order_id"`
+	Pair       string  `db:"pair" json:"pair"`
+	Quantity   float64 `db:"quantity" json:"quantity"`
+	EntryPrice float64 `db:"entry_price" json:"entry_price"`
+	ExitPrice  float64 `db:"exit_price" json:"exit_price"`
+
+	// Fee is the exit fee plus the share of the entry fees, in the quote asset
+	Fee float64 `db:"fee" json:"fee"`
+	// Profit is the realized PnL without fees
+	Profit        float64 `db:"profit" json:"profit"`
+	ProfitPercent float64 `db:"profit_percent" json:"profit_percent"`
+
+	OpenedAt time.Time `db:"opened_at" json:"opened_at"`
+	ClosedAt time.Time `db:"closed_at" json:"closed_at"`
+}
+
+// NetProfit is the realized PnL after fees
+func (t Trade) NetProfit() float64 {
+	return t.Profit - t.Fee
+}
+
+// HoldingTime is the time between the opening of the position and the exit
+func (t Trade) HoldingTime() time.Duration {
+	return t.ClosedAt.Sub(t.OpenedAt)
+}
+
+func (t Trade) String() string {
+	return fmt.Sprintf("%s | ID: %d, %f x $%f -> $%f, PnL: %f (%.2f %%), Fee: %f, Holding: %s",
+		t.Pair, t.ID, t.Quantity, t.EntryPrice, t.ExitPrice, t.Profit, t.ProfitPercent*100, t.Fee, t.HoldingTime())
+}
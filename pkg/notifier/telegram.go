@@ -134,7 +134,13 @@ func (t telegram) BalanceHandle(m *tb.Message) {
 	total := 0.0
 
 	for _, pair := range t.settings.Pairs {
-		assetPair, quotePair := exchange.SplitAssetQuote(pair)
+		assetPair, quotePair, err := exchange.SplitAssetQuote(pair)
+		if err != nil {
+			log.Error().Err(err).Msg("bot balance handle failed.")
+			t.OnError(err)
+			return
+		}
+
 		assetSize, quoteSize, err := t.orderController.Position(pair)
 		if err != nil {
 			log.Error().Err(err).Msg("bot balance handle failed.")
@@ -188,7 +194,14 @@ func (t telegram) HelpHandle(m *tb.Message) {
 }
 
 func (t telegram) ProfitHandle(m *tb.Message) {
-	if len(t.orderController.Results) == 0 {
+	summaries, err := t.orderController.Summaries()
+	if err != nil {
+		log.Error().Err(err).Msg("bot profit handle failed.")
+		t.OnError(err)
+		return
+	}
+
+	if len(summaries) == 0 {
 		_, err := t.client.Send(m.Sender, "No trades registered.")
 		if err != nil {
 			log.Error().Err(err).Msg("bot profit handle failed.")
@@ -196,7 +209,7 @@ func (t telegram) ProfitHandle(m *tb.Message) {
 		return
 	}
 
-	for pair, summary := range t.orderController.Results {
+	for pair, summary := range summaries {
 		_, err := t.client.Send(m.Sender, fmt.Sprintf("*PAIR*: `%s`\n`%s`", pair, summary.String()))
 		if err != nil {
 			log.Error().Err(err).Msg("bot profit handle failed.")
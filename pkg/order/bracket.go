@@ -0,0 +1,326 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/storage"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrInvalidBracket = errors.New("invalid bracket prices")
+	ErrBracketExits   = errors.New("bracket exits under the minimum quantity")
+)
+
+// CreateBracketOrder enters the pair with a limit order, or at market without entry price,
+// and protects the position with an OCO of the opposite side. The exits are placed for
+// the filled quantity once the entry is filled, or canceled after a partial fill, and the
+// bracket is canceled with an entry canceled before any fill. The bracket is returned with
+// the error of an entry of unknown status, it follows the entry once found on the exchange.
+func (c *Controller) CreateBracketOrder(side model.SideType, pair string, size, entry, takeProfit,
+	stop, stopLimit float64) (model.Bracket, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.accepting(); err != nil {
+		return model.Bracket{}, err
+	}
+
+	if !validBracket(side, entry, takeProfit, stop, stopLimit) {
+		return model.Bracket{}, ErrInvalidBracket
+	}
+
+	log.Info().Msgf("[ORDER] Creating BRACKET %s order for %s", side, pair)
+	kind := model.OrderTypeMarket
+	if entry > 0 {
+		kind = model.OrderTypeLimit
+	}
+	orders, submitErr := c.submit([]model.Order{pendingOrder(side, kind, pair, size, entry)},
+		func(trader exchange.Trader) ([]model.Order, error) {
+			var (
+				order model.Order
+				err   error
+			)
+			if entry > 0 {
+				order, err = trader.CreateOrderLimit(side, pair, size, entry)
+			} else {
+				order, err = trader.CreateOrderMarket(side, pair, size)
+			}
+			return []model.Order{order}, err
+		})
+	if submitErr != nil {
+		c.notifyError(submitErr)
+		if len(orders) == 0 {
+			return model.Bracket{}, submitErr
+		}
+	}
+
+	order := orders[0]
+	if submitErr == nil {
+		if order.Type == model.OrderTypeMarket {
+			c.processTrade(&order, model.Order{})
+		}
+		c.updates.Push(order)
+		log.Info().Msgf("[ORDER CREATED] %s", order)
+	}
+
+	bracket := model.Bracket{
+		Pair:       pair,
+		Side:       side,
+		Status:     model.BracketStatusTypePending,
+		Quantity:   size,
+		Entry:      entry,
+		TakeProfit: takeProfit,
+		Stop:       stop,
+		StopLimit:  stopLimit,
+		EntryID:    order.ID,
+		CreatedAt:  order.CreatedAt,
+		UpdatedAt:  order.CreatedAt,
+	}
+	err := c.storage.CreateBracket(&bracket)
+	if err != nil {
+		c.notifyError(err)
+		return model.Bracket{}, err
+	}
+
+	// a market entry is usually filled at once
+	c.updateBracket(&bracket)
+	return bracket, submitErr
+}
+
+// validBracket checks the exits are on each side of the entry
+func validBracket(side model.SideType, entry, takeProfit, stop, stopLimit float64) bool {
+	if takeProfit <= 0 || stop <= 0 || stopLimit <= 0 || entry < 0 {
+		return false
+	}
+	if side == model.SideTypeSell {
+		return stop > takeProfit && (entry == 0 || takeProfit < entry && entry < stop)
+	}
+	return stop < takeProfit && (entry == 0 || stop < entry && entry < takeProfit)
+}
+
+// Brackets returns the persisted brackets
+func (c *Controller) Brackets(filters ...storage.BracketFilter) ([]*model.Bracket, error) {
+	return c.storage.Brackets(filters...)
+}
+
+// CancelBracket cancels the entry of the bracket, or its exits when they are placed
+func (c *Controller) CancelBracket(bracket model.Bracket) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	current, err := c.bracket(bracket.ID)
+	if err != nil {
+		return err
+	}
+	if !current.Active() {
+		return nil
+	}
+
+	log.Info().Msgf("[ORDER] Cancelling bracket for %s", current.Pair)
+	for _, id := range []int64{current.EntryID, current.TakeProfitID, current.StopID} {
+		if err := c.cancelStored(id); err != nil {
+			c.notifyError(err)
+			return err
+		}
+	}
+
+	return c.setBracketStatus(current, model.BracketStatusTypeCanceled, time.Now())
+}
+
+// cancelStored cancels a stored order still open on the exchange, the legs of an
+// OCO may be canceled with the first one
+func (c *Controller) cancelStored(id int64) error {
+	if id == 0 {
+		return nil
+	}
+
+	order, err := c.storedOrder(id)
+	if err != nil {
+		return err
+	}
+
+	excOrder, err := c.exchange.Order(order.Pair, order.ExchangeID)
+	if err != nil {
+		return err
+	}
+	if excOrder.Status != model.OrderStatusTypeNew && excOrder.Status != model.OrderStatusTypePartiallyFilled {
+		return nil
+	}
+
+	err = c.exchange.Cancel(*order)
+	if err != nil {
+		return err
+	}
+
+	order.Status = model.OrderStatusTypePendingCancel
+	return c.storage.UpdateOrder(order)
+}
+
+func (c *Controller) bracket(id int64) (*model.Bracket, error) {
+	brackets, err := c.storage.Brackets(storage.BracketFilterFunc(func(bracket model.Bracket) bool {
+		return bracket.ID == id
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if len(brackets) == 0 {
+		return nil, fmt.Errorf("bracket %d not found", id)
+	}
+	return brackets[0], nil
+}
+
+func (c *Controller) storedOrder(id int64) (*model.Order, error) {
+	orders, err := c.storage.Orders(storage.OrderFilterFunc(func(order model.Order) bool {
+		return order.ID == id
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("order %d not found", id)
+	}
+	return orders[0], nil
+}
+
+// updateBrackets follows the active brackets with the stored state of their orders,
+// so the brackets continue after a restart
+func (c *Controller) updateBrackets() {
+	brackets, err := c.storage.Brackets(storage.WithBracketStatusIn(
+		model.BracketStatusTypePending,
+		model.BracketStatusTypeOpen,
+	))
+	if err != nil {
+		c.notifyError(err)
+		return
+	}
+
+	for _, bracket := range brackets {
+		c.updateBracket(bracket)
+	}
+}
+
+func (c *Controller) updateBracket(bracket *model.Bracket) {
+	var err error
+	switch bracket.Status {
+	case model.BracketStatusTypePending:
+		err = c.updateBracketEntry(bracket)
+	case model.BracketStatusTypeOpen:
+		err = c.updateBracketExits(bracket)
+	}
+	if err != nil {
+		c.notifyError(fmt.Errorf("bracket %d: %w", bracket.ID, err))
+	}
+}
+
+func (c *Controller) updateBracketEntry(bracket *model.Bracket) error {
+	entry, err := c.storedOrder(bracket.EntryID)
+	if err != nil {
+		return err
+	}
+
+	switch entry.Status {
+	case model.OrderStatusTypeFilled:
+	case model.OrderStatusTypeCanceled, model.OrderStatusTypeExpired, model.OrderStatusTypeRejected:
+		if entry.Executed() == 0 {
+			return c.setBracketStatus(bracket, model.BracketStatusTypeCanceled, entry.UpdatedAt)
+		}
+	default:
+		return nil
+	}
+
+	quantity := c.exitQuantity(*entry)
+	if quantity <= 0 || quantity < c.exchange.GetAssetsInfo(bracket.Pair).MinQuantity {
+		if err := c.setBracketStatus(bracket, model.BracketStatusTypeCanceled, entry.UpdatedAt); err != nil {
+			return err
+		}
+		return ErrBracketExits
+	}
+
+	side := model.SideTypeSell
+	if bracket.Side == model.SideTypeSell {
+		side = model.SideTypeBuy
+	}
+
+	log.Info().Msgf("[ORDER] Creating BRACKET exits for %s", bracket.Pair)
+	orders, err := c.submitOCO(side, bracket.Pair, quantity, bracket.TakeProfit, bracket.Stop, bracket.StopLimit)
+	if rejected(err) {
+		// the exits are not sent again, the position is left to the strategy
+		if statusErr := c.setBracketStatus(bracket, model.BracketStatusTypeFailed, entry.UpdatedAt); statusErr != nil {
+			return statusErr
+		}
+		return fmt.Errorf("exits rejected: %w", err)
+	}
+	if err != nil && len(orders) == 0 {
+		// retried with the next update
+		return err
+	}
+
+	// exits of unknown status are followed as pending orders, they are not sent twice
+	for i := range orders {
+		if orders[i].Stop != nil {
+			bracket.StopID = orders[i].ID
+		} else {
+			bracket.TakeProfitID = orders[i].ID
+		}
+		if err == nil {
+			c.updates.Push(orders[i])
+		}
+	}
+	if statusErr := c.setBracketStatus(bracket, model.BracketStatusTypeOpen, entry.UpdatedAt); statusErr != nil {
+		return statusErr
+	}
+	return err
+}
+
+// exitQuantity is the executed quantity of the entry without the fee paid in the base
+// asset, rounded down to the step size of the pair
+func (c *Controller) exitQuantity(entry model.Order) float64 {
+	info := c.exchange.GetAssetsInfo(entry.Pair)
+	quantity := entry.Executed()
+	if entry.Side == model.SideTypeBuy && entry.FeeAsset != "" && entry.FeeAsset == info.BaseAsset {
+		quantity -= entry.Fee
+	}
+	return RoundStep(quantity, info.StepSize)
+}
+
+func (c *Controller) updateBracketExits(bracket *model.Bracket) error {
+	filled, done := false, true
+	var updatedAt time.Time
+	for _, id := range []int64{bracket.TakeProfitID, bracket.StopID} {
+		order, err := c.storedOrder(id)
+		if err != nil {
+			return err
+		}
+		if order.UpdatedAt.After(updatedAt) {
+			updatedAt = order.UpdatedAt
+		}
+		switch order.Status {
+		case model.OrderStatusTypeFilled:
+			filled = true
+		case model.OrderStatusTypeCanceled, model.OrderStatusTypeExpired, model.OrderStatusTypeRejected:
+			filled = filled || order.Executed() > 0
+		default:
+			done = false
+		}
+	}
+
+	switch {
+	case filled && done:
+		return c.setBracketStatus(bracket, model.BracketStatusTypeClosed, updatedAt)
+	case done:
+		return c.setBracketStatus(bracket, model.BracketStatusTypeCanceled, updatedAt)
+	}
+	return nil
+}
+
+func (c *Controller) setBracketStatus(bracket *model.Bracket, status model.BracketStatusType, t time.Time) error {
+	bracket.Status = status
+	bracket.UpdatedAt = t
+	log.Info().Msgf("[BRACKET %s] %s", status, bracket)
+	return c.storage.UpdateBracket(bracket)
+}
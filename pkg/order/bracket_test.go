@@ -0,0 +1,210 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestController_Bracket(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hour int, price float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hour) * time.Hour),
+			Open: price, High: price, Low: price, Close: price, Volume: 10, Complete: true}
+	}
+	setup := func() (*exchange.PaperWallet, storage.Storage, *Controller) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+			exchange.WithPaperLiquidity(0.2))
+		wallet.OnCandle(candle(0, 105))
+		return wallet, db, NewController(ctx, wallet, db, NewMonitor(wallet))
+	}
+	stored := func(controller *Controller, id int64) model.Bracket {
+		bracket, err := controller.bracket(id)
+		require.NoError(t, err)
+		return *bracket
+	}
+
+	t.Run("invalid prices", func(t *testing.T) {
+		_, _, controller := setup()
+		_, err := controller.CreateBracketOrder(model.SideTypeBuy, "BTCUSDT", 1, 100, 90, 120, 119)
+		require.ErrorIs(t, err, ErrInvalidBracket)
+		_, err = controller.CreateBracketOrder(model.SideTypeBuy, "BTCUSDT", 1, 130, 120, 90, 89)
+		require.ErrorIs(t, err, ErrInvalidBracket)
+	})
+
+	t.Run("exits after the entry", func(t *testing.T) {
+		wallet, _, controller := setup()
+		bracket, err := controller.CreateBracketOrder(model.SideTypeBuy, "BTCUSDT", 1, 100, 120, 90, 89)
+		require.NoError(t, err)
+		require.Equal(t, model.BracketStatusTypePending, bracket.Status)
+
+		wallet.OnCandle(candle(1, 100))
+		controller.updateOrders()
+		bracket = stored(controller, bracket.ID)
+		require.Equal(t, model.BracketStatusTypeOpen, bracket.Status)
+
+		stop, err := controller.storedOrder(bracket.StopID)
+		require.NoError(t, err)
+		require.Equal(t, model.SideTypeSell, stop.Side)
+		require.Equal(t, 1.0, stop.Quantity)
+		require.Equal(t, 90.0, *stop.Stop)
+
+		wallet.OnCandle(candle(2, 125))
+		controller.updateOrders()
+		require.Equal(t, model.BracketStatusTypeClosed, stored(controller, bracket.ID).Status)
+
+		takeProfit, err := controller.storedOrder(bracket.TakeProfitID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, takeProfit.Status)
+		stop, err = controller.storedOrder(bracket.StopID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, stop.Status)
+
+		trades, err := controller.Trades()
+		require.NoError(t, err)
+		require.Len(t, trades, 1)
+		require.InDelta(t, 20, trades[0].Profit, 1e-9)
+	})
+
+	t.Run("sell entry", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 100),
+			exchange.WithPaperAsset("BTC", 1))
+		wallet.OnCandle(candle(0, 105))
+		controller := NewController(ctx, wallet, db, NewMonitor(wallet))
+
+		bracket, err := controller.CreateBracketOrder(model.SideTypeSell, "BTCUSDT", 1, 110, 90, 120, 121)
+		require.NoError(t, err)
+		wallet.OnCandle(candle(1, 110))
+		controller.updateOrders()
+		bracket = stored(controller, bracket.ID)
+		require.Equal(t, model.BracketStatusTypeOpen, bracket.Status)
+
+		stop, err := controller.storedOrder(bracket.StopID)
+		require.NoError(t, err)
+		require.Equal(t, model.SideTypeBuy, stop.Side)
+		require.Equal(t, 120.0, *stop.Stop)
+
+		// the buy stop is reached above the entry, at the open of the gap
+		wallet.OnCandle(candle(2, 125))
+		controller.updateOrders()
+		require.Equal(t, model.BracketStatusTypeClosed, stored(controller, bracket.ID).Status)
+		stop, err = controller.storedOrder(bracket.StopID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, stop.Status)
+		takeProfit, err := controller.storedOrder(bracket.TakeProfitID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, takeProfit.Status)
+
+		account, err := wallet.Account()
+		require.NoError(t, err)
+		require.Equal(t, 1.0, account.Balance("BTC").Free)
+		require.InDelta(t, 0, account.Balance("USDT").Lock, 1e-9)
+		require.InDelta(t, 100+110-125, account.Balance("USDT").Free, 1e-9)
+	})
+
+	t.Run("rejected exits", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 0),
+			exchange.WithPaperAsset("BTC", 1))
+		wallet.OnCandle(candle(0, 105))
+		controller := NewController(ctx, wallet, db, NewMonitor(wallet))
+		notifier := &errorNotifier{}
+		controller.SetNotifier(notifier)
+
+		// the buy stop needs more than the quote of the entry
+		bracket, err := controller.CreateBracketOrder(model.SideTypeSell, "BTCUSDT", 1, 110, 90, 120, 121)
+		require.NoError(t, err)
+		wallet.OnCandle(candle(1, 110))
+		for i := 0; i < 3; i++ {
+			controller.updateOrders()
+		}
+
+		require.Equal(t, model.BracketStatusTypeFailed, stored(controller, bracket.ID).Status)
+		require.Len(t, notifier.errors, 1)
+		orders, err := controller.Orders(storage.WithStatus(model.OrderStatusTypeRejected))
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+	})
+
+	t.Run("market entry", func(t *testing.T) {
+		_, _, controller := setup()
+		bracket, err := controller.CreateBracketOrder(model.SideTypeBuy, "BTCUSDT", 1, 0, 120, 90, 89)
+		require.NoError(t, err)
+		require.Equal(t, model.BracketStatusTypeOpen, bracket.Status)
+		require.NotZero(t, bracket.TakeProfitID)
+	})
+
+	t.Run("cancel before the entry", func(t *testing.T) {
+		wallet, _, controller := setup()
+		bracket, err := controller.CreateBracketOrder(model.SideTypeBuy, "BTCUSDT", 1, 100, 120, 90, 89)
+		require.NoError(t, err)
+		entry, err := controller.storedOrder(bracket.EntryID)
+		require.NoError(t, err)
+		require.NoError(t, controller.Cancel(*entry))
+
+		wallet.OnCandle(candle(1, 100))
+		controller.updateOrders()
+		require.Equal(t, model.BracketStatusTypeCanceled, stored(controller, bracket.ID).Status)
+
+		bracket, err = controller.CreateBracketOrder(model.SideTypeBuy, "BTCUSDT", 1, 95, 120, 90, 89)
+		require.NoError(t, err)
+		require.NoError(t, controller.CancelBracket(bracket))
+		require.Equal(t, model.BracketStatusTypeCanceled, stored(controller, bracket.ID).Status)
+		entry, err = controller.storedOrder(bracket.EntryID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypePendingCancel, entry.Status)
+	})
+
+	t.Run("partial entry after a restart", func(t *testing.T) {
+		wallet, db, controller := setup()
+		bracket, err := controller.CreateBracketOrder(model.SideTypeBuy, "BTCUSDT", 3, 100, 120, 90, 89)
+		require.NoError(t, err)
+
+		// the liquidity of the candle fills 2 of 3
+		wallet.OnCandle(candle(1, 100))
+		controller.updateOrders()
+		require.Equal(t, model.BracketStatusTypePending, stored(controller, bracket.ID).Status)
+		entry, err := controller.storedOrder(bracket.EntryID)
+		require.NoError(t, err)
+		require.NoError(t, controller.Cancel(*entry))
+
+		// a new controller continues with the persisted bracket
+		controller = NewController(ctx, wallet, db, NewMonitor(wallet))
+		wallet.OnCandle(candle(2, 110))
+		controller.updateOrders()
+		bracket = stored(controller, bracket.ID)
+		require.Equal(t, model.BracketStatusTypeOpen, bracket.Status)
+		takeProfit, err := controller.storedOrder(bracket.TakeProfitID)
+		require.NoError(t, err)
+		require.Equal(t, 2.0, takeProfit.Quantity)
+
+		require.NoError(t, controller.CancelBracket(bracket))
+		wallet.OnCandle(candle(3, 110))
+		controller.updateOrders()
+		require.Equal(t, model.BracketStatusTypeCanceled, stored(controller, bracket.ID).Status)
+		exit, err := wallet.Order("BTCUSDT", takeProfit.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, exit.Status)
+	})
+}
+
+type errorNotifier struct {
+	errors []error
+}
+
+func (n *errorNotifier) Notify(string) {}
+
+func (n *errorNotifier) OnError(err error) {
+	n.errors = append(n.errors, err)
+}
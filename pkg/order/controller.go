@@ -2,10 +2,9 @@ package order
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"github.com/lynbklk/tradebot/pkg/notifier"
 	"github.com/lynbklk/tradebot/pkg/storage"
-	"math"
 	"sync"
 	"time"
 
@@ -14,6 +13,8 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+var ErrHalted = errors.New("controller halted")
+
 type Controller struct {
 	mtx      sync.Mutex
 	ctx      context.Context
@@ -21,12 +22,16 @@ type Controller struct {
 	storage  storage.Storage
 	//orderFeed      *Feed
 	monitor        Monitor
-	notifier       notifier.Notifier
+	updates        *orderQueue
+	notifier       Notifier
 	Results        map[string]*summary
 	lastPrice      map[string]float64
 	tickerInterval time.Duration
 	finish         chan bool
 	status         Status
+	halted         string
+
+	clientOrderPrefix string
 }
 
 func NewController(ctx context.Context, exchange exchange.Exchange, storage storage.Storage,
@@ -38,14 +43,17 @@ func NewController(ctx context.Context, exchange exchange.Exchange, storage stor
 		exchange: exchange,
 		//orderFeed:      orderFeed,
 		monitor:        monitor,
+		updates:        newOrderQueue(ctx, monitor),
 		lastPrice:      make(map[string]float64),
 		Results:        make(map[string]*summary),
 		tickerInterval: time.Second,
 		finish:         make(chan bool),
+
+		clientOrderPrefix: defaultClientOrderPrefix,
 	}
 }
 
-func (c *Controller) SetNotifier(notifier notifier.Notifier) {
+func (c *Controller) SetNotifier(notifier Notifier) {
 	c.notifier = notifier
 }
 
@@ -53,52 +61,6 @@ func (c *Controller) OnCandle(candle model.Candle) {
 	c.lastPrice[candle.Pair] = candle.Close
 }
 
-func (c *Controller) calculateProfit(o *model.Order) (value, percent float64, err error) {
-	// get filled orders before the current order
-	orders, err := c.storage.Orders(
-		storage.WithUpdateAtBeforeOrEqual(o.UpdatedAt),
-		storage.WithStatus(model.OrderStatusTypeFilled),
-		storage.WithPair(o.Pair),
-	)
-	if err != nil {
-		return 0, 0, err
-	}
-
-	quantity := 0.0
-	avgPrice := 0.0
-
-	for _, order := range orders {
-		// skip current order
-		if o.ID == order.ID {
-			continue
-		}
-
-		// calculate avg price
-		if order.Side == model.SideTypeBuy {
-			price := order.Price
-			if order.Type == model.OrderTypeStopLoss || order.Type == model.OrderTypeStopLossLimit {
-				price = *order.Stop
-			}
-			avgPrice = (order.Quantity*price + avgPrice*quantity) / (order.Quantity + quantity)
-			quantity += order.Quantity
-		} else {
-			quantity = math.Max(quantity-order.Quantity, 0)
-		}
-	}
-
-	if quantity == 0 {
-		return 0, 0, nil
-	}
-
-	cost := o.Quantity * avgPrice
-	price := o.Price
-	if o.Type == model.OrderTypeStopLoss || o.Type == model.OrderTypeStopLossLimit {
-		price = *o.Stop
-	}
-	profitValue := o.Quantity*price - cost
-	return profitValue, profitValue / cost, nil
-}
-
 func (c *Controller) notify(message string) {
 	log.Info().Msg(message)
 	if c.notifier != nil {
@@ -113,8 +75,11 @@ func (c *Controller) notifyError(err error) {
 	}
 }
 
-func (c *Controller) processTrade(order *model.Order) {
-	if order.Status != model.OrderStatusTypeFilled {
+// processTrade applies the quantity executed since the previous state of the order,
+// so partial fills are accounted once each
+func (c *Controller) processTrade(order *model.Order, previous model.Order) {
+	fill, ok := execution(previous, *order)
+	if !ok {
 		return
 	}
 
@@ -124,28 +89,33 @@ func (c *Controller) processTrade(order *model.Order) {
 	}
 
 	// register order volume
-	c.Results[order.Pair].Volume += order.Price * order.Quantity
+	c.Results[order.Pair].Volume += fill.Price * fill.Quantity
 
-	// calculate profit only to sell orders
-	if order.Side != model.SideTypeSell {
+	trade, err := updateLedger(c.storage, &fill)
+	if err != nil {
+		c.notifyError(err)
 		return
 	}
 
-	profitValue, profit, err := c.calculateProfit(order)
-	if err != nil {
-		c.notifyError(err)
+	// profit is realized only by sell orders
+	if trade == nil {
 		return
 	}
 
-	order.Profit = profit
-	if profitValue >= 0 {
-		c.Results[order.Pair].Win = append(c.Results[order.Pair].Win, profitValue)
+	order.Profit = trade.ProfitPercent
+	if trade.Profit >= 0 {
+		c.Results[order.Pair].Win = append(c.Results[order.Pair].Win, trade.Profit)
 	} else {
-		c.Results[order.Pair].Lose = append(c.Results[order.Pair].Lose, profitValue)
+		c.Results[order.Pair].Lose = append(c.Results[order.Pair].Lose, trade.Profit)
 	}
 
-	_, quote := exchange.SplitAssetQuote(order.Pair)
-	c.notify(fmt.Sprintf("[PROFIT] %f %s (%f %%)\n`%s`", profitValue, quote, profit*100, c.Results[order.Pair].String()))
+	_, quote, err := exchange.SplitAssetQuote(order.Pair)
+	if err != nil {
+		c.notifyError(err)
+		return
+	}
+	c.notify(fmt.Sprintf("[PROFIT] %f %s (%f %%)\n`%s`", trade.Profit, quote, trade.ProfitPercent*100,
+		c.Results[order.Pair].String()))
 }
 
 func (c *Controller) updateOrders() {
@@ -154,6 +124,7 @@ func (c *Controller) updateOrders() {
 
 	// pending orders
 	orders, err := c.storage.Orders(storage.WithStatusIn(
+		model.OrderStatusTypePendingNew,
 		model.OrderStatusTypeNew,
 		model.OrderStatusTypePartiallyFilled,
 		model.OrderStatusTypePendingCancel,
@@ -165,40 +136,120 @@ func (c *Controller) updateOrders() {
 	}
 
 	// For each pending order, check for updates
-	var updatedOrders []model.Order
+	var updatedOrders, previousOrders []model.Order
 	for _, order := range orders {
-		excOrder, err := c.exchange.Order(order.Pair, order.ExchangeID)
+		var excOrder model.Order
+		if order.Status == model.OrderStatusTypePendingNew {
+			excOrder, err = c.resolve(*order)
+		} else {
+			excOrder, err = c.exchange.Order(order.Pair, order.ExchangeID)
+		}
+		if errors.Is(err, exchange.ErrOrderNotFound) && order.Status == model.OrderStatusTypePendingNew {
+			continue
+		}
 		if err != nil {
 			log.Error().Err(err).Msgf("order controller get %d failed.", order.ExchangeID)
 			continue
 		}
 
-		// no status change
-		if excOrder.Status == order.Status {
-			continue
+		if excOrder, changed := c.syncOrder(order, excOrder); changed {
+			updatedOrders = append(updatedOrders, excOrder)
+			previousOrders = append(previousOrders, *order)
 		}
+	}
 
-		excOrder.ID = order.ID
-		err = c.storage.UpdateOrder(&excOrder)
-		if err != nil {
-			c.notifyError(err)
-			continue
-		}
+	for i, processOrder := range updatedOrders {
+		c.processTrade(&processOrder, previousOrders[i])
+		c.updates.Push(processOrder)
+	}
+
+	c.updateBrackets()
+}
+
+// syncOrder stores the state of the order on the exchange, it returns the updated order
+// when its status or execution changed
+func (c *Controller) syncOrder(order *model.Order, excOrder model.Order) (model.Order, bool) {
+	// no status change or new execution
+	changed := excOrder.Status != order.Status || excOrder.ExecutedQuantity != order.ExecutedQuantity
+	if !changed && !trailed(excOrder, *order) {
+		return model.Order{}, false
+	}
+
+	excOrder.ID = order.ID
+	// one-way futures orders are returned without their position side
+	if excOrder.PositionSide == "" {
+		excOrder.PositionSide = order.PositionSide
+	}
+	if excOrder.Trailing == nil {
+		excOrder.Trailing = order.Trailing
+	}
+	if excOrder.ClientOrderID == "" {
+		excOrder.ClientOrderID = order.ClientOrderID
+	}
+	err := c.storage.UpdateOrder(&excOrder)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, false
+	}
 
-		log.Info().Msgf("[ORDER %s] %s", excOrder.Status, excOrder)
-		updatedOrders = append(updatedOrders, excOrder)
+	// the stop of a trailing order followed the price
+	if !changed {
+		return model.Order{}, false
 	}
 
-	for _, processOrder := range updatedOrders {
-		c.processTrade(&processOrder)
-		c.monitor.Publish(processOrder)
+	log.Info().Msgf("[ORDER %s] %s", excOrder.Status, excOrder)
+	return excOrder, true
+}
+
+// trailed tells if the stop of a trailing stop order moved on the exchange
+func trailed(excOrder, order model.Order) bool {
+	if order.Type != model.OrderTypeTrailingStop || excOrder.Stop == nil {
+		return false
 	}
+	return order.Stop == nil || *excOrder.Stop != *order.Stop
 }
 
 func (c *Controller) Status() Status {
 	return c.status
 }
 
+// Halt rejects the new orders until the controller is resumed, the orders created before
+// are still synced with the exchange
+func (c *Controller) Halt(reason string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.halted = reason
+	log.Warn().Msgf("Bot halted: %s", reason)
+}
+
+// Resume accepts new orders again after a halt
+func (c *Controller) Resume() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.halted != "" {
+		c.halted = ""
+		log.Info().Msg("Bot resumed.")
+	}
+}
+
+// Halted tells if the controller rejects new orders
+func (c *Controller) Halted() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.halted != ""
+}
+
+// accepting returns ErrHalted while the controller is halted, the mutex must be held
+func (c *Controller) accepting() error {
+	if c.halted != "" {
+		return fmt.Errorf("%w: %s", ErrHalted, c.halted)
+	}
+	return nil
+}
+
 func (c *Controller) Start() {
 	if c.status != StatusRunning {
 		c.status = StatusRunning
@@ -235,6 +286,18 @@ func (c *Controller) Position(pair string) (asset, quote float64, err error) {
 	return c.exchange.Position(pair)
 }
 
+func (c *Controller) GetAssetsInfo(pair string) model.AssetInfo {
+	return c.exchange.GetAssetsInfo(pair)
+}
+
+// UserInfo returns the commissions of the exchange, none when the exchange does not know them
+func (c *Controller) UserInfo() exchange.UserInfo {
+	if account, ok := c.exchange.(interface{ UserInfo() exchange.UserInfo }); ok {
+		return account.UserInfo()
+	}
+	return exchange.UserInfo{}
+}
+
 func (c *Controller) LastQuote(pair string) (float64, error) {
 	return c.exchange.GetLastQuote(c.ctx, pair)
 }
@@ -247,6 +310,56 @@ func (c *Controller) PositionValue(pair string) (float64, error) {
 	return asset * c.lastPrice[pair], nil
 }
 
+// Positions returns the positions of the ledger
+func (c *Controller) Positions(filters ...storage.PositionFilter) ([]*model.Position, error) {
+	return c.storage.Positions(filters...)
+}
+
+// Orders returns the stored orders
+func (c *Controller) Orders(filters ...storage.OrderFilter) ([]*model.Order, error) {
+	return c.storage.Orders(filters...)
+}
+
+// Trades returns the trades realized by the ledger
+func (c *Controller) Trades(filters ...storage.TradeFilter) ([]*model.Trade, error) {
+	return c.storage.Trades(filters...)
+}
+
+// Summaries returns the results by pair from the persisted trades and filled orders
+func (c *Controller) Summaries() (map[string]*summary, error) {
+	summaries := make(map[string]*summary)
+	get := func(pair string) *summary {
+		if _, ok := summaries[pair]; !ok {
+			summaries[pair] = &summary{Pair: pair}
+		}
+		return summaries[pair]
+	}
+
+	orders, err := c.storage.Orders()
+	if err != nil {
+		return nil, err
+	}
+	for _, order := range orders {
+		if executed := order.Executed(); executed > 0 {
+			get(order.Pair).Volume += order.Price * executed
+		}
+	}
+
+	trades, err := c.storage.Trades()
+	if err != nil {
+		return nil, err
+	}
+	for _, trade := range trades {
+		result := get(trade.Pair)
+		if trade.Profit >= 0 {
+			result.Win = append(result.Win, trade.Profit)
+		} else {
+			result.Lose = append(result.Lose, trade.Profit)
+		}
+	}
+	return summaries, nil
+}
+
 func (c *Controller) Order(pair string, id int64) (model.Order, error) {
 	return c.exchange.Order(pair, id)
 }
@@ -256,42 +369,54 @@ func (c *Controller) CreateOrderOCO(side model.SideType, pair string, size, pric
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
+	if err := c.accepting(); err != nil {
+		return nil, err
+	}
+
 	log.Info().Msgf("[ORDER] Creating OCO order for %s", pair)
-	orders, err := c.exchange.CreateOrderOCO(side, pair, size, price, stop, stopLimit)
+	orders, err := c.submitOCO(side, pair, size, price, stop, stopLimit)
 	if err != nil {
 		c.notifyError(err)
 		return nil, err
 	}
 
 	for i := range orders {
-		err := c.storage.CreateOrder(&orders[i])
-		if err != nil {
-			c.notifyError(err)
-			return nil, err
-		}
-		go c.monitor.Publish(orders[i])
+		c.updates.Push(orders[i])
 	}
 
 	return orders, nil
 }
 
+// submitOCO submits the limit maker and the stop legs of an OCO
+func (c *Controller) submitOCO(side model.SideType, pair string, size, price, stop,
+	stopLimit float64) ([]model.Order, error) {
+
+	stopOrder := pendingOrder(side, model.OrderTypeStopLossLimit, pair, size, stopLimit)
+	stopOrder.Stop = &stop
+	pending := []model.Order{pendingOrder(side, model.OrderTypeLimitMaker, pair, size, price), stopOrder}
+	return c.submit(pending, func(trader exchange.Trader) ([]model.Order, error) {
+		return trader.CreateOrderOCO(side, pair, size, price, stop, stopLimit)
+	})
+}
+
 func (c *Controller) CreateOrderLimit(side model.SideType, pair string, size, limit float64) (model.Order, error) {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	log.Info().Msgf("[ORDER] Creating LIMIT %s order for %s", side, pair)
-	order, err := c.exchange.CreateOrderLimit(side, pair, size, limit)
-	if err != nil {
-		c.notifyError(err)
+	if err := c.accepting(); err != nil {
 		return model.Order{}, err
 	}
 
-	err = c.storage.CreateOrder(&order)
+	log.Info().Msgf("[ORDER] Creating LIMIT %s order for %s", side, pair)
+	order, err := c.submitOrder(pendingOrder(side, model.OrderTypeLimit, pair, size, limit),
+		func(trader exchange.Trader) (model.Order, error) {
+			return trader.CreateOrderLimit(side, pair, size, limit)
+		})
 	if err != nil {
 		c.notifyError(err)
 		return model.Order{}, err
 	}
-	go c.monitor.Publish(order)
+	c.updates.Push(order)
 	log.Info().Msgf("[ORDER CREATED] %s", order)
 	return order, nil
 }
@@ -300,22 +425,23 @@ func (c *Controller) CreateOrderMarketQuote(side model.SideType, pair string, am
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	log.Info().Msgf("[ORDER] Creating MARKET %s order for %s", side, pair)
-	order, err := c.exchange.CreateOrderMarketQuote(side, pair, amount)
-	if err != nil {
-		c.notifyError(err)
+	if err := c.accepting(); err != nil {
 		return model.Order{}, err
 	}
 
-	err = c.storage.CreateOrder(&order)
+	log.Info().Msgf("[ORDER] Creating MARKET %s order for %s", side, pair)
+	order, err := c.submitOrder(pendingOrder(side, model.OrderTypeMarket, pair, 0, 0),
+		func(trader exchange.Trader) (model.Order, error) {
+			return trader.CreateOrderMarketQuote(side, pair, amount)
+		})
 	if err != nil {
 		c.notifyError(err)
 		return model.Order{}, err
 	}
 
 	// calculate profit
-	c.processTrade(&order)
-	go c.monitor.Publish(order)
+	c.processTrade(&order, model.Order{})
+	c.updates.Push(order)
 	log.Info().Msgf("[ORDER CREATED] %s", order)
 	return order, err
 }
@@ -324,63 +450,154 @@ func (c *Controller) CreateOrderMarket(side model.SideType, pair string, size fl
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
+	if err := c.accepting(); err != nil {
+		return model.Order{}, err
+	}
+
 	log.Info().Msgf("[ORDER] Creating MARKET %s order for %s", side, pair)
-	order, err := c.exchange.CreateOrderMarket(side, pair, size)
+	order, err := c.submitOrder(pendingOrder(side, model.OrderTypeMarket, pair, size, 0),
+		func(trader exchange.Trader) (model.Order, error) {
+			return trader.CreateOrderMarket(side, pair, size)
+		})
 	if err != nil {
 		c.notifyError(err)
 		return model.Order{}, err
 	}
 
-	err = c.storage.CreateOrder(&order)
+	// calculate profit
+	c.processTrade(&order, model.Order{})
+	c.updates.Push(order)
+	log.Info().Msgf("[ORDER CREATED] %s", order)
+	return order, err
+}
+
+// OpenShort opens a short position when the exchange is a margin trader
+func (c *Controller) OpenShort(pair string, size float64) (model.Order, error) {
+	return c.createOrderShort(model.SideTypeSell, pair, size, func(trader exchange.MarginTrader) (model.Order, error) {
+		return trader.OpenShort(pair, size)
+	})
+}
+
+// CloseShort closes a short position when the exchange is a margin trader
+func (c *Controller) CloseShort(pair string, size float64) (model.Order, error) {
+	return c.createOrderShort(model.SideTypeBuy, pair, size, func(trader exchange.MarginTrader) (model.Order, error) {
+		return trader.CloseShort(pair, size)
+	})
+}
+
+func (c *Controller) createOrderShort(side model.SideType, pair string, size float64,
+	create func(trader exchange.MarginTrader) (model.Order, error)) (model.Order, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.accepting(); err != nil {
+		return model.Order{}, err
+	}
+
+	if _, ok := c.exchange.(exchange.MarginTrader); !ok {
+		return model.Order{}, exchange.ErrMarginDisabled
+	}
+
+	log.Info().Msgf("[ORDER] Creating SHORT order for %s", pair)
+	pending := pendingOrder(side, model.OrderTypeMarket, pair, size, 0)
+	pending.PositionSide = model.PositionSideTypeShort
+	order, err := c.submitOrder(pending, func(trader exchange.Trader) (model.Order, error) {
+		margin, ok := trader.(exchange.MarginTrader)
+		if !ok {
+			return model.Order{}, exchange.ErrMarginDisabled
+		}
+		return create(margin)
+	})
 	if err != nil {
 		c.notifyError(err)
 		return model.Order{}, err
 	}
 
 	// calculate profit
-	c.processTrade(&order)
-	go c.monitor.Publish(order)
+	c.processTrade(&order, model.Order{})
+	c.updates.Push(order)
 	log.Info().Msgf("[ORDER CREATED] %s", order)
-	return order, err
+	return order, nil
+}
+
+// MarginLevel returns the margin level of the exchange when it is a margin trader
+func (c *Controller) MarginLevel() (float64, error) {
+	trader, ok := c.exchange.(exchange.MarginTrader)
+	if !ok {
+		return 0, exchange.ErrMarginDisabled
+	}
+	return trader.MarginLevel()
 }
 
 func (c *Controller) CreateOrderStop(pair string, size float64, limit float64) (model.Order, error) {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
+	if err := c.accepting(); err != nil {
+		return model.Order{}, err
+	}
+
 	log.Info().Msgf("[ORDER] Creating STOP order for %s", pair)
-	order, err := c.exchange.CreateOrderStop(pair, size, limit)
+	pending := pendingOrder(model.SideTypeSell, model.OrderTypeStopLoss, pair, size, limit)
+	pending.Stop = &limit
+	order, err := c.submitOrder(pending, func(trader exchange.Trader) (model.Order, error) {
+		return trader.CreateOrderStop(pair, size, limit)
+	})
 	if err != nil {
 		c.notifyError(err)
 		return model.Order{}, err
 	}
+	c.updates.Push(order)
+	log.Info().Msgf("[ORDER CREATED] %s", order)
+	return order, nil
+}
+
+func (c *Controller) CreateOrderTrailingStop(pair string, size float64, trailing model.Trailing) (model.Order, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.accepting(); err != nil {
+		return model.Order{}, err
+	}
 
-	err = c.storage.CreateOrder(&order)
+	log.Info().Msgf("[ORDER] Creating TRAILING STOP order for %s", pair)
+	pending := pendingOrder(model.SideTypeSell, model.OrderTypeTrailingStop, pair, size, 0)
+	pending.Trailing = &trailing
+	order, err := c.submitOrder(pending, func(trader exchange.Trader) (model.Order, error) {
+		return trader.CreateOrderTrailingStop(pair, size, trailing)
+	})
 	if err != nil {
 		c.notifyError(err)
 		return model.Order{}, err
 	}
-	go c.monitor.Publish(order)
+	c.updates.Push(order)
 	log.Info().Msgf("[ORDER CREATED] %s", order)
 	return order, nil
 }
 
+// Cancel cancels the order on the exchange, only the status of the stored order is changed
+// so the fills synced since the copy of the caller are kept
 func (c *Controller) Cancel(order model.Order) error {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	log.Info().Msgf("[ORDER] Cancelling order for %s", order.Pair)
-	err := c.exchange.Cancel(order)
+	stored, err := c.storedOrder(order.ID)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msgf("[ORDER] Cancelling order for %s", stored.Pair)
+	err = c.exchange.Cancel(*stored)
 	if err != nil {
 		return err
 	}
 
-	order.Status = model.OrderStatusTypePendingCancel
-	err = c.storage.UpdateOrder(&order)
+	stored.Status = model.OrderStatusTypePendingCancel
+	err = c.storage.UpdateOrder(stored)
 	if err != nil {
 		c.notifyError(err)
 		return err
 	}
-	log.Info().Msgf("[ORDER CANCELED] %s", order)
+	log.Info().Msgf("[ORDER CANCELED] %s", stored)
 	return nil
 }
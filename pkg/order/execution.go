@@ -0,0 +1,368 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+type AlgoType string
+type ExecutionStatus string
+
+const (
+	AlgoTWAP    AlgoType = "TWAP"
+	AlgoIceberg AlgoType = "ICEBERG"
+
+	ExecutionStatusRunning  ExecutionStatus = "RUNNING"
+	ExecutionStatusDone     ExecutionStatus = "DONE"
+	ExecutionStatusCanceled ExecutionStatus = "CANCELED"
+	ExecutionStatusFailed   ExecutionStatus = "FAILED"
+)
+
+var ErrExecutionNotFound = errors.New("execution not found")
+
+// ExecutionTrader places the child orders, eg: the order controller or the paper wallet
+type ExecutionTrader interface {
+	exchange.Trader
+	GetAssetsInfo(pair string) model.AssetInfo
+}
+
+// Execution is the progress of a parent order split in child orders
+type Execution struct {
+	ID       int64
+	Algo     AlgoType
+	Pair     string
+	Side     model.SideType
+	Status   ExecutionStatus
+	Quantity float64
+	Executed float64
+	// AvgPrice is the average price of the executed quantity
+	AvgPrice float64
+	Orders   []model.Order
+	Err      error
+}
+
+// Progress is the executed fraction of the parent quantity
+func (e Execution) Progress() float64 {
+	if e.Quantity == 0 {
+		return 0
+	}
+	return e.Executed / e.Quantity
+}
+
+func (e Execution) String() string {
+	return fmt.Sprintf("[%s] %s %s %s | ID: %d, %f / %f (%.2f %%) x $%f, Orders: %d",
+		e.Status, e.Algo, e.Side, e.Pair, e.ID, e.Executed, e.Quantity, e.Progress()*100, e.AvgPrice, len(e.Orders))
+}
+
+type algoExecution struct {
+	Execution
+	info model.AssetInfo
+
+	// TWAP: the slices are sent at the start of each interval, the first candle is the start
+	interval time.Duration
+	slices   int
+	sent     int
+	start    time.Time
+
+	// Iceberg: a single limit order of the visible quantity is open at a time
+	limit   float64
+	visible float64
+}
+
+// Executor splits parent orders in child orders. The executions advance with the complete
+// candles of their pair, so they run the same with live candles and in backtests, where
+// the executor must see each candle after the paper wallet.
+type Executor struct {
+	mtx         sync.Mutex
+	trader      ExecutionTrader
+	lastID      int64
+	executions  map[int64]*algoExecution
+	subscribers []func(Execution)
+}
+
+func NewExecutor(trader ExecutionTrader) *Executor {
+	return &Executor{
+		trader:     trader,
+		executions: make(map[int64]*algoExecution),
+	}
+}
+
+// Subscribe registers a callback for the changes of progress and status of the executions
+func (e *Executor) Subscribe(callback func(Execution)) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.subscribers = append(e.subscribers, callback)
+}
+
+// TWAP sends the quantity at market in slices of equal size over the duration
+func (e *Executor) TWAP(side model.SideType, pair string, quantity float64, duration time.Duration,
+	slices int) (Execution, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if slices <= 0 || duration <= 0 {
+		return Execution{}, fmt.Errorf("invalid twap schedule: %d slices in %s", slices, duration)
+	}
+
+	exec, err := e.newExecution(AlgoTWAP, side, pair, quantity)
+	if err != nil {
+		return Execution{}, err
+	}
+	exec.slices = slices
+	exec.interval = duration / time.Duration(slices)
+	return e.register(exec), nil
+}
+
+// Iceberg sends the quantity with limit orders showing up to the visible quantity,
+// each slice is placed when the previous one is filled
+func (e *Executor) Iceberg(side model.SideType, pair string, quantity, limit, visible float64) (Execution, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	exec, err := e.newExecution(AlgoIceberg, side, pair, quantity)
+	if err != nil {
+		return Execution{}, err
+	}
+	if visible < exec.info.MinQuantity || visible <= 0 || limit <= 0 {
+		return Execution{}, &exchange.OrderError{Err: exchange.ErrInvalidQuantity, Pair: pair, Quantity: visible}
+	}
+	exec.limit = limit
+	exec.visible = visible
+
+	e.advance(exec)
+	return e.register(exec), exec.Err
+}
+
+func (e *Executor) newExecution(algo AlgoType, side model.SideType, pair string, quantity float64) (*algoExecution, error) {
+	info := e.trader.GetAssetsInfo(pair)
+	if quantity <= 0 || RoundStep(quantity, info.StepSize) < info.MinQuantity {
+		return nil, &exchange.OrderError{Err: exchange.ErrInvalidQuantity, Pair: pair, Quantity: quantity}
+	}
+
+	e.lastID++
+	return &algoExecution{
+		Execution: Execution{
+			ID:       e.lastID,
+			Algo:     algo,
+			Pair:     pair,
+			Side:     side,
+			Status:   ExecutionStatusRunning,
+			Quantity: RoundStep(quantity, info.StepSize),
+		},
+		info: info,
+	}, nil
+}
+
+func (e *Executor) register(exec *algoExecution) Execution {
+	e.executions[exec.ID] = exec
+	log.Info().Msgf("[EXECUTION] %s", exec.Execution)
+	return exec.snapshot()
+}
+
+// Execution returns the progress of an execution
+func (e *Executor) Execution(id int64) (Execution, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	exec, ok := e.executions[id]
+	if !ok {
+		return Execution{}, ErrExecutionNotFound
+	}
+	return exec.snapshot(), nil
+}
+
+// Cancel stops an execution and cancels its open child orders
+func (e *Executor) Cancel(id int64) error {
+	e.mtx.Lock()
+	exec, ok := e.executions[id]
+	if !ok {
+		e.mtx.Unlock()
+		return ErrExecutionNotFound
+	}
+
+	var err error
+	if exec.Status == ExecutionStatusRunning {
+		for _, order := range exec.Orders {
+			if open(order) {
+				if cancelErr := e.trader.Cancel(order); cancelErr != nil {
+					err = cancelErr
+				}
+			}
+		}
+		exec.Status = ExecutionStatusCanceled
+	}
+	snapshot := exec.snapshot()
+	subscribers := e.subscribers
+	e.mtx.Unlock()
+
+	for _, subscriber := range subscribers {
+		subscriber(snapshot)
+	}
+	return err
+}
+
+// OnCandle follows the child orders and sends the next slices of the executions of the pair
+func (e *Executor) OnCandle(candle model.Candle) {
+	if !candle.Complete {
+		return
+	}
+
+	e.mtx.Lock()
+	var updated []Execution
+	for _, exec := range e.executions {
+		if exec.Pair != candle.Pair || exec.Status != ExecutionStatusRunning {
+			continue
+		}
+
+		executed, status := exec.Executed, exec.Status
+		e.refresh(exec)
+		if exec.Algo == AlgoTWAP && exec.start.IsZero() {
+			exec.start = candle.Time
+		}
+		if exec.Algo == AlgoTWAP && exec.sent < exec.slices {
+			exec.sent = int(math.Min(float64(exec.slices), float64(candle.Time.Sub(exec.start)/exec.interval+1)))
+		}
+		e.advance(exec)
+
+		if exec.Executed != executed || exec.Status != status {
+			updated = append(updated, exec.snapshot())
+		}
+	}
+	subscribers := e.subscribers
+	e.mtx.Unlock()
+
+	// subscribers are notified without the lock, so they are able to create new executions
+	for _, snapshot := range updated {
+		log.Info().Msgf("[EXECUTION] %s", snapshot)
+		for _, subscriber := range subscribers {
+			subscriber(snapshot)
+		}
+	}
+}
+
+// refresh updates the open child orders and the executed quantity and average price
+func (e *Executor) refresh(exec *algoExecution) {
+	var executed, volume float64
+	for i, order := range exec.Orders {
+		if open(order) {
+			current, err := e.trader.Order(order.Pair, order.ExchangeID)
+			if err != nil {
+				log.Error().Err(err).Msgf("execution get order %d failed.", order.ExchangeID)
+			} else {
+				// the exchange does not know the storage id of the controller
+				current.ID = order.ID
+				exec.Orders[i] = current
+			}
+		}
+		executed += exec.Orders[i].Executed()
+		volume += exec.Orders[i].Executed() * exec.Orders[i].Price
+	}
+
+	exec.Executed = executed
+	if executed > 0 {
+		exec.AvgPrice = volume / executed
+	}
+}
+
+// advance sends the child order due, if any, and completes the execution without open orders
+func (e *Executor) advance(exec *algoExecution) {
+	var (
+		committed float64
+		waiting   bool
+	)
+	for _, order := range exec.Orders {
+		if open(order) {
+			committed += order.Quantity
+			waiting = true
+		} else {
+			committed += order.Executed()
+		}
+	}
+	remaining := RoundStep(exec.Quantity-committed, exec.info.StepSize)
+
+	var quantity float64
+	switch exec.Algo {
+	case AlgoTWAP:
+		// the slices due are sent together, the last one sends the rest
+		due := exec.Quantity * float64(exec.sent) / float64(exec.slices)
+		quantity = e.childQuantity(exec, due-committed, remaining)
+		if exec.sent == exec.slices && !waiting {
+			quantity = remaining
+		}
+	case AlgoIceberg:
+		if !waiting {
+			quantity = e.childQuantity(exec, exec.visible, remaining)
+		}
+	}
+
+	if quantity > 0 && quantity >= exec.info.MinQuantity {
+		var (
+			order model.Order
+			err   error
+		)
+		if exec.Algo == AlgoIceberg {
+			order, err = e.trader.CreateOrderLimit(exec.Side, exec.Pair, quantity, exec.limit)
+		} else {
+			order, err = e.trader.CreateOrderMarket(exec.Side, exec.Pair, quantity)
+		}
+		if err != nil {
+			log.Error().Err(err).Msgf("execution %d child order failed.", exec.ID)
+			exec.Status = ExecutionStatusFailed
+			exec.Err = err
+			return
+		}
+
+		exec.Orders = append(exec.Orders, order)
+		waiting = open(order)
+		remaining = RoundStep(remaining-quantity, exec.info.StepSize)
+		e.refresh(exec)
+	}
+
+	// the rest under the minimum quantity can not be sent
+	scheduled := exec.Algo != AlgoTWAP || exec.sent == exec.slices
+	if scheduled && !waiting && (remaining <= 0 || remaining < exec.info.MinQuantity) {
+		exec.Status = ExecutionStatusDone
+	}
+}
+
+// childQuantity rounds the wanted quantity to the filters of the pair, a child order
+// leaving less than the minimum quantity sends the remaining quantity
+func (e *Executor) childQuantity(exec *algoExecution, want, remaining float64) float64 {
+	quantity := RoundStep(want, exec.info.StepSize)
+	if quantity <= 0 {
+		return 0
+	}
+	quantity = math.Max(quantity, exec.info.MinQuantity)
+	if remaining-quantity < exec.info.MinQuantity {
+		quantity = remaining
+	}
+	return quantity
+}
+
+func (exec *algoExecution) snapshot() Execution {
+	snapshot := exec.Execution
+	snapshot.Orders = append([]model.Order(nil), exec.Orders...)
+	return snapshot
+}
+
+func open(order model.Order) bool {
+	return order.Status == model.OrderStatusTypeNew || order.Status == model.OrderStatusTypePartiallyFilled ||
+		order.Status == model.OrderStatusTypePendingCancel
+}
+
+// RoundStep rounds the quantity down to the step size of the pair, the epsilon keeps exact
+// multiples of the step, a zero step keeps the quantity
+func RoundStep(quantity, step float64) float64 {
+	if step <= 0 {
+		return quantity
+	}
+	return math.Floor(quantity/step+1e-9) * step
+}
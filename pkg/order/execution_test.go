@@ -0,0 +1,147 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+type filterTrader struct {
+	ExecutionTrader
+	info model.AssetInfo
+}
+
+func (f filterTrader) GetAssetsInfo(_ string) model.AssetInfo {
+	return f.info
+}
+
+func TestExecutor(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hour int, price float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hour) * time.Hour),
+			Open: price, High: price, Low: price, Close: price, Volume: 10, Complete: true}
+	}
+	setup := func(step, minQuantity float64) (*exchange.PaperWallet, *Executor) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		wallet.OnCandle(candle(0, 100))
+		controller := NewController(ctx, wallet, db, NewMonitor(wallet))
+		return wallet, NewExecutor(filterTrader{
+			ExecutionTrader: controller,
+			info:            model.AssetInfo{StepSize: step, MinQuantity: minQuantity},
+		})
+	}
+	feed := func(wallet *exchange.PaperWallet, executor *Executor, candle model.Candle) {
+		wallet.OnCandle(candle)
+		executor.OnCandle(candle)
+	}
+
+	t.Run("invalid quantity", func(t *testing.T) {
+		_, executor := setup(0.01, 0.05)
+		_, err := executor.TWAP(model.SideTypeBuy, "BTCUSDT", 0.049, time.Hour, 2)
+		require.ErrorIs(t, err, exchange.ErrInvalidQuantity)
+		_, err = executor.Iceberg(model.SideTypeBuy, "BTCUSDT", 1, 100, 0.01)
+		require.ErrorIs(t, err, exchange.ErrInvalidQuantity)
+	})
+
+	t.Run("twap", func(t *testing.T) {
+		wallet, executor := setup(0.01, 0.05)
+		var updates []Execution
+		executor.Subscribe(func(execution Execution) {
+			updates = append(updates, execution)
+		})
+
+		execution, err := executor.TWAP(model.SideTypeBuy, "BTCUSDT", 1, 3*time.Hour, 3)
+		require.NoError(t, err)
+		require.Equal(t, ExecutionStatusRunning, execution.Status)
+
+		feed(wallet, executor, candle(1, 100))
+		feed(wallet, executor, candle(2, 110))
+		execution, err = executor.Execution(execution.ID)
+		require.NoError(t, err)
+		require.Equal(t, ExecutionStatusRunning, execution.Status)
+		require.InDelta(t, 0.66, execution.Executed, 1e-9)
+		require.InDelta(t, 0.66, execution.Progress(), 1e-9)
+
+		// the last slice sends the rest of the rounding
+		feed(wallet, executor, candle(3, 120))
+		execution, err = executor.Execution(execution.ID)
+		require.NoError(t, err)
+		require.Equal(t, ExecutionStatusDone, execution.Status)
+		require.Len(t, execution.Orders, 3)
+		require.InDelta(t, 0.33, execution.Orders[0].Quantity, 1e-9)
+		require.InDelta(t, 0.33, execution.Orders[1].Quantity, 1e-9)
+		require.InDelta(t, 0.34, execution.Orders[2].Quantity, 1e-9)
+		require.InDelta(t, 1, execution.Executed, 1e-9)
+		require.InDelta(t, 110.1, execution.AvgPrice, 1e-9)
+		require.Len(t, updates, 3)
+
+		feed(wallet, executor, candle(4, 120))
+		execution, err = executor.Execution(execution.ID)
+		require.NoError(t, err)
+		require.Len(t, execution.Orders, 3)
+	})
+
+	t.Run("twap sends the slices due", func(t *testing.T) {
+		wallet, executor := setup(0.01, 0.05)
+		execution, err := executor.TWAP(model.SideTypeBuy, "BTCUSDT", 1, 4*time.Hour, 4)
+		require.NoError(t, err)
+
+		feed(wallet, executor, candle(1, 100))
+		feed(wallet, executor, candle(3, 100))
+		execution, err = executor.Execution(execution.ID)
+		require.NoError(t, err)
+		require.Len(t, execution.Orders, 2)
+		require.InDelta(t, 0.75, execution.Executed, 1e-9)
+	})
+
+	t.Run("iceberg", func(t *testing.T) {
+		wallet, executor := setup(0.1, 0.3)
+		execution, err := executor.Iceberg(model.SideTypeBuy, "BTCUSDT", 1, 100, 0.45)
+		require.NoError(t, err)
+		require.Len(t, execution.Orders, 1)
+		require.InDelta(t, 0.4, execution.Orders[0].Quantity, 1e-9)
+
+		feed(wallet, executor, candle(1, 100))
+		execution, err = executor.Execution(execution.ID)
+		require.NoError(t, err)
+		require.InDelta(t, 0.4, execution.Executed, 1e-9)
+
+		// the next slice takes the rest, it would leave less than the minimum quantity
+		require.Len(t, execution.Orders, 2)
+		require.InDelta(t, 0.6, execution.Orders[1].Quantity, 1e-9)
+
+		feed(wallet, executor, candle(2, 105))
+		feed(wallet, executor, candle(3, 99))
+		execution, err = executor.Execution(execution.ID)
+		require.NoError(t, err)
+		require.Equal(t, ExecutionStatusDone, execution.Status)
+		require.InDelta(t, 1, execution.Progress(), 1e-9)
+		require.InDelta(t, 100, execution.AvgPrice, 1e-9)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		wallet, executor := setup(0.1, 0.3)
+		execution, err := executor.Iceberg(model.SideTypeBuy, "BTCUSDT", 1, 90, 0.5)
+		require.NoError(t, err)
+		require.NoError(t, executor.Cancel(execution.ID))
+
+		feed(wallet, executor, candle(1, 85))
+		execution, err = executor.Execution(execution.ID)
+		require.NoError(t, err)
+		require.Equal(t, ExecutionStatusCanceled, execution.Status)
+		require.Len(t, execution.Orders, 1)
+		order, err := wallet.Order("BTCUSDT", execution.Orders[0].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+
+		require.ErrorIs(t, executor.Cancel(42), ErrExecutionNotFound)
+	})
+}
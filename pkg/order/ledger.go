@@ -0,0 +1,165 @@
+package order
+
+import (
+	"math"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// positionDust is the remaining quantity considered as a closed position
+const positionDust = 1e-9
+
+// fillPrice is the price of a filled order, stop orders are filled at the stop price
+func fillPrice(order *model.Order) float64 {
+	if (order.Type == model.OrderTypeStopLoss || order.Type == model.OrderTypeStopLossLimit) && order.Stop != nil {
+		return *order.Stop
+	}
+	return order.Price
+}
+
+// feeValue converts the fee of an order to the quote asset, fees paid with
+// a third asset are not converted
+func feeValue(order *model.Order, price float64) float64 {
+	if order.Fee == 0 {
+		return 0
+	}
+
+	asset, quote, err := exchange.SplitAssetQuote(order.Pair)
+	if err != nil {
+		log.Error().Err(err).Msg("ledger fee failed.")
+		return 0
+	}
+
+	switch order.FeeAsset {
+	case quote, "":
+		return order.Fee
+	case asset:
+		return order.Fee * price
+	default:
+		log.Warn().Msgf("ledger ignored fee of %d paid in %s", order.ID, order.FeeAsset)
+		return 0
+	}
+}
+
+// execution returns the part of an order executed since its previous state, with the
+// quantity, average price and fee of the new fills
+func execution(previous, order model.Order) (model.Order, bool) {
+	executed := order.Executed() - previous.Executed()
+	if executed <= positionDust {
+		return model.Order{}, false
+	}
+
+	fill := order
+	fill.Quantity = executed
+	if previous.Executed() > 0 {
+		fill.Price = (order.Price*order.Executed() - previous.Price*previous.Executed()) / executed
+	}
+	if previous.FeeAsset == order.FeeAsset {
+		fill.Fee = order.Fee - previous.Fee
+	}
+	return fill, true
+}
+
+// updateLedger applies a filled order to the open position of the pair and side.
+// An entry increases the position, an exit reduces it and returns the realized trade.
+// Buys enter long positions and sells enter the short ones.
+func updateLedger(db storage.Storage, order *model.Order) (*model.Trade, error) {
+	positions, err := db.Positions(
+		storage.WithPositionPair(order.Pair),
+		storage.WithPositionStatus(model.PositionStatusTypeOpen),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	short := order.PositionSide == model.PositionSideTypeShort
+	price := fillPrice(order)
+	fee := feeValue(order, price)
+
+	var position *model.Position
+	for _, open := range positions {
+		if open.IsShort() == short {
+			position = open
+		}
+	}
+
+	if (order.Side == model.SideTypeBuy) != short {
+		if position == nil {
+			position = &model.Position{
+				Pair:     order.Pair,
+				Status:   model.PositionStatusTypeOpen,
+				OpenedAt: order.UpdatedAt,
+			}
+			if short {
+				position.Side = model.PositionSideTypeShort
+			}
+		}
+
+		// a long entry receives its quantity net of the fee paid in the asset, the fee is
+		// accounted in the entry fee
+		quantity := order.Quantity
+		if !short && order.Fee > 0 && order.FeeAsset != "" {
+			if asset, _, err := exchange.SplitAssetQuote(order.Pair); err == nil && order.FeeAsset == asset {
+				quantity -= order.Fee
+			}
+		}
+
+		position.AvgPrice = (position.AvgPrice*position.Quantity + price*quantity) /
+			(position.Quantity + quantity)
+		position.Quantity += quantity
+		position.EntryFee += fee
+		position.Fees += fee
+		position.UpdatedAt = order.UpdatedAt
+
+		if position.ID == 0 {
+			return nil, db.CreatePosition(position)
+		}
+		return nil, db.UpdatePosition(position)
+	}
+
+	// exits without position are not tracked, eg: assets bought outside the bot
+	if position == nil {
+		return nil, nil
+	}
+
+	quantity := math.Min(order.Quantity, position.Quantity)
+	entryFee := position.EntryFee * quantity / position.Quantity
+	cost := quantity * position.AvgPrice
+	trade := &model.Trade{
+		PositionID: position.ID,
+		OrderID:    order.ID,
+		Pair:       order.Pair,
+		Quantity:   quantity,
+		EntryPrice: position.AvgPrice,
+		ExitPrice:  price,
+		Fee:        entryFee + fee,
+		Profit:     quantity*price - cost,
+		OpenedAt:   position.OpenedAt,
+		ClosedAt:   order.UpdatedAt,
+	}
+	if short {
+		trade.Profit = -trade.Profit
+	}
+	if cost > 0 {
+		trade.ProfitPercent = trade.Profit / cost
+	}
+
+	position.Quantity -= quantity
+	position.EntryFee -= entryFee
+	position.Fees += fee
+	position.RealizedPnL += trade.NetProfit()
+	position.UpdatedAt = order.UpdatedAt
+	if position.Quantity < positionDust {
+		position.Quantity = 0
+		position.Status = model.PositionStatusTypeClosed
+		position.ClosedAt = &order.UpdatedAt
+	}
+
+	if err := db.UpdatePosition(position); err != nil {
+		return nil, err
+	}
+	return trade, db.CreateTrade(trade)
+}
@@ -0,0 +1,334 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateLedger(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	fill := func(side model.SideType, quantity, price, fee float64, hours int) *model.Trade {
+		order := &model.Order{
+			Pair:      "BTCUSDT",
+			Side:      side,
+			Type:      model.OrderTypeMarket,
+			Status:    model.OrderStatusTypeFilled,
+			Price:     price,
+			Quantity:  quantity,
+			Fee:       fee,
+			FeeAsset:  "USDT",
+			UpdatedAt: start.Add(time.Duration(hours) * time.Hour),
+		}
+		require.NoError(t, db.CreateOrder(order))
+		trade, err := updateLedger(db, order)
+		require.NoError(t, err)
+		return trade
+	}
+
+	require.Nil(t, fill(model.SideTypeSell, 1, 100, 0, 0))
+	require.Nil(t, fill(model.SideTypeBuy, 1, 100, 1, 0))
+	require.Nil(t, fill(model.SideTypeBuy, 1, 200, 1, 1))
+
+	positions, err := db.Positions(storage.WithPositionStatus(model.PositionStatusTypeOpen))
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	require.Equal(t, 2.0, positions[0].Quantity)
+	require.Equal(t, 150.0, positions[0].AvgPrice)
+
+	trade := fill(model.SideTypeSell, 1, 180, 1, 3)
+	require.NotNil(t, trade)
+	require.Equal(t, 30.0, trade.Profit)
+	require.Equal(t, 0.2, trade.ProfitPercent)
+	require.Equal(t, 2.0, trade.Fee)
+	require.Equal(t, 3*time.Hour, trade.HoldingTime())
+
+	trade = fill(model.SideTypeSell, 2, 120, 1, 4)
+	require.Equal(t, 1.0, trade.Quantity)
+	require.Equal(t, -30.0, trade.Profit)
+
+	positions, err = db.Positions()
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	require.Equal(t, model.PositionStatusTypeClosed, positions[0].Status)
+	require.Equal(t, -4.0, positions[0].RealizedPnL)
+	require.Equal(t, 4.0, positions[0].Fees)
+
+	trades, err := db.Trades(storage.WithTradePair("BTCUSDT"))
+	require.NoError(t, err)
+	require.Len(t, trades, 2)
+}
+
+func TestUpdateLedger_BaseFee(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	buy := &model.Order{Pair: "BTCUSDT", Side: model.SideTypeBuy, Type: model.OrderTypeMarket,
+		Status: model.OrderStatusTypeFilled, Price: 100, Quantity: 1, Fee: 0.001, FeeAsset: "BTC"}
+	require.NoError(t, db.CreateOrder(buy))
+	_, err = updateLedger(db, buy)
+	require.NoError(t, err)
+
+	// the fee paid in the asset is not held
+	positions, err := db.Positions(storage.WithPositionStatus(model.PositionStatusTypeOpen))
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	require.InDelta(t, 0.999, positions[0].Quantity, 1e-9)
+	require.InDelta(t, 100, positions[0].AvgPrice, 1e-9)
+	require.InDelta(t, 0.1, positions[0].EntryFee, 1e-9)
+
+	sell := &model.Order{Pair: "BTCUSDT", Side: model.SideTypeSell, Type: model.OrderTypeMarket,
+		Status: model.OrderStatusTypeFilled, Price: 110, Quantity: 0.999}
+	require.NoError(t, db.CreateOrder(sell))
+	trade, err := updateLedger(db, sell)
+	require.NoError(t, err)
+	require.InDelta(t, 9.99, trade.Profit, 1e-9)
+
+	positions, err = db.Positions(storage.WithPositionStatus(model.PositionStatusTypeOpen))
+	require.NoError(t, err)
+	require.Empty(t, positions)
+}
+
+func TestExecution(t *testing.T) {
+	order := model.Order{
+		Pair:     "BTCUSDT",
+		Type:     model.OrderTypeMarket,
+		Status:   model.OrderStatusTypeNew,
+		Price:    100,
+		Quantity: 3,
+	}
+
+	_, ok := execution(order, order)
+	require.False(t, ok)
+
+	first := order
+	first.Status = model.OrderStatusTypePartiallyFilled
+	first.ExecutedQuantity = 1
+	first.Fee = 0.1
+	first.FeeAsset = "USDT"
+	fill, ok := execution(order, first)
+	require.True(t, ok)
+	require.Equal(t, 1.0, fill.Quantity)
+	require.Equal(t, 100.0, fill.Price)
+	require.Equal(t, 0.1, fill.Fee)
+
+	second := first
+	second.Status = model.OrderStatusTypeFilled
+	second.ExecutedQuantity = 3
+	second.Price = 120
+	second.Fee = 0.4
+	fill, ok = execution(first, second)
+	require.True(t, ok)
+	require.Equal(t, 2.0, fill.Quantity)
+	require.InDelta(t, 130, fill.Price, 1e-9)
+	require.InDelta(t, 0.3, fill.Fee, 1e-9)
+
+	// orders filled without executed quantity are executed in full
+	legacy := order
+	legacy.Status = model.OrderStatusTypeFilled
+	fill, ok = execution(order, legacy)
+	require.True(t, ok)
+	require.Equal(t, 3.0, fill.Quantity)
+}
+
+func TestController_PartialFills(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hour int, price float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hour) * time.Hour),
+			Open: price, High: price, Low: price, Close: price, Volume: 10, Complete: true}
+	}
+
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+		exchange.WithPaperLiquidity(0.2))
+	wallet.OnCandle(candle(0, 100))
+	controller := NewController(ctx, wallet, db, NewMonitor(wallet))
+
+	order, err := controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 3, 100)
+	require.NoError(t, err)
+
+	position := func() *model.Position {
+		positions, err := controller.Positions(storage.WithPositionStatus(model.PositionStatusTypeOpen))
+		require.NoError(t, err)
+		require.Len(t, positions, 1)
+		return positions[0]
+	}
+
+	wallet.OnCandle(candle(1, 100))
+	controller.updateOrders()
+	orders, err := db.Orders(storage.WithStatus(model.OrderStatusTypePartiallyFilled))
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	require.Equal(t, order.ExchangeID, orders[0].ExchangeID)
+	require.Equal(t, 2.0, orders[0].ExecutedQuantity)
+	require.Equal(t, 2.0, position().Quantity)
+
+	wallet.OnCandle(candle(2, 100))
+	controller.updateOrders()
+	require.Equal(t, 3.0, position().Quantity)
+
+	// a market sell over the liquidity left in the candle is filled over two candles
+	sell, err := controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 3)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypePartiallyFilled, sell.Status)
+	require.Equal(t, 1.0, sell.ExecutedQuantity)
+	require.Equal(t, 2.0, position().Quantity)
+
+	wallet.OnCandle(candle(3, 130))
+	controller.updateOrders()
+	sell, err = wallet.Order("BTCUSDT", sell.ExchangeID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, sell.Status)
+	require.InDelta(t, 120, sell.Price, 1e-9)
+
+	trades, err := controller.Trades()
+	require.NoError(t, err)
+	require.Len(t, trades, 2)
+	require.InDelta(t, 0, trades[0].Profit, 1e-9)
+	require.InDelta(t, 60, trades[1].Profit, 1e-9)
+
+	summaries, err := controller.Summaries()
+	require.NoError(t, err)
+	require.InDelta(t, 300+360, summaries["BTCUSDT"].Volume, 1e-9)
+}
+
+func TestController_CancelStale(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hour int, price float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hour) * time.Hour),
+			Open: price, High: price, Low: price, Close: price, Volume: 10, Complete: true}
+	}
+
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+		exchange.WithPaperLiquidity(0.2))
+	wallet.OnCandle(candle(0, 100))
+	controller := NewController(ctx, wallet, db, NewMonitor(wallet))
+
+	// the copy of the order is stale after the partial fill
+	order, err := controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 3, 100)
+	require.NoError(t, err)
+	wallet.OnCandle(candle(1, 100))
+	controller.updateOrders()
+
+	require.NoError(t, controller.Cancel(order))
+	stored, err := controller.storedOrder(order.ID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypePendingCancel, stored.Status)
+	require.Equal(t, 2.0, stored.ExecutedQuantity)
+
+	controller.updateOrders()
+	positions, err := controller.Positions(storage.WithPositionStatus(model.PositionStatusTypeOpen))
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	require.Equal(t, 2.0, positions[0].Quantity)
+
+	summaries, err := controller.Summaries()
+	require.NoError(t, err)
+	require.InDelta(t, 200, summaries["BTCUSDT"].Volume, 1e-9)
+}
+
+func TestController_TrailingStop(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hour int, open, high, low, close float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hour) * time.Hour),
+			Open: open, High: high, Low: low, Close: close, Complete: true}
+	}
+
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 100))
+	wallet.OnCandle(candle(0, 100, 100, 100, 100))
+	controller := NewController(ctx, wallet, db, NewMonitor(wallet))
+
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+	order, err := controller.CreateOrderTrailingStop("BTCUSDT", 1, model.TrailingRate(0.1))
+	require.NoError(t, err)
+
+	stored := func() *model.Order {
+		orders, err := db.Orders(storage.OrderFilterFunc(func(o model.Order) bool {
+			return o.ExchangeID == order.ExchangeID
+		}))
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		return orders[0]
+	}
+	require.InDelta(t, 90, *stored().Stop, 1e-9)
+
+	// the stop followed the high
+	wallet.OnCandle(candle(1, 100, 120, 110, 115))
+	controller.updateOrders()
+	require.Equal(t, model.OrderStatusTypeNew, stored().Status)
+	require.InDelta(t, 108, *stored().Stop, 1e-9)
+	require.Equal(t, model.TrailingRate(0.1), *stored().Trailing)
+
+	wallet.OnCandle(candle(2, 115, 115, 100, 105))
+	controller.updateOrders()
+	require.Equal(t, model.OrderStatusTypeFilled, stored().Status)
+
+	trades, err := controller.Trades()
+	require.NoError(t, err)
+	require.Len(t, trades, 1)
+	require.InDelta(t, 8, trades[0].Profit, 1e-9)
+}
+
+func TestUpdateLedger_Short(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	fill := func(side model.SideType, positionSide model.PositionSideType, quantity, price float64,
+		hours int) *model.Trade {
+		order := &model.Order{
+			Pair:         "BTCUSDT",
+			Side:         side,
+			Type:         model.OrderTypeMarket,
+			Status:       model.OrderStatusTypeFilled,
+			Price:        price,
+			Quantity:     quantity,
+			PositionSide: positionSide,
+			UpdatedAt:    start.Add(time.Duration(hours) * time.Hour),
+		}
+		require.NoError(t, db.CreateOrder(order))
+		trade, err := updateLedger(db, order)
+		require.NoError(t, err)
+		return trade
+	}
+
+	// long and short positions of the same pair are kept apart
+	require.Nil(t, fill(model.SideTypeBuy, "", 1, 100, 0))
+	require.Nil(t, fill(model.SideTypeSell, model.PositionSideTypeShort, 2, 100, 1))
+
+	positions, err := db.Positions(storage.WithPositionStatus(model.PositionStatusTypeOpen))
+	require.NoError(t, err)
+	require.Len(t, positions, 2)
+	require.True(t, positions[1].IsShort())
+	require.Equal(t, 2.0, positions[1].Quantity)
+
+	trade := fill(model.SideTypeBuy, model.PositionSideTypeShort, 2, 80, 2)
+	require.NotNil(t, trade)
+	require.Equal(t, 40.0, trade.Profit)
+	require.Equal(t, 0.2, trade.ProfitPercent)
+
+	positions, err = db.Positions(storage.WithPositionStatus(model.PositionStatusTypeOpen))
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	require.False(t, positions[0].IsShort())
+}
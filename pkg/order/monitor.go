@@ -1,6 +1,9 @@
 package order
 
 import (
+	"context"
+	"sync"
+
 	"github.com/lynbklk/tradebot/pkg/exchange"
 	"github.com/lynbklk/tradebot/pkg/model"
 )
@@ -60,3 +63,52 @@ func (m *MonitorV1) Publish(order model.Order) {
 		m.Feeds[order.Pair].Data <- order
 	}
 }
+
+// orderQueue publishes the orders to a monitor from a single goroutine, in the order they
+// are pushed. Pushing never blocks, so the watchers may create orders while an order of
+// the controller is published.
+type orderQueue struct {
+	mtx     sync.Mutex
+	cond    *sync.Cond
+	orders  []model.Order
+	monitor Monitor
+}
+
+func newOrderQueue(ctx context.Context, monitor Monitor) *orderQueue {
+	q := &orderQueue{monitor: monitor}
+	q.cond = sync.NewCond(&q.mtx)
+	go func() {
+		<-ctx.Done()
+		q.mtx.Lock()
+		q.cond.Broadcast()
+		q.mtx.Unlock()
+	}()
+	go q.run(ctx)
+	return q
+}
+
+func (q *orderQueue) Push(order model.Order) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.orders = append(q.orders, order)
+	q.cond.Signal()
+}
+
+func (q *orderQueue) run(ctx context.Context) {
+	for {
+		q.mtx.Lock()
+		for len(q.orders) == 0 && ctx.Err() == nil {
+			q.cond.Wait()
+		}
+		if ctx.Err() != nil {
+			q.mtx.Unlock()
+			return
+		}
+		order := q.orders[0]
+		q.orders = q.orders[1:]
+		q.mtx.Unlock()
+
+		q.monitor.Publish(order)
+	}
+}
@@ -0,0 +1,34 @@
+package order
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+type chanMonitor struct {
+	Monitor
+	orders chan model.Order
+}
+
+func (m chanMonitor) Publish(order model.Order) {
+	m.orders <- order
+}
+
+func TestOrderQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	monitor := chanMonitor{orders: make(chan model.Order)}
+	queue := newOrderQueue(ctx, monitor)
+
+	// pushed while the monitor is not receiving
+	for id := int64(1); id <= 100; id++ {
+		queue.Push(model.Order{ID: id})
+	}
+	for id := int64(1); id <= 100; id++ {
+		require.Equal(t, id, (<-monitor.orders).ID)
+	}
+}
@@ -0,0 +1,6 @@
+package order
+
+type Notifier interface {
+	Notify(string)
+	OnError(err error)
+}
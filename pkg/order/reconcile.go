@@ -0,0 +1,218 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/storage"
+	"github.com/olekukonko/tablewriter"
+	"github.com/rs/zerolog/log"
+)
+
+// reconcileLimit is the count of recent orders listed by pair
+const reconcileLimit = 500
+
+var ErrOrdersNotListed = errors.New("exchange does not list orders")
+
+// OrderLister is an exchange listing the recent orders of a pair, eg: Binance
+type OrderLister interface {
+	Orders(pair string, limit int) ([]model.Order, error)
+}
+
+// BalanceDiff is an asset position of the exchange different from the ledger
+type BalanceDiff struct {
+	Pair     string
+	Exchange float64
+	Ledger   float64
+}
+
+// Reconciliation is the report of the differences found between the exchange and the storage
+type Reconciliation struct {
+	Imported []model.Order
+	Updated  []model.Order
+	Balances []BalanceDiff
+}
+
+// Consistent tells if the balances of the exchange match the ledger
+func (r Reconciliation) Consistent() bool {
+	return len(r.Balances) == 0
+}
+
+func (r Reconciliation) String() string {
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"Pair", "Exchange", "Ledger", "Diff"})
+	for _, diff := range r.Balances {
+		table.Append([]string{
+			diff.Pair,
+			fmt.Sprintf("%.8f", diff.Exchange),
+			fmt.Sprintf("%.8f", diff.Ledger),
+			fmt.Sprintf("%.8f", diff.Exchange-diff.Ledger),
+		})
+	}
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT,
+		tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	table.Render()
+
+	return fmt.Sprintf("[RECONCILIATION] Imported: %d, Updated: %d, Balance differences: %d\n%s",
+		len(r.Imported), len(r.Updated), len(r.Balances), tableString.String())
+}
+
+// Reconcile updates the storage with the orders of the exchange, to be called before the
+// controller starts. The unknown orders created since the given time are imported, the
+// stale orders are updated and applied to the ledger, the orders stored before a request of
+// unknown status are found by their client order id, then the asset positions of the
+// exchange are compared with the open positions of the ledger.
+func (c *Controller) Reconcile(since time.Time, pairs ...string) (*Reconciliation, error) {
+	lister, ok := c.exchange.(OrderLister)
+	if !ok {
+		return nil, ErrOrdersNotListed
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	type update struct {
+		order    model.Order
+		previous model.Order
+	}
+	var (
+		report  = &Reconciliation{}
+		updates []update
+	)
+	for _, pair := range pairs {
+		excOrders, err := lister.Orders(pair, reconcileLimit)
+		if err != nil {
+			return nil, err
+		}
+		stored, err := c.storage.Orders(storage.WithPair(pair))
+		if err != nil {
+			return nil, err
+		}
+
+		byExchangeID := make(map[int64]*model.Order)
+		byClientID := make(map[string]*model.Order)
+		for _, order := range stored {
+			// orders never confirmed by the exchange
+			if order.ExchangeID == 0 && order.ClientOrderID != "" {
+				byClientID[order.ClientOrderID] = order
+				continue
+			}
+			byExchangeID[order.ExchangeID] = order
+		}
+
+		listed := make(map[int64]bool)
+		resolved := make(map[int64]bool)
+		for _, excOrder := range excOrders {
+			listed[excOrder.ExchangeID] = true
+			order, ok := byExchangeID[excOrder.ExchangeID]
+			if !ok && excOrder.ClientOrderID != "" {
+				if order, ok = byClientID[excOrder.ClientOrderID]; ok {
+					resolved[order.ID] = true
+				}
+			}
+			if !ok {
+				if excOrder.CreatedAt.Before(since) {
+					continue
+				}
+				err := c.storage.CreateOrder(&excOrder)
+				if err != nil {
+					return nil, err
+				}
+				log.Info().Msgf("[ORDER IMPORTED] %s", excOrder)
+				report.Imported = append(report.Imported, excOrder)
+				updates = append(updates, update{order: excOrder})
+				continue
+			}
+
+			if excOrder, changed := c.syncOrder(order, excOrder); changed {
+				report.Updated = append(report.Updated, excOrder)
+				updates = append(updates, update{order: excOrder, previous: *order})
+			}
+		}
+
+		// pending orders older than the listed ones
+		for _, order := range stored {
+			var excOrder model.Order
+			switch {
+			case order.Status == model.OrderStatusTypePendingNew && !resolved[order.ID]:
+				excOrder, err = c.resolve(*order)
+				if errors.Is(err, exchange.ErrOrderNotFound) {
+					continue
+				}
+			case open(*order) && !listed[order.ExchangeID]:
+				excOrder, err = c.exchange.Order(order.Pair, order.ExchangeID)
+			default:
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if excOrder, changed := c.syncOrder(order, excOrder); changed {
+				report.Updated = append(report.Updated, excOrder)
+				updates = append(updates, update{order: excOrder, previous: *order})
+			}
+		}
+	}
+
+	// the ledger is built in the order of the fills
+	sort.SliceStable(updates, func(i, j int) bool {
+		return updates[i].order.UpdatedAt.Before(updates[j].order.UpdatedAt)
+	})
+	for _, update := range updates {
+		c.processTrade(&update.order, update.previous)
+		c.updates.Push(update.order)
+	}
+	c.updateBrackets()
+
+	var err error
+	report.Balances, err = c.balanceDiffs(pairs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(report.Imported) > 0 || len(report.Updated) > 0 || !report.Consistent() {
+		c.notify(report.String())
+	}
+	return report, nil
+}
+
+// balanceDiffs compares the asset position of each pair with the open positions of the ledger,
+// differences under the step size of the pair are ignored
+func (c *Controller) balanceDiffs(pairs []string) ([]BalanceDiff, error) {
+	var diffs []BalanceDiff
+	for _, pair := range pairs {
+		asset, _, err := c.exchange.Position(pair)
+		if err != nil {
+			return nil, err
+		}
+
+		positions, err := c.storage.Positions(
+			storage.WithPositionPair(pair),
+			storage.WithPositionStatus(model.PositionStatusTypeOpen),
+		)
+		if err != nil {
+			return nil, err
+		}
+		var ledger float64
+		for _, position := range positions {
+			if position.IsShort() {
+				ledger -= position.Quantity
+			} else {
+				ledger += position.Quantity
+			}
+		}
+
+		tolerance := math.Max(c.exchange.GetAssetsInfo(pair).StepSize, positionDust)
+		if math.Abs(asset-ledger) > tolerance {
+			diffs = append(diffs, BalanceDiff{Pair: pair, Exchange: asset, Ledger: ledger})
+		}
+	}
+	return diffs, nil
+}
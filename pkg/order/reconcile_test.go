@@ -0,0 +1,105 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+type listingWallet struct {
+	*exchange.PaperWallet
+}
+
+func (l listingWallet) Orders(pair string, _ int) ([]model.Order, error) {
+	var orders []model.Order
+	for _, order := range l.PaperWallet.Orders() {
+		if order.Pair == pair {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func TestController_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hour int, price float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hour) * time.Hour),
+			Open: price, High: price, Low: price, Close: price, Volume: 100, Complete: true}
+	}
+
+	t.Run("not listed", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		controller := NewController(ctx, wallet, db, NewMonitor(wallet))
+		_, err = controller.Reconcile(start, "BTCUSDT")
+		require.ErrorIs(t, err, ErrOrdersNotListed)
+	})
+
+	t.Run("orders changed while down", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := listingWallet{exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))}
+		wallet.OnCandle(candle(0, 100))
+		controller := NewController(ctx, wallet, db, NewMonitor(wallet))
+
+		// an order before the reconciliation window is not imported
+		_, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 0.5)
+		require.NoError(t, err)
+		_, err = wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.5)
+		require.NoError(t, err)
+
+		wallet.OnCandle(candle(1, 100))
+		limit, err := controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 95)
+		require.NoError(t, err)
+
+		// placed before the crash, without being stored
+		_, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 2)
+		require.NoError(t, err)
+		wallet.OnCandle(candle(2, 90))
+
+		controller = NewController(ctx, wallet, db, NewMonitor(wallet))
+		report, err := controller.Reconcile(start.Add(time.Hour), "BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, report.Imported, 1)
+		require.Equal(t, 2.0, report.Imported[0].Quantity)
+		require.Len(t, report.Updated, 1)
+		require.Equal(t, limit.ID, report.Updated[0].ID)
+		require.Equal(t, model.OrderStatusTypeFilled, report.Updated[0].Status)
+		require.True(t, report.Consistent())
+
+		positions, err := controller.Positions(storage.WithPositionStatus(model.PositionStatusTypeOpen))
+		require.NoError(t, err)
+		require.Len(t, positions, 1)
+		require.Equal(t, 3.0, positions[0].Quantity)
+
+		// a second pass finds nothing new
+		report, err = controller.Reconcile(start.Add(time.Hour), "BTCUSDT")
+		require.NoError(t, err)
+		require.Empty(t, report.Imported)
+		require.Empty(t, report.Updated)
+	})
+
+	t.Run("balance differences", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := listingWallet{exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+			exchange.WithPaperAsset("BTC", 1.5))}
+		wallet.OnCandle(candle(0, 100))
+		controller := NewController(ctx, wallet, db, NewMonitor(wallet))
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		report, err := controller.Reconcile(start, "BTCUSDT")
+		require.NoError(t, err)
+		require.False(t, report.Consistent())
+		require.Equal(t, []BalanceDiff{{Pair: "BTCUSDT", Exchange: 2.5, Ledger: 1}}, report.Balances)
+		require.Contains(t, report.String(), "BTCUSDT")
+	})
+}
@@ -0,0 +1,181 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// defaultClientOrderPrefix starts the client order ids, followed by the storage id of the orders
+	defaultClientOrderPrefix = "tradebot"
+
+	// pendingTimeout is the delay before rejecting a pending order unknown to the exchange,
+	// a request that timed out may still reach the exchange
+	pendingTimeout = time.Minute
+)
+
+// rejectedError is the error of orders refused by the exchange, they are never sent again
+type rejectedError struct {
+	err error
+}
+
+func (r rejectedError) Error() string {
+	return r.err.Error()
+}
+
+func (r rejectedError) Unwrap() error {
+	return r.err
+}
+
+// rejected tells if the orders of a submit error were refused by the exchange
+func rejected(err error) bool {
+	var rejectedErr rejectedError
+	return errors.As(err, &rejectedErr)
+}
+
+// SetClientOrderPrefix sets the prefix of the client order ids, to tell apart the orders of
+// bots sharing an account
+func (c *Controller) SetClientOrderPrefix(prefix string) {
+	c.clientOrderPrefix = prefix
+}
+
+func (c *Controller) clientOrderID(id int64) string {
+	return fmt.Sprintf("%s-%d", c.clientOrderPrefix, id)
+}
+
+// pendingOrder is the record of an order stored before its request
+func pendingOrder(side model.SideType, kind model.OrderType, pair string, quantity, price float64) model.Order {
+	return model.Order{
+		Pair:     pair,
+		Side:     side,
+		Type:     kind,
+		Quantity: quantity,
+		Price:    price,
+	}
+}
+
+// submit stores the orders as pending with their client order id, then creates them on the
+// exchange. An order is sent once: the exchange refuses a duplicate client order id only
+// while the first order is open, so a request of unknown status, eg: a timeout, is never
+// sent again. The pending orders are returned with the error, the controller finds them by
+// their client order id on the next sync or rejects them after the pending timeout.
+func (c *Controller) submit(pending []model.Order,
+	create func(trader exchange.Trader) ([]model.Order, error)) ([]model.Order, error) {
+
+	now := time.Now()
+	ids := make([]string, len(pending))
+	for i := range pending {
+		pending[i].Status = model.OrderStatusTypePendingNew
+		pending[i].CreatedAt = now
+		pending[i].UpdatedAt = now
+		err := c.storage.CreateOrder(&pending[i])
+		if err != nil {
+			return nil, err
+		}
+
+		pending[i].ClientOrderID = c.clientOrderID(pending[i].ID)
+		err = c.storage.UpdateOrder(&pending[i])
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = pending[i].ClientOrderID
+	}
+
+	var sender exchange.Trader = c.exchange
+	trader, ok := c.exchange.(exchange.ClientOrderTrader)
+	if ok {
+		sender = trader.WithClientOrderID(ids...)
+	}
+
+	orders, err := create(sender)
+	if err == nil {
+		return c.confirm(pending, orders)
+	}
+	if !ok || !errors.Is(err, exchange.ErrStatusUnknown) {
+		c.reject(pending)
+		return nil, rejectedError{err: err}
+	}
+
+	log.Warn().Err(err).Msgf("[ORDER] Pending %s", strings.Join(ids, ", "))
+	return pending, err
+}
+
+// submitOrder submits a single order
+func (c *Controller) submitOrder(pending model.Order,
+	create func(trader exchange.Trader) (model.Order, error)) (model.Order, error) {
+
+	orders, err := c.submit([]model.Order{pending}, func(trader exchange.Trader) ([]model.Order, error) {
+		order, err := create(trader)
+		if err != nil {
+			return nil, err
+		}
+		return []model.Order{order}, nil
+	})
+	if err != nil {
+		return model.Order{}, err
+	}
+	return orders[0], nil
+}
+
+// confirm stores the orders created by the exchange over their pending records
+func (c *Controller) confirm(pending []model.Order, orders []model.Order) ([]model.Order, error) {
+	for i := range orders {
+		record := pending[match(pending, orders[i])]
+		orders[i].ID = record.ID
+		orders[i].ClientOrderID = record.ClientOrderID
+		err := c.storage.UpdateOrder(&orders[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return orders, nil
+}
+
+// match returns the index of the pending record of an order, the legs of an OCO created
+// without client order id are told apart by their stop
+func match(pending []model.Order, order model.Order) int {
+	for i, record := range pending {
+		if order.ClientOrderID != "" && record.ClientOrderID == order.ClientOrderID {
+			return i
+		}
+	}
+	for i, record := range pending {
+		if (record.Stop != nil) == (order.Stop != nil) {
+			return i
+		}
+	}
+	return 0
+}
+
+// reject marks the pending records of orders refused by the exchange
+func (c *Controller) reject(pending []model.Order) {
+	for i := range pending {
+		pending[i].Status = model.OrderStatusTypeRejected
+		pending[i].UpdatedAt = time.Now()
+		err := c.storage.UpdateOrder(&pending[i])
+		if err != nil {
+			c.notifyError(err)
+		}
+	}
+}
+
+// resolve returns the state on the exchange of a pending order, it is rejected when the
+// exchange does not know it after the pending timeout
+func (c *Controller) resolve(order model.Order) (model.Order, error) {
+	excOrder, err := model.Order{}, exchange.ErrOrderNotFound
+	if trader, ok := c.exchange.(exchange.ClientOrderTrader); ok {
+		excOrder, err = trader.OrderByClientID(order.Pair, order.ClientOrderID)
+	}
+	if errors.Is(err, exchange.ErrOrderNotFound) && time.Since(order.CreatedAt) > pendingTimeout {
+		order.Status = model.OrderStatusTypeRejected
+		order.UpdatedAt = time.Now()
+		return order, nil
+	}
+	return excOrder, err
+}
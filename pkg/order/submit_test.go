@@ -0,0 +1,109 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/exchange/binancetest"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestController_Submit(t *testing.T) {
+	ctx := context.Background()
+	server, err := binancetest.NewServer(
+		binancetest.WithCsvFile("BTCUSDT", "1h", "../../testdata/btc-1h.csv"),
+		binancetest.WithBalance("USDT", 10000),
+		binancetest.WithStartTime(time.Date(2020, 11, 17, 10, 0, 0, 0, time.UTC)),
+	)
+	require.NoError(t, err)
+	defer server.Close()
+
+	binance, err := exchange.NewBinance(ctx,
+		exchange.WithBinanceBaseURL(server.URL()),
+		exchange.WithBinanceCredentials("key", "secret"))
+	require.NoError(t, err)
+
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	controller := NewController(ctx, binance, db, NewMonitor(binance))
+	controller.SetClientOrderPrefix("test")
+
+	stored := func(id int64) model.Order {
+		order, err := controller.storedOrder(id)
+		require.NoError(t, err)
+		return *order
+	}
+	listed := func() int {
+		orders, err := binance.(*exchange.Binance).Orders("BTCUSDT", 100)
+		require.NoError(t, err)
+		return len(orders)
+	}
+
+	pending := func() model.Order {
+		orders, err := controller.Orders(storage.WithStatus(model.OrderStatusTypePendingNew))
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		return *orders[0]
+	}
+
+	t.Run("response lost", func(t *testing.T) {
+		server.FailOrders(1, true)
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 0.1)
+		require.ErrorIs(t, err, exchange.ErrStatusUnknown)
+		// the order is not sent again
+		require.Equal(t, 1, listed())
+
+		order := pending()
+		require.Equal(t, "test-1", order.ClientOrderID)
+		require.Zero(t, order.ExchangeID)
+
+		// the order is found by its client order id on the next sync
+		controller.updateOrders()
+		order = stored(order.ID)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.NotZero(t, order.ExchangeID)
+		require.Equal(t, "test-1", order.ClientOrderID)
+
+		asset, _, err := binance.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.InDelta(t, 0.1, asset, 1e-9)
+		positions, err := controller.Positions(storage.WithPositionStatus(model.PositionStatusTypeOpen))
+		require.NoError(t, err)
+		require.Len(t, positions, 1)
+		require.InDelta(t, 0.1, positions[0].Quantity, 1e-9)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 10)
+		require.Error(t, err)
+		require.NotErrorIs(t, err, exchange.ErrStatusUnknown)
+
+		orders, err := controller.Orders(storage.WithStatus(model.OrderStatusTypeRejected))
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Zero(t, orders[0].ExchangeID)
+		require.Equal(t, 1, listed())
+	})
+
+	t.Run("request lost", func(t *testing.T) {
+		server.FailOrders(1, false)
+		_, err := controller.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 0.1, 100000)
+		require.ErrorIs(t, err, exchange.ErrStatusUnknown)
+		require.Equal(t, 1, listed())
+		order := pending()
+
+		// the request may still reach the exchange
+		controller.updateOrders()
+		require.Equal(t, model.OrderStatusTypePendingNew, stored(order.ID).Status)
+
+		order.CreatedAt = order.CreatedAt.Add(-2 * pendingTimeout)
+		require.NoError(t, db.UpdateOrder(&order))
+		controller.updateOrders()
+		require.Equal(t, model.OrderStatusTypeRejected, stored(order.ID).Status)
+		require.Equal(t, 1, listed())
+	})
+}
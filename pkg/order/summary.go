@@ -65,7 +65,8 @@ func (s summary) WinPercentage() float64 {
 func (s summary) String() string {
 	tableString := &strings.Builder{}
 	table := tablewriter.NewWriter(tableString)
-	_, quote := exchange.SplitAssetQuote(s.Pair)
+	// an unknown pair is still reported, without the quote
+	_, quote, _ := exchange.SplitAssetQuote(s.Pair)
 	data := [][]string{
 		{"Coin", s.Pair},
 		{"Trades", strconv.Itoa(len(s.Lose) + len(s.Win))},
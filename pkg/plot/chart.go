@@ -174,12 +174,11 @@ func (c *Chart) OnCandle(candle model.Candle) {
 	}
 }
 
-func (c *Chart) equityValuesByPair(pair string) (asset []assetValue, quote []assetValue) {
+func (c *Chart) equityValuesByAsset(asset string) ([]assetValue, []assetValue) {
 	assetValues := make([]assetValue, 0)
 	equityValues := make([]assetValue, 0)
 
 	if c.paperWallet != nil {
-		asset, _ := exchange.SplitAssetQuote(pair)
 		for _, value := range c.paperWallet.AssetValues(asset) {
 			assetValues = append(assetValues, assetValue{
 				Time:  value.Time,
@@ -324,9 +323,14 @@ func (c *Chart) handleData(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	asset, quote := exchange.SplitAssetQuote(pair)
-	assetValues, equityValues := c.equityValuesByPair(pair)
-	err := json.NewEncoder(w).Encode(map[string]interface{}{
+	asset, quote, err := exchange.SplitAssetQuote(pair)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	assetValues, equityValues := c.equityValuesByAsset(asset)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
 		"candles":       c.candlesByPair(pair),
 		"indicators":    c.indicatorsByPair(pair),
 		"shapes":        c.shapesByPair(pair),
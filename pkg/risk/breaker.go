@@ -0,0 +1,356 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/notifier"
+	"github.com/lynbklk/tradebot/pkg/order"
+	"github.com/lynbklk/tradebot/pkg/storage"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrTripped = errors.New("circuit breaker tripped")
+
+// Breaker is a kill switch on the equity of the account, valued in the base coin at the
+// last quotes. When the loss of the day or the drawdown from the peak reaches its limit,
+// it cancels the open orders and flattens the positions when configured, then halts the
+// controller so no new order is created until it is re-armed.
+// The Breaker is a Trader, the strategies trade through it.
+type Breaker struct {
+	mtx        sync.Mutex
+	controller *order.Controller
+	notifier   notifier.Notifier
+	baseCoin   string
+
+	maxDailyLoss float64
+	maxDrawdown  float64
+	cancelOrders bool
+	flatten      bool
+
+	peak      float64
+	day       time.Time
+	dayEquity float64
+	tripped   bool
+	reason    string
+}
+
+type BreakerOption func(*Breaker)
+
+// WithMaxDailyLoss trips the breaker with a loss of the fraction of the equity at the start of the day (UTC)
+func WithMaxDailyLoss(fraction float64) BreakerOption {
+	return func(b *Breaker) {
+		b.maxDailyLoss = fraction
+	}
+}
+
+// WithMaxDrawdown trips the breaker with a drawdown of the fraction of the peak equity
+func WithMaxDrawdown(fraction float64) BreakerOption {
+	return func(b *Breaker) {
+		b.maxDrawdown = fraction
+	}
+}
+
+// WithCancelOrders cancels the open orders of the controller when the breaker trips
+func WithCancelOrders() BreakerOption {
+	return func(b *Breaker) {
+		b.cancelOrders = true
+	}
+}
+
+// WithFlatten cancels the open orders and closes the positions at market when the breaker trips
+func WithFlatten() BreakerOption {
+	return func(b *Breaker) {
+		b.cancelOrders = true
+		b.flatten = true
+	}
+}
+
+func NewBreaker(controller *order.Controller, baseCoin string, options ...BreakerOption) *Breaker {
+	breaker := &Breaker{
+		controller: controller,
+		baseCoin:   baseCoin,
+	}
+	for _, option := range options {
+		option(breaker)
+	}
+	return breaker
+}
+
+func (b *Breaker) SetNotifier(notifier notifier.Notifier) {
+	b.notifier = notifier
+}
+
+// OnCandle checks the equity with each complete candle
+func (b *Breaker) OnCandle(candle model.Candle) {
+	if !candle.Complete {
+		return
+	}
+	if err := b.Check(candle.Time); err != nil {
+		log.Error().Err(err).Msg("breaker check failed.")
+	}
+}
+
+// Check values the equity at the given time and trips the breaker over the limits
+func (b *Breaker) Check(t time.Time) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.tripped {
+		return nil
+	}
+
+	equity, err := b.equity()
+	if err != nil {
+		return err
+	}
+
+	b.peak = math.Max(b.peak, equity)
+	if day := t.UTC().Truncate(24 * time.Hour); !day.Equal(b.day) {
+		b.day = day
+		b.dayEquity = equity
+	}
+
+	if b.maxDailyLoss > 0 && b.dayEquity > 0 {
+		if loss := (b.dayEquity - equity) / b.dayEquity; loss >= b.maxDailyLoss {
+			b.trip(fmt.Sprintf("daily loss %.2f %% over %.2f %%", loss*100, b.maxDailyLoss*100))
+			return nil
+		}
+	}
+	if b.maxDrawdown > 0 && b.peak > 0 {
+		if drawdown := (b.peak - equity) / b.peak; drawdown >= b.maxDrawdown {
+			b.trip(fmt.Sprintf("drawdown %.2f %% over %.2f %%", drawdown*100, b.maxDrawdown*100))
+		}
+	}
+	return nil
+}
+
+// Tripped tells if the breaker is latched, with the reason
+func (b *Breaker) Tripped() (bool, string) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return b.tripped, b.reason
+}
+
+// Rearm releases the breaker and resumes the controller, the current equity is the new
+// peak and start of the day.
+func (b *Breaker) Rearm() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	equity, err := b.equity()
+	if err != nil {
+		return err
+	}
+
+	b.tripped, b.reason = false, ""
+	b.peak, b.dayEquity = equity, equity
+	b.controller.Resume()
+	b.notify("✅ BREAKER RE-ARMED")
+	return nil
+}
+
+// equity is the value of the balances in the base coin, the assets without a quote in the
+// base coin are left out
+func (b *Breaker) equity() (float64, error) {
+	account, err := b.controller.Account()
+	if err != nil {
+		return 0, err
+	}
+
+	var equity float64
+	for _, balance := range account.Balances {
+		amount := balance.Free + balance.Lock - balance.Borrowed - balance.Interest
+		if amount == 0 {
+			continue
+		}
+		if balance.Tick == b.baseCoin {
+			equity += amount
+			continue
+		}
+		quote, err := b.controller.LastQuote(balance.Tick + b.baseCoin)
+		if err != nil {
+			log.Warn().Err(err).Msgf("breaker skipped %s without quote.", balance.Tick)
+			continue
+		}
+		equity += amount * quote
+	}
+	return equity, nil
+}
+
+func (b *Breaker) trip(reason string) {
+	b.tripped, b.reason = true, reason
+	b.notify(fmt.Sprintf("🚨 BREAKER TRIPPED: %s", reason))
+
+	if b.cancelOrders {
+		b.cancel()
+	}
+	if b.flatten {
+		b.close()
+	}
+	// the orders of the controller are still synced while halted
+	b.controller.Halt(reason)
+}
+
+func (b *Breaker) cancel() {
+	orders, err := b.controller.Orders(storage.WithStatusIn(
+		model.OrderStatusTypeNew,
+		model.OrderStatusTypePartiallyFilled,
+	))
+	if err != nil {
+		b.notifyError(err)
+		return
+	}
+
+	// canceling a leg of an OCO also cancels its sibling
+	groups := make(map[int64]bool)
+	for _, o := range orders {
+		if o.GroupID != nil {
+			if groups[*o.GroupID] {
+				continue
+			}
+			groups[*o.GroupID] = true
+		}
+		if err := b.controller.Cancel(*o); err != nil {
+			b.notifyError(err)
+		}
+	}
+}
+
+// close sells the long positions and buys back the short positions of the ledger at market,
+// the assets not traded by the controller are left untouched
+func (b *Breaker) close() {
+	positions, err := b.controller.Positions(storage.WithPositionStatus(model.PositionStatusTypeOpen))
+	if err != nil {
+		b.notifyError(err)
+		return
+	}
+
+	var pairs []string
+	longs, shorts := make(map[string]float64), make(map[string]float64)
+	for _, position := range positions {
+		if _, ok := longs[position.Pair]; !ok {
+			pairs = append(pairs, position.Pair)
+			longs[position.Pair] = 0
+		}
+		if position.IsShort() {
+			shorts[position.Pair] += position.Quantity
+		} else {
+			longs[position.Pair] += position.Quantity
+		}
+	}
+
+	for _, pair := range pairs {
+		if shorts[pair] > 0 {
+			if _, err := b.controller.CloseShort(pair, shorts[pair]); err != nil {
+				b.notifyError(err)
+			}
+		}
+		if longs[pair] <= 0 {
+			continue
+		}
+
+		// the free asset with the lock released by the canceled orders
+		asset, _, err := b.controller.Position(pair)
+		if err != nil {
+			b.notifyError(err)
+			continue
+		}
+		info := b.controller.GetAssetsInfo(pair)
+		quantity := order.RoundStep(math.Min(longs[pair], asset), info.StepSize)
+		if quantity <= 0 || quantity < info.MinQuantity {
+			continue
+		}
+		if _, err := b.controller.CreateOrderMarket(model.SideTypeSell, pair, quantity); err != nil {
+			b.notifyError(err)
+		}
+	}
+}
+
+func (b *Breaker) notify(message string) {
+	log.Info().Msg(message)
+	if b.notifier != nil {
+		b.notifier.Notify(message)
+	}
+}
+
+func (b *Breaker) notifyError(err error) {
+	log.Error().Err(err).Msg("breaker error")
+	if b.notifier != nil {
+		b.notifier.OnError(err)
+	}
+}
+
+func (b *Breaker) armed() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.tripped {
+		return fmt.Errorf("%w: %s", ErrTripped, b.reason)
+	}
+	return nil
+}
+
+func (b *Breaker) Account() (model.Account, error) {
+	return b.controller.Account()
+}
+
+func (b *Breaker) Position(pair string) (asset, quote float64, err error) {
+	return b.controller.Position(pair)
+}
+
+func (b *Breaker) Order(pair string, id int64) (model.Order, error) {
+	return b.controller.Order(pair, id)
+}
+
+func (b *Breaker) Cancel(order model.Order) error {
+	return b.controller.Cancel(order)
+}
+
+func (b *Breaker) CreateOrderOCO(side model.SideType, pair string, size, price, stop,
+	stopLimit float64) ([]model.Order, error) {
+	if err := b.armed(); err != nil {
+		return nil, err
+	}
+	return b.controller.CreateOrderOCO(side, pair, size, price, stop, stopLimit)
+}
+
+func (b *Breaker) CreateOrderLimit(side model.SideType, pair string, size float64, limit float64) (model.Order, error) {
+	if err := b.armed(); err != nil {
+		return model.Order{}, err
+	}
+	return b.controller.CreateOrderLimit(side, pair, size, limit)
+}
+
+func (b *Breaker) CreateOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
+	if err := b.armed(); err != nil {
+		return model.Order{}, err
+	}
+	return b.controller.CreateOrderMarket(side, pair, size)
+}
+
+func (b *Breaker) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	if err := b.armed(); err != nil {
+		return model.Order{}, err
+	}
+	return b.controller.CreateOrderMarketQuote(side, pair, quote)
+}
+
+func (b *Breaker) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	if err := b.armed(); err != nil {
+		return model.Order{}, err
+	}
+	return b.controller.CreateOrderStop(pair, quantity, limit)
+}
+
+func (b *Breaker) CreateOrderTrailingStop(pair string, quantity float64, trailing model.Trailing) (model.Order, error) {
+	if err := b.armed(); err != nil {
+		return model.Order{}, err
+	}
+	return b.controller.CreateOrderTrailingStop(pair, quantity, trailing)
+}
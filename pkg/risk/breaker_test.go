@@ -0,0 +1,190 @@
+package risk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/order"
+	"github.com/lynbklk/tradebot/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// cancelWallet fails the cancel of closed orders like the exchanges
+type cancelWallet struct {
+	*exchange.PaperWallet
+}
+
+func (c cancelWallet) Cancel(o model.Order) error {
+	current, err := c.Order(o.Pair, o.ExchangeID)
+	if err != nil {
+		return err
+	}
+	if current.Status != model.OrderStatusTypeNew && current.Status != model.OrderStatusTypePartiallyFilled {
+		return exchange.ErrOrderNotFound
+	}
+	return c.PaperWallet.Cancel(o)
+}
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hour int, price float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hour) * time.Hour),
+			Open: price, High: price, Low: price, Close: price, Volume: 100, Complete: true}
+	}
+	setup := func(options ...BreakerOption) (*exchange.PaperWallet, *Breaker, *fakeNotifier) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		wallet.OnCandle(candle(0, 100))
+		controller := order.NewController(ctx, wallet, db, order.NewMonitor(wallet))
+		notifier := &fakeNotifier{}
+		breaker := NewBreaker(controller, "USDT", options...)
+		breaker.SetNotifier(notifier)
+
+		_, err = breaker.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 50)
+		require.NoError(t, err)
+		breaker.OnCandle(candle(0, 100))
+		return wallet, breaker, notifier
+	}
+	feed := func(wallet *exchange.PaperWallet, breaker *Breaker, candle model.Candle) {
+		wallet.OnCandle(candle)
+		breaker.OnCandle(candle)
+	}
+
+	t.Run("drawdown", func(t *testing.T) {
+		wallet, breaker, notifier := setup(WithMaxDrawdown(0.1))
+		feed(wallet, breaker, candle(1, 120))
+		feed(wallet, breaker, candle(2, 100))
+		tripped, _ := breaker.Tripped()
+		require.False(t, tripped)
+
+		// equity of 10.5k from the peak of 11k, then 9.9k
+		feed(wallet, breaker, candle(3, 98))
+		tripped, reason := breaker.Tripped()
+		require.True(t, tripped)
+		require.Contains(t, reason, "drawdown")
+		require.Len(t, notifier.messages, 1)
+
+		_, err := breaker.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.ErrorIs(t, err, ErrTripped)
+		// the controller is halted for the strategies trading without the breaker
+		require.True(t, breaker.controller.Halted())
+		_, err = breaker.controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.ErrorIs(t, err, order.ErrHalted)
+
+		// latched until re-armed
+		feed(wallet, breaker, candle(4, 120))
+		tripped, _ = breaker.Tripped()
+		require.True(t, tripped)
+
+		require.NoError(t, breaker.Rearm())
+		tripped, _ = breaker.Tripped()
+		require.False(t, tripped)
+		require.False(t, breaker.controller.Halted())
+		_, err = breaker.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+	})
+
+	t.Run("daily loss", func(t *testing.T) {
+		wallet, breaker, _ := setup(WithMaxDailyLoss(0.05))
+		feed(wallet, breaker, candle(12, 120))
+		feed(wallet, breaker, candle(23, 111))
+		tripped, _ := breaker.Tripped()
+		require.False(t, tripped)
+
+		// the equity of the day starts at 10.55k
+		feed(wallet, breaker, candle(24, 111))
+		feed(wallet, breaker, candle(25, 100))
+		tripped, reason := breaker.Tripped()
+		require.True(t, tripped)
+		require.Contains(t, reason, "daily loss")
+	})
+
+	t.Run("unpriced asset", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+			exchange.WithPaperAsset("BNB", 10))
+		wallet.OnCandle(candle(0, 100))
+		controller := order.NewController(ctx, wallet, db, order.NewMonitor(wallet))
+		breaker := NewBreaker(controller, "USDT", WithMaxDrawdown(0.1))
+
+		// BNB has no quote in USDT
+		require.NoError(t, breaker.Check(start))
+		equity, err := breaker.equity()
+		require.NoError(t, err)
+		require.InDelta(t, 10000, equity, 1e-9)
+	})
+
+	t.Run("flatten", func(t *testing.T) {
+		wallet, breaker, _ := setup(WithMaxDrawdown(0.1), WithFlatten())
+		limit, err := breaker.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 10, 50)
+		require.NoError(t, err)
+		// the asset locked by the take profit is sold once released
+		_, err = breaker.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 20, 200)
+		require.NoError(t, err)
+
+		feed(wallet, breaker, candle(1, 80))
+		tripped, _ := breaker.Tripped()
+		require.True(t, tripped)
+
+		limit, err = wallet.Order("BTCUSDT", limit.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, limit.Status)
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Zero(t, asset)
+	})
+
+	t.Run("flatten ledger positions", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+			exchange.WithPaperAsset("BTC", 5))
+		wallet.OnCandle(candle(0, 100))
+		controller := order.NewController(ctx, wallet, db, order.NewMonitor(wallet))
+		breaker := NewBreaker(controller, "USDT", WithMaxDrawdown(0.1), WithFlatten())
+
+		_, err = breaker.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 50)
+		require.NoError(t, err)
+		breaker.OnCandle(candle(0, 100))
+		feed(wallet, breaker, candle(1, 80))
+		tripped, _ := breaker.Tripped()
+		require.True(t, tripped)
+
+		// the asset held before the controller is kept
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.InDelta(t, 5, asset, 1e-9)
+	})
+	t.Run("oco canceled once", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		wallet.OnCandle(candle(0, 100))
+		controller := order.NewController(ctx, cancelWallet{wallet}, db, order.NewMonitor(wallet))
+		notifier := &fakeNotifier{}
+		breaker := NewBreaker(controller, "USDT", WithMaxDrawdown(0.1), WithCancelOrders())
+		breaker.SetNotifier(notifier)
+
+		_, err = breaker.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 50)
+		require.NoError(t, err)
+		orders, err := breaker.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 50, 200, 50, 49)
+		require.NoError(t, err)
+		breaker.OnCandle(candle(0, 100))
+		feed(wallet, breaker, candle(1, 80))
+		tripped, _ := breaker.Tripped()
+		require.True(t, tripped)
+
+		require.Empty(t, notifier.errors)
+		for _, o := range orders {
+			o, err = wallet.Order("BTCUSDT", o.ExchangeID)
+			require.NoError(t, err)
+			require.Equal(t, model.OrderStatusTypeCanceled, o.Status)
+		}
+	})
+}
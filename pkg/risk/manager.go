@@ -0,0 +1,398 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/notifier"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrMaxNotional   = errors.New("order notional over the limit")
+	ErrMaxPosition   = errors.New("position over the limit")
+	ErrMaxExposure   = errors.New("total exposure over the limit")
+	ErrMaxOpenOrders = errors.New("too many open orders")
+	ErrMaxOrderRate  = errors.New("too many orders per minute")
+	ErrPriceBand     = errors.New("price out of the band of the last quote")
+)
+
+// RiskError is an order rejected by the risk manager, with the value checked and its limit
+type RiskError struct {
+	Err   error
+	Pair  string
+	Value float64
+	Limit float64
+}
+
+func (r *RiskError) Error() string {
+	return fmt.Sprintf("risk error: %v: %s %f > %f", r.Err, r.Pair, r.Value, r.Limit)
+}
+
+func (r *RiskError) Unwrap() error {
+	return r.Err
+}
+
+// Manager is a Trader checking each order against the risk limits before sending it to the
+// wrapped trader. A zero limit is disabled. Orders reducing a position are not limited by
+// the price band, the position and exposure limits, so a strategy is always able to exit.
+type Manager struct {
+	mtx      sync.Mutex
+	ctx      context.Context
+	trader   exchange.Trader
+	feeder   exchange.Feeder
+	notifier notifier.Notifier
+	clock    func() time.Time
+
+	maxNotional   float64
+	maxPosition   float64
+	maxPositions  map[string]float64
+	maxExposure   float64
+	maxOpenOrders int
+	maxOrderRate  int
+	priceBand     float64
+
+	pairs  map[string]bool
+	open   []model.Order
+	recent []time.Time
+}
+
+type Option func(*Manager)
+
+// WithMaxNotional limits the value in the quote asset of each order
+func WithMaxNotional(value float64) Option {
+	return func(m *Manager) {
+		m.maxNotional = value
+	}
+}
+
+// WithMaxPosition limits the value of the position of the given pairs after an order,
+// or of any pair without pairs
+func WithMaxPosition(value float64, pairs ...string) Option {
+	return func(m *Manager) {
+		if len(pairs) == 0 {
+			m.maxPosition = value
+		}
+		for _, pair := range pairs {
+			m.maxPositions[pair] = value
+		}
+	}
+}
+
+// WithMaxExposure limits the value of the positions of all the pairs after an order
+func WithMaxExposure(value float64) Option {
+	return func(m *Manager) {
+		m.maxExposure = value
+	}
+}
+
+// WithMaxOpenOrders limits the orders sent through the manager and still open
+func WithMaxOpenOrders(count int) Option {
+	return func(m *Manager) {
+		m.maxOpenOrders = count
+	}
+}
+
+// WithMaxOrdersPerMinute limits the orders sent in the last minute
+func WithMaxOrdersPerMinute(count int) Option {
+	return func(m *Manager) {
+		m.maxOrderRate = count
+	}
+}
+
+// WithPriceBand limits the distance of the order prices to the last quote, eg: 0.05 for 5%,
+// the exits of a position, eg: its stops, are not limited
+func WithPriceBand(fraction float64) Option {
+	return func(m *Manager) {
+		m.priceBand = fraction
+	}
+}
+
+// WithPairs adds the pairs valued for the total exposure, the pairs traded through
+// the manager are added on their first order
+func WithPairs(pairs ...string) Option {
+	return func(m *Manager) {
+		for _, pair := range pairs {
+			m.pairs[pair] = true
+		}
+	}
+}
+
+// WithClock sets the time of the order rate, eg: the time of the last candle in backtests
+func WithClock(clock func() time.Time) Option {
+	return func(m *Manager) {
+		m.clock = clock
+	}
+}
+
+func NewManager(ctx context.Context, trader exchange.Trader, feeder exchange.Feeder, options ...Option) *Manager {
+	manager := &Manager{
+		ctx:          ctx,
+		trader:       trader,
+		feeder:       feeder,
+		clock:        time.Now,
+		maxPositions: make(map[string]float64),
+		pairs:        make(map[string]bool),
+	}
+	for _, option := range options {
+		option(manager)
+	}
+	return manager
+}
+
+func (m *Manager) SetNotifier(notifier notifier.Notifier) {
+	m.notifier = notifier
+}
+
+func (m *Manager) Account() (model.Account, error) {
+	return m.trader.Account()
+}
+
+func (m *Manager) Position(pair string) (asset, quote float64, err error) {
+	return m.trader.Position(pair)
+}
+
+func (m *Manager) Order(pair string, id int64) (model.Order, error) {
+	return m.trader.Order(pair, id)
+}
+
+func (m *Manager) Cancel(order model.Order) error {
+	return m.trader.Cancel(order)
+}
+
+func (m *Manager) CreateOrderOCO(side model.SideType, pair string, size, price, stop,
+	stopLimit float64) ([]model.Order, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	err := m.check(side, pair, size, price, []float64{price, stop, stopLimit}, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := m.trader.CreateOrderOCO(side, pair, size, price, stop, stopLimit)
+	if err != nil {
+		return nil, err
+	}
+	m.accept(orders...)
+	return orders, nil
+}
+
+func (m *Manager) CreateOrderLimit(side model.SideType, pair string, size float64, limit float64) (model.Order, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if err := m.check(side, pair, size, limit, []float64{limit}, 1); err != nil {
+		return model.Order{}, err
+	}
+	return m.create(m.trader.CreateOrderLimit(side, pair, size, limit))
+}
+
+func (m *Manager) CreateOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if err := m.check(side, pair, size, 0, nil, 1); err != nil {
+		return model.Order{}, err
+	}
+	return m.create(m.trader.CreateOrderMarket(side, pair, size))
+}
+
+func (m *Manager) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	last, err := m.feeder.GetLastQuote(m.ctx, pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+	if err := m.check(side, pair, quote/last, last, nil, 1); err != nil {
+		return model.Order{}, err
+	}
+	return m.create(m.trader.CreateOrderMarketQuote(side, pair, quote))
+}
+
+func (m *Manager) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if err := m.check(model.SideTypeSell, pair, quantity, limit, []float64{limit}, 1); err != nil {
+		return model.Order{}, err
+	}
+	return m.create(m.trader.CreateOrderStop(pair, quantity, limit))
+}
+
+func (m *Manager) CreateOrderTrailingStop(pair string, quantity float64, trailing model.Trailing) (model.Order, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if err := m.check(model.SideTypeSell, pair, quantity, 0, nil, 1); err != nil {
+		return model.Order{}, err
+	}
+	return m.create(m.trader.CreateOrderTrailingStop(pair, quantity, trailing))
+}
+
+func (m *Manager) create(order model.Order, err error) (model.Order, error) {
+	if err != nil {
+		return model.Order{}, err
+	}
+	m.accept(order)
+	return order, nil
+}
+
+// accept records the orders sent for the open orders and the order rate
+func (m *Manager) accept(orders ...model.Order) {
+	m.open = append(m.open, orders...)
+	m.recent = append(m.recent, m.clock())
+}
+
+// check validates an order of the size at the price, the last quote without price.
+// The prices are checked against the price band and the count is the orders to be opened.
+func (m *Manager) check(side model.SideType, pair string, size, price float64, prices []float64, count int) error {
+	m.pairs[pair] = true
+
+	last, err := m.feeder.GetLastQuote(m.ctx, pair)
+	if err != nil {
+		return err
+	}
+	if price == 0 {
+		price = last
+	}
+
+	err = m.checkLimits(side, pair, size, price, last, prices, count)
+	if err != nil {
+		m.reject(err)
+	}
+	return err
+}
+
+func (m *Manager) checkLimits(side model.SideType, pair string, size, price, last float64,
+	prices []float64, count int) error {
+	if m.maxNotional > 0 && size*price > m.maxNotional {
+		return &RiskError{Err: ErrMaxNotional, Pair: pair, Value: size * price, Limit: m.maxNotional}
+	}
+
+	maxPosition, ok := m.maxPositions[pair]
+	if !ok {
+		maxPosition = m.maxPosition
+	}
+
+	// the value of the position before and after the order
+	var current, next float64
+	if m.priceBand > 0 && len(prices) > 0 || maxPosition > 0 || m.maxExposure > 0 {
+		position, _, err := m.trader.Position(pair)
+		if err != nil {
+			return err
+		}
+		change := size
+		if side == model.SideTypeSell {
+			change = -size
+		}
+		current, next = math.Abs(position)*last, math.Abs(position+change)*last
+	}
+	reducing := next <= current
+
+	if m.priceBand > 0 && last > 0 && !reducing {
+		for _, p := range prices {
+			if distance := math.Abs(p-last) / last; distance > m.priceBand {
+				return &RiskError{Err: ErrPriceBand, Pair: pair, Value: distance, Limit: m.priceBand}
+			}
+		}
+	}
+
+	if m.maxOrderRate > 0 {
+		if rate := m.orderRate(); rate+1 > m.maxOrderRate {
+			return &RiskError{Err: ErrMaxOrderRate, Pair: pair, Value: float64(rate + 1),
+				Limit: float64(m.maxOrderRate)}
+		}
+	}
+
+	if m.maxOpenOrders > 0 {
+		if open := m.openOrders(); open+count > m.maxOpenOrders {
+			return &RiskError{Err: ErrMaxOpenOrders, Pair: pair, Value: float64(open + count),
+				Limit: float64(m.maxOpenOrders)}
+		}
+	}
+
+	if reducing || maxPosition <= 0 && m.maxExposure <= 0 {
+		return nil
+	}
+
+	if maxPosition > 0 && next > maxPosition {
+		return &RiskError{Err: ErrMaxPosition, Pair: pair, Value: next, Limit: maxPosition}
+	}
+
+	if m.maxExposure > 0 {
+		exposure, err := m.exposure()
+		if err != nil {
+			return err
+		}
+		if exposure += next - current; exposure > m.maxExposure {
+			return &RiskError{Err: ErrMaxExposure, Pair: pair, Value: exposure, Limit: m.maxExposure}
+		}
+	}
+	return nil
+}
+
+// orderRate is the count of orders sent in the last minute
+func (m *Manager) orderRate() int {
+	since := m.clock().Add(-time.Minute)
+	recent := m.recent[:0]
+	for _, t := range m.recent {
+		if t.After(since) {
+			recent = append(recent, t)
+		}
+	}
+	m.recent = recent
+	return len(m.recent)
+}
+
+// openOrders is the count of orders sent and still open, the done orders are forgotten
+func (m *Manager) openOrders() int {
+	open := m.open[:0]
+	for _, order := range m.open {
+		current, err := m.trader.Order(order.Pair, order.ExchangeID)
+		if err != nil {
+			log.Error().Err(err).Msgf("risk get order %d failed.", order.ExchangeID)
+			current = order
+		}
+		if current.Status == model.OrderStatusTypeNew || current.Status == model.OrderStatusTypePartiallyFilled {
+			open = append(open, order)
+		}
+	}
+	m.open = open
+	return len(m.open)
+}
+
+// exposure is the value of the positions of the known pairs at their last quotes
+func (m *Manager) exposure() (float64, error) {
+	var exposure float64
+	for pair := range m.pairs {
+		position, _, err := m.trader.Position(pair)
+		if err != nil {
+			return 0, err
+		}
+		if position == 0 {
+			continue
+		}
+		last, err := m.feeder.GetLastQuote(m.ctx, pair)
+		if err != nil {
+			return 0, err
+		}
+		exposure += math.Abs(position) * last
+	}
+	return exposure, nil
+}
+
+func (m *Manager) reject(err error) {
+	log.Error().Err(err).Msg("risk rejected order.")
+	if m.notifier != nil {
+		m.notifier.OnError(err)
+	}
+}
@@ -0,0 +1,141 @@
+package risk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeNotifier struct {
+	messages []string
+	errors   []error
+}
+
+func (f *fakeNotifier) Notify(message string) {
+	f.messages = append(f.messages, message)
+}
+
+func (f *fakeNotifier) OnOrder(_ model.Order) {}
+
+func (f *fakeNotifier) OnError(err error) {
+	f.errors = append(f.errors, err)
+}
+
+func (f *fakeNotifier) Start() {}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(pair string, minute int, price float64) model.Candle {
+		return model.Candle{Pair: pair, Time: start.Add(time.Duration(minute) * time.Minute),
+			Open: price, High: price, Low: price, Close: price, Volume: 100, Complete: true}
+	}
+	setup := func(options ...Option) (*exchange.PaperWallet, *Manager, *fakeNotifier) {
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		wallet.OnCandle(candle("BTCUSDT", 0, 100))
+		wallet.OnCandle(candle("ETHUSDT", 0, 10))
+		notifier := &fakeNotifier{}
+		manager := NewManager(ctx, wallet, wallet, options...)
+		manager.SetNotifier(notifier)
+		return wallet, manager, notifier
+	}
+
+	t.Run("max notional", func(t *testing.T) {
+		_, manager, notifier := setup(WithMaxNotional(500))
+		_, err := manager.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 5)
+		require.NoError(t, err)
+
+		_, err = manager.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 6, 95)
+		require.ErrorIs(t, err, ErrMaxNotional)
+		var riskErr *RiskError
+		require.ErrorAs(t, err, &riskErr)
+		require.Equal(t, "BTCUSDT", riskErr.Pair)
+		require.Equal(t, 570.0, riskErr.Value)
+		require.Len(t, notifier.errors, 1)
+
+		_, err = manager.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSDT", 600)
+		require.ErrorIs(t, err, ErrMaxNotional)
+	})
+
+	t.Run("max position", func(t *testing.T) {
+		_, manager, _ := setup(WithMaxPosition(1000), WithMaxPosition(50, "ETHUSDT"))
+		_, err := manager.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 8)
+		require.NoError(t, err)
+		_, err = manager.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 3)
+		require.ErrorIs(t, err, ErrMaxPosition)
+		_, err = manager.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 6)
+		require.ErrorIs(t, err, ErrMaxPosition)
+
+		// reducing the position is always allowed
+		_, err = manager.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 2)
+		require.NoError(t, err)
+	})
+
+	t.Run("max exposure", func(t *testing.T) {
+		_, manager, _ := setup(WithMaxExposure(1000))
+		_, err := manager.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 8)
+		require.NoError(t, err)
+		_, err = manager.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 30)
+		require.ErrorIs(t, err, ErrMaxExposure)
+		_, err = manager.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 20)
+		require.NoError(t, err)
+	})
+
+	t.Run("max open orders", func(t *testing.T) {
+		wallet, manager, _ := setup(WithMaxOpenOrders(2))
+		first, err := manager.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 90)
+		require.NoError(t, err)
+		_, err = manager.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 80)
+		require.NoError(t, err)
+		_, err = manager.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 70)
+		require.ErrorIs(t, err, ErrMaxOpenOrders)
+
+		require.NoError(t, manager.Cancel(first))
+		_, err = manager.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 70)
+		require.NoError(t, err)
+
+		// both legs of an oco are open orders
+		wallet.OnCandle(candle("BTCUSDT", 1, 75))
+		_, err = manager.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 85, 65, 64)
+		require.ErrorIs(t, err, ErrMaxOpenOrders)
+	})
+
+	t.Run("orders per minute", func(t *testing.T) {
+		now := start
+		_, manager, _ := setup(WithMaxOrdersPerMinute(2), WithClock(func() time.Time { return now }))
+		for i := 0; i < 2; i++ {
+			_, err := manager.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+			require.NoError(t, err)
+		}
+		_, err := manager.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.ErrorIs(t, err, ErrMaxOrderRate)
+
+		now = now.Add(time.Minute)
+		_, err = manager.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+	})
+
+	t.Run("price band", func(t *testing.T) {
+		_, manager, notifier := setup(WithPriceBand(0.05))
+		_, err := manager.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 96)
+		require.NoError(t, err)
+		_, err = manager.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 10)
+		require.ErrorIs(t, err, ErrPriceBand)
+		_, err = manager.CreateOrderStop("BTCUSDT", 1, 90)
+		require.ErrorIs(t, err, ErrPriceBand)
+		require.Len(t, notifier.errors, 2)
+
+		// the exits of a position are not limited
+		_, err = manager.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 2)
+		require.NoError(t, err)
+		_, err = manager.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 130, 80, 79)
+		require.NoError(t, err)
+		_, err = manager.CreateOrderStop("BTCUSDT", 1, 80)
+		require.NoError(t, err)
+		require.Len(t, notifier.errors, 2)
+	})
+}
@@ -0,0 +1,171 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/order"
+)
+
+var (
+	ErrInvalidEntry = errors.New("invalid entry to size")
+	ErrNoEdge       = errors.New("kelly fraction without edge")
+)
+
+// Entry is the entry to size, the stop and the ATR are used by the sizers based on them
+type Entry struct {
+	Price float64
+	Stop  float64
+	ATR   float64
+}
+
+// Sizer returns the quantity of the base asset of an entry, rounded to the step size of the
+// pair and checked against its minimum quantity and notional.
+// The equity is the value of the quote and asset position of the pair at the entry price.
+type Sizer interface {
+	Size(trader exchange.Trader, pair string, entry Entry) (float64, error)
+}
+
+// FixedFractional invests a fraction of the equity
+type FixedFractional struct {
+	Fraction float64
+}
+
+func (s FixedFractional) Size(trader exchange.Trader, pair string, entry Entry) (float64, error) {
+	if entry.Price <= 0 {
+		return 0, ErrInvalidEntry
+	}
+	return size(trader, pair, entry.Price, func(equity, _ float64) float64 {
+		return s.Fraction * equity / entry.Price
+	})
+}
+
+// VolatilityTarget risks a fraction of the equity on a move of Multiplier times the ATR,
+// a zero multiplier is one ATR, the quantity is capped at the buying power
+type VolatilityTarget struct {
+	Fraction   float64
+	Multiplier float64
+}
+
+func (s VolatilityTarget) Size(trader exchange.Trader, pair string, entry Entry) (float64, error) {
+	multiplier := s.Multiplier
+	if multiplier == 0 {
+		multiplier = 1
+	}
+	if entry.Price <= 0 || entry.ATR <= 0 {
+		return 0, ErrInvalidEntry
+	}
+	return size(trader, pair, entry.Price, func(equity, buyingPower float64) float64 {
+		return math.Min(s.Fraction*equity/(multiplier*entry.ATR), buyingPower)
+	})
+}
+
+// Kelly invests the Kelly fraction of the equity, W - (1 - W) / R with the win rate W and
+// the ratio R of the average win over the average loss, times the scale (eg: 0.5 for half
+// Kelly), a zero scale is the full fraction
+type Kelly struct {
+	WinRate float64
+	Payoff  float64
+	Scale   float64
+}
+
+// Fraction is the scaled Kelly fraction
+func (s Kelly) Fraction() float64 {
+	if s.Payoff <= 0 {
+		return 0
+	}
+	scale := s.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	return (s.WinRate - (1-s.WinRate)/s.Payoff) * scale
+}
+
+func (s Kelly) Size(trader exchange.Trader, pair string, entry Entry) (float64, error) {
+	if entry.Price <= 0 {
+		return 0, ErrInvalidEntry
+	}
+	fraction := s.Fraction()
+	if fraction <= 0 {
+		return 0, ErrNoEdge
+	}
+	return size(trader, pair, entry.Price, func(equity, _ float64) float64 {
+		return math.Min(fraction, 1) * equity / entry.Price
+	})
+}
+
+// FixedRisk loses a fraction of the equity when the stop of the entry is reached, the
+// quantity is capped at the buying power
+type FixedRisk struct {
+	Fraction float64
+}
+
+func (s FixedRisk) Size(trader exchange.Trader, pair string, entry Entry) (float64, error) {
+	if entry.Price <= 0 || entry.Stop <= 0 || entry.Stop == entry.Price {
+		return 0, ErrInvalidEntry
+	}
+	return size(trader, pair, entry.Price, func(equity, buyingPower float64) float64 {
+		return math.Min(s.Fraction*equity/math.Abs(entry.Price-entry.Stop), buyingPower)
+	})
+}
+
+// size computes the quantity for the equity and the buying power of the pair and applies
+// the filters of the pair, the buying power is the quantity the quote balance buys with
+// the taker fee
+func size(trader exchange.Trader, pair string, price float64,
+	quantity func(equity, buyingPower float64) float64) (float64, error) {
+	asset, quote, err := trader.Position(pair)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := assetInfo(trader, pair)
+	if err != nil {
+		return 0, err
+	}
+
+	value := quantity(quote+asset*price, quote/(price*(1+takerFee(trader))))
+	value = order.RoundStep(value, info.StepSize)
+	if info.MaxQuantity > 0 {
+		value = math.Min(value, info.MaxQuantity)
+	}
+
+	if value <= 0 || value < info.MinQuantity {
+		return 0, &exchange.OrderError{
+			Err:      fmt.Errorf("%w: min: %f", exchange.ErrInvalidQuantity, info.MinQuantity),
+			Pair:     pair,
+			Quantity: value,
+		}
+	}
+	if value*price < info.MinNotional {
+		return 0, &exchange.OrderError{
+			Err:      fmt.Errorf("%w: notional %f under %f", exchange.ErrInvalidQuantity, value*price, info.MinNotional),
+			Pair:     pair,
+			Quantity: value,
+		}
+	}
+	return value, nil
+}
+
+// assetInfo returns the filters of the pair from the trader when it knows them,
+// eg: the exchanges, the paper wallet or the order controller, or from the registry
+func assetInfo(trader exchange.Trader, pair string) (model.AssetInfo, error) {
+	if feeder, ok := trader.(interface {
+		GetAssetsInfo(pair string) model.AssetInfo
+	}); ok {
+		return feeder.GetAssetsInfo(pair), nil
+	}
+	return exchange.DefaultRegistry.AssetInfo(pair)
+}
+
+// takerFee returns the taker commission of the trader when it knows it, eg: the exchanges,
+// the paper wallet or the order controller
+func takerFee(trader exchange.Trader) float64 {
+	if account, ok := trader.(interface{ UserInfo() exchange.UserInfo }); ok {
+		return account.UserInfo().TakerCommission
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+package risk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+type feeTrader struct {
+	*exchange.PaperWallet
+	info model.AssetInfo
+}
+
+func (f feeTrader) GetAssetsInfo(_ string) model.AssetInfo {
+	return f.info
+}
+
+type infoTrader struct {
+	exchange.Trader
+	info model.AssetInfo
+}
+
+func (i infoTrader) GetAssetsInfo(_ string) model.AssetInfo {
+	return i.info
+}
+
+func TestSizer(t *testing.T) {
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+		exchange.WithPaperAsset("BTC", 50))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		Open: 100, High: 100, Low: 100, Close: 100, Volume: 100, Complete: true})
+	trader := infoTrader{Trader: wallet, info: model.AssetInfo{StepSize: 0.01, MinQuantity: 0.1, MinNotional: 10}}
+
+	// the equity of the pair is 15000 at 100
+	for name, tc := range map[string]struct {
+		sizer    Sizer
+		entry    Entry
+		expected float64
+	}{
+		"fixed fractional":  {FixedFractional{Fraction: 0.1}, Entry{Price: 100}, 15},
+		"volatility target": {VolatilityTarget{Fraction: 0.01, Multiplier: 2}, Entry{Price: 100, ATR: 7}, 10.71},
+		"half kelly":        {Kelly{WinRate: 0.6, Payoff: 2, Scale: 0.5}, Entry{Price: 100}, 30},
+		"fixed risk":        {FixedRisk{Fraction: 0.02}, Entry{Price: 100, Stop: 93}, 42.85},
+
+		// the buying power is 100 at 100
+		"volatility target capped": {VolatilityTarget{Fraction: 0.05}, Entry{Price: 100, ATR: 0.5}, 100},
+		"fixed risk capped":        {FixedRisk{Fraction: 0.02}, Entry{Price: 100, Stop: 99.9}, 100},
+	} {
+		t.Run(name, func(t *testing.T) {
+			size, err := tc.sizer.Size(trader, "BTCUSDT", tc.entry)
+			require.NoError(t, err)
+			require.InDelta(t, tc.expected, size, 1e-9)
+		})
+	}
+
+	t.Run("invalid entries", func(t *testing.T) {
+		_, err := FixedRisk{Fraction: 0.02}.Size(trader, "BTCUSDT", Entry{Price: 100})
+		require.ErrorIs(t, err, ErrInvalidEntry)
+		_, err = VolatilityTarget{Fraction: 0.01}.Size(trader, "BTCUSDT", Entry{Price: 100})
+		require.ErrorIs(t, err, ErrInvalidEntry)
+		_, err = Kelly{WinRate: 0.3, Payoff: 1}.Size(trader, "BTCUSDT", Entry{Price: 100})
+		require.ErrorIs(t, err, ErrNoEdge)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		_, err := FixedFractional{Fraction: 0.0005}.Size(trader, "BTCUSDT", Entry{Price: 100})
+		require.ErrorIs(t, err, exchange.ErrInvalidQuantity)
+
+		trader.info.MinNotional = 100
+		_, err = FixedFractional{Fraction: 0.005}.Size(trader, "BTCUSDT", Entry{Price: 100})
+		require.ErrorIs(t, err, exchange.ErrInvalidQuantity)
+
+		// without filters from the trader, the registry is used
+		size, err := FixedFractional{Fraction: 0.1}.Size(struct{ exchange.Trader }{wallet}, "BTCUSDT",
+			Entry{Price: 100})
+		require.NoError(t, err)
+		require.InDelta(t, 15, size, 1e-9)
+	})
+}
+
+func TestSizer_BuyingPower(t *testing.T) {
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10010),
+		exchange.WithPaperFee(0.001, 0.001))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		Open: 100, High: 100, Low: 100, Close: 100, Volume: 1000, Complete: true})
+	trader := feeTrader{PaperWallet: wallet, info: model.AssetInfo{StepSize: 0.01}}
+
+	// 10010 buys 100 at 100 with the taker fee of 10
+	for name, sizer := range map[string]Sizer{
+		"volatility target": VolatilityTarget{Fraction: 0.05},
+		"fixed risk":        FixedRisk{Fraction: 0.02},
+	} {
+		t.Run(name, func(t *testing.T) {
+			size, err := sizer.Size(trader, "BTCUSDT", Entry{Price: 100, Stop: 99.9, ATR: 0.5})
+			require.NoError(t, err)
+			require.InDelta(t, 100, size, 1e-9)
+		})
+	}
+
+	size, err := FixedRisk{Fraction: 0.02}.Size(trader, "BTCUSDT", Entry{Price: 100, Stop: 99.9})
+	require.NoError(t, err)
+	_, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", size)
+	require.NoError(t, err)
+}
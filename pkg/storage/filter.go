@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+)
+
+// condition is the SQL form of a filter, an empty condition is matched in memory
+type condition struct {
+	where string
+	args  []interface{}
+}
+
+// OrderFilter selects orders. SQL backends use its condition with the table indexes,
+// the other backends call Match.
+type OrderFilter struct {
+	condition
+	Match func(model.Order) bool
+}
+
+type PositionFilter struct {
+	condition
+	Match func(model.Position) bool
+}
+
+type TradeFilter struct {
+	condition
+	Match func(model.Trade) bool
+}
+
+type BracketFilter struct {
+	condition
+	Match func(model.Bracket) bool
+}
+
+// OrderFilterFunc creates a filter without SQL condition, matched in memory by all backends
+func OrderFilterFunc(match func(model.Order) bool) OrderFilter {
+	return OrderFilter{Match: match}
+}
+
+func PositionFilterFunc(match func(model.Position) bool) PositionFilter {
+	return PositionFilter{Match: match}
+}
+
+func TradeFilterFunc(match func(model.Trade) bool) TradeFilter {
+	return TradeFilter{Match: match}
+}
+
+func BracketFilterFunc(match func(model.Bracket) bool) BracketFilter {
+	return BracketFilter{Match: match}
+}
+
+func placeholders(size int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", size), ",")
+}
+
+func WithStatusIn(status ...model.OrderStatusType) OrderFilter {
+	args := make([]interface{}, 0, len(status))
+	for _, s := range status {
+		args = append(args, string(s))
+	}
+
+	return OrderFilter{
+		condition: condition{"status IN (" + placeholders(len(status)) + ")", args},
+		Match: func(order model.Order) bool {
+			for _, s := range status {
+				if s == order.Status {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+func WithStatus(status model.OrderStatusType) OrderFilter {
+	return OrderFilter{
+		condition: condition{"status = ?", []interface{}{string(status)}},
+		Match: func(order model.Order) bool {
+			return order.Status == status
+		},
+	}
+}
+
+func WithPair(pair string) OrderFilter {
+	return OrderFilter{
+		condition: condition{"pair = ?", []interface{}{pair}},
+		Match: func(order model.Order) bool {
+			return order.Pair == pair
+		},
+	}
+}
+
+func WithClientOrderID(id string) OrderFilter {
+	return OrderFilter{
+		condition: condition{"client_order_id = ?", []interface{}{id}},
+		Match: func(order model.Order) bool {
+			return order.ClientOrderID == id
+		},
+	}
+}
+
+func WithUpdateAtBeforeOrEqual(time time.Time) OrderFilter {
+	return OrderFilter{
+		condition: condition{"updated_at <= ?", []interface{}{time.UnixNano()}},
+		Match: func(order model.Order) bool {
+			return !order.UpdatedAt.After(time)
+		},
+	}
+}
+
+func WithPositionPair(pair string) PositionFilter {
+	return PositionFilter{
+		condition: condition{"pair = ?", []interface{}{pair}},
+		Match: func(position model.Position) bool {
+			return position.Pair == pair
+		},
+	}
+}
+
+func WithPositionStatus(status model.PositionStatusType) PositionFilter {
+	return PositionFilter{
+		condition: condition{"status = ?", []interface{}{string(status)}},
+		Match: func(position model.Position) bool {
+			return position.Status == status
+		},
+	}
+}
+
+func WithTradePair(pair string) TradeFilter {
+	return TradeFilter{
+		condition: condition{"pair = ?", []interface{}{pair}},
+		Match: func(trade model.Trade) bool {
+			return trade.Pair == pair
+		},
+	}
+}
+
+func WithTradePosition(id int64) TradeFilter {
+	return TradeFilter{
+		condition: condition{"position_id = ?", []interface{}{id}},
+		Match: func(trade model.Trade) bool {
+			return trade.PositionID == id
+		},
+	}
+}
+
+func WithBracketStatusIn(status ...model.BracketStatusType) BracketFilter {
+	args := make([]interface{}, 0, len(status))
+	for _, s := range status {
+		args = append(args, string(s))
+	}
+
+	return BracketFilter{
+		condition: condition{"status IN (" + placeholders(len(status)) + ")", args},
+		Match: func(bracket model.Bracket) bool {
+			for _, s := range status {
+				if s == bracket.Status {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+func WithBracketPair(pair string) BracketFilter {
+	return BracketFilter{
+		condition: condition{"pair = ?", []interface{}{pair}},
+		Match: func(bracket model.Bracket) bool {
+			return bracket.Pair == pair
+		},
+	}
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MigrateBunt copies the orders, positions, trades and brackets of a buntdb file into a sqlite
+// database, keeping their ids. The copy is done in a single transaction.
+func MigrateBunt(source, target string) error {
+	if _, err := os.Stat(source); err != nil {
+		return err
+	}
+
+	bunt, err := new(source)
+	if err != nil {
+		return err
+	}
+	defer bunt.(*Bunt).db.Close()
+
+	sqlite, err := newSQLite(target)
+	if err != nil {
+		return err
+	}
+	defer sqlite.Close()
+
+	orders, err := bunt.Orders()
+	if err != nil {
+		return err
+	}
+
+	positions, err := bunt.Positions()
+	if err != nil {
+		return err
+	}
+
+	trades, err := bunt.Trades()
+	if err != nil {
+		return err
+	}
+
+	brackets, err := bunt.Brackets()
+	if err != nil {
+		return err
+	}
+
+	tx, err := sqlite.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	insert := func(table, columns string, values []interface{}) error {
+		_, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, columns,
+			placeholders(len(values))), values...)
+		if err != nil {
+			return fmt.Errorf("migrate %s: %w", strings.TrimSuffix(table, "s"), err)
+		}
+		return nil
+	}
+
+	err = func() error {
+		for _, order := range orders {
+			if err := insert("orders", orderColumns, orderValues(order)); err != nil {
+				return err
+			}
+		}
+		for _, position := range positions {
+			if err := insert("positions", positionColumns, positionValues(position)); err != nil {
+				return err
+			}
+		}
+		for _, trade := range trades {
+			if err := insert("trades", tradeColumns, tradeValues(trade)); err != nil {
+				return err
+			}
+		}
+		for _, bracket := range brackets {
+			if err := insert("brackets", bracketColumns, bracketValues(bracket)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
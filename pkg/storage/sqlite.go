@@ -0,0 +1,565 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+
+	// pure go driver, registered as "sqlite"
+	_ "modernc.org/sqlite"
+)
+
+// migrations are applied in order, the schema version is kept in the user_version pragma
+var migrations = []string{
+	`CREATE TABLE orders (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		exchange_id INTEGER NOT NULL,
+		pair        TEXT    NOT NULL,
+		side        TEXT    NOT NULL,
+		type        TEXT    NOT NULL,
+		status      TEXT    NOT NULL,
+		price       REAL    NOT NULL,
+		quantity    REAL    NOT NULL,
+		fee         REAL    NOT NULL DEFAULT 0,
+		fee_asset   TEXT    NOT NULL DEFAULT '',
+		created_at  INTEGER NOT NULL,
+		updated_at  INTEGER NOT NULL,
+		stop        REAL,
+		group_id    INTEGER
+	);
+	CREATE INDEX orders_status_index ON orders (status);
+	CREATE INDEX orders_pair_index ON orders (pair);
+	CREATE INDEX orders_updated_at_index ON orders (updated_at);
+	CREATE INDEX orders_exchange_id_index ON orders (exchange_id);`,
+
+	`CREATE TABLE positions (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		pair         TEXT    NOT NULL,
+		status       TEXT    NOT NULL,
+		quantity     REAL    NOT NULL,
+		avg_price    REAL    NOT NULL,
+		entry_fee    REAL    NOT NULL,
+		fees         REAL    NOT NULL,
+		realized_pnl REAL    NOT NULL,
+		opened_at    INTEGER NOT NULL,
+		updated_at   INTEGER NOT NULL,
+		closed_at    INTEGER
+	);
+	CREATE INDEX positions_pair_status_index ON positions (pair, status);
+	CREATE INDEX positions_updated_at_index ON positions (updated_at);
+
+	CREATE TABLE trades (
+		id             INTEGER PRIMARY KEY AUTOINCREMENT,
+		position_id    INTEGER NOT NULL REFERENCES positions (id),
+		order_id       INTEGER NOT NULL,
+		pair           TEXT    NOT NULL,
+		quantity       REAL    NOT NULL,
+		entry_price    REAL    NOT NULL,
+		exit_price     REAL    NOT NULL,
+		fee            REAL    NOT NULL,
+		profit         REAL    NOT NULL,
+		profit_percent REAL    NOT NULL,
+		opened_at      INTEGER NOT NULL,
+		closed_at      INTEGER NOT NULL
+	);
+	CREATE INDEX trades_pair_index ON trades (pair);
+	CREATE INDEX trades_position_id_index ON trades (position_id);
+	CREATE INDEX trades_closed_at_index ON trades (closed_at);`,
+
+	`ALTER TABLE orders ADD COLUMN executed_quantity REAL NOT NULL DEFAULT 0;`,
+
+	`ALTER TABLE orders ADD COLUMN position_side TEXT NOT NULL DEFAULT '';
+	ALTER TABLE positions ADD COLUMN side TEXT NOT NULL DEFAULT '';`,
+
+	`ALTER TABLE orders ADD COLUMN trailing_rate REAL;
+	ALTER TABLE orders ADD COLUMN trailing_offset REAL;`,
+
+	`CREATE TABLE brackets (
+		id             INTEGER PRIMARY KEY AUTOINCREMENT,
+		pair           TEXT    NOT NULL,
+		side           TEXT    NOT NULL,
+		status         TEXT    NOT NULL,
+		quantity       REAL    NOT NULL,
+		entry          REAL    NOT NULL,
+		take_profit    REAL    NOT NULL,
+		stop           REAL    NOT NULL,
+		stop_limit     REAL    NOT NULL,
+		entry_id       INTEGER NOT NULL,
+		take_profit_id INTEGER NOT NULL,
+		stop_id        INTEGER NOT NULL,
+		created_at     INTEGER NOT NULL,
+		updated_at     INTEGER NOT NULL
+	);
+	CREATE INDEX brackets_status_index ON brackets (status);`,
+
+	`ALTER TABLE orders ADD COLUMN client_order_id TEXT NOT NULL DEFAULT '';
+	CREATE INDEX orders_client_order_id_index ON orders (client_order_id);`,
+}
+
+const (
+	orderColumns = "id, exchange_id, pair, side, type, status, price, quantity, executed_quantity, fee, fee_asset, " +
+		"created_at, updated_at, stop, group_id, position_side, trailing_rate, trailing_offset, client_order_id"
+	positionColumns = "id, pair, status, quantity, avg_price, entry_fee, fees, realized_pnl, " +
+		"opened_at, updated_at, closed_at, side"
+	tradeColumns = "id, position_id, order_id, pair, quantity, entry_price, exit_price, fee, profit, " +
+		"profit_percent, opened_at, closed_at"
+	bracketColumns = "id, pair, side, status, quantity, entry, take_profit, stop, stop_limit, " +
+		"entry_id, take_profit_id, stop_id, created_at, updated_at"
+)
+
+// SQLite keeps the records in tables, times are stored as unix nanoseconds
+type SQLite struct {
+	db *sql.DB
+}
+
+// FromSQLite opens or creates a sqlite database and applies the pending migrations
+func FromSQLite(file string) (Storage, error) {
+	return newSQLite(file)
+}
+
+func newSQLite(file string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", file)
+	if err != nil {
+		return nil, err
+	}
+
+	// a single connection serializes the writes and keeps in memory databases alive
+	db.SetMaxOpenConns(1)
+
+	storage := &SQLite{db: db}
+	if err := storage.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return storage, nil
+}
+
+func (s *SQLite) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqlite migration %d: %w", version+1, err)
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the database file
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(value int64) time.Time {
+	if value == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, value).UTC()
+}
+
+// where joins the SQL conditions of the filters
+func where(conditions []condition) (string, []interface{}) {
+	clauses := make([]string, 0, len(conditions))
+	args := make([]interface{}, 0)
+	for _, condition := range conditions {
+		if condition.where == "" {
+			continue
+		}
+		clauses = append(clauses, condition.where)
+		args = append(args, condition.args...)
+	}
+
+	if len(clauses) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (s *SQLite) CreateOrder(order *model.Order) error {
+	values := orderValues(order)[1:]
+	result, err := s.db.Exec(
+		"INSERT INTO orders ("+strings.TrimPrefix(orderColumns, "id, ")+") VALUES ("+placeholders(len(values))+")",
+		values...)
+	if err != nil {
+		return err
+	}
+
+	order.ID, err = result.LastInsertId()
+	return err
+}
+
+func (s *SQLite) UpdateOrder(order *model.Order) error {
+	values := orderValues(order)
+	_, err := s.db.Exec(`UPDATE orders SET exchange_id = ?, pair = ?, side = ?, type = ?, status = ?,
+		price = ?, quantity = ?, executed_quantity = ?, fee = ?, fee_asset = ?, created_at = ?, updated_at = ?,
+		stop = ?, group_id = ?, position_side = ?, trailing_rate = ?, trailing_offset = ?,
+		client_order_id = ? WHERE id = ?`, append(values[1:], order.ID)...)
+	return err
+}
+
+func orderValues(order *model.Order) []interface{} {
+	var (
+		stop           sql.NullFloat64
+		groupID        sql.NullInt64
+		trailingRate   sql.NullFloat64
+		trailingOffset sql.NullFloat64
+	)
+	if order.Stop != nil {
+		stop = sql.NullFloat64{Float64: *order.Stop, Valid: true}
+	}
+	if order.GroupID != nil {
+		groupID = sql.NullInt64{Int64: *order.GroupID, Valid: true}
+	}
+	if order.Trailing != nil {
+		trailingRate = sql.NullFloat64{Float64: order.Trailing.Rate, Valid: true}
+		trailingOffset = sql.NullFloat64{Float64: order.Trailing.Offset, Valid: true}
+	}
+
+	return []interface{}{
+		order.ID, order.ExchangeID, order.Pair, string(order.Side), string(order.Type), string(order.Status),
+		order.Price, order.Quantity, order.ExecutedQuantity, order.Fee, order.FeeAsset,
+		unixNano(order.CreatedAt), unixNano(order.UpdatedAt), stop, groupID, string(order.PositionSide),
+		trailingRate, trailingOffset, order.ClientOrderID,
+	}
+}
+
+func scanOrder(row scanner) (*model.Order, error) {
+	var (
+		order                model.Order
+		createdAt, updatedAt int64
+		stop                 sql.NullFloat64
+		groupID              sql.NullInt64
+		trailingRate         sql.NullFloat64
+		trailingOffset       sql.NullFloat64
+	)
+
+	err := row.Scan(&order.ID, &order.ExchangeID, &order.Pair, &order.Side, &order.Type, &order.Status,
+		&order.Price, &order.Quantity, &order.ExecutedQuantity, &order.Fee, &order.FeeAsset, &createdAt, &updatedAt, &stop, &groupID,
+		&order.PositionSide, &trailingRate, &trailingOffset, &order.ClientOrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	order.CreatedAt = fromUnixNano(createdAt)
+	order.UpdatedAt = fromUnixNano(updatedAt)
+	if stop.Valid {
+		order.Stop = &stop.Float64
+	}
+	if groupID.Valid {
+		order.GroupID = &groupID.Int64
+	}
+	if trailingRate.Valid || trailingOffset.Valid {
+		order.Trailing = &model.Trailing{Rate: trailingRate.Float64, Offset: trailingOffset.Float64}
+	}
+	return &order, nil
+}
+
+func (s *SQLite) Orders(filters ...OrderFilter) ([]*model.Order, error) {
+	conditions := make([]condition, 0, len(filters))
+	for _, filter := range filters {
+		conditions = append(conditions, filter.condition)
+	}
+	clause, args := where(conditions)
+
+	rows, err := s.db.Query("SELECT "+orderColumns+" FROM orders"+clause+" ORDER BY updated_at, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]*model.Order, 0)
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		matched := true
+		for _, filter := range filters {
+			if filter.where == "" && !filter.Match(*order) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			orders = append(orders, order)
+		}
+	}
+	return orders, rows.Err()
+}
+
+func (s *SQLite) CreatePosition(position *model.Position) error {
+	values := positionValues(position)[1:]
+	result, err := s.db.Exec(
+		"INSERT INTO positions ("+strings.TrimPrefix(positionColumns, "id, ")+") VALUES ("+placeholders(len(values))+")",
+		values...)
+	if err != nil {
+		return err
+	}
+
+	position.ID, err = result.LastInsertId()
+	return err
+}
+
+func (s *SQLite) UpdatePosition(position *model.Position) error {
+	values := positionValues(position)
+	_, err := s.db.Exec(`UPDATE positions SET pair = ?, status = ?, quantity = ?, avg_price = ?, entry_fee = ?,
+		fees = ?, realized_pnl = ?, opened_at = ?, updated_at = ?, closed_at = ?, side = ? WHERE id = ?`,
+		append(values[1:], position.ID)...)
+	return err
+}
+
+func positionValues(position *model.Position) []interface{} {
+	var closedAt sql.NullInt64
+	if position.ClosedAt != nil {
+		closedAt = sql.NullInt64{Int64: unixNano(*position.ClosedAt), Valid: true}
+	}
+
+	return []interface{}{
+		position.ID, position.Pair, string(position.Status), position.Quantity, position.AvgPrice,
+		position.EntryFee, position.Fees, position.RealizedPnL,
+		unixNano(position.OpenedAt), unixNano(position.UpdatedAt), closedAt, string(position.Side),
+	}
+}
+
+func scanPosition(row scanner) (*model.Position, error) {
+	var (
+		position            model.Position
+		openedAt, updatedAt int64
+		closedAt            sql.NullInt64
+	)
+
+	err := row.Scan(&position.ID, &position.Pair, &position.Status, &position.Quantity, &position.AvgPrice,
+		&position.EntryFee, &position.Fees, &position.RealizedPnL, &openedAt, &updatedAt, &closedAt,
+		&position.Side)
+	if err != nil {
+		return nil, err
+	}
+
+	position.OpenedAt = fromUnixNano(openedAt)
+	position.UpdatedAt = fromUnixNano(updatedAt)
+	if closedAt.Valid {
+		value := fromUnixNano(closedAt.Int64)
+		position.ClosedAt = &value
+	}
+	return &position, nil
+}
+
+func (s *SQLite) Positions(filters ...PositionFilter) ([]*model.Position, error) {
+	conditions := make([]condition, 0, len(filters))
+	for _, filter := range filters {
+		conditions = append(conditions, filter.condition)
+	}
+	clause, args := where(conditions)
+
+	rows, err := s.db.Query("SELECT "+positionColumns+" FROM positions"+clause+" ORDER BY updated_at, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	positions := make([]*model.Position, 0)
+	for rows.Next() {
+		position, err := scanPosition(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		matched := true
+		for _, filter := range filters {
+			if filter.where == "" && !filter.Match(*position) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			positions = append(positions, position)
+		}
+	}
+	return positions, rows.Err()
+}
+
+func (s *SQLite) CreateTrade(trade *model.Trade) error {
+	result, err := s.db.Exec(
+		"INSERT INTO trades ("+strings.TrimPrefix(tradeColumns, "id, ")+") VALUES (?,?,?,?,?,?,?,?,?,?,?)",
+		tradeValues(trade)[1:]...)
+	if err != nil {
+		return err
+	}
+
+	trade.ID, err = result.LastInsertId()
+	return err
+}
+
+func tradeValues(trade *model.Trade) []interface{} {
+	return []interface{}{
+		trade.ID, trade.PositionID, trade.OrderID, trade.Pair, trade.Quantity, trade.EntryPrice,
+		trade.ExitPrice, trade.Fee, trade.Profit, trade.ProfitPercent,
+		unixNano(trade.OpenedAt), unixNano(trade.ClosedAt),
+	}
+}
+
+func scanTrade(row scanner) (*model.Trade, error) {
+	var (
+		trade              model.Trade
+		openedAt, closedAt int64
+	)
+
+	err := row.Scan(&trade.ID, &trade.PositionID, &trade.OrderID, &trade.Pair, &trade.Quantity,
+		&trade.EntryPrice, &trade.ExitPrice, &trade.Fee, &trade.Profit, &trade.ProfitPercent, &openedAt, &closedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	trade.OpenedAt = fromUnixNano(openedAt)
+	trade.ClosedAt = fromUnixNano(closedAt)
+	return &trade, nil
+}
+
+func (s *SQLite) Trades(filters ...TradeFilter) ([]*model.Trade, error) {
+	conditions := make([]condition, 0, len(filters))
+	for _, filter := range filters {
+		conditions = append(conditions, filter.condition)
+	}
+	clause, args := where(conditions)
+
+	rows, err := s.db.Query("SELECT "+tradeColumns+" FROM trades"+clause+" ORDER BY closed_at, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trades := make([]*model.Trade, 0)
+	for rows.Next() {
+		trade, err := scanTrade(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		matched := true
+		for _, filter := range filters {
+			if filter.where == "" && !filter.Match(*trade) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			trades = append(trades, trade)
+		}
+	}
+	return trades, rows.Err()
+}
+
+func (s *SQLite) CreateBracket(bracket *model.Bracket) error {
+	values := bracketValues(bracket)[1:]
+	result, err := s.db.Exec(
+		"INSERT INTO brackets ("+strings.TrimPrefix(bracketColumns, "id, ")+") VALUES ("+placeholders(len(values))+")",
+		values...)
+	if err != nil {
+		return err
+	}
+
+	bracket.ID, err = result.LastInsertId()
+	return err
+}
+
+func (s *SQLite) UpdateBracket(bracket *model.Bracket) error {
+	values := bracketValues(bracket)
+	_, err := s.db.Exec(`UPDATE brackets SET pair = ?, side = ?, status = ?, quantity = ?, entry = ?,
+		take_profit = ?, stop = ?, stop_limit = ?, entry_id = ?, take_profit_id = ?, stop_id = ?,
+		created_at = ?, updated_at = ? WHERE id = ?`, append(values[1:], bracket.ID)...)
+	return err
+}
+
+func bracketValues(bracket *model.Bracket) []interface{} {
+	return []interface{}{
+		bracket.ID, bracket.Pair, string(bracket.Side), string(bracket.Status), bracket.Quantity,
+		bracket.Entry, bracket.TakeProfit, bracket.Stop, bracket.StopLimit,
+		bracket.EntryID, bracket.TakeProfitID, bracket.StopID,
+		unixNano(bracket.CreatedAt), unixNano(bracket.UpdatedAt),
+	}
+}
+
+func scanBracket(row scanner) (*model.Bracket, error) {
+	var (
+		bracket              model.Bracket
+		createdAt, updatedAt int64
+	)
+
+	err := row.Scan(&bracket.ID, &bracket.Pair, &bracket.Side, &bracket.Status, &bracket.Quantity,
+		&bracket.Entry, &bracket.TakeProfit, &bracket.Stop, &bracket.StopLimit,
+		&bracket.EntryID, &bracket.TakeProfitID, &bracket.StopID, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	bracket.CreatedAt = fromUnixNano(createdAt)
+	bracket.UpdatedAt = fromUnixNano(updatedAt)
+	return &bracket, nil
+}
+
+func (s *SQLite) Brackets(filters ...BracketFilter) ([]*model.Bracket, error) {
+	conditions := make([]condition, 0, len(filters))
+	for _, filter := range filters {
+		conditions = append(conditions, filter.condition)
+	}
+	clause, args := where(conditions)
+
+	rows, err := s.db.Query("SELECT "+bracketColumns+" FROM brackets"+clause+" ORDER BY updated_at, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	brackets := make([]*model.Bracket, 0)
+	for rows.Next() {
+		bracket, err := scanBracket(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		matched := true
+		for _, filter := range filters {
+			if filter.where == "" && !filter.Match(*bracket) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			brackets = append(brackets, bracket)
+		}
+	}
+	return brackets, rows.Err()
+}
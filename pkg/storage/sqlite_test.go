@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLite(t *testing.T) {
+	now := time.Now()
+	repo, err := FromSQLite(":memory:")
+	require.NoError(t, err)
+
+	stop := 9.0
+	groupID := int64(7)
+	firstOrder := &model.Order{
+		ExchangeID: 1,
+		Pair:       "BTCUSDT",
+		Side:       model.SideTypeBuy,
+		Type:       model.OrderTypeLimit,
+		Status:     model.OrderStatusTypeNew,
+		Price:      10,
+		Quantity:   1,
+		CreatedAt:  now.Add(-time.Minute),
+		UpdatedAt:  now.Add(-time.Minute),
+		Stop:       &stop,
+		GroupID:    &groupID,
+
+		ClientOrderID: "tradebot-1",
+	}
+	require.NoError(t, repo.CreateOrder(firstOrder))
+
+	secondOrder := &model.Order{
+		ExchangeID: 2,
+		Pair:       "ETHUSDT",
+		Side:       model.SideTypeBuy,
+		Type:       model.OrderTypeLimit,
+		Status:     model.OrderStatusTypeFilled,
+		Price:      10,
+		Quantity:   1,
+		Fee:        0.01,
+		FeeAsset:   "USDT",
+		CreatedAt:  now.Add(time.Minute),
+		UpdatedAt:  now.Add(time.Minute),
+	}
+	require.NoError(t, repo.CreateOrder(secondOrder))
+
+	t.Run("filter with date restriction", func(t *testing.T) {
+		orders, err := repo.Orders(WithUpdateAtBeforeOrEqual(now))
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Equal(t, int64(1), orders[0].ExchangeID)
+		require.Equal(t, stop, *orders[0].Stop)
+		require.Equal(t, groupID, *orders[0].GroupID)
+		require.True(t, firstOrder.UpdatedAt.Equal(orders[0].UpdatedAt))
+		require.Equal(t, time.UTC, orders[0].UpdatedAt.Location())
+	})
+
+	t.Run("get all", func(t *testing.T) {
+		orders, err := repo.Orders()
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+		require.Equal(t, int64(1), orders[0].ExchangeID)
+		require.Equal(t, int64(2), orders[1].ExchangeID)
+		require.Nil(t, orders[1].Stop)
+		require.Equal(t, "USDT", orders[1].FeeAsset)
+	})
+
+	t.Run("filter by client order id", func(t *testing.T) {
+		orders, err := repo.Orders(WithClientOrderID("tradebot-1"))
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Equal(t, firstOrder.ID, orders[0].ID)
+		require.Equal(t, "tradebot-1", orders[0].ClientOrderID)
+	})
+
+	t.Run("combined filters", func(t *testing.T) {
+		orders, err := repo.Orders(WithStatusIn(model.OrderStatusTypeNew, model.OrderStatusTypeFilled),
+			WithPair("ETHUSDT"))
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Equal(t, secondOrder.ID, orders[0].ID)
+
+		orders, err = repo.Orders(OrderFilterFunc(func(order model.Order) bool {
+			return order.Price*order.Quantity > 5
+		}), WithPair("BTCUSDT"))
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Equal(t, firstOrder.ID, orders[0].ID)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		firstOrder.Status = model.OrderStatusTypeCanceled
+		firstOrder.ExecutedQuantity = 0.5
+		require.NoError(t, repo.UpdateOrder(firstOrder))
+
+		orders, err := repo.Orders(WithStatus(model.OrderStatusTypeCanceled))
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Equal(t, firstOrder.ID, orders[0].ID)
+		require.Equal(t, 0.5, orders[0].ExecutedQuantity)
+	})
+
+	t.Run("trailing stop", func(t *testing.T) {
+		stop := 90.0
+		order := &model.Order{ExchangeID: 3, Pair: "BTCUSDT", Side: model.SideTypeSell,
+			Type: model.OrderTypeTrailingStop, Status: model.OrderStatusTypeNew, Price: stop, Quantity: 1,
+			Stop: &stop, Trailing: &model.Trailing{Rate: 0.1}, CreatedAt: now, UpdatedAt: now}
+		require.NoError(t, repo.CreateOrder(order))
+
+		moved := 108.0
+		order.Stop = &moved
+		require.NoError(t, repo.UpdateOrder(order))
+
+		orders, err := repo.Orders(OrderFilterFunc(func(o model.Order) bool {
+			return o.ID == order.ID
+		}))
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Equal(t, &model.Trailing{Rate: 0.1}, orders[0].Trailing)
+		require.Equal(t, 108.0, *orders[0].Stop)
+
+		orders, err = repo.Orders(WithPair("ETHUSDT"))
+		require.NoError(t, err)
+		require.Nil(t, orders[0].Trailing)
+	})
+
+	t.Run("positions and trades", func(t *testing.T) {
+		position := &model.Position{Pair: "BTCUSDT", Status: model.PositionStatusTypeOpen, Quantity: 1,
+			AvgPrice: 10, Side: model.PositionSideTypeShort, OpenedAt: now, UpdatedAt: now}
+		require.NoError(t, repo.CreatePosition(position))
+
+		closedAt := now.Add(time.Hour)
+		position.Status = model.PositionStatusTypeClosed
+		position.ClosedAt = &closedAt
+		require.NoError(t, repo.UpdatePosition(position))
+
+		positions, err := repo.Positions(WithPositionPair("BTCUSDT"), WithPositionStatus(model.PositionStatusTypeClosed))
+		require.NoError(t, err)
+		require.Len(t, positions, 1)
+		require.True(t, closedAt.Equal(*positions[0].ClosedAt))
+		require.True(t, positions[0].IsShort())
+
+		trade := &model.Trade{PositionID: position.ID, Pair: "BTCUSDT", Quantity: 1, EntryPrice: 10,
+			ExitPrice: 12, Profit: 2, OpenedAt: now, ClosedAt: closedAt}
+		require.NoError(t, repo.CreateTrade(trade))
+
+		trades, err := repo.Trades(WithTradePosition(position.ID))
+		require.NoError(t, err)
+		require.Len(t, trades, 1)
+		require.Equal(t, time.Hour, trades[0].HoldingTime())
+	})
+}
+
+func TestMigrateBunt(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "bot.db")
+	target := filepath.Join(dir, "bot.sqlite")
+
+	bunt, err := FromFile(source)
+	require.NoError(t, err)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		order := &model.Order{ExchangeID: int64(i), Pair: "BTCUSDT", Status: model.OrderStatusTypeFilled,
+			UpdatedAt: now.Add(time.Duration(i) * time.Minute)}
+		require.NoError(t, bunt.CreateOrder(order))
+	}
+	position := &model.Position{Pair: "BTCUSDT", Status: model.PositionStatusTypeOpen, UpdatedAt: now}
+	require.NoError(t, bunt.CreatePosition(position))
+	require.NoError(t, bunt.CreateTrade(&model.Trade{PositionID: position.ID, Pair: "BTCUSDT", ClosedAt: now}))
+	require.NoError(t, bunt.CreateBracket(&model.Bracket{Pair: "BTCUSDT", Status: model.BracketStatusTypeOpen,
+		EntryID: 1, TakeProfitID: 2, StopID: 3, UpdatedAt: now}))
+	require.NoError(t, bunt.(*Bunt).db.Close())
+
+	require.NoError(t, MigrateBunt(source, target))
+
+	repo, err := FromSQLite(target)
+	require.NoError(t, err)
+	orders, err := repo.Orders(WithPair("BTCUSDT"))
+	require.NoError(t, err)
+	require.Len(t, orders, 3)
+	require.Equal(t, int64(3), orders[2].ID)
+
+	positions, err := repo.Positions()
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+
+	trades, err := repo.Trades(WithTradePosition(position.ID))
+	require.NoError(t, err)
+	require.Len(t, trades, 1)
+
+	brackets, err := repo.Brackets(WithBracketStatusIn(model.BracketStatusTypeOpen))
+	require.NoError(t, err)
+	require.Len(t, brackets, 1)
+	require.Equal(t, int64(3), brackets[0].StopID)
+	require.Equal(t, now.UnixNano(), brackets[0].UpdatedAt.UnixNano())
+
+	// new records continue the migrated sequences
+	order := &model.Order{Pair: "BTCUSDT"}
+	require.NoError(t, repo.CreateOrder(order))
+	require.Equal(t, int64(4), order.ID)
+
+	require.Error(t, MigrateBunt(filepath.Join(dir, "missing.db"), target))
+}
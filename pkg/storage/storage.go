@@ -4,22 +4,38 @@ import (
 	"encoding/json"
 	"log"
 	"strconv"
+	"strings"
 	"sync/atomic"
-	"time"
 
 	"github.com/lynbklk/tradebot/pkg/model"
 
 	"github.com/tidwall/buntdb"
 )
 
-type OrderFilter func(model.Order) bool
-
 type Storage interface {
 	CreateOrder(order *model.Order) error
 	UpdateOrder(order *model.Order) error
 	Orders(filters ...OrderFilter) ([]*model.Order, error)
+
+	CreatePosition(position *model.Position) error
+	UpdatePosition(position *model.Position) error
+	Positions(filters ...PositionFilter) ([]*model.Position, error)
+
+	CreateTrade(trade *model.Trade) error
+	Trades(filters ...TradeFilter) ([]*model.Trade, error)
+
+	CreateBracket(bracket *model.Bracket) error
+	UpdateBracket(bracket *model.Bracket) error
+	Brackets(filters ...BracketFilter) ([]*model.Bracket, error)
 }
 
+// keys of positions, trades and brackets are prefixed, orders keep the plain id
+const (
+	positionPrefix = "position:"
+	tradePrefix    = "trade:"
+	bracketPrefix  = "bracket:"
+)
+
 func FromMemory() (Storage, error) {
 	return new(":memory:")
 }
@@ -29,8 +45,11 @@ func FromFile(file string) (Storage, error) {
 }
 
 type Bunt struct {
-	lastID int64
-	db     *buntdb.DB
+	lastID         int64
+	lastPositionID int64
+	lastTradeID    int64
+	lastBracketID  int64
+	db             *buntdb.DB
 }
 
 func new(sourceFile string) (Storage, error) {
@@ -44,46 +63,82 @@ func new(sourceFile string) (Storage, error) {
 		return nil, err
 	}
 
-	return &Bunt{
+	err = db.CreateIndex("position_index", positionPrefix+"*", buntdb.IndexJSON("updated_at"))
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.CreateIndex("trade_index", tradePrefix+"*", buntdb.IndexJSON("closed_at"))
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.CreateIndex("bracket_index", bracketPrefix+"*", buntdb.IndexJSON("updated_at"))
+	if err != nil {
+		return nil, err
+	}
+
+	bunt := &Bunt{
 		db: db,
-	}, nil
+	}
+	return bunt, bunt.loadLastIDs()
+}
+
+// loadLastIDs continues the sequences of a database file
+func (b *Bunt) loadLastIDs() error {
+	return b.db.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys("*", func(key, _ string) bool {
+			last, value := &b.lastID, key
+			if strings.HasPrefix(key, positionPrefix) {
+				last, value = &b.lastPositionID, strings.TrimPrefix(key, positionPrefix)
+			} else if strings.HasPrefix(key, tradePrefix) {
+				last, value = &b.lastTradeID, strings.TrimPrefix(key, tradePrefix)
+			} else if strings.HasPrefix(key, bracketPrefix) {
+				last, value = &b.lastBracketID, strings.TrimPrefix(key, bracketPrefix)
+			}
+
+			if id, err := strconv.ParseInt(value, 10, 64); err == nil && id > *last {
+				*last = id
+			}
+			return true
+		})
+	})
 }
 
 func (b *Bunt) getID() int64 {
 	return atomic.AddInt64(&b.lastID, 1)
 }
 
-func (b *Bunt) CreateOrder(order *model.Order) error {
+func (b *Bunt) set(key string, value interface{}) error {
 	return b.db.Update(func(tx *buntdb.Tx) error {
-		order.ID = b.getID()
-		content, err := json.Marshal(order)
+		content, err := json.Marshal(value)
 		if err != nil {
 			return err
 		}
 
-		_, _, err = tx.Set(strconv.FormatInt(order.ID, 10), string(content), nil)
+		_, _, err = tx.Set(key, string(content), nil)
 		return err
 	})
 }
 
-func (b Bunt) UpdateOrder(order *model.Order) error {
-	return b.db.Update(func(tx *buntdb.Tx) error {
-		id := strconv.FormatInt(order.ID, 10)
-
-		content, err := json.Marshal(order)
-		if err != nil {
-			return err
-		}
+func (b *Bunt) CreateOrder(order *model.Order) error {
+	order.ID = b.getID()
+	return b.set(strconv.FormatInt(order.ID, 10), order)
+}
 
-		_, _, err = tx.Set(id, string(content), nil)
-		return err
-	})
+func (b Bunt) UpdateOrder(order *model.Order) error {
+	return b.set(strconv.FormatInt(order.ID, 10), order)
 }
 
 func (b Bunt) Orders(filters ...OrderFilter) ([]*model.Order, error) {
 	orders := make([]*model.Order, 0)
 	err := b.db.View(func(tx *buntdb.Tx) error {
 		err := tx.Ascend("update_index", func(key, value string) bool {
+			if strings.HasPrefix(key, positionPrefix) || strings.HasPrefix(key, tradePrefix) ||
+				strings.HasPrefix(key, bracketPrefix) {
+				return true
+			}
+
 			var order model.Order
 			err := json.Unmarshal([]byte(value), &order)
 			if err != nil {
@@ -92,7 +147,7 @@ func (b Bunt) Orders(filters ...OrderFilter) ([]*model.Order, error) {
 			}
 
 			for _, filter := range filters {
-				if ok := filter(order); !ok {
+				if ok := filter.Match(order); !ok {
 					return true
 				}
 			}
@@ -109,31 +164,106 @@ func (b Bunt) Orders(filters ...OrderFilter) ([]*model.Order, error) {
 	return orders, nil
 }
 
-func WithStatusIn(status ...model.OrderStatusType) OrderFilter {
-	return func(order model.Order) bool {
-		for _, s := range status {
-			if s == order.Status {
+func (b *Bunt) CreatePosition(position *model.Position) error {
+	position.ID = atomic.AddInt64(&b.lastPositionID, 1)
+	return b.set(positionPrefix+strconv.FormatInt(position.ID, 10), position)
+}
+
+func (b *Bunt) UpdatePosition(position *model.Position) error {
+	return b.set(positionPrefix+strconv.FormatInt(position.ID, 10), position)
+}
+
+func (b *Bunt) Positions(filters ...PositionFilter) ([]*model.Position, error) {
+	positions := make([]*model.Position, 0)
+	err := b.db.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("position_index", func(key, value string) bool {
+			var position model.Position
+			err := json.Unmarshal([]byte(value), &position)
+			if err != nil {
+				log.Println(err)
 				return true
 			}
-		}
-		return false
+
+			for _, filter := range filters {
+				if ok := filter.Match(position); !ok {
+					return true
+				}
+			}
+
+			positions = append(positions, &position)
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
+	return positions, nil
 }
 
-func WithStatus(status model.OrderStatusType) OrderFilter {
-	return func(order model.Order) bool {
-		return order.Status == status
-	}
+func (b *Bunt) CreateTrade(trade *model.Trade) error {
+	trade.ID = atomic.AddInt64(&b.lastTradeID, 1)
+	return b.set(tradePrefix+strconv.FormatInt(trade.ID, 10), trade)
 }
 
-func WithPair(pair string) OrderFilter {
-	return func(order model.Order) bool {
-		return order.Pair == pair
+func (b *Bunt) Trades(filters ...TradeFilter) ([]*model.Trade, error) {
+	trades := make([]*model.Trade, 0)
+	err := b.db.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("trade_index", func(key, value string) bool {
+			var trade model.Trade
+			err := json.Unmarshal([]byte(value), &trade)
+			if err != nil {
+				log.Println(err)
+				return true
+			}
+
+			for _, filter := range filters {
+				if ok := filter.Match(trade); !ok {
+					return true
+				}
+			}
+
+			trades = append(trades, &trade)
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
+	return trades, nil
+}
+
+func (b *Bunt) CreateBracket(bracket *model.Bracket) error {
+	bracket.ID = atomic.AddInt64(&b.lastBracketID, 1)
+	return b.set(bracketPrefix+strconv.FormatInt(bracket.ID, 10), bracket)
 }
 
-func WithUpdateAtBeforeOrEqual(time time.Time) OrderFilter {
-	return func(order model.Order) bool {
-		return !order.UpdatedAt.After(time)
+func (b *Bunt) UpdateBracket(bracket *model.Bracket) error {
+	return b.set(bracketPrefix+strconv.FormatInt(bracket.ID, 10), bracket)
+}
+
+func (b *Bunt) Brackets(filters ...BracketFilter) ([]*model.Bracket, error) {
+	brackets := make([]*model.Bracket, 0)
+	err := b.db.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("bracket_index", func(key, value string) bool {
+			var bracket model.Bracket
+			err := json.Unmarshal([]byte(value), &bracket)
+			if err != nil {
+				log.Println(err)
+				return true
+			}
+
+			for _, filter := range filters {
+				if ok := filter.Match(bracket); !ok {
+					return true
+				}
+			}
+
+			brackets = append(brackets, &bracket)
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
+	return brackets, nil
 }
@@ -96,3 +96,106 @@ func TestNewBunt(t *testing.T) {
 		require.Equal(t, firstOrder.Quantity, orders[0].Quantity)
 	})
 }
+
+func TestBunt_Ledger(t *testing.T) {
+	file, err := ioutil.TempFile(os.TempDir(), "*.db")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	now := time.Now()
+	repo, err := FromFile(file.Name())
+	require.NoError(t, err)
+
+	order := &model.Order{Pair: "BTCUSDT", Status: model.OrderStatusTypeFilled, UpdatedAt: now}
+	require.NoError(t, repo.CreateOrder(order))
+
+	position := &model.Position{
+		Pair:      "BTCUSDT",
+		Status:    model.PositionStatusTypeOpen,
+		Quantity:  1,
+		AvgPrice:  10,
+		OpenedAt:  now,
+		UpdatedAt: now,
+	}
+	require.NoError(t, repo.CreatePosition(position))
+	require.Equal(t, int64(1), position.ID)
+
+	trade := &model.Trade{
+		PositionID: position.ID,
+		Pair:       "BTCUSDT",
+		Quantity:   1,
+		EntryPrice: 10,
+		ExitPrice:  12,
+		Profit:     2,
+		OpenedAt:   now,
+		ClosedAt:   now.Add(time.Hour),
+	}
+	require.NoError(t, repo.CreateTrade(trade))
+
+	bracket := &model.Bracket{Pair: "BTCUSDT", Side: model.SideTypeBuy, Status: model.BracketStatusTypePending,
+		Quantity: 1, Entry: 10, TakeProfit: 12, Stop: 9, StopLimit: 8.9, EntryID: order.ID, UpdatedAt: now}
+	require.NoError(t, repo.CreateBracket(bracket))
+	require.Equal(t, int64(1), bracket.ID)
+
+	t.Run("orders ignore ledger records", func(t *testing.T) {
+		orders, err := repo.Orders()
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Equal(t, order.ID, orders[0].ID)
+	})
+
+	t.Run("update position", func(t *testing.T) {
+		position.Status = model.PositionStatusTypeClosed
+		require.NoError(t, repo.UpdatePosition(position))
+
+		positions, err := repo.Positions(WithPositionStatus(model.PositionStatusTypeOpen))
+		require.NoError(t, err)
+		require.Len(t, positions, 0)
+
+		positions, err = repo.Positions(WithPositionPair("BTCUSDT"))
+		require.NoError(t, err)
+		require.Len(t, positions, 1)
+		require.Equal(t, model.PositionStatusTypeClosed, positions[0].Status)
+	})
+
+	t.Run("trades", func(t *testing.T) {
+		trades, err := repo.Trades(WithTradePosition(position.ID))
+		require.NoError(t, err)
+		require.Len(t, trades, 1)
+		require.Equal(t, time.Hour, trades[0].HoldingTime())
+	})
+
+	t.Run("brackets", func(t *testing.T) {
+		bracket.Status = model.BracketStatusTypeOpen
+		bracket.TakeProfitID, bracket.StopID = 2, 3
+		require.NoError(t, repo.UpdateBracket(bracket))
+
+		brackets, err := repo.Brackets(WithBracketStatusIn(model.BracketStatusTypePending))
+		require.NoError(t, err)
+		require.Len(t, brackets, 0)
+
+		brackets, err = repo.Brackets(WithBracketPair("BTCUSDT"))
+		require.NoError(t, err)
+		require.Len(t, brackets, 1)
+		require.Equal(t, model.BracketStatusTypeOpen, brackets[0].Status)
+		require.Equal(t, int64(3), brackets[0].StopID)
+	})
+
+	t.Run("reopen keeps sequences", func(t *testing.T) {
+		require.NoError(t, repo.(*Bunt).db.Close())
+		repo, err = FromFile(file.Name())
+		require.NoError(t, err)
+
+		second := &model.Position{Pair: "ETHUSDT", Status: model.PositionStatusTypeOpen}
+		require.NoError(t, repo.CreatePosition(second))
+		require.Equal(t, int64(2), second.ID)
+
+		next := &model.Order{Pair: "ETHUSDT"}
+		require.NoError(t, repo.CreateOrder(next))
+		require.Equal(t, int64(2), next.ID)
+
+		bracket := &model.Bracket{Pair: "ETHUSDT"}
+		require.NoError(t, repo.CreateBracket(bracket))
+		require.Equal(t, int64(2), bracket.ID)
+	})
+}
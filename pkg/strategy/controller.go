@@ -0,0 +1,109 @@
+package strategy
+
+import (
+	"time"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/indicator"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/util"
+	"github.com/rs/zerolog/log"
+)
+
+// Controller runs a strategy for a single pair
+type Controller struct {
+	pair       string
+	strategy   Strategy
+	trader     exchange.Trader
+	timeframes map[string]*indicator.Indicator
+	duration   time.Duration
+	lastTime   int64
+	started    bool
+}
+
+func NewController(pair string, strategy Strategy, trader exchange.Trader) *Controller {
+	return &Controller{
+		pair:       pair,
+		strategy:   strategy,
+		trader:     trader,
+		timeframes: make(map[string]*indicator.Indicator),
+	}
+}
+
+// AddTimeframe registers an extra timeframe of the pair, exposed in the dataframe of each candle
+func (c *Controller) AddTimeframe(i *indicator.Indicator) {
+	c.timeframes[i.Timeframe] = i
+}
+
+func (c *Controller) Start() error {
+	duration, err := util.TimeframeDuration(c.strategy.Timeframe())
+	if err != nil {
+		return err
+	}
+	c.duration = duration
+
+	if err := c.strategy.OnStart(c.pair, c.trader); err != nil {
+		return err
+	}
+	c.started = true
+	return nil
+}
+
+func (c *Controller) Stop() {
+	if c.started {
+		c.started = false
+		c.strategy.OnStop(c.pair, c.trader)
+	}
+}
+
+// OnIndicator is registered on the indicator agent and receives the dataframe of each closed candle
+func (c *Controller) OnIndicator(i *indicator.Indicator) {
+	df := i.GetDataframe()
+	last := df.Time[len(df.Time)-1].Unix()
+	if last < c.lastTime {
+		log.Error().Msgf("late candle received: %s %d", c.pair, last)
+		return
+	}
+	c.lastTime = last
+
+	if len(df.Close) < c.strategy.WarmupPeriod() {
+		return
+	}
+
+	if len(c.timeframes) > 0 {
+		closeTime := df.Time[len(df.Time)-1].Add(c.duration)
+		views := make(map[string]*model.Dataframe, len(c.timeframes))
+		for timeframe, other := range c.timeframes {
+			view, err := other.Snapshot(closeTime)
+			if err != nil {
+				log.Error().Err(err).Msgf("snapshot %s %s failed.", c.pair, timeframe)
+				return
+			}
+			views[timeframe] = view
+		}
+		// the dataframe is shared with the other subscribers of the indicator, the views
+		// of this controller are set on a copy
+		view := *df
+		view.Timeframes = views
+		df = &view
+	}
+
+	// the dataframe may be read by other controllers while indicators are filled
+	i.Lock()
+	c.strategy.Indicators(df)
+	i.Unlock()
+
+	if c.started {
+		c.strategy.OnCandle(df, c.trader)
+	}
+}
+
+// Watch implements order.Watcher
+func (c *Controller) Watch(order model.Order) {
+	c.strategy.OnOrder(order)
+}
+
+// GetPair implements order.Watcher
+func (c *Controller) GetPair() string {
+	return c.pair
+}
@@ -2,42 +2,59 @@ package strategy
 
 import (
 	"fmt"
-	mapset "github.com/deckarep/golang-set/v2"
+
+	"github.com/lynbklk/tradebot/pkg/exchange"
 	"github.com/lynbklk/tradebot/pkg/indicator"
-	"github.com/lynbklk/tradebot/pkg/util"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/rs/zerolog/log"
 )
 
+var ema45Periods = map[string][]int{
+	"1m": {5, 10, 20, 60},
+	"1h": {2, 4, 12, 24},
+	"1d": {3, 5, 10, 30},
+}
+
 type Ema45Strategy struct {
-	set   mapset.Set[string]
-	agent *indicator.Agent
+	Base
 }
 
-func NewEma45Strategy(agent *indicator.Agent) *Ema45Strategy {
-	return &Ema45Strategy{
-		set:   mapset.NewSet[string](),
-		agent: agent,
-	}
+func NewEma45Strategy() *Ema45Strategy {
+	return &Ema45Strategy{}
 }
 
-func (s *Ema45Strategy) AddIndicators(pair string, timeframe string) {
-	key := util.PairTimeframeToKey(pair, timeframe)
-	if !s.set.Contains(key) {
-		s.set.Add(key)
-	}
+func (s *Ema45Strategy) Timeframe() string {
+	return "1m"
+}
+
+func (s *Ema45Strategy) Timeframes() []string {
+	return []string{"1h", "1d"}
+}
+
+func (s *Ema45Strategy) WarmupPeriod() int {
+	return 60
 }
 
-func (s *Ema45Strategy) Update(indicator *indicator.Indicator) {
-	ema5 := indicator.GetDataframe().Metadata["ema5"].Last(0)
-	close := indicator.GetDataframe().Close.Last(0)
-	fmt.Printf("ema8: %f, close: %f\n", ema5, close)
-	return
+func (s *Ema45Strategy) IndicatorSpecs(timeframe string) []indicator.Spec {
+	specs := make([]indicator.Spec, 0)
+	for _, period := range ema45Periods[timeframe] {
+		specs = append(specs, indicator.EMA(fmt.Sprintf("ema%d", period), period))
+	}
+	return specs
 }
 
-func (s *Ema45Strategy) Run() {
-	keys := s.set.ToSlice()
-	for _, key := range keys {
-		pair, timeframe := util.PairTimeframeFromKey(key)
-		s.agent.Regist(pair, timeframe, s.Update)
+func (s *Ema45Strategy) Indicators(_ *model.Dataframe) {}
+
+func (s *Ema45Strategy) OnCandle(df *model.Dataframe, _ exchange.Trader) {
+	ema5 := df.Metadata["ema5"].Last(0)
+	close := df.Close.Last(0)
+	log.Info().Msgf("%s ema5: %f, close: %f", df.Pair, ema5, close)
+
+	for _, timeframe := range s.Timeframes() {
+		other := df.Timeframes[timeframe]
+		if other == nil || len(other.Close) == 0 {
+			continue
+		}
+		log.Info().Msgf("%s %s close: %f", df.Pair, timeframe, other.Close.Last(0))
 	}
-	s.agent.Run()
 }
@@ -0,0 +1,103 @@
+package strategy
+
+import (
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/indicator"
+	"github.com/lynbklk/tradebot/pkg/model"
+	"github.com/lynbklk/tradebot/pkg/order"
+	"github.com/rs/zerolog/log"
+)
+
+// Runtime hosts strategies on top of an indicator agent. The same runtime is used
+// for live trading (order.Controller), paper trading and backtesting (exchange.PaperWallet).
+type Runtime struct {
+	agent       *indicator.Agent
+	trader      exchange.Trader
+	monitor     order.Monitor
+	controllers map[string][]*Controller
+}
+
+type RuntimeOption func(*Runtime)
+
+// WithOrderMonitor forwards the order updates published by the monitor to the strategies
+func WithOrderMonitor(monitor order.Monitor) RuntimeOption {
+	return func(runtime *Runtime) {
+		runtime.monitor = monitor
+	}
+}
+
+func NewRuntime(agent *indicator.Agent, trader exchange.Trader, options ...RuntimeOption) *Runtime {
+	runtime := &Runtime{
+		agent:       agent,
+		trader:      trader,
+		controllers: make(map[string][]*Controller),
+	}
+	for _, option := range options {
+		option(runtime)
+	}
+	return runtime
+}
+
+// AddStrategy runs the strategy for each one of the given pairs
+func (r *Runtime) AddStrategy(strategy Strategy, pairs ...string) error {
+	timeframes := []string{strategy.Timeframe()}
+	if multi, ok := strategy.(MultiTimeframeStrategy); ok {
+		timeframes = append(timeframes, multi.Timeframes()...)
+	}
+
+	for _, pair := range pairs {
+		controller := NewController(pair, strategy, r.trader)
+		for _, timeframe := range timeframes {
+			i := r.agent.AddIndicator(pair, timeframe)
+			if specs, ok := strategy.(IndicatorStrategy); ok {
+				if err := i.AddSpecs(specs.IndicatorSpecs(timeframe)...); err != nil {
+					return err
+				}
+			}
+			if timeframe == strategy.Timeframe() {
+				i.SetWarmupPeriod(strategy.WarmupPeriod())
+				continue
+			}
+			controller.AddTimeframe(i)
+		}
+
+		r.controllers[pair] = append(r.controllers[pair], controller)
+		r.agent.Regist(pair, strategy.Timeframe(), controller.OnIndicator)
+		if r.monitor != nil {
+			r.monitor.RegistWatcher(controller)
+		}
+	}
+	return nil
+}
+
+// OnOrder dispatches an order update to the strategies of the order pair
+func (r *Runtime) OnOrder(order model.Order) {
+	for _, controller := range r.controllers[order.Pair] {
+		controller.Watch(order)
+	}
+}
+
+// Run starts all strategies and blocks until the data feed finishes
+func (r *Runtime) Run() error {
+	for _, controllers := range r.controllers {
+		for _, controller := range controllers {
+			if err := controller.Start(); err != nil {
+				r.stop()
+				return err
+			}
+		}
+	}
+
+	log.Info().Msg("Strategies started.")
+	r.agent.Run()
+	r.stop()
+	return nil
+}
+
+func (r *Runtime) stop() {
+	for _, controllers := range r.controllers {
+		for _, controller := range controllers {
+			controller.Stop()
+		}
+	}
+}
@@ -1,9 +1,58 @@
 package strategy
 
-import "github.com/lynbklk/tradebot/pkg/indicator"
+import (
+	"github.com/lynbklk/tradebot/pkg/exchange"
+	"github.com/lynbklk/tradebot/pkg/indicator"
+	"github.com/lynbklk/tradebot/pkg/model"
+)
 
 type Strategy interface {
-	AddIndicator(pair string, timeframe string)
-	Update(indicator *indicator.Indicator)
-	Run()
+	// Timeframe is the time interval in which the strategy will be executed. eg: 1h, 1d, 1w
+	Timeframe() string
+	// WarmupPeriod is the necessary time to wait before executing the strategy, to load data for indicators.
+	// This time is measured in the period specified in the `Timeframe` function.
+	WarmupPeriod() int
+	// Indicators will be executed for each new candle, in order to fill indicators before `OnCandle` function is called.
+	Indicators(df *model.Dataframe)
+	// OnStart is executed once for each pair, before the first candle is received.
+	// Returning an error aborts the runtime.
+	OnStart(pair string, trader exchange.Trader) error
+	// OnCandle will be executed for each new candle, after indicators are filled, here you can do your trading logic.
+	// OnCandle is executed after the candle close.
+	OnCandle(df *model.Dataframe, trader exchange.Trader)
+	// OnOrder will be executed for each order update of the pairs handled by the strategy.
+	OnOrder(order model.Order)
+	// OnStop is executed once for each pair, after the data feed finishes.
+	OnStop(pair string, trader exchange.Trader)
 }
+
+// MultiTimeframeStrategy reads other timeframes of the pair besides `Timeframe`.
+// On each candle of `Timeframe`, df.Timeframes holds a dataframe for each one of the
+// extra timeframes, with only the candles closed until the close of the current candle.
+// In backtests a candle closed together with the current one is seen on the next candle.
+type MultiTimeframeStrategy interface {
+	Strategy
+	// Timeframes are the extra timeframes read by the strategy. eg: 4h, 1d
+	Timeframes() []string
+}
+
+// IndicatorStrategy declares the indicators it reads from the dataframe metadata. They are
+// computed once per pair and timeframe for all strategies, before `Indicators` is called.
+type IndicatorStrategy interface {
+	Strategy
+	// IndicatorSpecs returns the indicators of the given timeframe, it is called for
+	// `Timeframe` and for each one of the extra timeframes of multi timeframe strategies.
+	IndicatorSpecs(timeframe string) []indicator.Spec
+}
+
+// Base implements the lifecycle hooks as no-ops, strategies can embed it
+// and only implement the hooks they need.
+type Base struct{}
+
+func (Base) OnStart(_ string, _ exchange.Trader) error {
+	return nil
+}
+
+func (Base) OnOrder(_ model.Order) {}
+
+func (Base) OnStop(_ string, _ exchange.Trader) {}
@@ -3,6 +3,9 @@ package util
 import (
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/xhit/go-str2duration/v2"
 )
 
 func PairTimeframeToKey(pair string, timeframe string) string {
@@ -13,3 +16,7 @@ func PairTimeframeFromKey(key string) (pair, timeframe string) {
 	parts := strings.Split(key, "--")
 	return parts[0], parts[1]
 }
+
+func TimeframeDuration(timeframe string) (time.Duration, error) {
+	return str2duration.ParseDuration(timeframe)
+}
@@ -1,26 +0,0 @@
-package strategy
-
-import (
-	"github.com/lynbklk/tradebot/pkg/exchange"
-	"github.com/lynbklk/tradebot/pkg/model"
-)
-
-type Strategy interface {
-	// Timeframe is the time interval in which the strategy will be executed. eg: 1h, 1d, 1w
-	Timeframe() string
-	// WarmupPeriod is the necessary time to wait before executing the strategy, to load data for indicators.
-	// This time is measured in the period specified in the `Timeframe` function.
-	WarmupPeriod() int
-	// Indicators will be executed for each new candle, in order to fill indicators before `OnCandle` function is called.
-	Indicators(df *model.Dataframe)
-	// OnCandle will be executed for each new candle, after indicators are filled, here you can do your trading logic.
-	// OnCandle is executed after the candle close.
-	OnCandle(df *model.Dataframe, trader exchange.Trader)
-}
-
-type HighFrequencyStrategy interface {
-	Strategy
-
-	// OnPartialCandle will be executed for each new partial candle, after indicators are filled.
-	OnPartialCandle(df *model.Dataframe, trader exchange.Trader)
-}
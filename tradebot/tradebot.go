@@ -52,9 +52,8 @@ func NewBot(ctx context.Context, settings model.Settings, exch service.Exchange,
 	}
 
 	for _, pair := range settings.Pairs {
-		asset, quote := exchange.SplitAssetQuote(pair)
-		if asset == "" || quote == "" {
-			return nil, fmt.Errorf("invalid pair: %s", pair)
+		if _, _, err := exchange.SplitAssetQuote(pair); err != nil {
+			return nil, fmt.Errorf("invalid pair: %w", err)
 		}
 	}
 